@@ -0,0 +1,121 @@
+// auth.go
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   调用方身份
+   ========================= */
+
+// API_KEYS 形如 "key1:alice,key2:bob"，请求用 Authorization: Bearer <key> 识别用户，
+// 带了未知密钥返回 401，不带密钥也返回 401（API_ALLOW_ANONYMOUS=true 时按匿名用户处理）。
+// 未配置 API_KEYS 时视为开发模式，直接信任 X-User-ID 请求头。
+var (
+	apiKeys        = map[string]string{}
+	allowAnonymous = false
+)
+
+// ADMIN_USERS 逗号分隔的管理员用户；只在配置了 API_KEYS 时生效，开发模式下身份可以伪造，管理接口一律拒绝
+var adminUsers = map[string]bool{}
+
+const ctxUserKey = "user_id"
+
+// queryTokenRoutes 允许用 ?token= 传密钥的路由
+var queryTokenRoutes = map[string]bool{
+	"/api/ws":              true,
+	"/api/jobs/:id/events": true,
+}
+
+// anonymousRoutes 配置了 API_KEYS 时仍允许不带密钥访问的路由
+var anonymousRoutes = map[string]bool{
+	"/": true,
+}
+
+func initAuth() {
+	for _, pair := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		k, u, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && k != "" && u != "" {
+			apiKeys[k] = u
+		}
+	}
+	for _, u := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			adminUsers[u] = true
+		}
+	}
+	allowAnonymous = parseBoolDefault(os.Getenv("API_ALLOW_ANONYMOUS"), false)
+}
+
+// resolveUser 返回调用方，匿名时为空串；ok=false 表示带了未知的密钥
+func resolveUser(c *gin.Context) (user string, ok bool) {
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if token == "" && queryTokenRoutes[c.FullPath()] {
+		// 浏览器 WebSocket/EventSource 无法设置请求头；其它接口不接受 URL 里的密钥，避免进访问日志和 Referer
+		token = c.Query("token")
+	}
+	if len(apiKeys) > 0 {
+		if token == "" {
+			return "", true
+		}
+		user, ok = apiKeys[token]
+		return user, ok
+	}
+	return strings.TrimSpace(c.GetHeader("X-User-ID")), true
+}
+
+// identify 解析身份写入 context；配置了 API_KEYS 时拒绝未知密钥，并按 API_ALLOW_ANONYMOUS 拒绝匿名调用
+func identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := resolveUser(c)
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "invalid api key"})
+			return
+		}
+		if user == "" && len(apiKeys) > 0 && !allowAnonymous && !anonymousRoutes[c.FullPath()] {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "api key required"})
+			return
+		}
+		c.Set(ctxUserKey, user)
+		c.Next()
+	}
+}
+
+// currentUser 返回当前调用方，匿名时为空串
+func currentUser(c *gin.Context) string {
+	return c.GetString(ctxUserKey)
+}
+
+// requireAdmin 管理接口鉴权：必须配置 API_KEYS 且调用方在 ADMIN_USERS 中（见 isAdmin），否则一律 403
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAdmin(currentUser(c)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"ok": false, "error": "admin only"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// canAccessJob 只有任务所有者和管理员可见；匿名提交的任务（owner 为空）只对匿名调用方可见，
+// 已登录用户看不到别人的匿名任务
+func canAccessJob(c *gin.Context, jm *JobMeta) bool {
+	return jobVisibleTo(currentUser(c), jm)
+}
+
+// jobVisibleTo 供没有请求 context 的调用方（WebSocket 订阅）使用，规则同 canAccessJob
+func jobVisibleTo(user string, jm *JobMeta) bool {
+	return jm.Owner == user || isAdmin(user)
+}
+
+// isAdmin 开发模式下 X-User-ID 由调用方随意填写，不承认任何管理员
+func isAdmin(user string) bool {
+	return len(apiKeys) > 0 && user != "" && adminUsers[user]
+}
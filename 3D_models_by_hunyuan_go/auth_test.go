@@ -0,0 +1,142 @@
+// auth_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryTokenOnlyOnStreamingRoutes(t *testing.T) {
+	oldKeys, oldAnon := apiKeys, allowAnonymous
+	apiKeys, allowAnonymous = map[string]string{"k1": "alice"}, true
+	defer func() { apiKeys, allowAnonymous = oldKeys, oldAnon }()
+
+	r := gin.New()
+	r.Use(identify())
+	h := func(c *gin.Context) { c.String(http.StatusOK, currentUser(c)) }
+	r.GET("/api/ws", h)
+	r.GET("/api/jobs/:id/events", h)
+	r.GET("/api/jobs", h)
+
+	for path, want := range map[string]string{
+		"/api/ws?token=k1":             "alice",
+		"/api/jobs/j1/events?token=k1": "alice",
+		"/api/jobs?token=k1":           "", // 不认 URL 里的密钥，按匿名处理
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if got := w.Body.String(); got != want {
+			t.Errorf("%s: user %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestJobVisibleTo(t *testing.T) {
+	oldAdmins, oldKeys := adminUsers, apiKeys
+	adminUsers = map[string]bool{"root": true}
+	apiKeys = map[string]string{"k1": "root"}
+	defer func() { adminUsers, apiKeys = oldAdmins, oldKeys }()
+
+	cases := []struct {
+		user, owner string
+		want        bool
+	}{
+		{"alice", "alice", true},
+		{"bob", "alice", false},
+		{"", "alice", false},
+		{"alice", "", false}, // 匿名任务对已登录用户不可见
+		{"", "", true},
+		{"root", "alice", true},
+		{"root", "", true},
+	}
+	for _, tc := range cases {
+		if got := jobVisibleTo(tc.user, &JobMeta{Owner: tc.owner}); got != tc.want {
+			t.Errorf("user %q owner %q: got %v, want %v", tc.user, tc.owner, got, tc.want)
+		}
+	}
+
+	// 开发模式下 X-User-ID 可伪造，ADMIN_USERS 不生效
+	apiKeys = map[string]string{}
+	if jobVisibleTo("root", &JobMeta{Owner: "alice"}) {
+		t.Error("dev mode: claimed admin sees other users' jobs")
+	}
+}
+
+func TestIdentifyWithAPIKeys(t *testing.T) {
+	oldKeys, oldAnon := apiKeys, allowAnonymous
+	apiKeys = map[string]string{"k1": "alice"}
+	defer func() { apiKeys, allowAnonymous = oldKeys, oldAnon }()
+
+	r := gin.New()
+	r.Use(identify())
+	h := func(c *gin.Context) { c.String(http.StatusOK, currentUser(c)) }
+	r.GET("/", h)
+	r.GET("/api/jobs", h)
+
+	do := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("X-User-ID", "mallory")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for _, tc := range []struct {
+		path, token string
+		anon        bool
+		status      int
+		user        string
+	}{
+		{"/api/jobs", "k1", false, http.StatusOK, "alice"},
+		{"/api/jobs", "wrong", false, http.StatusUnauthorized, ""},
+		{"/api/jobs", "wrong", true, http.StatusUnauthorized, ""},
+		{"/api/jobs", "", false, http.StatusUnauthorized, ""},
+		{"/api/jobs", "", true, http.StatusOK, ""}, // X-User-ID 被忽略
+		{"/", "", false, http.StatusOK, ""},
+	} {
+		allowAnonymous = tc.anon
+		w := do(tc.path, tc.token)
+		if w.Code != tc.status || (w.Code == http.StatusOK && w.Body.String() != tc.user) {
+			t.Errorf("%s token=%q anon=%v: %d %q, want %d %q", tc.path, tc.token, tc.anon, w.Code, w.Body.String(), tc.status, tc.user)
+		}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	oldKeys, oldAdmins := apiKeys, adminUsers
+	defer func() { apiKeys, adminUsers = oldKeys, oldAdmins }()
+
+	r := gin.New()
+	r.Use(identify())
+	r.GET("/admin", requireAdmin(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	do := func(header, value string) int {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 默认部署：什么都没配置
+	apiKeys, adminUsers = map[string]string{}, map[string]bool{}
+	if code := do("X-User-ID", "root"); code != http.StatusForbidden {
+		t.Errorf("no config: %d, want 403", code)
+	}
+	// 只配了 ADMIN_USERS，X-User-ID 可伪造
+	adminUsers = map[string]bool{"root": true}
+	if code := do("X-User-ID", "root"); code != http.StatusForbidden {
+		t.Errorf("ADMIN_USERS without API_KEYS: %d, want 403", code)
+	}
+	apiKeys = map[string]string{"k-root": "root", "k-alice": "alice"}
+	if code := do("Authorization", "Bearer k-alice"); code != http.StatusForbidden {
+		t.Errorf("non-admin key: %d, want 403", code)
+	}
+	if code := do("Authorization", "Bearer k-root"); code != http.StatusOK {
+		t.Errorf("admin key: %d, want 200", code)
+	}
+}
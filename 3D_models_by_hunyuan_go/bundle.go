@@ -0,0 +1,174 @@
+// bundle.go
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   整包下载
+   ========================= */
+
+// GET /api/jobs/:id/bundle.zip 一次打包 job 的所有模型、预览图和 manifest.json。
+// 边从存储读边写 ZIP，不在内存或磁盘上拼整包；已压缩的格式按 Store 写入以省 CPU。
+
+type bundleEntry struct {
+	Name   string `json:"name"`
+	Index  int    `json:"index"`
+	Kind   string `json:"kind"`
+	Type   string `json:"type,omitempty"`
+	Format string `json:"format,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url,omitempty"`
+
+	key string
+}
+
+type bundleMissing struct {
+	Index int    `json:"index"`
+	Kind  string `json:"kind"`
+	Error string `json:"error"`
+}
+
+type bundleManifest struct {
+	JobID       string          `json:"job_id"`
+	Status      string          `json:"status"`
+	Params      *JobParams      `json:"params,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Files       []bundleEntry   `json:"files"`
+	Missing     []bundleMissing `json:"missing,omitempty"`
+}
+
+// 这些格式本身已压缩，再 Deflate 收益很小
+var storedExts = map[string]bool{
+	".glb": true, ".zip": true, ".usdz": true, ".png": true, ".jpg": true, ".jpeg": true, ".webp": true, ".gif": true,
+}
+
+func handleBundle(c *gin.Context) {
+	jobID := c.Param("id")
+	ctx := c.Request.Context()
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if jm.Status != "DONE" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done"})
+		return
+	}
+
+	m := bundleManifest{JobID: jobID, Status: jm.Status, Params: jm.Params, CreatedAt: jm.CreatedAt, GeneratedAt: time.Now().UTC()}
+
+	// 先把所有条目拉进存储并校验，出错的记入 manifest；此时还没写响应头，全部失败可以正常返回错误
+	add := func(idx int, kind, key, src, typ, name, url string) {
+		info, err := fetchArtifact(ctx, jobID, idx, kind, key, src)
+		if err == nil {
+			var v *verifyResult
+			if v, err = verifyArtifact(ctx, jobID, idx, kind, key, info); err == nil {
+				m.Files = append(m.Files, bundleEntry{
+					Name: name, Index: idx, Kind: kind, Type: typ, Format: v.Format,
+					Size: v.Size, SHA256: v.SHA256, URL: url, key: key,
+				})
+				return
+			}
+		}
+		m.Missing = append(m.Missing, bundleMissing{Index: idx, Kind: kind, Error: err.Error()})
+	}
+	for i, f := range jm.Files {
+		ext := strings.ToLower(f.Type)
+		if ext == "" {
+			ext = "bin"
+		}
+		key := f.Key
+		if key == "" {
+			key = artifactKey(jobID, i, ext)
+		}
+		add(i, KindModel, key, f.sourceURL(), f.Type, path.Base(key), f.Url)
+
+		if src := f.sourcePreviewURL(); src != "" {
+			pkey := f.PreviewKey
+			if pkey == "" {
+				pkey = previewKey(jobID, i, src)
+			}
+			add(i, KindPreview, pkey, src, "", path.Base(pkey), f.PreviewImageUrl)
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if len(m.Files) == 0 {
+		c.JSON(http.StatusGone, gin.H{"ok": false, "error": "no artifacts available", "missing": m.Missing})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+jobID+`.zip"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	if err := writeBundle(c, zw, &m); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("bundle %s: %v\n", jobID, err)
+		}
+		abortConn(c)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		abortConn(c)
+	}
+}
+
+func writeBundle(c *gin.Context, zw *zip.Writer, m *bundleManifest) error {
+	ctx := c.Request.Context()
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: m.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+
+	for _, e := range m.Files {
+		rc, info, err := store.Get(ctx, e.key)
+		if err != nil {
+			return err
+		}
+		method := zip.Deflate
+		if storedExts[strings.ToLower(path.Ext(e.Name))] {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Method: method, Modified: info.ModTime})
+		if err == nil {
+			var n int64
+			n, err = io.Copy(w, rc)
+			if err == nil && n != e.Size {
+				err = errors.New("size changed while bundling " + e.Name)
+			}
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		_ = cacheRepo.Touch(ctx, m.JobID, e.Index, e.Kind)
+	}
+	return nil
+}
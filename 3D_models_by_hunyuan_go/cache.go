@@ -0,0 +1,465 @@
+// cache.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   缓存配额与回收
+   ========================= */
+
+// artifacts 表记录了每个已入库文件的 key、大小和所属 job（经 jobs.owner 关联到用户），
+// 这里补上最近访问时间，定期按 LRU 把总量压回全局配额和每用户配额以内。
+// 只淘汰能重新得到的文件：导出/优化/渲染等派生文件（export:*）按需重新生成；
+// 腾讯云的原始模型和预览图仅在 job 仍处于上游保留期（CACHE_SOURCE_RETENTION）内时淘汰，
+// 再次下载时重新拉取（地址过期则按 refresh 流程处理）。用户上传的原始文件永不淘汰。
+var (
+	cacheRepo            CacheRepo
+	cacheMaxBytes        int64         // 全局配额，0 表示不限
+	userQuotaBytes       int64         // 每用户配额，0 表示不限
+	cacheSourceRetention time.Duration // 上游保留结果的时长，0 表示原始文件不参与淘汰
+	cachePartTTL         = 24 * time.Hour
+	quarantineTTL        = 7 * 24 * time.Hour
+	cacheGCInterval      = 10 * time.Minute
+)
+
+const cacheLowWater = 0.9 // 超额后回收到配额的 90%，避免频繁抖动
+
+type UserUsage struct {
+	Owner     string `json:"owner"`
+	Jobs      int64  `json:"jobs"`
+	Files     int64  `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	Quota     int64  `json:"quota,omitempty"`
+	OverQuota bool   `json:"over_quota,omitempty"`
+}
+
+type JobUsage struct {
+	JobID      string    `json:"job_id"`
+	Owner      string    `json:"owner"`
+	Files      int64     `json:"files"`
+	Bytes      int64     `json:"bytes"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+type CacheRepo interface {
+	// Touch 记录一次访问；一分钟内的重复访问不再写库
+	Touch(ctx context.Context, jobID string, idx int, kind string) error
+	Total(ctx context.Context) (files, bytes int64, err error)
+	ByUser(ctx context.Context) ([]UserUsage, error)
+	ByJob(ctx context.Context, owner string, limit int) ([]JobUsage, error)
+	// UserBytes 单个用户已入库的总字节数
+	UserBytes(ctx context.Context, owner string) (int64, error)
+	// LRU 返回最久未访问的可淘汰条目，owner 非空时只看该用户。派生文件（export:*）都可淘汰；
+	// 原始模型和预览图只有 job 创建于 sourceSince 之后（上游仍可重新拉取）才返回，sourceSince 为零值时不返回
+	LRU(ctx context.Context, owner string, sourceSince time.Time, limit int) ([]Artifact, error)
+	MarkEvicted(ctx context.Context, jobID string, idx int, kind string) error
+}
+
+/* =========================
+   PostgreSQL Repo
+   ========================= */
+
+type pgCacheRepo struct{ db *sql.DB }
+
+func NewPGCacheRepo(db *sql.DB) CacheRepo { return &pgCacheRepo{db: db} }
+
+func (r *pgCacheRepo) Touch(ctx context.Context, jobID string, idx int, kind string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE artifacts SET last_access_at = now()
+		WHERE job_id = $1 AND idx = $2 AND kind = $3
+		  AND (last_access_at IS NULL OR last_access_at < now() - interval '1 minute')
+	`, jobID, idx, kind)
+	return err
+}
+
+func (r *pgCacheRepo) Total(ctx context.Context) (int64, int64, error) {
+	var files, bytes int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(size),0) FROM artifacts WHERE status = 'mirrored'
+	`).Scan(&files, &bytes)
+	return files, bytes, err
+}
+
+func (r *pgCacheRepo) ByUser(ctx context.Context) ([]UserUsage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT COALESCE(j.owner,''), COUNT(DISTINCT a.job_id), COUNT(*), COALESCE(SUM(a.size),0)
+		FROM artifacts a LEFT JOIN jobs j ON j.job_id = a.job_id
+		WHERE a.status = 'mirrored'
+		GROUP BY 1 ORDER BY 4 DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []UserUsage
+	for rows.Next() {
+		var u UserUsage
+		if err := rows.Scan(&u.Owner, &u.Jobs, &u.Files, &u.Bytes); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgCacheRepo) ByJob(ctx context.Context, owner string, limit int) ([]JobUsage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.job_id, COALESCE(j.owner,''), COUNT(*), COALESCE(SUM(a.size),0),
+		       MAX(COALESCE(a.last_access_at, a.updated_at))
+		FROM artifacts a LEFT JOIN jobs j ON j.job_id = a.job_id
+		WHERE a.status = 'mirrored' AND ($1 = '' OR j.owner = $1)
+		GROUP BY a.job_id, j.owner ORDER BY 4 DESC
+		LIMIT $2
+	`, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []JobUsage
+	for rows.Next() {
+		var u JobUsage
+		if err := rows.Scan(&u.JobID, &u.Owner, &u.Files, &u.Bytes, &u.LastAccess); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgCacheRepo) UserBytes(ctx context.Context, owner string) (int64, error) {
+	var n int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(a.size),0)
+		FROM artifacts a JOIN jobs j ON j.job_id = a.job_id
+		WHERE a.status = 'mirrored' AND j.owner = $1
+	`, owner).Scan(&n)
+	return n, err
+}
+
+func (r *pgCacheRepo) LRU(ctx context.Context, owner string, sourceSince time.Time, limit int) ([]Artifact, error) {
+	since := sql.NullTime{Time: sourceSince, Valid: !sourceSince.IsZero()}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.job_id, a.idx, a.kind, a.key, COALESCE(a.size,0)
+		FROM artifacts a LEFT JOIN jobs j ON j.job_id = a.job_id
+		WHERE a.status = 'mirrored' AND ($1 = '' OR j.owner = $1)
+		  AND (a.kind LIKE 'export:%'
+		       OR (a.kind IN ('model','preview') AND a.job_id NOT LIKE 'upload-%'
+		           AND $2::timestamptz IS NOT NULL AND j.created_at > $2))
+		ORDER BY COALESCE(a.last_access_at, a.updated_at) ASC
+		LIMIT $3
+	`, owner, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Artifact
+	for rows.Next() {
+		var a Artifact
+		if err := rows.Scan(&a.JobID, &a.Idx, &a.Kind, &a.Key, &a.Size); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgCacheRepo) MarkEvicted(ctx context.Context, jobID string, idx int, kind string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE artifacts SET status = 'evicted', sha256 = NULL, format = NULL, updated_at = now()
+		WHERE job_id = $1 AND idx = $2 AND kind = $3
+	`, jobID, idx, kind)
+	return err
+}
+
+func createCacheColumns(db *sql.DB) error {
+	_, err := db.Exec(`
+		ALTER TABLE artifacts ADD COLUMN IF NOT EXISTS last_access_at TIMESTAMPTZ;
+		CREATE INDEX IF NOT EXISTS artifacts_lru_idx ON artifacts (status, last_access_at);
+	`)
+	return err
+}
+
+func initCache(db *sql.DB) {
+	cacheMaxBytes = parseBytes(os.Getenv("CACHE_MAX_BYTES"))
+	userQuotaBytes = parseBytes(os.Getenv("USER_STORAGE_QUOTA"))
+	for env, dst := range map[string]*time.Duration{
+		"CACHE_PART_TTL":         &cachePartTTL,
+		"QUARANTINE_TTL":         &quarantineTTL,
+		"CACHE_GC_INTERVAL":      &cacheGCInterval,
+		"CACHE_SOURCE_RETENTION": &cacheSourceRetention,
+	} {
+		if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(env))); err == nil && d > 0 {
+			*dst = d
+		}
+	}
+	if err := createCacheColumns(db); err != nil {
+		log.Fatal("Error creating cache columns:", err)
+	}
+	cacheRepo = NewPGCacheRepo(db)
+	go cacheJanitor()
+}
+
+// parseBytes 支持纯字节数和 K/M/G/T 后缀（1024 进制），如 "50G"、"512MiB"
+func parseBytes(v string) int64 {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	if v == "" {
+		return 0
+	}
+	mult := int64(1)
+	switch v[len(v)-1] {
+	case 'K':
+		mult = 1 << 10
+	case 'M':
+		mult = 1 << 20
+	case 'G':
+		mult = 1 << 30
+	case 'T':
+		mult = 1 << 40
+	}
+	if mult > 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int64(n * float64(mult))
+}
+
+/* =========================
+   回收
+   ========================= */
+
+func cacheJanitor() {
+	t := time.NewTicker(cacheGCInterval)
+	defer t.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		runCacheGC(ctx)
+		cancel()
+		<-t.C
+	}
+}
+
+func runCacheGC(ctx context.Context) {
+	if ls, ok := store.(*LocalStore); ok {
+		cleanStaleFiles(ls.root)
+	}
+	if userQuotaBytes > 0 {
+		users, err := cacheRepo.ByUser(ctx)
+		if err != nil {
+			log.Println("cache gc:", err)
+			return
+		}
+		for _, u := range users {
+			if u.Owner != "" && u.Bytes > userQuotaBytes {
+				evictLRU(ctx, u.Owner, u.Bytes-int64(float64(userQuotaBytes)*cacheLowWater))
+			}
+		}
+	}
+	if cacheMaxBytes > 0 {
+		_, total, err := cacheRepo.Total(ctx)
+		if err != nil {
+			log.Println("cache gc:", err)
+			return
+		}
+		if total > cacheMaxBytes {
+			evictLRU(ctx, "", total-int64(float64(cacheMaxBytes)*cacheLowWater))
+		}
+	}
+}
+
+// evictLRU 按最近访问时间从旧到新删除可淘汰的条目，直到释放 need 字节；返回实际释放的字节数
+func evictLRU(ctx context.Context, owner string, need int64) int64 {
+	var freed int64
+	for freed < need && ctx.Err() == nil {
+		var since time.Time
+		if cacheSourceRetention > 0 {
+			// 留一小时余量，避免刚淘汰就赶上上游清理
+			since = time.Now().Add(-cacheSourceRetention + time.Hour)
+		}
+		evicted := 0
+		list, err := cacheRepo.LRU(ctx, owner, since, 100)
+		if err != nil {
+			log.Println("cache evict:", err)
+			return freed
+		}
+		if len(list) == 0 {
+			return freed
+		}
+		for _, a := range list {
+			if freed >= need {
+				break
+			}
+			if _, busy := fetchProgress(a.Key); busy {
+				continue
+			}
+			if err := store.Delete(ctx, a.Key); err != nil {
+				log.Printf("cache evict %s: %v\n", a.Key, err)
+				continue
+			}
+			if err := cacheRepo.MarkEvicted(ctx, a.JobID, a.Idx, a.Kind); err != nil {
+				log.Printf("cache evict %s: %v\n", a.Key, err)
+				return freed
+			}
+			freed += a.Size
+			evicted++
+			log.Printf("cache evicted %s (%d bytes, owner=%q)\n", a.Key, a.Size, owner)
+		}
+		if evicted == 0 {
+			return freed // 剩下的都在下载中
+		}
+	}
+	return freed
+}
+
+// requireQuota 放在提交和上传接口前：用户超出 USER_STORAGE_QUOTA 时先就地淘汰，
+// 剩下的都不可淘汰（上传的原始文件、上游已不保留的结果）仍超额则拒绝新任务。
+// 排在 idempotent() 之后，重放已完成的提交不受配额影响
+func requireQuota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner := currentUser(c)
+		if userQuotaBytes <= 0 || owner == "" || cacheRepo == nil {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		used, err := cacheRepo.UserBytes(ctx, owner)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		if used > userQuotaBytes {
+			used -= evictLRU(ctx, owner, used-int64(float64(userQuotaBytes)*cacheLowWater))
+		}
+		if used > userQuotaBytes {
+			c.AbortWithStatusJSON(http.StatusInsufficientStorage, gin.H{
+				"ok": false, "error": "storage_quota_exceeded",
+				"message": fmt.Sprintf("storage used %d bytes exceeds quota %d bytes", used, userQuotaBytes),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// tempFileKey 由临时文件的相对路径还原所属 key：<key>.part、<key>.chunks、<key>.chunks.tmp、<key>.tmp-<随机串>
+func tempFileKey(rel string) string {
+	key := filepath.ToSlash(rel)
+	if i := strings.LastIndex(key, ".tmp-"); i >= 0 {
+		key = key[:i]
+	}
+	for _, suf := range []string{".part", ".chunks.tmp", ".chunks"} {
+		key = strings.TrimSuffix(key, suf)
+	}
+	return key
+}
+
+// cleanStaleFiles 清理本地存储中中断的下载残留和过期的隔离文件；.lock 文件由 lockFile 释放时删除，
+// 残留的（进程崩溃）可能正被其它进程持有，保留不动
+func cleanStaleFiles(root string) {
+	now := time.Now()
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		age := now.Sub(fi.ModTime())
+		name := d.Name()
+		rel, _ := filepath.Rel(root, p)
+
+		stale := false
+		switch {
+		case strings.HasPrefix(filepath.ToSlash(rel), "quarantine/"):
+			stale = age > quarantineTTL
+		case strings.HasSuffix(name, ".part"), strings.HasSuffix(name, ".chunks"),
+			strings.HasSuffix(name, ".chunks.tmp"), strings.Contains(name, ".tmp-"):
+			stale = age > cachePartTTL
+		}
+		if !stale {
+			return nil
+		}
+		// 下载进行中的 .part 会持续更新 mtime，这里再按 key 确认一次
+		if _, busy := fetchProgress(tempFileKey(rel)); busy {
+			return nil
+		}
+		if err := os.Remove(p); err == nil {
+			log.Printf("cache gc: removed %s (%s old)\n", rel, age.Truncate(time.Minute))
+		}
+		return nil
+	})
+}
+
+/* =========================
+   HTTP Handlers
+   ========================= */
+
+// GET /api/admin/storage?owner=alice&limit=50 存储用量（按用户、按 job）
+func handleStorageUsage(c *gin.Context) {
+	ctx := c.Request.Context()
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	files, bytes, err := cacheRepo.Total(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	users, err := cacheRepo.ByUser(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	for i := range users {
+		if userQuotaBytes > 0 && users[i].Owner != "" {
+			users[i].Quota = userQuotaBytes
+			users[i].OverQuota = users[i].Bytes > userQuotaBytes
+		}
+	}
+	jobs, err := cacheRepo.ByJob(ctx, c.Query("owner"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":         true,
+		"files":      files,
+		"bytes":      bytes,
+		"quota":      cacheMaxBytes,
+		"user_quota": userQuotaBytes,
+		"by_user":    users,
+		"by_job":     jobs,
+	})
+}
+
+// POST /api/admin/storage/gc 立即执行一次回收
+func handleStorageGC(c *gin.Context) {
+	runCacheGC(c.Request.Context())
+	files, bytes, err := cacheRepo.Total(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "files": files, "bytes": bytes})
+}
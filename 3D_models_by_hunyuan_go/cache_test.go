@@ -0,0 +1,21 @@
+// cache_test.go
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTempFileKey(t *testing.T) {
+	for rel, want := range map[string]string{
+		"jobs/j1/0.glb.part":           "jobs/j1/0.glb",
+		"jobs/j1/0.glb.chunks":         "jobs/j1/0.glb",
+		"jobs/j1/0.glb.chunks.tmp":     "jobs/j1/0.glb",
+		"jobs/j1/0.glb.tmp-a1b2c3d4e5": "jobs/j1/0.glb",
+		"jobs/j1/0.glb":                "jobs/j1/0.glb",
+	} {
+		if got := tempFileKey(filepath.FromSlash(rel)); got != want {
+			t.Errorf("tempFileKey(%q) = %q, want %q", rel, got, want)
+		}
+	}
+}
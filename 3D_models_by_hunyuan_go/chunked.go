@@ -0,0 +1,260 @@
+// chunked.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   多连接分片下载
+   ========================= */
+
+// 已知大小的大文件按 Range 切成分片并行拉取，每片独立重试。
+// 完成情况记在 <out>.chunks 中，进程重启后只补缺失的分片。
+var (
+	downloadConcurrency = 4
+	downloadChunkSize   = int64(8 << 20) // 8MiB
+)
+
+var errRangeUnsupported = errors.New("upstream does not support range requests")
+
+func initChunked() {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("DOWNLOAD_CONCURRENCY"))); err == nil && n > 0 {
+		downloadConcurrency = n
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("DOWNLOAD_CHUNK_SIZE")), 10, 64); err == nil && n >= 1<<20 {
+		downloadChunkSize = n
+	}
+}
+
+// useChunked 文件至少两片时才值得并行
+func useChunked(total int64) bool {
+	return downloadConcurrency > 1 && total >= 2*downloadChunkSize
+}
+
+// chunkState 分片状态 sidecar
+type chunkState struct {
+	Total     int64  `json:"total"`
+	ChunkSize int64  `json:"chunk_size"`
+	Done      []bool `json:"done"`
+}
+
+func (cs *chunkState) bounds(i int) (int64, int64) {
+	start := int64(i) * cs.ChunkSize
+	end := start + cs.ChunkSize
+	if end > cs.Total {
+		end = cs.Total
+	}
+	return start, end
+}
+
+func (cs *chunkState) doneBytes() int64 {
+	var n int64
+	for i, d := range cs.Done {
+		if d {
+			s, e := cs.bounds(i)
+			n += e - s
+		}
+	}
+	return n
+}
+
+func saveChunkState(path string, cs *chunkState) error {
+	b, err := json.Marshal(cs)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadChunkState 读取可续用的分片状态；没有 sidecar 但有单连接留下的 .part 时，把已连续写入的前缀记为完成
+func loadChunkState(sidecar, part string, total int64) *chunkState {
+	n := int((total + downloadChunkSize - 1) / downloadChunkSize)
+	fresh := &chunkState{Total: total, ChunkSize: downloadChunkSize, Done: make([]bool, n)}
+
+	if b, err := os.ReadFile(sidecar); err == nil {
+		var cs chunkState
+		if json.Unmarshal(b, &cs) == nil && cs.Total == total && cs.ChunkSize > 0 &&
+			len(cs.Done) == int((total+cs.ChunkSize-1)/cs.ChunkSize) {
+			return &cs
+		}
+		// 上游文件变了或参数变了，整体重来
+		_ = os.Remove(part)
+		return fresh
+	}
+
+	if fi, err := os.Stat(part); err == nil {
+		for i := range fresh.Done {
+			if _, e := fresh.bounds(i); e <= fi.Size() {
+				fresh.Done[i] = true
+			}
+		}
+	}
+	return fresh
+}
+
+// downloadChunked 并行下载到 out；上游不支持 Range 时返回 errRangeUnsupported
+func downloadChunked(url, out string, total int64, st *fetchState) error {
+	const (
+		maxRetries   = 5
+		backoffStart = 400 * time.Millisecond
+	)
+	tmp := out + ".part"
+	sidecar := out + ".chunks"
+
+	cs := loadChunkState(sidecar, tmp, total)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(total); err != nil {
+		return err
+	}
+	if err := saveChunkState(sidecar, cs); err != nil {
+		return err
+	}
+	st.reset(total)
+	st.add(cs.doneBytes())
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	jobs := make(chan int)
+	for w := 0; w < downloadConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start, end := cs.bounds(i)
+				var err error
+				backoff := backoffStart
+				for attempt := 0; attempt < maxRetries; attempt++ {
+					err = fetchChunk(ctx, url, f, start, end, st)
+					var bad *badStatusError
+					if err == nil || errors.As(err, &bad) || errors.Is(err, errRangeUnsupported) || ctx.Err() != nil {
+						break
+					}
+					time.Sleep(backoff)
+					backoff *= 2
+				}
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				cs.Done[i] = true
+				serr := saveChunkState(sidecar, cs)
+				mu.Unlock()
+				if serr != nil {
+					fail(serr)
+				}
+			}
+		}()
+	}
+	for i, d := range cs.Done {
+		if d {
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// 校验：所有分片完成且大小与预期一致
+	for i, d := range cs.Done {
+		if !d {
+			return fmt.Errorf("chunk %d missing", i)
+		}
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != total {
+		return fmt.Errorf("size mismatch: got=%d, want=%d", fi.Size(), total)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return err
+	}
+	_ = os.Remove(sidecar)
+	return nil
+}
+
+// fetchChunk 拉取 [start, end) 写入文件对应位置，读到的字节数必须与分片长度一致
+func fetchChunk(ctx context.Context, url string, f *os.File, start, end int64, st *fetchState) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	// 与单连接下载一致，使用短连接
+	req.Header.Set("Connection", "close")
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &badStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return errRangeUnsupported
+	}
+	if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-%d/", start, end-1)) {
+		return fmt.Errorf("unexpected Content-Range %q for bytes %d-%d", cr, start, end-1)
+	}
+
+	w := io.NewOffsetWriter(f, start)
+	n, err := io.Copy(w, io.LimitReader(&progressReader{r: resp.Body, st: st}, end-start))
+	if err == nil && n != end-start {
+		err = fmt.Errorf("short chunk: got=%d, want=%d", n, end-start)
+	}
+	if err != nil {
+		st.add(-n) // 该片会整体重下
+	}
+	return err
+}
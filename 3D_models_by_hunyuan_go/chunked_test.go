@@ -0,0 +1,112 @@
+// chunked_test.go
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testChunkedSettings(t *testing.T, chunk int64) {
+	t.Helper()
+	oldSize, oldConc := downloadChunkSize, downloadConcurrency
+	downloadChunkSize, downloadConcurrency = chunk, 2
+	t.Cleanup(func() { downloadChunkSize, downloadConcurrency = oldSize, oldConc })
+}
+
+func TestDownloadChunkedResume(t *testing.T) {
+	testChunkedSettings(t, 1024)
+	data := bytes.Repeat([]byte("0123456789abcdef"), 320) // 5120 字节，5 片
+	total := int64(len(data))
+
+	var (
+		mu     sync.Mutex
+		ranges []string
+		broken = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rg := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rg)
+		fail := broken && strings.HasPrefix(rg, "bytes=2048-")
+		mu.Unlock()
+		if fail {
+			http.Error(w, "boom", http.StatusForbidden) // 4xx 不重试，直接失败
+			return
+		}
+		http.ServeContent(w, r, "m.glb", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "m.glb")
+	if err := downloadChunked(srv.URL, out, total, &fetchState{}); err == nil {
+		t.Fatal("first attempt should fail on chunk 2")
+	}
+	if _, err := os.Stat(out + ".chunks"); err != nil {
+		t.Fatalf("sidecar missing after failure: %v", err)
+	}
+
+	mu.Lock()
+	broken, ranges = false, nil
+	mu.Unlock()
+	done := loadChunkState(out+".chunks", out+".part", total)
+	var want int
+	for _, d := range done.Done {
+		if !d {
+			want++
+		}
+	}
+	if want == 0 || want == len(done.Done) {
+		t.Fatalf("unexpected resume state %v", done.Done)
+	}
+
+	if err := downloadChunked(srv.URL, out, total, &fetchState{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != want {
+		t.Errorf("resume fetched %d chunks (%v), want only the %d missing", len(ranges), ranges, want)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	for _, p := range []string{out + ".part", out + ".chunks"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s not cleaned up", p)
+		}
+	}
+}
+
+func TestLoadChunkState(t *testing.T) {
+	testChunkedSettings(t, 1024)
+	dir := t.TempDir()
+	part, sidecar := filepath.Join(dir, "m.part"), filepath.Join(dir, "m.chunks")
+
+	// 单连接留下的 2.5 片前缀：前两片可续用
+	if err := os.WriteFile(part, make([]byte, 2560), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cs := loadChunkState(sidecar, part, 5000)
+	if want := []bool{true, true, false, false, false}; !slices.Equal(cs.Done, want) {
+		t.Errorf("from .part: %v, want %v", cs.Done, want)
+	}
+
+	// sidecar 与上游大小不符：丢弃 .part 重来
+	if err := saveChunkState(sidecar, &chunkState{Total: 4000, ChunkSize: 1024, Done: []bool{true, true, true, true}}); err != nil {
+		t.Fatal(err)
+	}
+	cs = loadChunkState(sidecar, part, 5000)
+	if cs.doneBytes() != 0 {
+		t.Errorf("stale sidecar reused: %v", cs.Done)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Error("stale .part kept")
+	}
+}
@@ -0,0 +1,481 @@
+// events.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   Job 事件总线（SSE 推送）
+   ========================= */
+
+// 每个 job 只有一个上游轮询协程，结果扇出给所有订阅者；
+// 其它模块（如产物镜像）也通过 hub.Publish 推送进度
+var (
+	jobPollInterval = 3 * time.Second
+	sseHeartbeat    = 15 * time.Second
+	watchLinger     = 10 * time.Minute // 无订阅者后保留事件历史的时长
+	hub             = newJobHub()
+)
+
+const (
+	EventStatus = "status" // 状态变化 WAIT/RUN/DONE/FAIL
+	EventQueue  = "queue"  // 本地排队位置
+	EventMirror = "mirror" // 产物镜像进度
+	EventFiles  = "files"  // 最终文件列表
+	EventEnd    = "end"    // 终态，流结束
+
+	watchHistory = 128
+	subBuffer    = 64
+	maxPollFails = 20 // 后台跟踪连续失败后放弃，等下次有人订阅再恢复
+)
+
+type JobEvent struct {
+	ID    int64     `json:"id"`
+	JobID string    `json:"job_id"`
+	Type  string    `json:"type"`
+	Data  any       `json:"data"`
+	At    time.Time `json:"at"`
+}
+
+type jobWatch struct {
+	mu       sync.Mutex
+	jobID    string
+	seq      int64
+	history  []JobEvent
+	subs     map[chan JobEvent]struct{}
+	status   string
+	errStr   string
+	queue    int
+	files    []ResultFile
+	terminal bool
+	finished bool // files/end 已发出（DONE 时可能要等镜像完成）
+	polling  bool
+	tracked  bool // 无订阅者也持续轮询直到终态（webhook、镜像等后台任务依赖）
+	idleAt   time.Time
+}
+
+type JobHub struct {
+	mu      sync.Mutex
+	watches map[string]*jobWatch
+	owners  map[string]map[*ownerSub]struct{}
+	onDone  []func(jobID string, res *QueryProResult)
+	// prepare 在 DONE 后、发出 files/end 之前执行（如镜像产物），返回最终文件列表
+	prepare func(jobID string, res *QueryProResult) []ResultFile
+}
+
+// 按用户监听新提交的 job（WebSocket 的"我的全部任务"）
+type ownerSub struct{ fn func(jobID string) }
+
+func newJobHub() *JobHub {
+	h := &JobHub{watches: map[string]*jobWatch{}, owners: map[string]map[*ownerSub]struct{}{}}
+	go h.reap()
+	return h
+}
+
+func initJobEvents() {
+	if v := strings.TrimSpace(os.Getenv("JOB_POLL_INTERVAL")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= time.Second {
+			jobPollInterval = d
+		}
+	}
+}
+
+func (h *JobHub) watch(jobID string) *jobWatch {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.watches[jobID]
+	if !ok {
+		w = &jobWatch{jobID: jobID, subs: map[chan JobEvent]struct{}{}, queue: -1, idleAt: time.Now()}
+		h.watches[jobID] = w
+	}
+	return w
+}
+
+// 定期回收无订阅者且闲置超时的 watch
+func (h *JobHub) reap() {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for range t.C {
+		h.mu.Lock()
+		for id, w := range h.watches {
+			w.mu.Lock()
+			idle := len(w.subs) == 0 && !w.polling && time.Since(w.idleAt) > watchLinger
+			w.mu.Unlock()
+			if idle {
+				delete(h.watches, id)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Subscribe 返回 lastID 之后需要补发的事件和实时事件通道。
+// lastID 已不在历史中时，补发一条当前状态快照。
+func (h *JobHub) Subscribe(jobID string, lastID int64) ([]JobEvent, <-chan JobEvent, func()) {
+	w := h.watch(jobID)
+	ch := make(chan JobEvent, subBuffer)
+
+	w.mu.Lock()
+	var replay []JobEvent
+	switch {
+	case lastID > w.seq && w.status != "":
+		// 来自已回收的旧 watch，序号不连续
+		replay = append(replay, w.snapshot(lastID)...)
+	case lastID <= 0:
+		replay = append(replay, w.history...)
+	case len(w.history) > 0 && lastID >= w.history[0].ID-1:
+		for _, ev := range w.history {
+			if ev.ID > lastID {
+				replay = append(replay, ev)
+			}
+		}
+	case w.status != "":
+		replay = append(replay, w.snapshot(lastID)...)
+	}
+	w.subs[ch] = struct{}{}
+	startPoll := !w.polling && !w.terminal
+	if startPoll {
+		w.polling = true
+	}
+	w.mu.Unlock()
+
+	if startPoll {
+		go h.poll(w)
+	}
+
+	cancel := func() {
+		w.mu.Lock()
+		if _, ok := w.subs[ch]; ok {
+			delete(w.subs, ch)
+			close(ch)
+		}
+		if len(w.subs) == 0 {
+			w.idleAt = time.Now()
+		}
+		w.mu.Unlock()
+	}
+	return replay, ch, cancel
+}
+
+// snapshot 用当前状态合成续传事件，每个事件占用一个新序号（不进 history、不广播），
+// 续传的客户端能凭 Last-Event-ID 区分它们；序号先推到 after 之后，保证比客户端已见过的大。需持有 w.mu
+func (w *jobWatch) snapshot(after int64) []JobEvent {
+	now := time.Now()
+	w.seq = max(w.seq, after)
+	ev := func(typ string, data any) JobEvent {
+		w.seq++
+		return JobEvent{ID: w.seq, JobID: w.jobID, Type: typ, Data: data, At: now}
+	}
+	evs := []JobEvent{ev(EventStatus, gin.H{"status": w.status, "error": w.errStr})}
+	if w.finished {
+		evs = append(evs, ev(EventFiles, w.files), ev(EventEnd, gin.H{"status": w.status}))
+	}
+	return evs
+}
+
+// 需持有 w.mu
+func (w *jobWatch) emit(typ string, data any) {
+	w.seq++
+	ev := JobEvent{ID: w.seq, JobID: w.jobID, Type: typ, Data: data, At: time.Now()}
+	w.history = append(w.history, ev)
+	if len(w.history) > watchHistory {
+		w.history = w.history[len(w.history)-watchHistory:]
+	}
+	for ch := range w.subs {
+		select {
+		case ch <- ev:
+		default:
+			// 慢消费者直接断开，客户端可凭 Last-Event-ID 续传
+			delete(w.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// WatchOwner 在该用户每次提交新 job 时回调 fn（异步调用，可能并发）
+func (h *JobHub) WatchOwner(owner string, fn func(jobID string)) func() {
+	sub := &ownerSub{fn: fn}
+	h.mu.Lock()
+	if h.owners[owner] == nil {
+		h.owners[owner] = map[*ownerSub]struct{}{}
+	}
+	h.owners[owner][sub] = struct{}{}
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		delete(h.owners[owner], sub)
+		if len(h.owners[owner]) == 0 {
+			delete(h.owners, owner)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// OnTerminal 注册 job 结束（files/end 已发出）后的回调（每个进程内每个 job 触发一次，回调需自行幂等）
+func (h *JobHub) OnTerminal(fn func(jobID string, res *QueryProResult)) {
+	h.mu.Lock()
+	h.onDone = append(h.onDone, fn)
+	h.mu.Unlock()
+}
+
+// Track 在后台轮询该 job 直到终态，不依赖订阅者
+func (h *JobHub) Track(jobID string) {
+	w := h.watch(jobID)
+	w.mu.Lock()
+	w.tracked = true
+	start := !w.polling && !w.terminal
+	if start {
+		w.polling = true
+	}
+	w.mu.Unlock()
+	if start {
+		go h.poll(w)
+	}
+}
+
+// TrackActive 启动时恢复对未结束 job 的后台轮询
+func (h *JobHub) TrackActive() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	jobs, err := repo.List(ctx, JobFilter{AllOwners: true, Statuses: []string{"WAIT", "RUN"}, Limit: 500})
+	if err != nil {
+		log.Println("track active jobs:", err)
+		return
+	}
+	for _, jm := range jobs {
+		h.Track(jm.JobID)
+	}
+}
+
+// NotifyCreated 由提交接口调用：开始后台跟踪，并通知该用户的 WebSocket 订阅。
+// 回调（查库、订阅）放到 goroutine 里执行，不拖慢提交请求
+func (h *JobHub) NotifyCreated(owner, jobID string) {
+	h.Track(jobID)
+	if owner == "" {
+		return
+	}
+	h.mu.Lock()
+	subs := make([]*ownerSub, 0, len(h.owners[owner]))
+	for sub := range h.owners[owner] {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+	for _, sub := range subs {
+		go sub.fn(jobID)
+	}
+}
+
+// Publish 向某个 job 的所有订阅者推送自定义事件
+func (h *JobHub) Publish(jobID, typ string, data any) {
+	w := h.watch(jobID)
+	w.mu.Lock()
+	w.emit(typ, data)
+	w.mu.Unlock()
+}
+
+// Observe 合并一次上游查询结果，仅在变化时产生事件
+func (h *JobHub) Observe(jobID string, res *QueryProResult) {
+	var errStr string
+	if res.Status == "FAIL" {
+		errStr = strings.TrimSpace(res.ErrorCode + " " + res.ErrorMessage)
+	}
+
+	queue := -1
+	if res.Status == "WAIT" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if n, err := repo.QueuePosition(ctx, jobID); err == nil {
+			queue = n
+		}
+		cancel()
+	}
+
+	w := h.watch(jobID)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.terminal {
+		return
+	}
+	if res.Status != w.status {
+		w.status, w.errStr = res.Status, errStr
+		w.emit(EventStatus, gin.H{"status": res.Status, "error": errStr})
+	}
+	if queue != w.queue {
+		w.queue = queue
+		if queue >= 0 {
+			w.emit(EventQueue, gin.H{"position": queue})
+		}
+	}
+	if !isTerminal(res.Status) {
+		return
+	}
+	w.terminal = true
+	h.mu.Lock()
+	prepare := h.prepare
+	h.mu.Unlock()
+	if res.Status == "DONE" && prepare != nil {
+		go func() { h.finish(jobID, res, prepare(jobID, res)) }()
+		return
+	}
+	go h.finish(jobID, res, res.Files)
+}
+
+// finish 发出最终文件列表与结束事件，并触发终态回调
+func (h *JobHub) finish(jobID string, res *QueryProResult, files []ResultFile) {
+	w := h.watch(jobID)
+	w.mu.Lock()
+	if w.finished {
+		w.mu.Unlock()
+		return
+	}
+	w.finished = true
+	w.files = files
+	w.emit(EventFiles, files)
+	w.emit(EventEnd, gin.H{"status": res.Status})
+	w.mu.Unlock()
+
+	h.mu.Lock()
+	hooks := append([]func(string, *QueryProResult){}, h.onDone...)
+	h.mu.Unlock()
+	for _, fn := range hooks {
+		go fn(jobID, res)
+	}
+}
+
+// SetPrepare 注册 DONE 后的准备步骤（只能有一个）
+func (h *JobHub) SetPrepare(fn func(jobID string, res *QueryProResult) []ResultFile) {
+	h.mu.Lock()
+	h.prepare = fn
+	h.mu.Unlock()
+}
+
+// 单个 job 的上游轮询；无订阅者或进入终态后退出
+func (h *JobHub) poll(w *jobWatch) {
+	defer func() {
+		w.mu.Lock()
+		w.polling = false
+		w.idleAt = time.Now()
+		w.mu.Unlock()
+	}()
+
+	// 先用数据库中的终态短路，避免对已完成的 job 再打上游
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	jm, err := repo.Get(ctx, w.jobID)
+	cancel()
+	if err == nil && jm != nil && (jm.Status == "DONE" || jm.Status == "FAIL") {
+		h.Observe(w.jobID, &QueryProResult{Status: jm.Status, ErrorMessage: jm.Error, Files: jm.Files})
+		return
+	}
+
+	t := time.NewTicker(jobPollInterval)
+	defer t.Stop()
+	fails := 0
+	for {
+		res, err := queryHunyuan(w.jobID)
+		if err != nil {
+			log.Printf("poll %s: %v\n", w.jobID, err)
+			fails++
+		} else {
+			fails = 0
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			recordQueryResult(ctx, w.jobID, res)
+			cancel()
+			h.Observe(w.jobID, res)
+		}
+
+		w.mu.Lock()
+		done := w.terminal || (len(w.subs) == 0 && (!w.tracked || fails >= maxPollFails))
+		w.mu.Unlock()
+		if done {
+			return
+		}
+		<-t.C
+	}
+}
+
+/* =========================
+   HTTP Handler
+   ========================= */
+
+func writeSSE(c *gin.Context, ev JobEvent) error {
+	b, err := json.Marshal(ev.Data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, b); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// GET /api/jobs/:id/events
+// 支持 Last-Event-ID 请求头（或 ?last_event_id=）断线续传；收到 end 事件后服务端关闭连接
+func handleJobEvents(c *gin.Context) {
+	jobID := c.Param("id")
+	jm, err := repo.Get(c.Request.Context(), jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+
+	lastRaw := c.GetHeader("Last-Event-ID")
+	if lastRaw == "" {
+		lastRaw = c.Query("last_event_id")
+	}
+	lastID, _ := strconv.ParseInt(strings.TrimSpace(lastRaw), 10, 64)
+
+	replay, ch, cancel := hub.Subscribe(jobID, lastID)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", 3000)
+	c.Writer.Flush()
+
+	for _, ev := range replay {
+		if writeSSE(c, ev) != nil || ev.Type == EventEnd {
+			return
+		}
+	}
+
+	hb := time.NewTicker(sseHeartbeat)
+	defer hb.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-hb.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case ev, ok := <-ch:
+			if !ok {
+				// 被判定为慢消费者，断开让客户端续传
+				return
+			}
+			if writeSSE(c, ev) != nil || ev.Type == EventEnd {
+				return
+			}
+		}
+	}
+}
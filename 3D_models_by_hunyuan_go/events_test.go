@@ -0,0 +1,42 @@
+// events_test.go
+package main
+
+import "testing"
+
+func TestSubscribeSnapshotIDs(t *testing.T) {
+	h := newJobHub()
+	w := h.watch("j1")
+	w.mu.Lock()
+	w.status, w.terminal, w.finished = "DONE", true, true
+	w.files = []ResultFile{{Type: "GLB"}}
+	w.seq = 5 // 重建后的 watch，没有历史
+	w.mu.Unlock()
+
+	for _, lastID := range []int64{10, 2} {
+		replay, _, cancel := h.Subscribe("j1", lastID)
+		cancel()
+		if len(replay) != 3 {
+			t.Fatalf("lastID=%d: %d events, want status/files/end", lastID, len(replay))
+		}
+		prev := lastID
+		for _, ev := range replay {
+			if ev.ID <= prev {
+				t.Errorf("lastID=%d: %s has id %d after %d", lastID, ev.Type, ev.ID, prev)
+			}
+			prev = ev.ID
+		}
+		if replay[2].Type != EventEnd {
+			t.Errorf("last event %s, want end", replay[2].Type)
+		}
+	}
+
+	// 之后的事件序号继续递增
+	w.mu.Lock()
+	seq := w.seq
+	w.emit(EventStatus, nil)
+	got := w.history[len(w.history)-1].ID
+	w.mu.Unlock()
+	if got != seq+1 {
+		t.Errorf("next event id %d, want %d", got, seq+1)
+	}
+}
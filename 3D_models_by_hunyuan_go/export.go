@@ -0,0 +1,334 @@
+// export.go
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+/* =========================
+   格式转换导出
+   ========================= */
+
+// GET /api/jobs/:id/export?format=stl|obj|ply|usdz|gltf|glb|fbx[&index=N]
+//     [&height=|size=][&unit=mm|cm|m|in][&center=1][&ground=1][&up=y|z][&faces=N][&lods=N1,N2]
+//     [&optimize=1[&max_texture=N][&jpeg_quality=N][&quantize=0][&texture_format=webp|ktx2][&meshopt=1]]
+// 解析 job 的 GLB（或 OBJ）产物，转换后写入 artifact 存储（exports/ 前缀），之后的请求直接命中缓存。
+// 缓存行记在 artifacts 表，kind 为 export:<variant>，和模型文件一样参与 LRU 淘汰和配额统计。
+
+const (
+	KindExport = "export"
+
+	// 导出器输出有变化时递增，使旧缓存失效（v3：导出文件带来源信息）
+	exportVersion = "v3"
+
+	exportCreator = "hunyuan3d-gin"
+)
+
+var (
+	exportGroup singleflight.Group
+	// 限制同时进行的网格解析/转换，避免大模型把 CPU 和内存占满
+	exportSem = make(chan struct{}, 2)
+
+	ErrUnsupportedSource = errors.New("source artifact cannot be converted")
+)
+
+type exportFormat struct {
+	ext        string // 存储 key 与下载文件名的扩展名
+	metersOnly bool   // 格式规定以米为单位、Y 轴向上（glTF）
+	write      func(w io.Writer, s *Scene, name string) error
+}
+
+var exportFormats = map[string]exportFormat{
+	"stl": {"stl", false, func(w io.Writer, s *Scene, name string) error {
+		return WriteSTL(w, s, exportCreator+" "+name)
+	}},
+	"obj": {"obj.zip", false, func(w io.Writer, s *Scene, name string) error {
+		return WriteOBJZip(w, s, name, exportCreator)
+	}},
+	"ply": {"ply", false, func(w io.Writer, s *Scene, name string) error {
+		return WritePLY(w, s, exportCreator+" "+name)
+	}},
+	"gltf": {"gltf", true, func(w io.Writer, s *Scene, name string) error {
+		return WriteGLTFEmbedded(w, s)
+	}},
+	"glb": {"glb", true, func(w io.Writer, s *Scene, name string) error {
+		return WriteGLB(w, s)
+	}},
+	"usdz": {"usdz", false, func(w io.Writer, s *Scene, name string) error {
+		return WriteUSDZ(w, s, exportCreator+" "+name)
+	}},
+	"fbx": {"fbx", false, func(w io.Writer, s *Scene, name string) error {
+		return WriteFBX(w, s, exportCreator)
+	}},
+}
+
+func initExport() {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("EXPORT_CONCURRENCY"))); err == nil && n > 0 {
+		exportSem = make(chan struct{}, n)
+	}
+}
+
+// exportKey 转换结果在存储中的 key
+func exportKey(jobID string, idx int, variant, ext string) string {
+	return fmt.Sprintf("exports/%s_%d_%s_%s-%s.%s", jobID, idx, variant, exportVersion, provenanceVariant(), ext)
+}
+
+// modelSourceIndex 选择转换源：显式 index，否则优先取 GLB/GLTF，其次 OBJ，最后 STL（用户上传）
+func modelSourceIndex(jm *JobMeta, q string) (int, error) {
+	if q != "" {
+		idx, err := strconv.Atoi(q)
+		if err != nil || idx < 0 || idx >= len(jm.Files) {
+			return 0, errors.New("index out of range")
+		}
+		return idx, nil
+	}
+	for _, want := range [][]string{{"glb", "gltf"}, {"obj", "zip"}, {"stl", "stl"}} {
+		for i, f := range jm.Files {
+			if t := strings.ToLower(f.Type); t == want[0] || t == want[1] {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.New("job has no GLB/OBJ/STL artifact to convert")
+}
+
+// modelArtifact 确保 job 的第 idx 个模型已入库并通过校验，返回 key 与摘要
+func modelArtifact(ctx context.Context, jobID string, idx int, f ResultFile) (string, *verifyResult, error) {
+	ext := strings.ToLower(f.Type)
+	if ext == "" {
+		ext = "bin"
+	}
+	key := f.Key
+	if key == "" {
+		key = artifactKey(jobID, idx, ext)
+	}
+	info, err := fetchArtifact(ctx, jobID, idx, KindModel, key, f.sourceURL())
+	if err != nil {
+		return "", nil, err
+	}
+	v, err := verifyArtifact(ctx, jobID, idx, KindModel, key, info)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, v, nil
+}
+
+// loadScene 拉取（必要时）并解析 job 的第 idx 个模型
+func loadScene(ctx context.Context, jobID string, idx int, f ResultFile) (*Scene, error) {
+	key, v, err := modelArtifact(ctx, jobID, idx, f)
+	if err != nil {
+		return nil, err
+	}
+	switch v.Format {
+	case "glb", "gltf", "obj", "zip", "stl":
+	default:
+		return nil, fmt.Errorf("%w: format %s", ErrUnsupportedSource, v.Format)
+	}
+
+	rc, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseModel(data, v.Format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedSource, err)
+	}
+	return s, nil
+}
+
+func handleExport(c *gin.Context) {
+	jobID := c.Param("id")
+	ctx := c.Request.Context()
+
+	format := strings.ToLower(c.Query("format"))
+	ef, ok := exportFormats[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "unsupported format, want one of stl|obj|ply|usdz|gltf|glb|fbx"})
+		return
+	}
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if jm.Status != "DONE" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done"})
+		return
+	}
+	idx, err := modelSourceIndex(jm, c.Query("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	unit := "m"
+	if format == "stl" {
+		unit = stlUnit
+	}
+	tf, err := parseExportTransform(c.Request.URL.Query(), unit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if tf.ZUp && ef.metersOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "glTF is always Y-up, up=z is not supported for " + format})
+		return
+	}
+	so, err := parseSimplifyOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if len(so.LODs) > 0 && !ef.metersOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "lods is only supported for glb and gltf"})
+		return
+	}
+	opt, err := parseOptimizeOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	// OPTIMIZE_TEXTURE_FORMAT/OPTIMIZE_MESHOPT 只是 GLB 的默认值，其他格式和 LOD 导出忽略；显式要求时报错
+	if opt.external() && (format != "glb" || len(so.LODs) > 0) {
+		if c.Query("texture_format") == "" && c.Query("meshopt") == "" {
+			opt.TextureFormat, opt.Meshopt = "", false
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "texture_format and meshopt are only supported for glb without lods"})
+			return
+		}
+	}
+
+	variant := format
+	for _, v := range []string{tf.Variant(), so.Variant(), opt.Variant()} {
+		if v != "" {
+			variant += "-" + v
+		}
+	}
+	key := exportKey(jobID, idx, variant, ef.ext)
+	kind := KindExport + ":" + variant
+	if _, err := store.Stat(ctx, key); err != nil {
+		if err := buildExport(ctx, jm, idx, kind, key, func(w io.Writer, s *Scene) error {
+			// 先做刚体变换和缩放再简化，各级 LOD 共用同一坐标系
+			tf.Apply(s, ef.metersOnly)
+			s = so.Apply(s)
+			var hook gltfMeshHook
+			if opt != nil {
+				OptimizeTextures(s, opt)
+				if opt.Quantize && ef.metersOnly {
+					hook = quantizeHook(s)
+				}
+			}
+			switch {
+			case len(so.LODs) > 0:
+				return so.writeLODs(w, s, format == "glb", hook)
+			case hook != nil || opt.external():
+				return writeOptimizedGLTF(w, s, opt, format == "glb")
+			}
+			return ef.write(w, s, jobID+"_"+strconv.Itoa(idx))
+		}); err != nil {
+			exportError(c, err)
+			return
+		}
+	}
+	serveArtifact(c, jm, idx, kind, key, jobID+"_"+strconv.Itoa(idx)+"."+ef.ext)
+}
+
+// exportError 把转换链路上的错误映射为 HTTP 状态
+func exportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrArtifactExpired):
+		c.JSON(http.StatusGone, gin.H{"ok": false, "error": "artifact_expired", "message": err.Error()})
+	case errors.Is(err, ErrCorruptArtifact):
+		c.JSON(http.StatusBadGateway, gin.H{"ok": false, "error": "artifact_corrupt", "message": err.Error()})
+	case errors.Is(err, ErrUnsupportedSource):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"ok": false, "error": "unsupported_source", "message": err.Error()})
+	case c.Request.Context().Err() != nil:
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "export failed: " + err.Error()})
+	}
+}
+
+// buildExport 解析源模型、调用 write 生成文件并入库；同一 key 并发请求只转换一次
+func buildExport(ctx context.Context, jm *JobMeta, idx int, kind, key string, write func(io.Writer, *Scene) error) error {
+	_, err, _ := exportGroup.Do(key, func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		if _, err := store.Stat(ctx, key); err == nil {
+			return nil, nil
+		}
+		exportSem <- struct{}{}
+		defer func() { <-exportSem }()
+
+		s, err := loadScene(ctx, jm.JobID, idx, jm.Files[idx])
+		if err != nil {
+			return nil, err
+		}
+		s.Provenance = jobProvenance(jm, idx)
+		return nil, putExport(ctx, jm.JobID, idx, kind, key, func(w io.Writer) error { return write(w, s) })
+	})
+	return err
+}
+
+// putExport 先写临时文件并算哈希，自检结构后再入库，并记下摘要供 ETag 使用
+func putExport(ctx context.Context, jobID string, idx int, kind, key string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if err := write(io.MultiWriter(tmp, h)); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	ext := strings.TrimPrefix(path.Ext(key), ".")
+	format, err := validateFormat(tmp, size, ext)
+	if err != nil {
+		return fmt.Errorf("exported %s failed self-check: %v", ext, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := store.Put(ctx, key, tmp, size, contentTypeFor(key)); err != nil {
+		return err
+	}
+	sha := hex.EncodeToString(h.Sum(nil))
+	// 同一 kind 的旧文件（exportVersion 或来源信息设置变化前生成的）不再被引用，顺手删掉，否则 LRU 再也找不到它
+	old, _ := artifactRepo.Get(ctx, jobID, idx, kind)
+	if err := artifactRepo.SetDigest(ctx, jobID, idx, kind, key, size, sha, format); err != nil {
+		log.Printf("export %s: %v\n", key, err)
+	} else if old != nil && old.Key != "" && old.Key != key {
+		if err := store.Delete(ctx, old.Key); err != nil {
+			log.Printf("export %s: delete stale %s: %v\n", key, old.Key, err)
+		}
+	}
+	log.Printf("exported %s (%d bytes)\n", key, size)
+	return nil
+}
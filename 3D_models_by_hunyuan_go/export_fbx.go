@@ -0,0 +1,348 @@
+// export_fbx.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+/* =========================
+   FBX 输出（二进制 7.4）
+   ========================= */
+
+// 每个 Mesh 输出一对 Geometry + Model，材质用 Phong 参数表达底色/自发光，
+// 底色贴图以 Video.Content 内嵌。金属度/粗糙度等 PBR 通道 FBX 没有通用表达，不输出。
+
+type fbxNode struct {
+	name     string
+	props    []any // int16 / bool / int32 / float32 / float64 / int64 / string / []byte / []float64 / []int32
+	children []*fbxNode
+}
+
+func fbxN(name string, props ...any) *fbxNode { return &fbxNode{name: name, props: props} }
+
+func (n *fbxNode) add(children ...*fbxNode) *fbxNode {
+	n.children = append(n.children, children...)
+	return n
+}
+
+// fbxP Properties70 中的一条 P 记录
+func fbxP(props ...any) *fbxNode { return fbxN("P", props...) }
+
+// 与 FileId 配套的固定时间戳，FBX SDK 会校验二者一致
+var (
+	fbxFileID   = []byte{0x28, 0xb3, 0x2a, 0xeb, 0xb6, 0x24, 0xcc, 0xc2, 0xbf, 0xc8, 0xb0, 0x2a, 0xa9, 0x2b, 0xfc, 0xf1}
+	fbxTimeID   = "1970-01-01 10:00:00:000"
+	fbxFootID   = []byte{0xfa, 0xbc, 0xab, 0x09, 0xd0, 0xc8, 0xd4, 0x66, 0xb1, 0x76, 0xfb, 0x83, 0x1c, 0xf7, 0x26, 0x7e}
+	fbxFootTail = []byte{0xf8, 0x5a, 0x8c, 0x6a, 0xde, 0xf5, 0xd9, 0x7e, 0xec, 0xe9, 0x0c, 0xe3, 0x75, 0x8f, 0x29, 0x0b}
+)
+
+const fbxVersion = 7400
+
+func WriteFBX(w io.Writer, s *Scene, creator string) error {
+	var uid int64 = 1000000
+	next := func() int64 { uid++; return uid }
+
+	objects := fbxN("Objects")
+	conns := fbxN("Connections")
+	link := func(kind string, child, parent int64, prop ...any) {
+		conns.add(fbxN("C", append([]any{kind, child, parent}, prop...)...))
+	}
+
+	// 贴图按图片去重，只有底色贴图有意义
+	texOf := map[int]int64{}
+	nTex := 0
+	texture := func(img int) int64 {
+		if id, ok := texOf[img]; ok {
+			return id
+		}
+		name := texName(s, img)
+		vid, tid := next(), next()
+		objects.add(
+			fbxN("Video", vid, name+"\x00\x01Video", "Clip").add(
+				fbxN("Type", "Clip"),
+				fbxN("Properties70").add(fbxP("Path", "KString", "XRefUrl", "", name)),
+				fbxN("UseMipMap", int32(0)),
+				fbxN("Filename", name),
+				fbxN("RelativeFilename", name),
+				fbxN("Content", s.Images[img].Data),
+			),
+			fbxN("Texture", tid, name+"\x00\x01Texture", "").add(
+				fbxN("Type", "TextureVideoClip"),
+				fbxN("Version", int32(202)),
+				fbxN("TextureName", name+"\x00\x01Texture"),
+				fbxN("Media", name+"\x00\x01Video"),
+				fbxN("FileName", name),
+				fbxN("RelativeFilename", name),
+			),
+		)
+		link("OO", vid, tid)
+		texOf[img] = tid
+		nTex++
+		return tid
+	}
+
+	matIDs := make([]int64, len(s.Materials))
+	for i, mat := range s.Materials {
+		id := next()
+		matIDs[i] = id
+		c := mat.BaseColor
+		objects.add(fbxN("Material", id, objName(mat.Name)+"\x00\x01Material", "").add(
+			fbxN("Version", int32(102)),
+			fbxN("ShadingModel", "phong"),
+			fbxN("MultiLayer", int32(0)),
+			fbxN("Properties70").add(
+				fbxP("DiffuseColor", "Color", "", "A", float64(c[0]), float64(c[1]), float64(c[2])),
+				fbxP("DiffuseFactor", "Number", "", "A", 1.0),
+				fbxP("EmissiveColor", "Color", "", "A", float64(mat.Emissive[0]), float64(mat.Emissive[1]), float64(mat.Emissive[2])),
+				fbxP("SpecularFactor", "Number", "", "A", float64(0.5*(1-mat.Roughness))),
+				fbxP("Shininess", "Number", "", "A", float64(2+(1-mat.Roughness)*98)),
+				fbxP("Opacity", "Number", "", "A", float64(c[3])),
+			),
+		))
+		if mat.BaseColorTex >= 0 {
+			link("OP", texture(mat.BaseColorTex), id, "DiffuseColor")
+		}
+	}
+
+	for _, m := range s.Meshes {
+		gid, mid := next(), next()
+		name := objName(m.Name)
+
+		verts := make([]float64, 0, len(m.Positions)*3)
+		for _, p := range m.Positions {
+			verts = append(verts, float64(p[0]), float64(p[1]), float64(p[2]))
+		}
+		// 多边形顶点索引：每个面的最后一个索引按位取反表示结束
+		poly := make([]int32, len(m.Indices))
+		for i, v := range m.Indices {
+			poly[i] = int32(v)
+			if i%3 == 2 {
+				poly[i] = ^int32(v)
+			}
+		}
+		geom := fbxN("Geometry", gid, name+"\x00\x01Geometry", "Mesh").add(
+			fbxN("Properties70"),
+			fbxN("GeometryVersion", int32(124)),
+			fbxN("Vertices", verts),
+			fbxN("PolygonVertexIndex", poly),
+		)
+		layer := fbxN("Layer", int32(0)).add(fbxN("Version", int32(100)))
+		if len(m.Normals) == len(m.Positions) {
+			nrm := make([]float64, 0, len(m.Indices)*3)
+			for _, v := range m.Indices {
+				n := m.Normals[v]
+				nrm = append(nrm, float64(n[0]), float64(n[1]), float64(n[2]))
+			}
+			geom.add(fbxN("LayerElementNormal", int32(0)).add(
+				fbxN("Version", int32(101)),
+				fbxN("Name", ""),
+				fbxN("MappingInformationType", "ByPolygonVertex"),
+				fbxN("ReferenceInformationType", "Direct"),
+				fbxN("Normals", nrm),
+			))
+			layer.add(fbxN("LayerElement").add(fbxN("Type", "LayerElementNormal"), fbxN("TypedIndex", int32(0))))
+		}
+		if len(m.UVs) == len(m.Positions) {
+			uv := make([]float64, 0, len(m.UVs)*2)
+			for _, t := range m.UVs {
+				uv = append(uv, float64(t[0]), float64(1-t[1]))
+			}
+			uvIdx := make([]int32, len(m.Indices))
+			for i, v := range m.Indices {
+				uvIdx[i] = int32(v)
+			}
+			geom.add(fbxN("LayerElementUV", int32(0)).add(
+				fbxN("Version", int32(101)),
+				fbxN("Name", "UVMap"),
+				fbxN("MappingInformationType", "ByPolygonVertex"),
+				fbxN("ReferenceInformationType", "IndexToDirect"),
+				fbxN("UV", uv),
+				fbxN("UVIndex", uvIdx),
+			))
+			layer.add(fbxN("LayerElement").add(fbxN("Type", "LayerElementUV"), fbxN("TypedIndex", int32(0))))
+		}
+		if m.Material >= 0 {
+			geom.add(fbxN("LayerElementMaterial", int32(0)).add(
+				fbxN("Version", int32(101)),
+				fbxN("Name", ""),
+				fbxN("MappingInformationType", "AllSame"),
+				fbxN("ReferenceInformationType", "IndexToDirect"),
+				fbxN("Materials", []int32{0}),
+			))
+			layer.add(fbxN("LayerElement").add(fbxN("Type", "LayerElementMaterial"), fbxN("TypedIndex", int32(0))))
+		}
+		geom.add(layer)
+
+		model := fbxN("Model", mid, name+"\x00\x01Model", "Mesh").add(
+			fbxN("Version", int32(232)),
+			fbxN("Properties70"),
+			fbxN("Shading", true),
+			fbxN("Culling", "CullingOff"),
+		)
+		objects.add(geom, model)
+		link("OO", mid, 0)
+		link("OO", gid, mid)
+		if m.Material >= 0 {
+			link("OO", matIDs[m.Material], mid)
+		}
+	}
+
+	defs := fbxN("Definitions").add(
+		fbxN("Version", int32(100)),
+		fbxN("Count", int32(1+2*len(s.Meshes)+len(s.Materials)+2*nTex)),
+		fbxN("ObjectType", "GlobalSettings").add(fbxN("Count", int32(1))),
+		fbxN("ObjectType", "Model").add(fbxN("Count", int32(len(s.Meshes)))),
+		fbxN("ObjectType", "Geometry").add(fbxN("Count", int32(len(s.Meshes)))),
+		fbxN("ObjectType", "Material").add(fbxN("Count", int32(len(s.Materials)))),
+	)
+	if nTex > 0 {
+		defs.add(
+			fbxN("ObjectType", "Texture").add(fbxN("Count", int32(nTex))),
+			fbxN("ObjectType", "Video").add(fbxN("Count", int32(nTex))),
+		)
+	}
+
+	// glTF 单位为米、Y 轴向上；FBX 以厘米计，UnitScaleFactor=100 表示 1 单位 = 1 米。
+	// Z 轴向上时按 3ds Max 约定：前方为 -Y
+	up, front, frontSign := int32(1), int32(2), int32(1)
+	if s.ZUp {
+		up, front, frontSign = 2, 1, -1
+	}
+	unit := s.unitMeters() * 100
+	root := []*fbxNode{
+		fbxN("FBXHeaderExtension").add(
+			fbxN("FBXHeaderVersion", int32(1003)),
+			fbxN("FBXVersion", int32(fbxVersion)),
+			fbxN("EncryptionType", int32(0)),
+			fbxN("CreationTimeStamp").add(
+				fbxN("Version", int32(1000)), fbxN("Year", int32(1970)), fbxN("Month", int32(1)), fbxN("Day", int32(1)),
+				fbxN("Hour", int32(10)), fbxN("Minute", int32(0)), fbxN("Second", int32(0)), fbxN("Millisecond", int32(0)),
+			),
+			fbxN("Creator", creator),
+		),
+		fbxN("FileId", fbxFileID),
+		fbxN("CreationTime", fbxTimeID),
+		fbxN("Creator", creator),
+		fbxN("GlobalSettings").add(
+			fbxN("Version", int32(1000)),
+			fbxN("Properties70").add(
+				fbxP("UpAxis", "int", "Integer", "", up),
+				fbxP("UpAxisSign", "int", "Integer", "", int32(1)),
+				fbxP("FrontAxis", "int", "Integer", "", front),
+				fbxP("FrontAxisSign", "int", "Integer", "", frontSign),
+				fbxP("CoordAxis", "int", "Integer", "", int32(0)),
+				fbxP("CoordAxisSign", "int", "Integer", "", int32(1)),
+				fbxP("OriginalUpAxis", "int", "Integer", "", up),
+				fbxP("OriginalUpAxisSign", "int", "Integer", "", int32(1)),
+				fbxP("UnitScaleFactor", "double", "Number", "", unit),
+				fbxP("OriginalUnitScaleFactor", "double", "Number", "", unit),
+			),
+		),
+		fbxN("Documents").add(
+			fbxN("Count", int32(1)),
+			fbxN("Document", int64(1000000), "Scene", "Scene").add(
+				fbxN("Properties70"),
+				fbxN("RootNode", int64(0)),
+			),
+		),
+		fbxN("References"),
+		defs,
+		objects,
+		conns,
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("Kaydara FBX Binary  \x00\x1a\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(fbxVersion))
+	for _, n := range root {
+		n.encode(&buf)
+	}
+	buf.Write(make([]byte, 13)) // 顶层列表的结束记录
+
+	buf.Write(fbxFootID)
+	buf.Write(make([]byte, 4))
+	pad := 16 - buf.Len()%16
+	buf.Write(make([]byte, pad))
+	binary.Write(&buf, binary.LittleEndian, uint32(fbxVersion))
+	buf.Write(make([]byte, 120))
+	buf.Write(fbxFootTail)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encode 写出节点记录；EndOffset 为相对文件起点的绝对偏移
+func (n *fbxNode) encode(buf *bytes.Buffer) {
+	start := buf.Len()
+	buf.Write(make([]byte, 12)) // EndOffset / NumProperties / PropertyListLen 占位
+	buf.WriteByte(byte(len(n.name)))
+	buf.WriteString(n.name)
+
+	propStart := buf.Len()
+	le := binary.LittleEndian
+	for _, p := range n.props {
+		switch v := p.(type) {
+		case int16:
+			buf.WriteByte('Y')
+			binary.Write(buf, le, v)
+		case bool:
+			buf.WriteByte('C')
+			if v {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+		case int32:
+			buf.WriteByte('I')
+			binary.Write(buf, le, v)
+		case float32:
+			buf.WriteByte('F')
+			binary.Write(buf, le, v)
+		case float64:
+			buf.WriteByte('D')
+			binary.Write(buf, le, v)
+		case int64:
+			buf.WriteByte('L')
+			binary.Write(buf, le, v)
+		case string:
+			buf.WriteByte('S')
+			binary.Write(buf, le, uint32(len(v)))
+			buf.WriteString(v)
+		case []byte:
+			buf.WriteByte('R')
+			binary.Write(buf, le, uint32(len(v)))
+			buf.Write(v)
+		case []float64:
+			buf.WriteByte('d')
+			binary.Write(buf, le, [3]uint32{uint32(len(v)), 0, uint32(len(v) * 8)})
+			var b [8]byte
+			for _, f := range v {
+				le.PutUint64(b[:], math.Float64bits(f))
+				buf.Write(b[:])
+			}
+		case []int32:
+			buf.WriteByte('i')
+			binary.Write(buf, le, [3]uint32{uint32(len(v)), 0, uint32(len(v) * 4)})
+			var b [4]byte
+			for _, x := range v {
+				le.PutUint32(b[:], uint32(x))
+				buf.Write(b[:])
+			}
+		}
+	}
+	propLen := buf.Len() - propStart
+
+	for _, c := range n.children {
+		c.encode(buf)
+	}
+	// 有子节点或没有属性的节点需要结束记录
+	if len(n.children) > 0 || len(n.props) == 0 {
+		buf.Write(make([]byte, 13))
+	}
+	hdr := buf.Bytes()[start:]
+	le.PutUint32(hdr[0:], uint32(buf.Len()))
+	le.PutUint32(hdr[4:], uint32(len(n.props)))
+	le.PutUint32(hdr[8:], uint32(propLen))
+}
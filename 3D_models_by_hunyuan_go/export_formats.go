@@ -0,0 +1,274 @@
+// export_formats.go
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+/* =========================
+   STL / PLY / OBJ 输出
+   ========================= */
+
+// texName 贴图在导出包内的文件名（按 Scene.Images 下标命名，避免重名）
+func texName(s *Scene, img int) string {
+	return fmt.Sprintf("texture_%d%s", img, s.Images[img].Ext())
+}
+
+// WriteSTL 二进制 STL：只有几何，法线按面重新计算
+func WriteSTL(w io.Writer, s *Scene, header string) error {
+	if s.Provenance != nil {
+		header = s.Provenance.stlHeader()
+	}
+	bw := bufio.NewWriterSize(w, 64<<10)
+	var h [84]byte
+	copy(h[:80], header)
+	binary.LittleEndian.PutUint32(h[80:], uint32(s.TriangleCount()))
+	bw.Write(h[:])
+
+	var rec [50]byte
+	put := func(off int, v [3]float32) {
+		for k := 0; k < 3; k++ {
+			binary.LittleEndian.PutUint32(rec[off+k*4:], math.Float32bits(v[k]))
+		}
+	}
+	for _, m := range s.Meshes {
+		for i := 0; i+2 < len(m.Indices); i += 3 {
+			a, b, c := m.Positions[m.Indices[i]], m.Positions[m.Indices[i+1]], m.Positions[m.Indices[i+2]]
+			put(0, FaceNormal(a, b, c))
+			put(12, a)
+			put(24, b)
+			put(36, c)
+			if _, err := bw.Write(rec[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WritePLY 二进制小端 PLY：所有网格合并，顶点带法线、UV 和颜色（无顶点色时取材质底色）
+func WritePLY(w io.Writer, s *Scene, comment string) error {
+	hasN, hasUV := true, true
+	for _, m := range s.Meshes {
+		hasN = hasN && len(m.Normals) == len(m.Positions)
+		hasUV = hasUV && len(m.UVs) == len(m.Positions)
+	}
+
+	bw := bufio.NewWriterSize(w, 64<<10)
+	fmt.Fprintf(bw, "ply\nformat binary_little_endian 1.0\ncomment %s\n", comment)
+	if s.Provenance != nil {
+		fmt.Fprintf(bw, "comment provenance %s\n", s.Provenance.line())
+	}
+	fmt.Fprintf(bw, "element vertex %d\nproperty float x\nproperty float y\nproperty float z\n", s.VertexCount())
+	if hasN {
+		bw.WriteString("property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if hasUV {
+		bw.WriteString("property float s\nproperty float t\n")
+	}
+	bw.WriteString("property uchar red\nproperty uchar green\nproperty uchar blue\nproperty uchar alpha\n")
+	fmt.Fprintf(bw, "element face %d\nproperty list uchar uint vertex_indices\nend_header\n", s.TriangleCount())
+
+	var b [4]byte
+	f32 := func(v float32) {
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(v))
+		bw.Write(b[:])
+	}
+	u8 := func(v float32) byte {
+		return byte(math.Round(float64(clamp01(v)) * 255))
+	}
+	for _, m := range s.Meshes {
+		base := [4]float32{1, 1, 1, 1}
+		if m.Material >= 0 {
+			base = s.Materials[m.Material].BaseColor
+		}
+		for i, p := range m.Positions {
+			f32(p[0])
+			f32(p[1])
+			f32(p[2])
+			if hasN {
+				f32(m.Normals[i][0])
+				f32(m.Normals[i][1])
+				f32(m.Normals[i][2])
+			}
+			if hasUV {
+				f32(m.UVs[i][0])
+				f32(1 - m.UVs[i][1])
+			}
+			c := base
+			if len(m.Colors) == len(m.Positions) {
+				for k := range c {
+					c[k] *= m.Colors[i][k]
+				}
+			}
+			bw.Write([]byte{u8(c[0]), u8(c[1]), u8(c[2]), u8(c[3])})
+		}
+	}
+	offset := uint32(0)
+	for _, m := range s.Meshes {
+		for i := 0; i+2 < len(m.Indices); i += 3 {
+			bw.WriteByte(3)
+			for k := 0; k < 3; k++ {
+				binary.LittleEndian.PutUint32(b[:], m.Indices[i+k]+offset)
+				bw.Write(b[:])
+			}
+		}
+		offset += uint32(len(m.Positions))
+	}
+	return bw.Flush()
+}
+
+func clamp01(v float32) float32 {
+	return min(max(v, 0), 1)
+}
+
+// WriteOBJZip OBJ + MTL + 贴图打成 zip；PBR 参数按 MTL 的 Pr/Pm 扩展写出
+func WriteOBJZip(w io.Writer, s *Scene, name, comment string) error {
+	zw := zip.NewWriter(w)
+	ow, err := zw.Create(name + ".obj")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(ow, 64<<10)
+	fmt.Fprintf(bw, "# %s\n", comment)
+	if s.Provenance != nil {
+		fmt.Fprintf(bw, "# provenance %s\n", s.Provenance.line())
+	}
+	fmt.Fprintf(bw, "mtllib %s.mtl\n", name)
+
+	var line []byte
+	num := func(v float32) {
+		line = append(line, ' ')
+		line = strconv.AppendFloat(line, float64(v), 'g', -1, 32)
+	}
+	base := 1
+	for _, m := range s.Meshes {
+		hasN := len(m.Normals) == len(m.Positions)
+		hasUV := len(m.UVs) == len(m.Positions)
+		hasC := len(m.Colors) == len(m.Positions)
+		fmt.Fprintf(bw, "o %s\n", objName(m.Name))
+		for i, p := range m.Positions {
+			line = append(line[:0], 'v')
+			num(p[0])
+			num(p[1])
+			num(p[2])
+			if hasC {
+				num(m.Colors[i][0])
+				num(m.Colors[i][1])
+				num(m.Colors[i][2])
+			}
+			line = append(line, '\n')
+			bw.Write(line)
+		}
+		if hasUV {
+			for _, uv := range m.UVs {
+				line = append(line[:0], 'v', 't')
+				num(uv[0])
+				num(1 - uv[1]) // OBJ 的 v 轴向上
+				line = append(line, '\n')
+				bw.Write(line)
+			}
+		}
+		if hasN {
+			for _, n := range m.Normals {
+				line = append(line[:0], 'v', 'n')
+				num(n[0])
+				num(n[1])
+				num(n[2])
+				line = append(line, '\n')
+				bw.Write(line)
+			}
+		}
+		if m.Material >= 0 {
+			fmt.Fprintf(bw, "usemtl %s\n", objName(s.Materials[m.Material].Name))
+		}
+		for i := 0; i+2 < len(m.Indices); i += 3 {
+			line = append(line[:0], 'f')
+			for k := 0; k < 3; k++ {
+				v := strconv.Itoa(base + int(m.Indices[i+k]))
+				line = append(line, ' ')
+				line = append(line, v...)
+				switch {
+				case hasUV && hasN:
+					line = append(line, '/')
+					line = append(line, v...)
+					line = append(line, '/')
+					line = append(line, v...)
+				case hasUV:
+					line = append(line, '/')
+					line = append(line, v...)
+				case hasN:
+					line = append(line, '/', '/')
+					line = append(line, v...)
+				}
+			}
+			line = append(line, '\n')
+			if _, err := bw.Write(line); err != nil {
+				return err
+			}
+		}
+		base += len(m.Positions)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	mw, err := zw.Create(name + ".mtl")
+	if err != nil {
+		return err
+	}
+	used := map[int]bool{}
+	for _, mat := range s.Materials {
+		c := mat.BaseColor
+		fmt.Fprintf(mw, "newmtl %s\nKa 0 0 0\nKd %g %g %g\nKs 0.04 0.04 0.04\nNs %g\nd %g\nillum 2\n",
+			objName(mat.Name), c[0], c[1], c[2], (1-mat.Roughness)*(1-mat.Roughness)*1000, c[3])
+		fmt.Fprintf(mw, "Pr %g\nPm %g\n", mat.Roughness, mat.Metallic)
+		if mat.Emissive != [3]float32{} {
+			fmt.Fprintf(mw, "Ke %g %g %g\n", mat.Emissive[0], mat.Emissive[1], mat.Emissive[2])
+		}
+		tex := func(stmt string, img int) {
+			if img >= 0 {
+				fmt.Fprintf(mw, "%s %s\n", stmt, texName(s, img))
+				used[img] = true
+			}
+		}
+		tex("map_Kd", mat.BaseColorTex)
+		tex("map_Bump", mat.NormalTex)
+		tex("map_Ke", mat.EmissiveTex)
+		mw.Write([]byte("\n"))
+	}
+	for img := range s.Images {
+		if !used[img] {
+			continue
+		}
+		// 贴图本身已压缩，不再 Deflate
+		tw, err := zw.CreateHeader(&zip.FileHeader{Name: texName(s, img), Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(s.Images[img].Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// objName OBJ/MTL 中的名字不能带空白
+func objName(n string) string {
+	out := []byte(n)
+	for i, ch := range out {
+		if ch <= ' ' {
+			out[i] = '_'
+		}
+	}
+	if len(out) == 0 {
+		return "unnamed"
+	}
+	return string(out)
+}
@@ -0,0 +1,118 @@
+// export_lod.go
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/* =========================
+   减面与 LOD 导出
+   ========================= */
+
+// 腾讯侧 FaceCount 最低 40000，对移动端仍然偏重。导出接口支持：
+//   faces=5000              转换前简化到不超过 5000 个三角形（任意格式）
+//   lods=20000,5000,1000    仅 glb/gltf：在主模型之外逐级简化，按 MSFT_lod 打包进同一文件
+// 两者可同时使用，此时 faces 决定主模型（LOD0）的面数。
+
+const (
+	maxLODLevels     = 4
+	minSimplifyFaces = 4
+)
+
+type SimplifyOptions struct {
+	Faces int   // 0 表示不简化
+	LODs  []int // 由高到低
+}
+
+func parseSimplifyOptions(q url.Values) (*SimplifyOptions, error) {
+	o := &SimplifyOptions{}
+	if v := q.Get("faces"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minSimplifyFaces {
+			return nil, errors.New("invalid faces, want an integer >= " + strconv.Itoa(minSimplifyFaces))
+		}
+		o.Faces = n
+	}
+	if v := q.Get("lods"); v != "" {
+		for _, p := range strings.Split(v, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil || n < minSimplifyFaces {
+				return nil, errors.New("invalid lods, want decreasing triangle counts like 20000,5000,1000")
+			}
+			if len(o.LODs) > 0 && n >= o.LODs[len(o.LODs)-1] || o.Faces > 0 && n >= o.Faces {
+				return nil, errors.New("lods must be decreasing and below faces")
+			}
+			o.LODs = append(o.LODs, n)
+		}
+		if len(o.LODs) > maxLODLevels {
+			return nil, errors.New("at most " + strconv.Itoa(maxLODLevels) + " lod levels")
+		}
+	}
+	return o, nil
+}
+
+// Variant 缓存 key 中的参数部分，如 f5000-lod2000.500
+func (o *SimplifyOptions) Variant() string {
+	var parts []string
+	if o.Faces > 0 {
+		parts = append(parts, "f"+strconv.Itoa(o.Faces))
+	}
+	if len(o.LODs) > 0 {
+		lv := make([]string, len(o.LODs))
+		for i, n := range o.LODs {
+			lv[i] = strconv.Itoa(n)
+		}
+		parts = append(parts, "lod"+strings.Join(lv, "."))
+	}
+	return strings.Join(parts, "-")
+}
+
+// Apply 按 faces 简化场景
+func (o *SimplifyOptions) Apply(s *Scene) *Scene {
+	if o.Faces <= 0 {
+		return s
+	}
+	before := s.TriangleCount()
+	out := Simplify(s, o.Faces)
+	log.Printf("simplify: %d -> %d triangles (target %d)\n", before, out.TriangleCount(), o.Faces)
+	return out
+}
+
+// lodCoverage MSFT_screencoverage：占屏比例低于 1/2、1/4…时切换到下一级，最后一级不剔除
+func lodCoverage(levels int) []float64 {
+	cov := make([]float64, levels+1)
+	for i := 0; i < levels; i++ {
+		cov[i] = 1 / float64(int(2)<<i)
+	}
+	return cov
+}
+
+// writeLODs 逐级简化（每级基于上一级）并输出带 MSFT_lod 的 glTF
+func (o *SimplifyOptions) writeLODs(w io.Writer, s *Scene, binary bool, hook gltfMeshHook) error {
+	levels := []*Scene{s}
+	for _, n := range o.LODs {
+		lv := Simplify(levels[len(levels)-1], n)
+		log.Printf("lod: %d -> %d triangles (target %d)\n", levels[len(levels)-1].TriangleCount(), lv.TriangleCount(), n)
+		levels = append(levels, lv)
+	}
+	b := buildGLTF(levels[0], hook)
+	for i := range levels[0].Meshes {
+		ids := make([]int, 0, len(levels)-1)
+		for _, lv := range levels[1:] {
+			ids = append(ids, b.addMesh(lv, lv.Meshes[i], hook))
+		}
+		b.doc.Nodes[i]["extensions"] = map[string]any{"MSFT_lod": map[string]any{"ids": ids}}
+		b.doc.Nodes[i]["extras"] = map[string]any{"MSFT_screencoverage": lodCoverage(len(ids))}
+	}
+	b.useExtension("MSFT_lod", false)
+	b.align(4)
+	if binary {
+		return b.writeGLB(w)
+	}
+	return b.writeEmbedded(w)
+}
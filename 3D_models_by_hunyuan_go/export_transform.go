@@ -0,0 +1,163 @@
+// export_transform.go
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/* =========================
+   导出前的单位与朝向归一化
+   ========================= */
+
+// 生成的模型单位和朝向不固定，导入 Unity/Blender 或切片软件前往往要手工缩放、摆正。
+// 导出接口支持以下参数，在转换前作用于整个场景：
+//   height=150 | size=150  目标高度（沿上方向）或最长边，二选一
+//   unit=mm|cm|m|in        上述数值的单位，也是 STL/OBJ/PLY 坐标的单位，默认 m（STL 默认 mm）
+//   center=1               水平居中到原点（未指定 ground 时三个轴都居中）
+//   ground=1               底部落在地面，即上方向坐标最小值为 0
+//   up=y|z                 上方向，默认 y；glTF/GLB 规定 Y 轴向上，不支持 z
+
+var unitMeters = map[string]float64{"mm": 0.001, "cm": 0.01, "m": 1, "in": 0.0254}
+
+// STL 不记录单位，切片软件一律按毫米读取；STL 导出和打印修复默认按毫米写坐标，否则 1 m 高的模型只有 1 mm
+const stlUnit = "mm"
+
+// 目标尺寸上限（按所选单位），防止误传巨大数值
+const maxExportDimension = 1e6
+
+type ExportTransform struct {
+	Height  float64 // 目标高度，0 表示不指定
+	Longest float64 // 目标最长边，0 表示不指定
+	Unit    string
+	Center  bool
+	Ground  bool
+	ZUp     bool
+}
+
+// parseExportTransform defaultUnit 为未指定 unit 时的单位
+func parseExportTransform(q url.Values, defaultUnit string) (*ExportTransform, error) {
+	t := &ExportTransform{Unit: defaultUnit}
+	if u := strings.ToLower(q.Get("unit")); u != "" {
+		if _, ok := unitMeters[u]; !ok {
+			return nil, errors.New("invalid unit, want one of mm|cm|m|in")
+		}
+		t.Unit = u
+	}
+	for name, dst := range map[string]*float64{"height": &t.Height, "size": &t.Longest} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(f > 0) || f > maxExportDimension {
+			return nil, errors.New("invalid " + name)
+		}
+		*dst = f
+	}
+	if t.Height > 0 && t.Longest > 0 {
+		return nil, errors.New("height and size are mutually exclusive")
+	}
+	for name, dst := range map[string]*bool{"center": &t.Center, "ground": &t.Ground} {
+		if v := q.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.New("invalid " + name)
+			}
+			*dst = b
+		}
+	}
+	switch strings.ToLower(q.Get("up")) {
+	case "", "y":
+	case "z":
+		t.ZUp = true
+	default:
+		return nil, errors.New("invalid up, want y or z")
+	}
+	return t, nil
+}
+
+// Variant 缓存 key 中的参数部分；不做任何变换时为空，与未带参数的导出共用缓存
+func (t *ExportTransform) Variant() string {
+	num := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	var parts []string
+	switch {
+	case t.Height > 0:
+		parts = append(parts, "h"+num(t.Height)+t.Unit)
+	case t.Longest > 0:
+		parts = append(parts, "s"+num(t.Longest)+t.Unit)
+	case t.Unit != "m":
+		parts = append(parts, "u"+t.Unit)
+	}
+	if t.Center {
+		parts = append(parts, "c")
+	}
+	if t.Ground {
+		parts = append(parts, "g")
+	}
+	if t.ZUp {
+		parts = append(parts, "zup")
+	}
+	return strings.Join(parts, "-")
+}
+
+// Apply 就地变换场景。源模型按 glTF 约定以米为单位、Y 轴向上；
+// metersOnly 的格式（glTF）坐标最终换回米，其余格式按所选单位写坐标并记到 Scene.MetersPerUnit
+func (t *ExportTransform) Apply(s *Scene, metersOnly bool) {
+	if t.Variant() == "" || s.VertexCount() == 0 {
+		return
+	}
+	um := unitMeters[t.Unit]
+	mn, mx := s.Bounds()
+	dims := sub3(mx, mn)
+
+	scale := 1 / um
+	switch {
+	case t.Height > 0 && dims[1] > 0:
+		scale = t.Height / float64(dims[1])
+	case t.Longest > 0:
+		if l := max(dims[0], dims[1], dims[2]); l > 0 {
+			scale = t.Longest / float64(l)
+		}
+	}
+	if metersOnly {
+		scale *= um
+		s.MetersPerUnit = 1
+	} else {
+		s.MetersPerUnit = um
+	}
+
+	// pivot 平移到原点后再缩放
+	var pivot [3]float64
+	if t.Center {
+		for k := 0; k < 3; k++ {
+			pivot[k] = (float64(mn[k]) + float64(mx[k])) / 2
+		}
+	}
+	if t.Ground {
+		pivot[1] = float64(mn[1])
+	}
+
+	// Y 轴向上转 Z 轴向上：绕 X 轴旋转 +90°，(x, y, z) → (x, -z, y)
+	rot := func(v [3]float32) [3]float32 {
+		if !t.ZUp {
+			return v
+		}
+		return [3]float32{v[0], -v[2], v[1]}
+	}
+	for _, m := range s.Meshes {
+		for i, p := range m.Positions {
+			var q [3]float32
+			for k := 0; k < 3; k++ {
+				q[k] = float32((float64(p[k]) - pivot[k]) * scale)
+			}
+			m.Positions[i] = rot(q)
+		}
+		for i, n := range m.Normals {
+			m.Normals[i] = rot(n)
+		}
+	}
+	s.ZUp = t.ZUp
+}
@@ -0,0 +1,37 @@
+// export_transform_test.go
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestExportTransformDefaultUnit(t *testing.T) {
+	for _, tc := range []struct {
+		query       string
+		defaultUnit string
+		variant     string
+		height      float32
+	}{
+		{"", "m", "", 1},
+		{"", stlUnit, "umm", 1000},
+		{"unit=m", stlUnit, "", 1},
+		{"unit=cm", stlUnit, "ucm", 100},
+		{"height=150", stlUnit, "h150mm", 150},
+	} {
+		q, _ := url.ParseQuery(tc.query)
+		tf, err := parseExportTransform(q, tc.defaultUnit)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		if got := tf.Variant(); got != tc.variant {
+			t.Errorf("%q default %s: variant %q, want %q", tc.query, tc.defaultUnit, got, tc.variant)
+		}
+		s := cubeTestScene()
+		tf.Apply(s, false)
+		mn, mx := s.Bounds()
+		if h := mx[1] - mn[1]; h != tc.height {
+			t.Errorf("%q default %s: height %v, want %v", tc.query, tc.defaultUnit, h, tc.height)
+		}
+	}
+}
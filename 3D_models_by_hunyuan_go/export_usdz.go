@@ -0,0 +1,245 @@
+// export_usdz.go
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+)
+
+/* =========================
+   USDZ 输出
+   ========================= */
+
+// USDZ 是不压缩的 zip：第一个文件为场景（这里用 USDA 文本），每个文件的数据起点按 64 字节对齐。
+// 材质用 UsdPreviewSurface；USDZ 只允许 PNG/JPEG 贴图，其他格式的贴图会被跳过。
+
+func WriteUSDZ(w io.Writer, s *Scene, doc string) error {
+	files := []struct {
+		name string
+		data []byte
+	}{{"model.usda", buildUSDA(s, doc)}}
+	for img := range s.Images {
+		if usdzTexOK(s, img) {
+			files = append(files, struct {
+				name string
+				data []byte
+			}{"textures/" + texName(s, img), s.Images[img].Data})
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	offset := 0
+	for _, f := range files {
+		// 本地文件头 30 字节 + 文件名 + extra，用 extra 字段补齐到 64 字节边界
+		base := offset + 30 + len(f.name)
+		pad := (64 - base%64) % 64
+		if pad > 0 && pad < 4 {
+			pad += 64
+		}
+		var extra []byte
+		if pad > 0 {
+			extra = make([]byte, pad)
+			binary.LittleEndian.PutUint16(extra[0:], 0x1986)
+			binary.LittleEndian.PutUint16(extra[2:], uint16(pad-4))
+		}
+		fw, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               f.name,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(f.data),
+			CompressedSize64:   uint64(len(f.data)),
+			UncompressedSize64: uint64(len(f.data)),
+			Extra:              extra,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+		offset = base + pad + len(f.data)
+	}
+	return zw.Close()
+}
+
+func usdzTexOK(s *Scene, img int) bool {
+	if img < 0 || img >= len(s.Images) {
+		return false
+	}
+	mt := s.Images[img].MimeType
+	return mt == "image/png" || mt == "image/jpeg"
+}
+
+// buildUSDA 生成 USDA 文本
+func buildUSDA(s *Scene, doc string) []byte {
+	var b bytes.Buffer
+	up := "Y"
+	if s.ZUp {
+		up = "Z"
+	}
+	fmt.Fprintf(&b, "#usda 1.0\n(\n    defaultPrim = \"Root\"\n    doc = %s\n    metersPerUnit = %s\n    upAxis = %q\n",
+		strconv.Quote(doc), strconv.FormatFloat(s.unitMeters(), 'g', -1, 64), up)
+	if s.Provenance != nil {
+		fmt.Fprintf(&b, "    customLayerData = {\n        string provenance = %s\n    }\n", strconv.Quote(s.Provenance.line()))
+	}
+	b.WriteString(")\n\n")
+	b.WriteString("def Xform \"Root\" (\n    kind = \"component\"\n)\n{\n")
+
+	if len(s.Materials) > 0 {
+		b.WriteString("    def Scope \"Materials\"\n    {\n")
+		for i, mat := range s.Materials {
+			writeUSDMaterial(&b, s, i, mat)
+		}
+		b.WriteString("    }\n")
+	}
+
+	var num []byte
+	f := func(v float32) string {
+		num = strconv.AppendFloat(num[:0], float64(v), 'g', -1, 32)
+		return string(num)
+	}
+	for mi, m := range s.Meshes {
+		fmt.Fprintf(&b, "\n    def Mesh \"Mesh_%d\" (\n        prepend apiSchemas = [\"MaterialBindingAPI\"]\n    )\n    {\n", mi)
+		mn, mx := (&Scene{Meshes: []*Mesh{m}}).Bounds()
+		fmt.Fprintf(&b, "        float3[] extent = [(%s, %s, %s), (%s, %s, %s)]\n", f(mn[0]), f(mn[1]), f(mn[2]), f(mx[0]), f(mx[1]), f(mx[2]))
+		if m.Material >= 0 && s.Materials[m.Material].DoubleSided {
+			b.WriteString("        uniform bool doubleSided = 1\n")
+		}
+		b.WriteString("        int[] faceVertexCounts = [")
+		for i := 0; i < len(m.Indices)/3; i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('3')
+		}
+		b.WriteString("]\n        int[] faceVertexIndices = [")
+		for i, v := range m.Indices {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(strconv.FormatUint(uint64(v), 10))
+		}
+		b.WriteString("]\n")
+		if m.Material >= 0 {
+			fmt.Fprintf(&b, "        rel material:binding = </Root/Materials/Material_%d>\n", m.Material)
+		}
+		if len(m.Normals) == len(m.Positions) {
+			b.WriteString("        normal3f[] normals = [")
+			for i, n := range m.Normals {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "(%s, %s, %s)", f(n[0]), f(n[1]), f(n[2]))
+			}
+			b.WriteString("] (\n            interpolation = \"vertex\"\n        )\n")
+		}
+		b.WriteString("        point3f[] points = [")
+		for i, p := range m.Positions {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "(%s, %s, %s)", f(p[0]), f(p[1]), f(p[2]))
+		}
+		b.WriteString("]\n")
+		if len(m.Colors) == len(m.Positions) {
+			b.WriteString("        color3f[] primvars:displayColor = [")
+			for i, c := range m.Colors {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "(%s, %s, %s)", f(c[0]), f(c[1]), f(c[2]))
+			}
+			b.WriteString("] (\n            interpolation = \"vertex\"\n        )\n")
+		}
+		if len(m.UVs) == len(m.Positions) {
+			b.WriteString("        texCoord2f[] primvars:st = [")
+			for i, uv := range m.UVs {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "(%s, %s)", f(uv[0]), f(1-uv[1]))
+			}
+			b.WriteString("] (\n            interpolation = \"vertex\"\n        )\n")
+		}
+		b.WriteString("        uniform token subdivisionScheme = \"none\"\n    }\n")
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func writeUSDMaterial(b *bytes.Buffer, s *Scene, i int, mat Material) {
+	path := fmt.Sprintf("/Root/Materials/Material_%d", i)
+	c := mat.BaseColor
+	fmt.Fprintf(b, "        def Material \"Material_%d\"\n        {\n", i)
+	fmt.Fprintf(b, "            token outputs:surface.connect = <%s/Surface.outputs:surface>\n\n", path)
+	b.WriteString("            def Shader \"Surface\"\n            {\n                uniform token info:id = \"UsdPreviewSurface\"\n")
+	if usdzTexOK(s, mat.BaseColorTex) {
+		fmt.Fprintf(b, "                color3f inputs:diffuseColor.connect = <%s/BaseColorTex.outputs:rgb>\n", path)
+	} else {
+		fmt.Fprintf(b, "                color3f inputs:diffuseColor = (%g, %g, %g)\n", c[0], c[1], c[2])
+	}
+	if mat.Emissive != [3]float32{} {
+		fmt.Fprintf(b, "                color3f inputs:emissiveColor = (%g, %g, %g)\n", mat.Emissive[0], mat.Emissive[1], mat.Emissive[2])
+	}
+	if usdzTexOK(s, mat.MetalRoughTex) {
+		// glTF 约定：G 通道为粗糙度，B 通道为金属度
+		fmt.Fprintf(b, "                float inputs:metallic.connect = <%s/MetalRoughTex.outputs:b>\n", path)
+		fmt.Fprintf(b, "                float inputs:roughness.connect = <%s/MetalRoughTex.outputs:g>\n", path)
+	} else {
+		fmt.Fprintf(b, "                float inputs:metallic = %g\n                float inputs:roughness = %g\n", mat.Metallic, mat.Roughness)
+	}
+	if usdzTexOK(s, mat.NormalTex) {
+		fmt.Fprintf(b, "                normal3f inputs:normal.connect = <%s/NormalTex.outputs:rgb>\n", path)
+	}
+	if usdzTexOK(s, mat.OcclusionTex) {
+		fmt.Fprintf(b, "                float inputs:occlusion.connect = <%s/OcclusionTex.outputs:r>\n", path)
+	}
+	if c[3] < 1 && mat.AlphaMode == "BLEND" {
+		if usdzTexOK(s, mat.BaseColorTex) {
+			fmt.Fprintf(b, "                float inputs:opacity.connect = <%s/BaseColorTex.outputs:a>\n", path)
+		} else {
+			fmt.Fprintf(b, "                float inputs:opacity = %g\n", c[3])
+		}
+	}
+	b.WriteString("                token outputs:surface\n            }\n")
+
+	b.WriteString("\n            def Shader \"PrimvarReader\"\n            {\n")
+	b.WriteString("                uniform token info:id = \"UsdPrimvarReader_float2\"\n")
+	b.WriteString("                string inputs:varname = \"st\"\n                float2 outputs:result\n            }\n")
+
+	tex := func(shader string, img int, raw bool, outputs string, scale string) {
+		if !usdzTexOK(s, img) {
+			return
+		}
+		fmt.Fprintf(b, "\n            def Shader \"%s\"\n            {\n", shader)
+		b.WriteString("                uniform token info:id = \"UsdUVTexture\"\n")
+		fmt.Fprintf(b, "                asset inputs:file = @textures/%s@\n", texName(s, img))
+		fmt.Fprintf(b, "                float2 inputs:st.connect = <%s/PrimvarReader.outputs:result>\n", path)
+		b.WriteString("                token inputs:wrapS = \"repeat\"\n                token inputs:wrapT = \"repeat\"\n")
+		if raw {
+			b.WriteString("                token inputs:sourceColorSpace = \"raw\"\n")
+		}
+		if scale != "" {
+			b.WriteString(scale)
+		}
+		b.WriteString(outputs)
+		b.WriteString("            }\n")
+	}
+	if usdzTexOK(s, mat.BaseColorTex) {
+		scale := ""
+		if c != [4]float32{1, 1, 1, 1} {
+			scale = fmt.Sprintf("                float4 inputs:scale = (%g, %g, %g, %g)\n", c[0], c[1], c[2], c[3])
+		}
+		tex("BaseColorTex", mat.BaseColorTex, false, "                float3 outputs:rgb\n                float outputs:a\n", scale)
+	}
+	tex("MetalRoughTex", mat.MetalRoughTex, true, "                float outputs:g\n                float outputs:b\n",
+		fmt.Sprintf("                float4 inputs:scale = (1, %g, %g, 1)\n", mat.Roughness, mat.Metallic))
+	tex("NormalTex", mat.NormalTex, true, "                float3 outputs:rgb\n",
+		"                float4 inputs:scale = (2, 2, 2, 1)\n                float4 inputs:bias = (-1, -1, -1, 0)\n")
+	tex("OcclusionTex", mat.OcclusionTex, true, "                float outputs:r\n", "")
+	b.WriteString("        }\n")
+}
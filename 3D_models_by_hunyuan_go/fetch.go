@@ -0,0 +1,179 @@
+// fetch.go
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+/* =========================
+   并发下载合并
+   ========================= */
+
+// 同一 artifact 的并发拉取在进程内用 singleflight 合并为一次，跨进程用文件锁互斥；
+// 所有等待者共享结果，并可通过进度接口查看同一份进度。
+var (
+	fetchGroup singleflight.Group
+	inflightMu sync.Mutex
+	inflight   = map[string]*fetchState{}
+)
+
+type fetchState struct {
+	bytes   atomic.Int64
+	total   atomic.Int64 // -1 表示未知
+	waiters atomic.Int32
+	started time.Time
+}
+
+// reset 开始（或重新开始）一次传输时设置总大小
+func (st *fetchState) reset(total int64) {
+	if st == nil {
+		return
+	}
+	st.bytes.Store(0)
+	st.total.Store(total)
+}
+
+func (st *fetchState) add(n int64) {
+	if st == nil {
+		return
+	}
+	st.bytes.Add(n)
+}
+
+type progressReader struct {
+	r  io.Reader
+	st *fetchState
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.st.add(int64(n))
+	return n, err
+}
+
+type FetchProgress struct {
+	Key       string    `json:"key"`
+	Bytes     int64     `json:"bytes"`
+	Total     int64     `json:"total"`
+	Percent   float64   `json:"percent,omitempty"`
+	Waiters   int32     `json:"waiters"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func fetchProgress(key string) (*FetchProgress, bool) {
+	inflightMu.Lock()
+	st, ok := inflight[key]
+	inflightMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	p := &FetchProgress{
+		Key:       key,
+		Bytes:     st.bytes.Load(),
+		Total:     st.total.Load(),
+		Waiters:   st.waiters.Load(),
+		StartedAt: st.started,
+	}
+	if p.Total > 0 {
+		p.Percent = float64(p.Bytes) * 100 / float64(p.Total)
+	}
+	return p, true
+}
+
+func joinFetch(key string) *fetchState {
+	inflightMu.Lock()
+	defer inflightMu.Unlock()
+	st, ok := inflight[key]
+	if !ok {
+		st = &fetchState{started: time.Now()}
+		st.total.Store(-1)
+		inflight[key] = st
+	}
+	st.waiters.Add(1)
+	return st
+}
+
+// endFetch 拉取结束后移出进度登记
+func endFetch(key string, st *fetchState) {
+	inflightMu.Lock()
+	if inflight[key] == st {
+		delete(inflight, key)
+	}
+	inflightMu.Unlock()
+}
+
+// downloadToStore 把 provider 的临时 URL 拉取进 artifact 存储。
+// 拉取本身与调用方的 ctx 解耦：某个等待者断开不会中断其它人共享的下载。
+func downloadToStore(ctx context.Context, srcURL, key string) (*ArtifactInfo, error) {
+	if info, err := store.Stat(ctx, key); err == nil {
+		return info, nil
+	} else if !errors.Is(err, ErrArtifactNotFound) {
+		return nil, err
+	}
+
+	st := joinFetch(key)
+	defer st.waiters.Add(-1)
+
+	ch := fetchGroup.DoChan(key, func() (any, error) {
+		defer endFetch(key, st)
+		return fetchToStore(context.WithoutCancel(ctx), srcURL, key, st)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*ArtifactInfo), nil
+	}
+}
+
+// GET /api/jobs/:id/files/:idx/progress 查看正在进行的拉取
+func handleFetchProgress(c *gin.Context) {
+	jobID := c.Param("id")
+	idx, _ := strconv.Atoi(c.Param("idx"))
+	jm, err := repo.Get(c.Request.Context(), jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if idx < 0 || idx >= len(jm.Files) {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "index out of range"})
+		return
+	}
+
+	f := jm.Files[idx]
+	key := f.Key
+	if key == "" {
+		ext := strings.ToLower(f.Type)
+		if ext == "" {
+			ext = "bin"
+		}
+		key = artifactKey(jobID, idx, ext)
+	}
+	if p, ok := fetchProgress(key); ok {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "state": "downloading", "progress": p})
+		return
+	}
+	if info, err := store.Stat(c.Request.Context(), key); err == nil {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "state": "ready", "size": info.Size})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "state": "idle"})
+}
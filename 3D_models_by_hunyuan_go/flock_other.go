@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+// flock_other.go
+package main
+
+import "context"
+
+// 不支持文件锁的平台只做进程内合并
+func lockFile(ctx context.Context, path string) (func(), error) {
+	return func() {}, nil
+}
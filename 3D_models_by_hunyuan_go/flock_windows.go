@@ -0,0 +1,44 @@
+//go:build windows
+
+// flock_windows.go
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile 获取跨进程排他锁（LockFileEx），阻塞直到成功或 ctx 结束。
+// 释放后删除锁文件；其它进程仍打开着它（正在等锁）时删除会失败，留给最后一个持有者删
+func lockFile(ctx context.Context, path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	h := windows.Handle(f.Fd())
+	for {
+		ol := new(windows.Overlapped)
+		err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+		if err == nil {
+			return func() {
+				_ = windows.UnlockFileEx(h, 0, 1, 0, new(windows.Overlapped))
+				_ = f.Close()
+				_ = os.Remove(path)
+			}, nil
+		}
+		if !errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+			f.Close()
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,1135 @@
+// gltf_validate.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* =========================
+   glTF 2.0 校验
+   ========================= */
+
+// 参照 Khronos glTF-Validator 的检查项（问题代码沿用其命名），覆盖前端加载失败最常见的原因：
+//   - GLB 容器：头、长度、chunk 顺序与对齐
+//   - 结构：必需属性、取值范围、枚举值、所有下标引用
+//   - 数据：bufferView/accessor 越界与对齐、accessor 实际值与 min/max 是否一致、NaN/Inf、索引越界
+//   - 贴图：图片能否解码、mimeType 与实际格式是否一致、材质引用的 TEXCOORD 是否存在
+//   - 扩展：extensionsRequired/extensionsUsed 声明是否一致、是否为常见查看器支持的扩展
+// 不检查动画、蒙皮的数据内容和 Draco/meshopt 压缩数据；外部文件（非 data URI 的 uri）无法读取，只记 info。
+
+const maxValidationIssues = 500
+
+type ValidationIssue struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`          // error | warning | info
+	Pointer  string `json:"pointer,omitempty"` // JSON Pointer，如 /accessors/3/min
+	Message  string `json:"message"`
+}
+
+type ValidationInfo struct {
+	Version            string   `json:"version,omitempty"`
+	Generator          string   `json:"generator,omitempty"`
+	ExtensionsUsed     []string `json:"extensions_used,omitempty"`
+	ExtensionsRequired []string `json:"extensions_required,omitempty"`
+	Nodes              int      `json:"nodes"`
+	Meshes             int      `json:"meshes"`
+	Primitives         int      `json:"primitives"`
+	Accessors          int      `json:"accessors"`
+	Materials          int      `json:"materials"`
+	Textures           int      `json:"textures"`
+	Images             int      `json:"images"`
+	Animations         int      `json:"animations"`
+	Skins              int      `json:"skins"`
+	Triangles          int64    `json:"triangles"`
+}
+
+type ValidationReport struct {
+	Format      string            `json:"format"`
+	Valid       bool              `json:"valid"` // 没有 error
+	Errors      int               `json:"errors"`
+	Warnings    int               `json:"warnings"`
+	Infos       int               `json:"infos"`
+	Truncated   bool              `json:"truncated,omitempty"` // 问题超过上限，只列出前 maxValidationIssues 条
+	Issues      []ValidationIssue `json:"issues"`
+	Info        ValidationInfo    `json:"info"`
+	ValidatedAt time.Time         `json:"validated_at"`
+}
+
+// 常见查看器（three.js GLTFLoader 等）能处理的扩展
+var knownGLTFExtensions = map[string]bool{
+	"KHR_draco_mesh_compression": true, "KHR_mesh_quantization": true, "KHR_texture_transform": true,
+	"KHR_texture_basisu": true, "KHR_materials_unlit": true, "KHR_materials_emissive_strength": true,
+	"KHR_materials_clearcoat": true, "KHR_materials_ior": true, "KHR_materials_sheen": true,
+	"KHR_materials_specular": true, "KHR_materials_transmission": true, "KHR_materials_volume": true,
+	"KHR_materials_iridescence": true, "KHR_materials_anisotropy": true, "KHR_materials_dispersion": true,
+	"KHR_materials_variants": true, "KHR_lights_punctual": true, "KHR_animation_pointer": true,
+	"EXT_meshopt_compression": true, "EXT_texture_webp": true, "EXT_texture_avif": true,
+	"EXT_mesh_gpu_instancing": true, "MSFT_lod": true, "MSFT_texture_dds": true,
+}
+
+type vTexRef struct {
+	Index    *int `json:"index"`
+	TexCoord int  `json:"texCoord"`
+}
+
+type vDoc struct {
+	Asset *struct {
+		Version    string `json:"version"`
+		MinVersion string `json:"minVersion"`
+		Generator  string `json:"generator"`
+	} `json:"asset"`
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Mesh        *int      `json:"mesh"`
+		Skin        *int      `json:"skin"`
+		Camera      *int      `json:"camera"`
+		Children    []int     `json:"children"`
+		Matrix      []float64 `json:"matrix"`
+		Translation []float64 `json:"translation"`
+		Rotation    []float64 `json:"rotation"`
+		Scale       []float64 `json:"scale"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Primitives []struct {
+			Attributes map[string]int             `json:"attributes"`
+			Indices    *int                       `json:"indices"`
+			Material   *int                       `json:"material"`
+			Mode       *int                       `json:"mode"`
+			Targets    []map[string]int           `json:"targets"`
+			Extensions map[string]json.RawMessage `json:"extensions"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Accessors []struct {
+		BufferView    *int            `json:"bufferView"`
+		ByteOffset    int             `json:"byteOffset"`
+		ComponentType int             `json:"componentType"`
+		Normalized    bool            `json:"normalized"`
+		Count         *int            `json:"count"`
+		Type          string          `json:"type"`
+		Min           []float64       `json:"min"`
+		Max           []float64       `json:"max"`
+		Sparse        json.RawMessage `json:"sparse"`
+	} `json:"accessors"`
+	BufferViews []struct {
+		Buffer     *int `json:"buffer"`
+		ByteOffset int  `json:"byteOffset"`
+		ByteLength *int `json:"byteLength"`
+		ByteStride int  `json:"byteStride"`
+		Target     int  `json:"target"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		ByteLength *int   `json:"byteLength"`
+		URI        string `json:"uri"`
+	} `json:"buffers"`
+	Materials []struct {
+		PbrMetallicRoughness *struct {
+			BaseColorFactor          []float64 `json:"baseColorFactor"`
+			MetallicFactor           *float64  `json:"metallicFactor"`
+			RoughnessFactor          *float64  `json:"roughnessFactor"`
+			BaseColorTexture         *vTexRef  `json:"baseColorTexture"`
+			MetallicRoughnessTexture *vTexRef  `json:"metallicRoughnessTexture"`
+		} `json:"pbrMetallicRoughness"`
+		NormalTexture    *vTexRef                   `json:"normalTexture"`
+		OcclusionTexture *vTexRef                   `json:"occlusionTexture"`
+		EmissiveTexture  *vTexRef                   `json:"emissiveTexture"`
+		EmissiveFactor   []float64                  `json:"emissiveFactor"`
+		AlphaMode        string                     `json:"alphaMode"`
+		AlphaCutoff      *float64                   `json:"alphaCutoff"`
+		Extensions       map[string]json.RawMessage `json:"extensions"`
+	} `json:"materials"`
+	Textures []struct {
+		Source     *int                       `json:"source"`
+		Sampler    *int                       `json:"sampler"`
+		Extensions map[string]json.RawMessage `json:"extensions"`
+	} `json:"textures"`
+	Samplers []struct {
+		MagFilter int `json:"magFilter"`
+		MinFilter int `json:"minFilter"`
+		WrapS     int `json:"wrapS"`
+		WrapT     int `json:"wrapT"`
+	} `json:"samplers"`
+	Images []struct {
+		URI        string `json:"uri"`
+		MimeType   string `json:"mimeType"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Skins              []json.RawMessage `json:"skins"`
+	Animations         []json.RawMessage `json:"animations"`
+	Cameras            []json.RawMessage `json:"cameras"`
+	ExtensionsUsed     []string          `json:"extensionsUsed"`
+	ExtensionsRequired []string          `json:"extensionsRequired"`
+}
+
+// accInfo 通过结构检查、数据可读的 accessor
+type accInfo struct {
+	ok         bool // 结构有效
+	readable   bool // 数据在内存中且未越界
+	ct, nc, cs int
+	count      int
+	stride     int
+	normalized bool
+	typ        string
+	data       []byte // 从第一个元素开始
+}
+
+func (a *accInfo) get(e, k int) float64 {
+	return readComponent(a.data[e*a.stride+k*a.cs:], a.ct)
+}
+
+func readComponent(b []byte, ct int) float64 {
+	switch ct {
+	case 5120:
+		return float64(int8(b[0]))
+	case 5121:
+		return float64(b[0])
+	case 5122:
+		return float64(int16(binary.LittleEndian.Uint16(b)))
+	case 5123:
+		return float64(binary.LittleEndian.Uint16(b))
+	case 5125:
+		return float64(binary.LittleEndian.Uint32(b))
+	}
+	return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+}
+
+type gltfValidator struct {
+	rep   *ValidationReport
+	doc   vDoc
+	glb   bool
+	bin   []byte
+	used  map[string]map[int]bool
+	ext   map[string]bool // extensionsUsed
+	bufs  [][]byte        // nil 表示数据不可用（外部文件或长度不符）
+	views [][]byte
+	accs  []accInfo
+	imgFm []string // 图片实际格式
+}
+
+// ValidateGLTF 校验 GLB 或 JSON 格式的 glTF
+func ValidateGLTF(data []byte) *ValidationReport {
+	v := &gltfValidator{
+		rep:  &ValidationReport{Format: "gltf", Issues: []ValidationIssue{}, ValidatedAt: time.Now()},
+		used: map[string]map[int]bool{},
+		ext:  map[string]bool{},
+	}
+	jsonData := data
+	if bytes.HasPrefix(data, []byte("glTF")) {
+		v.rep.Format, v.glb = "glb", true
+		jsonData = v.glbChunks(data)
+	}
+	if jsonData != nil && v.parse(jsonData) {
+		v.checkAsset()
+		v.checkExtensions()
+		v.checkBuffers()
+		v.checkBufferViews()
+		v.checkAccessors()
+		v.checkImages()
+		v.checkSamplers()
+		v.checkTextures()
+		v.checkMaterials()
+		v.checkMeshes()
+		v.checkNodes()
+		v.checkUnused()
+	}
+	v.rep.Valid = v.rep.Errors == 0
+	return v.rep
+}
+
+func (v *gltfValidator) add(sev, code, ptr, format string, args ...any) {
+	switch sev {
+	case "error":
+		v.rep.Errors++
+	case "warning":
+		v.rep.Warnings++
+	default:
+		v.rep.Infos++
+	}
+	if len(v.rep.Issues) >= maxValidationIssues {
+		v.rep.Truncated = true
+		return
+	}
+	v.rep.Issues = append(v.rep.Issues, ValidationIssue{Code: code, Severity: sev, Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+}
+
+// ref 检查下标引用并记为已使用
+func (v *gltfValidator) ref(kind string, idx, n int, ptr string) bool {
+	if idx < 0 || idx >= n {
+		v.add("error", "UNRESOLVED_REFERENCE", ptr, "%s index %d out of range (%d defined)", kind, idx, n)
+		return false
+	}
+	if v.used[kind] == nil {
+		v.used[kind] = map[int]bool{}
+	}
+	v.used[kind][idx] = true
+	return true
+}
+
+func jsonPointer(parts ...any) string {
+	var b strings.Builder
+	for _, p := range parts {
+		b.WriteByte('/')
+		s := fmt.Sprint(p)
+		s = strings.ReplaceAll(s, "~", "~0")
+		b.WriteString(strings.ReplaceAll(s, "/", "~1"))
+	}
+	return b.String()
+}
+
+/* ---------- GLB 容器 ---------- */
+
+// glbChunks 检查 GLB 结构，返回 JSON chunk（失败为 nil），BIN chunk 记在 v.bin
+func (v *gltfValidator) glbChunks(data []byte) []byte {
+	if len(data) < 12 {
+		v.add("error", "GLB_UNEXPECTED_END_OF_HEADER", "", "GLB header is truncated (%d bytes)", len(data))
+		return nil
+	}
+	if ver := binary.LittleEndian.Uint32(data[4:8]); ver != 2 {
+		v.add("error", "GLB_INVALID_VERSION", "", "GLB version %d, want 2", ver)
+		return nil
+	}
+	if l := int(binary.LittleEndian.Uint32(data[8:12])); l != len(data) {
+		v.add("error", "GLB_LENGTH_MISMATCH", "", "GLB header declares %d bytes, file has %d (truncated or padded)", l, len(data))
+		data = data[:min(l, len(data))]
+	}
+	var jsonData []byte
+	for off, n := 12, 0; off < len(data); n++ {
+		if off+8 > len(data) {
+			v.add("error", "GLB_CHUNK_TOO_BIG", "", "chunk %d header is truncated", n)
+			break
+		}
+		l := int(binary.LittleEndian.Uint32(data[off:]))
+		typ := string(data[off+4 : off+8])
+		if l%4 != 0 {
+			v.add("error", "GLB_CHUNK_LENGTH_UNALIGNED", "", "chunk %d length %d is not a multiple of 4", n, l)
+		}
+		if off+8+l > len(data) {
+			v.add("error", "GLB_CHUNK_TOO_BIG", "", "chunk %d (%q) declares %d bytes, only %d remain", n, typ, l, len(data)-off-8)
+			break
+		}
+		body := data[off+8 : off+8+l]
+		switch {
+		case typ == "JSON" && n == 0:
+			jsonData = body
+		case typ == "BIN\x00" && n == 1:
+			v.bin = body
+		case n == 0:
+			v.add("error", "GLB_UNEXPECTED_FIRST_CHUNK", "", "first chunk must be JSON, got %q", typ)
+			return nil
+		case typ == "JSON" || typ == "BIN\x00":
+			v.add("error", "GLB_UNEXPECTED_BIN_CHUNK", "", "unexpected %q chunk at position %d", strings.TrimRight(typ, "\x00"), n)
+		default:
+			v.add("warning", "GLB_UNKNOWN_CHUNK_TYPE", "", "unknown chunk type %q ignored", typ)
+		}
+		off += 8 + l
+	}
+	if jsonData == nil {
+		return nil
+	}
+	// JSON chunk 规定用空格补齐
+	if trimmed := bytes.TrimRight(jsonData, " "); bytes.HasSuffix(trimmed, []byte{0}) {
+		v.add("error", "GLB_JSON_PADDING", "", "JSON chunk is padded with NUL bytes instead of spaces")
+		jsonData = bytes.TrimRight(trimmed, "\x00")
+	}
+	return jsonData
+}
+
+/* ---------- JSON 与结构 ---------- */
+
+func (v *gltfValidator) parse(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		v.add("error", "BOM_FOUND", "", "JSON must not start with a UTF-8 BOM")
+		data = data[3:]
+	}
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		v.add("error", "INVALID_JSON", "", "invalid JSON: %v", err)
+		return false
+	}
+	root, ok := raw.(map[string]any)
+	if !ok {
+		v.add("error", "TYPE_MISMATCH", "", "root must be a JSON object")
+		return false
+	}
+	// 类型不符的字段会被跳过，其余照常解析
+	if err := json.Unmarshal(data, &v.doc); err != nil {
+		v.add("error", "TYPE_MISMATCH", "", "%v", err)
+	}
+	for _, e := range v.doc.ExtensionsUsed {
+		v.ext[e] = true
+	}
+	v.walkExtensions(root, "")
+	return true
+}
+
+// walkExtensions 检查各处 extensions 是否都已在 extensionsUsed 中声明，并记下扩展内引用的 bufferView
+func (v *gltfValidator) walkExtensions(node any, p string) {
+	switch n := node.(type) {
+	case map[string]any:
+		for k, c := range n {
+			cp := p + jsonPointer(k)
+			if exts, ok := c.(map[string]any); ok && k == "extensions" {
+				for name, body := range exts {
+					if !v.ext[name] {
+						v.add("error", "UNDECLARED_EXTENSION", cp+jsonPointer(name), "extension %s is not declared in extensionsUsed", name)
+					}
+					v.markExtensionViews(body)
+				}
+			}
+			v.walkExtensions(c, cp)
+		}
+	case []any:
+		for i, c := range n {
+			v.walkExtensions(c, p+jsonPointer(i))
+		}
+	}
+}
+
+func (v *gltfValidator) markExtensionViews(body any) {
+	switch n := body.(type) {
+	case map[string]any:
+		for k, c := range n {
+			if f, ok := c.(float64); ok && k == "bufferView" {
+				if v.used["bufferViews"] == nil {
+					v.used["bufferViews"] = map[int]bool{}
+				}
+				v.used["bufferViews"][int(f)] = true
+			}
+			v.markExtensionViews(c)
+		}
+	case []any:
+		for _, c := range n {
+			v.markExtensionViews(c)
+		}
+	}
+}
+
+func (v *gltfValidator) checkAsset() {
+	a := v.doc.Asset
+	if a == nil {
+		v.add("error", "UNDEFINED_PROPERTY", "/asset", "asset is required")
+		return
+	}
+	v.rep.Info.Version, v.rep.Info.Generator = a.Version, a.Generator
+	switch {
+	case a.Version == "":
+		v.add("error", "UNDEFINED_PROPERTY", "/asset/version", "asset.version is required")
+	case !strings.HasPrefix(a.Version, "2."):
+		v.add("error", "UNKNOWN_ASSET_MAJOR_VERSION", "/asset/version", "unsupported glTF version %s", a.Version)
+	}
+	if a.MinVersion != "" && a.MinVersion != "2.0" {
+		v.add("warning", "UNKNOWN_ASSET_MINOR_VERSION", "/asset/minVersion", "minVersion %s is newer than 2.0", a.MinVersion)
+	}
+}
+
+func (v *gltfValidator) checkExtensions() {
+	d := &v.doc
+	v.rep.Info.ExtensionsUsed, v.rep.Info.ExtensionsRequired = d.ExtensionsUsed, d.ExtensionsRequired
+	for i, e := range d.ExtensionsRequired {
+		if !v.ext[e] {
+			v.add("error", "UNUSED_EXTENSION_REQUIRED", jsonPointer("extensionsRequired", i), "required extension %s is missing from extensionsUsed", e)
+		}
+	}
+	for i, e := range d.ExtensionsUsed {
+		if !knownGLTFExtensions[e] {
+			v.add("warning", "UNSUPPORTED_EXTENSION", jsonPointer("extensionsUsed", i), "extension %s is not supported by common viewers", e)
+		}
+	}
+	if v.ext["KHR_draco_mesh_compression"] || v.ext["EXT_meshopt_compression"] {
+		v.add("info", "COMPRESSED_GEOMETRY", "/extensionsUsed", "viewer needs a Draco/meshopt decoder; compressed geometry data is not validated")
+	}
+}
+
+func (v *gltfValidator) checkBuffers() {
+	binUsed := false
+	bufs := make([][]byte, len(v.doc.Buffers))
+	for i, b := range v.doc.Buffers {
+		p := jsonPointer("buffers", i)
+		if b.ByteLength == nil || *b.ByteLength < 1 {
+			v.add("error", "UNDEFINED_PROPERTY", p+"/byteLength", "buffer byteLength must be >= 1")
+			continue
+		}
+		var data []byte
+		switch {
+		case b.URI == "" && v.glb && i == 0 && v.bin != nil:
+			data, binUsed = v.bin, true
+			if len(data)-*b.ByteLength > 3 {
+				v.add("error", "BUFFER_GLB_CHUNK_TOO_BIG", p, "BIN chunk has %d bytes, buffer declares %d", len(data), *b.ByteLength)
+			}
+		case b.URI == "":
+			v.add("error", "BUFFER_MISSING_GLB_DATA", p, "buffer has no uri and no GLB BIN chunk")
+			continue
+		case strings.HasPrefix(b.URI, "data:"):
+			var err error
+			if data, err = decodeDataURI(b.URI); err != nil {
+				v.add("error", "INVALID_URI", p+"/uri", "bad data URI: %v", err)
+				continue
+			}
+		default:
+			v.add("info", "EXTERNAL_RESOURCE", p+"/uri", "external buffer %q not available, data not validated", b.URI)
+			continue
+		}
+		if len(data) < *b.ByteLength {
+			v.add("error", "BUFFER_BYTE_LENGTH_MISMATCH", p+"/byteLength", "buffer declares %d bytes, data has %d", *b.ByteLength, len(data))
+			continue
+		}
+		bufs[i] = data[:*b.ByteLength]
+	}
+	if v.bin != nil && !binUsed {
+		v.add("warning", "GLB_UNUSED_BIN_CHUNK", "", "GLB BIN chunk is not referenced by buffers[0]")
+	}
+
+	v.views = make([][]byte, len(v.doc.BufferViews))
+	v.bufs = bufs
+}
+
+func (v *gltfValidator) checkBufferViews() {
+	d := &v.doc
+	for i, bv := range d.BufferViews {
+		p := jsonPointer("bufferViews", i)
+		if bv.Buffer == nil {
+			v.add("error", "UNDEFINED_PROPERTY", p+"/buffer", "bufferView.buffer is required")
+			continue
+		}
+		if !v.ref("buffers", *bv.Buffer, len(d.Buffers), p+"/buffer") {
+			continue
+		}
+		if bv.ByteLength == nil || *bv.ByteLength < 1 {
+			v.add("error", "UNDEFINED_PROPERTY", p+"/byteLength", "bufferView byteLength must be >= 1")
+			continue
+		}
+		if bv.ByteOffset < 0 {
+			v.add("error", "VALUE_NOT_IN_RANGE", p+"/byteOffset", "byteOffset %d is negative", bv.ByteOffset)
+			continue
+		}
+		if bv.ByteStride != 0 && (bv.ByteStride < 4 || bv.ByteStride > 252 || bv.ByteStride%4 != 0) {
+			v.add("error", "VALUE_NOT_IN_RANGE", p+"/byteStride", "byteStride %d must be a multiple of 4 in 4..252", bv.ByteStride)
+		}
+		switch bv.Target {
+		case 0, 34962:
+		case 34963:
+			if bv.ByteStride != 0 {
+				v.add("error", "BUFFER_VIEW_TARGET_OVERRIDE", p+"/byteStride", "index buffer views must not define byteStride")
+			}
+		default:
+			v.add("error", "VALUE_NOT_IN_LIST", p+"/target", "invalid target %d", bv.Target)
+		}
+		if bl := d.Buffers[*bv.Buffer].ByteLength; bl != nil && !spanFits(bv.ByteOffset, *bv.ByteLength, *bl) {
+			v.add("error", "BUFFER_VIEW_TOO_LONG", p, "bufferView %d+%d exceeds buffer %d (%d bytes)", bv.ByteOffset, *bv.ByteLength, *bv.Buffer, *bl)
+			continue
+		}
+		if data := v.bufs[*bv.Buffer]; data != nil && spanFits(bv.ByteOffset, *bv.ByteLength, len(data)) {
+			v.views[i] = data[bv.ByteOffset : bv.ByteOffset+*bv.ByteLength]
+		}
+	}
+}
+
+func (v *gltfValidator) checkAccessors() {
+	d := &v.doc
+	v.rep.Info.Accessors = len(d.Accessors)
+	v.accs = make([]accInfo, len(d.Accessors))
+	for i, a := range d.Accessors {
+		p := jsonPointer("accessors", i)
+		cs, ok := componentSize[a.ComponentType]
+		if !ok {
+			v.add("error", "VALUE_NOT_IN_LIST", p+"/componentType", "invalid componentType %d", a.ComponentType)
+			continue
+		}
+		nc, ok := typeComponents[a.Type]
+		if !ok {
+			v.add("error", "VALUE_NOT_IN_LIST", p+"/type", "invalid type %q", a.Type)
+			continue
+		}
+		if a.Count == nil || *a.Count < 1 {
+			v.add("error", "UNDEFINED_PROPERTY", p+"/count", "accessor count must be >= 1")
+			continue
+		}
+		if a.Normalized && (a.ComponentType == 5125 || a.ComponentType == 5126) {
+			v.add("error", "ACCESSOR_NORMALIZED_INVALID", p+"/normalized", "only 8/16-bit integer accessors can be normalized")
+		}
+		for _, mm := range []struct {
+			name string
+			vals []float64
+		}{{"min", a.Min}, {"max", a.Max}} {
+			if len(mm.vals) > 0 && len(mm.vals) != nc {
+				v.add("error", "ARRAY_LENGTH_NOT_IN_LIST", p+"/"+mm.name, "%s has %d values, %s needs %d", mm.name, len(mm.vals), a.Type, nc)
+			}
+		}
+		if len(a.Sparse) > 0 {
+			v.add("info", "SPARSE_NOT_VALIDATED", p+"/sparse", "sparse accessor data is not validated")
+		}
+		info := accInfo{ok: true, ct: a.ComponentType, nc: nc, cs: cs, count: *a.Count, normalized: a.Normalized, typ: a.Type}
+		v.accs[i] = info
+		if a.BufferView == nil || !v.ref("bufferViews", *a.BufferView, len(d.BufferViews), p+"/bufferView") {
+			continue
+		}
+		bv := d.BufferViews[*a.BufferView]
+		if bv.ByteLength == nil {
+			continue
+		}
+		elem := cs * nc
+		stride := bv.ByteStride
+		if stride == 0 {
+			stride = elem
+		} else if stride < elem {
+			v.add("error", "ACCESSOR_SMALL_BYTESTRIDE", p, "bufferView byteStride %d is smaller than the element size %d", stride, elem)
+			continue
+		}
+		if a.ByteOffset < 0 {
+			v.add("error", "VALUE_NOT_IN_RANGE", p+"/byteOffset", "byteOffset %d is negative", a.ByteOffset)
+			continue
+		}
+		if a.ByteOffset%cs != 0 || (bv.ByteOffset+a.ByteOffset)%cs != 0 {
+			v.add("error", "ACCESSOR_TOTAL_OFFSET_ALIGNMENT", p+"/byteOffset", "offset is not aligned to the %d-byte component size", cs)
+		}
+		if !accessorFits(a.ByteOffset, *a.Count, stride, elem, *bv.ByteLength) {
+			v.add("error", "ACCESSOR_TOO_LONG", p, "%d elements at offset %d (stride %d) exceed bufferView %d (%d bytes)", *a.Count, a.ByteOffset, stride, *a.BufferView, *bv.ByteLength)
+			continue
+		}
+		data := v.views[*a.BufferView]
+		if data == nil || !accessorFits(a.ByteOffset, *a.Count, stride, elem, len(data)) {
+			continue
+		}
+		info.readable, info.stride, info.data = true, stride, data[a.ByteOffset:]
+		v.accs[i] = info
+		// 矩阵列对齐填充较少见，只检查 SCALAR/VECn 的数值
+		if strings.HasPrefix(a.Type, "MAT") {
+			continue
+		}
+		v.checkAccessorValues(p, &info, a.Min, a.Max)
+	}
+}
+
+// checkAccessorValues 对比实际取值范围与 min/max，检查浮点 NaN/Inf
+func (v *gltfValidator) checkAccessorValues(p string, a *accInfo, declMin, declMax []float64) {
+	mn, mx := make([]float64, a.nc), make([]float64, a.nc)
+	for k := range mn {
+		mn[k], mx[k] = math.Inf(1), math.Inf(-1)
+	}
+	bad := 0
+	for e := 0; e < a.count; e++ {
+		for k := 0; k < a.nc; k++ {
+			x := a.get(e, k)
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				bad++
+				continue
+			}
+			mn[k], mx[k] = min(mn[k], x), max(mx[k], x)
+		}
+	}
+	if bad > 0 {
+		v.add("error", "ACCESSOR_INVALID_FLOAT", p, "%d components are NaN or Infinity", bad)
+	}
+	// 浮点 min/max 常按 float32 写出，比较时统一到 float32 精度
+	same := func(x, y float64) bool {
+		if a.ct == 5126 {
+			return float32(x) == float32(y)
+		}
+		return x == y
+	}
+	for k := 0; k < a.nc; k++ {
+		if len(declMin) == a.nc && !same(declMin[k], mn[k]) && !math.IsInf(mn[k], 0) {
+			code := "ACCESSOR_MIN_MISMATCH"
+			if mn[k] < declMin[k] {
+				code = "ACCESSOR_ELEMENT_OUT_OF_MIN_BOUND"
+			}
+			v.add("error", code, p+"/min/"+strconv.Itoa(k), "declared min %g, actual %g", declMin[k], mn[k])
+		}
+		if len(declMax) == a.nc && !same(declMax[k], mx[k]) && !math.IsInf(mx[k], 0) {
+			code := "ACCESSOR_MAX_MISMATCH"
+			if mx[k] > declMax[k] {
+				code = "ACCESSOR_ELEMENT_OUT_OF_MAX_BOUND"
+			}
+			v.add("error", code, p+"/max/"+strconv.Itoa(k), "declared max %g, actual %g", declMax[k], mx[k])
+		}
+	}
+}
+
+func (v *gltfValidator) checkImages() {
+	d := &v.doc
+	v.rep.Info.Images = len(d.Images)
+	v.imgFm = make([]string, len(d.Images))
+	for i, im := range d.Images {
+		p := jsonPointer("images", i)
+		var data []byte
+		switch {
+		case im.BufferView != nil && im.URI != "":
+			v.add("error", "ONE_OF_MISMATCH", p, "image must define either uri or bufferView, not both")
+			continue
+		case im.BufferView != nil:
+			if im.MimeType == "" {
+				v.add("error", "UNSATISFIED_DEPENDENCY", p+"/mimeType", "mimeType is required with bufferView")
+			}
+			if !v.ref("bufferViews", *im.BufferView, len(d.BufferViews), p+"/bufferView") {
+				continue
+			}
+			data = v.views[*im.BufferView]
+		case strings.HasPrefix(im.URI, "data:"):
+			var err error
+			if data, err = decodeDataURI(im.URI); err != nil {
+				v.add("error", "INVALID_URI", p+"/uri", "bad data URI: %v", err)
+				continue
+			}
+		case im.URI != "":
+			v.add("info", "EXTERNAL_RESOURCE", p+"/uri", "external image %q not available, data not validated", im.URI)
+			continue
+		default:
+			v.add("error", "ONE_OF_MISMATCH", p, "image must define uri or bufferView")
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		format := sniffFormat(data[:min(len(data), 512)])
+		if bytes.HasPrefix(data, []byte("\xabKTX 20\xbb")) {
+			format = "ktx2"
+		}
+		v.imgFm[i] = format
+		want := map[string]string{"png": "image/png", "jpeg": "image/jpeg", "webp": "image/webp", "ktx2": "image/ktx2", "gif": "image/gif"}[format]
+		if want == "" {
+			v.add("error", "IMAGE_UNRECOGNIZED_FORMAT", p, "image data is not a recognized image format")
+			continue
+		}
+		if im.MimeType != "" && im.MimeType != want {
+			v.add("warning", "IMAGE_MIME_TYPE_INVALID", p+"/mimeType", "mimeType %s, actual data is %s", im.MimeType, want)
+		}
+		if format == "png" || format == "jpeg" || format == "gif" {
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				v.add("error", "IMAGE_DATA_INVALID", p, "cannot decode image: %v", err)
+				continue
+			}
+			if cfg.Width&(cfg.Width-1) != 0 || cfg.Height&(cfg.Height-1) != 0 {
+				v.add("info", "IMAGE_NPOT_DIMENSIONS", p, "image is %dx%d (not a power of two)", cfg.Width, cfg.Height)
+			}
+		}
+	}
+}
+
+func (v *gltfValidator) checkSamplers() {
+	for i, s := range v.doc.Samplers {
+		p := jsonPointer("samplers", i)
+		if s.MagFilter != 0 && s.MagFilter != 9728 && s.MagFilter != 9729 {
+			v.add("error", "VALUE_NOT_IN_LIST", p+"/magFilter", "invalid magFilter %d", s.MagFilter)
+		}
+		if s.MinFilter != 0 && (s.MinFilter < 9728 || s.MinFilter > 9729 && s.MinFilter < 9984 || s.MinFilter > 9987) {
+			v.add("error", "VALUE_NOT_IN_LIST", p+"/minFilter", "invalid minFilter %d", s.MinFilter)
+		}
+		for name, w := range map[string]int{"wrapS": s.WrapS, "wrapT": s.WrapT} {
+			if w != 0 && w != 33071 && w != 33648 && w != 10497 {
+				v.add("error", "VALUE_NOT_IN_LIST", p+"/"+name, "invalid %s %d", name, w)
+			}
+		}
+	}
+}
+
+func (v *gltfValidator) checkTextures() {
+	d := &v.doc
+	v.rep.Info.Textures = len(d.Textures)
+	for i, t := range d.Textures {
+		p := jsonPointer("textures", i)
+		if t.Sampler != nil {
+			v.ref("samplers", *t.Sampler, len(d.Samplers), p+"/sampler")
+		}
+		// 扩展提供的 source（EXT_texture_webp、KHR_texture_basisu 等）
+		hasExtSource := false
+		for name, raw := range t.Extensions {
+			var e struct {
+				Source *int `json:"source"`
+			}
+			if json.Unmarshal(raw, &e) == nil && e.Source != nil {
+				hasExtSource = true
+				v.ref("images", *e.Source, len(d.Images), p+"/extensions/"+name+"/source")
+			}
+		}
+		if t.Source == nil {
+			if !hasExtSource {
+				v.add("warning", "TEXTURE_NO_SOURCE", p, "texture has no image source")
+			}
+			continue
+		}
+		if !v.ref("images", *t.Source, len(d.Images), p+"/source") {
+			continue
+		}
+		// 核心规范的 source 只允许 PNG/JPEG，其他格式须经扩展引用
+		if fm := v.imgFm[*t.Source]; fm != "" && fm != "png" && fm != "jpeg" {
+			v.add("error", "TEXTURE_INVALID_IMAGE_MIME_TYPE", p+"/source", "texture.source points to a %s image; only PNG/JPEG are allowed without an extension", fm)
+		}
+	}
+}
+
+// materialTexRefs 材质中的贴图引用，键为 JSON Pointer
+func (v *gltfValidator) materialTexRefs(i int) map[string]*vTexRef {
+	m := v.doc.Materials[i]
+	p := jsonPointer("materials", i)
+	refs := map[string]*vTexRef{}
+	if m.PbrMetallicRoughness != nil {
+		refs[p+"/pbrMetallicRoughness/baseColorTexture"] = m.PbrMetallicRoughness.BaseColorTexture
+		refs[p+"/pbrMetallicRoughness/metallicRoughnessTexture"] = m.PbrMetallicRoughness.MetallicRoughnessTexture
+	}
+	refs[p+"/normalTexture"] = m.NormalTexture
+	refs[p+"/occlusionTexture"] = m.OcclusionTexture
+	refs[p+"/emissiveTexture"] = m.EmissiveTexture
+	for k, r := range refs {
+		if r == nil {
+			delete(refs, k)
+		}
+	}
+	return refs
+}
+
+func (v *gltfValidator) checkMaterials() {
+	d := &v.doc
+	v.rep.Info.Materials = len(d.Materials)
+	unit := func(p string, x float64) {
+		if x < 0 || x > 1 {
+			v.add("error", "VALUE_NOT_IN_RANGE", p, "value %g must be in [0,1]", x)
+		}
+	}
+	for i, m := range d.Materials {
+		p := jsonPointer("materials", i)
+		if pbr := m.PbrMetallicRoughness; pbr != nil {
+			if len(pbr.BaseColorFactor) > 0 && len(pbr.BaseColorFactor) != 4 {
+				v.add("error", "ARRAY_LENGTH_NOT_IN_LIST", p+"/pbrMetallicRoughness/baseColorFactor", "baseColorFactor needs 4 values")
+			}
+			for k, x := range pbr.BaseColorFactor {
+				unit(p+"/pbrMetallicRoughness/baseColorFactor/"+strconv.Itoa(k), x)
+			}
+			if pbr.MetallicFactor != nil {
+				unit(p+"/pbrMetallicRoughness/metallicFactor", *pbr.MetallicFactor)
+			}
+			if pbr.RoughnessFactor != nil {
+				unit(p+"/pbrMetallicRoughness/roughnessFactor", *pbr.RoughnessFactor)
+			}
+		}
+		if len(m.EmissiveFactor) > 0 && len(m.EmissiveFactor) != 3 {
+			v.add("error", "ARRAY_LENGTH_NOT_IN_LIST", p+"/emissiveFactor", "emissiveFactor needs 3 values")
+		}
+		for k, x := range m.EmissiveFactor {
+			unit(p+"/emissiveFactor/"+strconv.Itoa(k), x)
+		}
+		switch m.AlphaMode {
+		case "", "OPAQUE", "BLEND":
+			if m.AlphaCutoff != nil {
+				v.add("warning", "MATERIAL_ALPHA_CUTOFF_INVALID_MODE", p+"/alphaCutoff", "alphaCutoff is only used with alphaMode MASK")
+			}
+		case "MASK":
+		default:
+			v.add("error", "VALUE_NOT_IN_LIST", p+"/alphaMode", "invalid alphaMode %q", m.AlphaMode)
+		}
+		for rp, r := range v.materialTexRefs(i) {
+			if r.Index == nil {
+				v.add("error", "UNDEFINED_PROPERTY", rp+"/index", "texture index is required")
+				continue
+			}
+			v.ref("textures", *r.Index, len(d.Textures), rp+"/index")
+			if r.TexCoord < 0 {
+				v.add("error", "VALUE_NOT_IN_RANGE", rp+"/texCoord", "texCoord must be >= 0")
+			}
+		}
+	}
+}
+
+func (v *gltfValidator) checkMeshes() {
+	d := &v.doc
+	v.rep.Info.Meshes = len(d.Meshes)
+	quant := v.ext["KHR_mesh_quantization"]
+	for mi, m := range d.Meshes {
+		if len(m.Primitives) == 0 {
+			v.add("error", "EMPTY_ENTITY", jsonPointer("meshes", mi, "primitives"), "mesh has no primitives")
+		}
+		for pi, prim := range m.Primitives {
+			v.rep.Info.Primitives++
+			p := jsonPointer("meshes", mi, "primitives", pi)
+			_, draco := prim.Extensions["KHR_draco_mesh_compression"]
+			mode := 4
+			if prim.Mode != nil {
+				mode = *prim.Mode
+			}
+			if mode < 0 || mode > 6 {
+				v.add("error", "VALUE_NOT_IN_RANGE", p+"/mode", "invalid mode %d", mode)
+			}
+			if len(prim.Attributes) == 0 {
+				v.add("error", "EMPTY_ENTITY", p+"/attributes", "primitive has no attributes")
+			}
+
+			names := make([]string, 0, len(prim.Attributes))
+			for name := range prim.Attributes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			vcount, texSets := -1, map[int]bool{}
+			for _, name := range names {
+				ai := prim.Attributes[name]
+				ap := p + "/attributes/" + name
+				if !v.ref("accessors", ai, len(d.Accessors), ap) || !v.accs[ai].ok {
+					continue
+				}
+				a := &v.accs[ai]
+				if vcount < 0 {
+					vcount = a.count
+				} else if a.count != vcount {
+					v.add("error", "MESH_PRIMITIVE_UNEQUAL_ACCESSOR_COUNT", ap, "%s has %d elements, other attributes have %d", name, a.count, vcount)
+				}
+				if set, ok := strings.CutPrefix(name, "TEXCOORD_"); ok {
+					if n, err := strconv.Atoi(set); err == nil {
+						texSets[n] = true
+					}
+				}
+				v.checkAttribute(ap, name, ai, a, quant)
+			}
+			if _, ok := prim.Attributes["POSITION"]; !ok && len(prim.Attributes) > 0 {
+				v.add("warning", "MESH_PRIMITIVE_NO_POSITION", p+"/attributes", "primitive has no POSITION and will not be rendered")
+			}
+			for ti, t := range prim.Targets {
+				for name, ai := range t {
+					v.ref("accessors", ai, len(d.Accessors), fmt.Sprintf("%s/targets/%d/%s", p, ti, name))
+				}
+			}
+
+			if prim.Material != nil && v.ref("materials", *prim.Material, len(d.Materials), p+"/material") {
+				for rp, r := range v.materialTexRefs(*prim.Material) {
+					if !texSets[r.TexCoord] {
+						v.add("error", "MESH_PRIMITIVE_TOO_FEW_TEXCOORDS", p+"/material", "material uses TEXCOORD_%d (%s) but the primitive does not have it", r.TexCoord, rp)
+					}
+				}
+			}
+
+			n := vcount
+			if prim.Indices != nil && v.ref("accessors", *prim.Indices, len(d.Accessors), p+"/indices") && v.accs[*prim.Indices].ok {
+				ia := &v.accs[*prim.Indices]
+				n = ia.count
+				if ia.typ != "SCALAR" || (ia.ct != 5121 && ia.ct != 5123 && ia.ct != 5125) {
+					v.add("error", "MESH_PRIMITIVE_INDICES_ACCESSOR_INVALID_FORMAT", p+"/indices", "indices must be SCALAR unsigned byte/short/int")
+				} else if ia.readable && !draco && vcount > 0 {
+					v.checkIndices(p+"/indices", ia, vcount, mode)
+				}
+			}
+			switch {
+			case n <= 0:
+			case mode == 4:
+				if n%3 != 0 {
+					v.add("warning", "MESH_PRIMITIVE_INCOMPATIBLE_MODE", p, "%d vertices/indices is not a multiple of 3 for TRIANGLES", n)
+				}
+				v.rep.Info.Triangles += int64(n / 3)
+			case mode == 5 || mode == 6:
+				v.rep.Info.Triangles += int64(max(n-2, 0))
+			}
+		}
+	}
+}
+
+// checkAttribute 按语义检查 accessor 类型；KHR_mesh_quantization 放宽分量类型限制
+func (v *gltfValidator) checkAttribute(p, name string, ai int, a *accInfo, quant bool) {
+	intNorm := (a.ct == 5121 || a.ct == 5123) && a.normalized
+	semantic, _, _ := strings.Cut(name, "_")
+	var okType, okComp bool
+	switch semantic {
+	case "POSITION":
+		okType, okComp = a.typ == "VEC3", a.ct == 5126 || quant
+		acc := v.doc.Accessors[ai]
+		if len(acc.Min) == 0 || len(acc.Max) == 0 {
+			v.add("error", "MESH_PRIMITIVE_POSITION_ACCESSOR_WITHOUT_BOUNDS", p, "POSITION accessor must define min and max")
+		}
+	case "NORMAL":
+		okType, okComp = a.typ == "VEC3", a.ct == 5126 || quant && (a.ct == 5120 || a.ct == 5122) && a.normalized
+		if a.ct == 5126 && a.readable {
+			bad := 0
+			for e := 0; e < a.count; e++ {
+				x, y, z := a.get(e, 0), a.get(e, 1), a.get(e, 2)
+				if l := math.Sqrt(x*x + y*y + z*z); math.Abs(l-1) > 0.01 {
+					bad++
+				}
+			}
+			if bad > 0 {
+				v.add("warning", "ACCESSOR_NON_UNIT", p, "%d of %d normals are not unit length", bad, a.count)
+			}
+		}
+	case "TANGENT":
+		okType, okComp = a.typ == "VEC4", a.ct == 5126 || quant && (a.ct == 5120 || a.ct == 5122) && a.normalized
+	case "TEXCOORD":
+		okType, okComp = a.typ == "VEC2", a.ct == 5126 || intNorm || quant
+	case "COLOR":
+		okType, okComp = a.typ == "VEC3" || a.typ == "VEC4", a.ct == 5126 || intNorm
+	case "JOINTS":
+		okType, okComp = a.typ == "VEC4", a.ct == 5121 || a.ct == 5123
+	case "WEIGHTS":
+		okType, okComp = a.typ == "VEC4", a.ct == 5126 || intNorm
+	default:
+		if !strings.HasPrefix(name, "_") {
+			v.add("warning", "MESH_PRIMITIVE_INVALID_ATTRIBUTE", p, "unknown attribute semantic %s (custom attributes must start with _)", name)
+		}
+		return
+	}
+	if !okType || !okComp {
+		v.add("error", "MESH_PRIMITIVE_ATTRIBUTES_ACCESSOR_INVALID_FORMAT", p, "%s cannot use %s with componentType %d (normalized=%v)", name, a.typ, a.ct, a.normalized)
+	}
+}
+
+// checkIndices 索引越界、图元重启值与退化三角形
+func (v *gltfValidator) checkIndices(p string, ia *accInfo, vcount, mode int) {
+	restart := float64(map[int]uint32{5121: 0xff, 5123: 0xffff, 5125: 0xffffffff}[ia.ct])
+	oob, rst, degenerate := 0, 0, 0
+	for e := 0; e < ia.count; e++ {
+		x := ia.get(e, 0)
+		if x == restart {
+			rst++
+		} else if int(x) >= vcount {
+			oob++
+		}
+	}
+	if mode == 4 {
+		for e := 0; e+2 < ia.count; e += 3 {
+			a, b, c := ia.get(e, 0), ia.get(e+1, 0), ia.get(e+2, 0)
+			if a == b || b == c || a == c {
+				degenerate++
+			}
+		}
+	}
+	if oob > 0 {
+		v.add("error", "ACCESSOR_INDEX_OOB", p, "%d indices reference vertices beyond the %d available", oob, vcount)
+	}
+	if rst > 0 {
+		v.add("error", "ACCESSOR_INDEX_PRIMITIVE_RESTART", p, "%d indices use the primitive restart value", rst)
+	}
+	if degenerate > 0 {
+		v.add("info", "MESH_PRIMITIVE_DEGENERATE_TRIANGLES", p, "%d degenerate triangles", degenerate)
+	}
+}
+
+func (v *gltfValidator) checkNodes() {
+	d := &v.doc
+	v.rep.Info.Nodes, v.rep.Info.Animations, v.rep.Info.Skins = len(d.Nodes), len(d.Animations), len(d.Skins)
+	parent := make([]int, len(d.Nodes))
+	for i := range parent {
+		parent[i] = -1
+	}
+	for i, n := range d.Nodes {
+		p := jsonPointer("nodes", i)
+		if n.Mesh != nil {
+			v.ref("meshes", *n.Mesh, len(d.Meshes), p+"/mesh")
+		}
+		if n.Skin != nil {
+			v.ref("skins", *n.Skin, len(d.Skins), p+"/skin")
+		}
+		if n.Camera != nil {
+			v.ref("cameras", *n.Camera, len(d.Cameras), p+"/camera")
+		}
+		if n.Matrix != nil {
+			if len(n.Matrix) != 16 {
+				v.add("error", "ARRAY_LENGTH_NOT_IN_LIST", p+"/matrix", "matrix needs 16 values")
+			}
+			if n.Translation != nil || n.Rotation != nil || n.Scale != nil {
+				v.add("error", "NODE_MATRIX_TRS", p, "node defines both matrix and TRS")
+			}
+		}
+		if n.Rotation != nil {
+			if len(n.Rotation) != 4 {
+				v.add("error", "ARRAY_LENGTH_NOT_IN_LIST", p+"/rotation", "rotation needs 4 values")
+			} else if l := math.Sqrt(n.Rotation[0]*n.Rotation[0] + n.Rotation[1]*n.Rotation[1] + n.Rotation[2]*n.Rotation[2] + n.Rotation[3]*n.Rotation[3]); math.Abs(l-1) > 1e-5 {
+				v.add("error", "ROTATION_NON_UNIT", p+"/rotation", "rotation quaternion has length %g", l)
+			}
+		}
+		for name, a := range map[string][]float64{"translation": n.Translation, "scale": n.Scale} {
+			if a != nil && len(a) != 3 {
+				v.add("error", "ARRAY_LENGTH_NOT_IN_LIST", p+"/"+name, "%s needs 3 values", name)
+			}
+		}
+		for ci, c := range n.Children {
+			cp := fmt.Sprintf("%s/children/%d", p, ci)
+			if !v.ref("nodes", c, len(d.Nodes), cp) {
+				continue
+			}
+			if parent[c] >= 0 {
+				v.add("error", "NODE_PARENT_OVERRIDE", cp, "node %d already has parent %d", c, parent[c])
+				continue
+			}
+			parent[c] = i
+		}
+	}
+	// 沿父链上溯检测环
+	for i := range d.Nodes {
+		for j, steps := parent[i], 0; j >= 0; j, steps = parent[j], steps+1 {
+			if j == i || steps > len(d.Nodes) {
+				v.add("error", "NODE_LOOP", jsonPointer("nodes", i), "node hierarchy contains a loop")
+				break
+			}
+		}
+	}
+
+	for si, s := range d.Scenes {
+		for ni, n := range s.Nodes {
+			np := jsonPointer("scenes", si, "nodes", ni)
+			if v.ref("nodes", n, len(d.Nodes), np) && parent[n] >= 0 {
+				v.add("error", "SCENE_NON_ROOT_NODE", np, "node %d is not a root node", n)
+			}
+		}
+	}
+	switch {
+	case d.Scene != nil:
+		if v.ref("scenes", *d.Scene, len(d.Scenes), "/scene") {
+			v.checkSceneVisible(*d.Scene, parent)
+		}
+	case len(d.Scenes) > 0:
+		v.add("info", "NO_DEFAULT_SCENE", "", "no default scene; viewers usually show scenes[0]")
+		v.checkSceneVisible(0, parent)
+	case len(d.Meshes) > 0:
+		v.add("warning", "NO_SCENE", "", "file has meshes but no scenes; many viewers will show nothing")
+	}
+}
+
+// checkSceneVisible 默认场景里没有任何网格时前端会显示空白
+func (v *gltfValidator) checkSceneVisible(si int, parent []int) {
+	d := &v.doc
+	stack := slices.Clone(d.Scenes[si].Nodes)
+	seen := map[int]bool{}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n < 0 || n >= len(d.Nodes) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		if d.Nodes[n].Mesh != nil {
+			return
+		}
+		stack = append(stack, d.Nodes[n].Children...)
+	}
+	v.add("warning", "SCENE_EMPTY", jsonPointer("scenes", si), "default scene contains no meshes; nothing will be displayed")
+}
+
+// checkUnused 未被引用的对象（动画、蒙皮引用的 accessor 不解析，存在时跳过 accessor 检查）
+func (v *gltfValidator) checkUnused() {
+	d := &v.doc
+	counts := map[string]int{
+		"bufferViews": len(d.BufferViews), "materials": len(d.Materials), "meshes": len(d.Meshes),
+		"textures": len(d.Textures), "images": len(d.Images), "samplers": len(d.Samplers),
+	}
+	if len(d.Animations) == 0 && len(d.Skins) == 0 {
+		counts["accessors"] = len(d.Accessors)
+	}
+	kinds := make([]string, 0, len(counts))
+	for k := range counts {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		for i := 0; i < counts[k]; i++ {
+			if !v.used[k][i] {
+				v.add("info", "UNUSED_OBJECT", jsonPointer(k, i), "%s %d is not used", strings.TrimSuffix(k, "s"), i)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// gltf_validate_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// testGLB 把 JSON 包成只有 JSON chunk 的 GLB，用 pad 补齐 4 字节（至少补一个）
+func testGLB(jsonData []byte, pad byte) []byte {
+	chunk := append([]byte(nil), jsonData...)
+	for {
+		chunk = append(chunk, pad)
+		if len(chunk)%4 == 0 {
+			break
+		}
+	}
+	b := []byte("glTF")
+	b = binary.LittleEndian.AppendUint32(b, 2)
+	b = binary.LittleEndian.AppendUint32(b, uint32(12+8+len(chunk)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(chunk)))
+	b = append(b, "JSON"...)
+	return append(b, chunk...)
+}
+
+// withBounds 给三角形的 POSITION 补上正确的 min/max，之后再叠加各用例的改动
+func withBounds(patch func(d map[string]any)) func(d map[string]any) {
+	return func(d map[string]any) {
+		testItem(d, "accessors", 0)["min"] = []any{0, 0, 0}
+		testItem(d, "accessors", 0)["max"] = []any{1, 1, 0}
+		if patch != nil {
+			patch(d)
+		}
+	}
+}
+
+func issueCodes(rep *ValidationReport) []string {
+	var codes []string
+	for _, is := range rep.Issues {
+		if is.Severity == "error" {
+			codes = append(codes, is.Code)
+		}
+	}
+	return codes
+}
+
+func TestValidateGLTFValid(t *testing.T) {
+	var glb bytes.Buffer
+	if err := buildGLTF(cubeTestScene(), nil).writeGLB(&glb); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"buildGLTF cube": glb.Bytes(),
+		"triangle json":  testTriangleGLTF(t, withBounds(nil)),
+		"triangle glb":   testGLB(testTriangleGLTF(t, withBounds(nil)), ' '),
+	} {
+		rep := ValidateGLTF(data)
+		if !rep.Valid || rep.Errors != 0 {
+			t.Errorf("%s: valid = %v, errors = %v", name, rep.Valid, issueCodes(rep))
+		}
+	}
+}
+
+func TestValidateGLTFIssues(t *testing.T) {
+	cases := []struct {
+		name string
+		data func(t *testing.T) []byte
+		want string
+	}{
+		{"accessor past bufferView", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "accessors", 0)["count"] = 4 }))
+		}, "ACCESSOR_TOO_LONG"},
+		{"accessor offset past bufferView", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "accessors", 0)["byteOffset"] = 12 }))
+		}, "ACCESSOR_TOO_LONG"},
+		{"indices out of range", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testPrimitive(d)["indices"] = 5 }))
+		}, "UNRESOLVED_REFERENCE"},
+		{"node mesh out of range", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "nodes", 0)["mesh"] = 3 }))
+		}, "UNRESOLVED_REFERENCE"},
+		{"bufferView buffer out of range", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "bufferViews", 1)["buffer"] = 1 }))
+		}, "UNRESOLVED_REFERENCE"},
+		{"json chunk padded with NUL", func(t *testing.T) []byte {
+			return testGLB(testTriangleGLTF(t, withBounds(nil)), 0)
+		}, "GLB_JSON_PADDING"},
+		{"max larger than data", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "accessors", 0)["max"] = []any{2, 1, 0} }))
+		}, "ACCESSOR_MAX_MISMATCH"},
+		{"min smaller than data", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "accessors", 0)["min"] = []any{-1, 0, 0} }))
+		}, "ACCESSOR_MIN_MISMATCH"},
+		{"element above max", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "accessors", 0)["max"] = []any{0.5, 1, 0} }))
+		}, "ACCESSOR_ELEMENT_OUT_OF_MAX_BOUND"},
+		{"element below min", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, withBounds(func(d map[string]any) { testItem(d, "accessors", 0)["min"] = []any{0, 0.5, 0} }))
+		}, "ACCESSOR_ELEMENT_OUT_OF_MIN_BOUND"},
+		{"position without bounds", func(t *testing.T) []byte {
+			return testTriangleGLTF(t, nil)
+		}, "MESH_PRIMITIVE_POSITION_ACCESSOR_WITHOUT_BOUNDS"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rep := ValidateGLTF(tc.data(t))
+			codes := issueCodes(rep)
+			if !slices.Contains(codes, tc.want) {
+				t.Fatalf("errors = %v, want %s", codes, tc.want)
+			}
+			if rep.Valid || rep.Errors != len(codes) {
+				t.Errorf("valid = %v, errors = %d, listed %d", rep.Valid, rep.Errors, len(codes))
+			}
+		})
+	}
+}
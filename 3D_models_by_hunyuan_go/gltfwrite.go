@@ -0,0 +1,308 @@
+// gltfwrite.go
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"slices"
+)
+
+/* =========================
+   glTF / GLB 输出
+   ========================= */
+
+// 从 Scene 重新生成干净的 glTF 2.0：每个 Mesh 一个节点、一个 primitive，
+// 顶点属性和图片放进同一个 buffer。GLB 以 BIN chunk 存放，.gltf 以 data URI 内嵌。
+
+type gltfOut struct {
+	Asset       map[string]any   `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []map[string]any `json:"scenes"`
+	Nodes       []map[string]any `json:"nodes"`
+	Meshes      []map[string]any `json:"meshes"`
+	Materials   []map[string]any `json:"materials,omitempty"`
+	Textures    []map[string]any `json:"textures,omitempty"`
+	Samplers    []map[string]any `json:"samplers,omitempty"`
+	Images      []map[string]any `json:"images,omitempty"`
+	Accessors   []map[string]any `json:"accessors"`
+	BufferViews []map[string]any `json:"bufferViews"`
+	Buffers     []map[string]any `json:"buffers"`
+
+	ExtensionsUsed     []string `json:"extensionsUsed,omitempty"`
+	ExtensionsRequired []string `json:"extensionsRequired,omitempty"`
+}
+
+// gltfBuilder 累积 buffer 与访问器
+type gltfBuilder struct {
+	doc gltfOut
+	bin bytes.Buffer
+}
+
+func (b *gltfBuilder) align(n int) {
+	for b.bin.Len()%n != 0 {
+		b.bin.WriteByte(0)
+	}
+}
+
+// addView 写入一段数据并返回 bufferView 下标
+func (b *gltfBuilder) addView(data []byte, stride int, target int) int {
+	b.align(4)
+	v := map[string]any{"buffer": 0, "byteOffset": b.bin.Len(), "byteLength": len(data)}
+	if stride > 0 {
+		v["byteStride"] = stride
+	}
+	if target > 0 {
+		v["target"] = target
+	}
+	b.bin.Write(data)
+	b.doc.BufferViews = append(b.doc.BufferViews, v)
+	return len(b.doc.BufferViews) - 1
+}
+
+// useExtension 登记扩展（去重）；required 的同时写入 extensionsRequired
+func (b *gltfBuilder) useExtension(name string, required bool) {
+	if !slices.Contains(b.doc.ExtensionsUsed, name) {
+		b.doc.ExtensionsUsed = append(b.doc.ExtensionsUsed, name)
+	}
+	if required && !slices.Contains(b.doc.ExtensionsRequired, name) {
+		b.doc.ExtensionsRequired = append(b.doc.ExtensionsRequired, name)
+	}
+}
+
+func (b *gltfBuilder) addAccessor(acc map[string]any) int {
+	b.doc.Accessors = append(b.doc.Accessors, acc)
+	return len(b.doc.Accessors) - 1
+}
+
+func float32Bytes(vals []float32) []byte {
+	out := make([]byte, len(vals)*4)
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(v))
+	}
+	return out
+}
+
+func (b *gltfBuilder) vec3(data [][3]float32, withBounds bool) int {
+	flat := make([]float32, 0, len(data)*3)
+	for _, v := range data {
+		flat = append(flat, v[0], v[1], v[2])
+	}
+	acc := map[string]any{
+		"bufferView": b.addView(float32Bytes(flat), 0, 34962), "componentType": 5126,
+		"count": len(data), "type": "VEC3",
+	}
+	if withBounds && len(data) > 0 {
+		mn, mx := data[0], data[0]
+		for _, v := range data {
+			for k := 0; k < 3; k++ {
+				mn[k] = min(mn[k], v[k])
+				mx[k] = max(mx[k], v[k])
+			}
+		}
+		acc["min"] = mn[:]
+		acc["max"] = mx[:]
+	}
+	return b.addAccessor(acc)
+}
+
+func (b *gltfBuilder) vec2(data [][2]float32) int {
+	flat := make([]float32, 0, len(data)*2)
+	for _, v := range data {
+		flat = append(flat, v[0], v[1])
+	}
+	return b.addAccessor(map[string]any{
+		"bufferView": b.addView(float32Bytes(flat), 0, 34962), "componentType": 5126,
+		"count": len(data), "type": "VEC2",
+	})
+}
+
+func (b *gltfBuilder) vec4(data [][4]float32) int {
+	flat := make([]float32, 0, len(data)*4)
+	for _, v := range data {
+		flat = append(flat, v[0], v[1], v[2], v[3])
+	}
+	return b.addAccessor(map[string]any{
+		"bufferView": b.addView(float32Bytes(flat), 0, 34962), "componentType": 5126,
+		"count": len(data), "type": "VEC4",
+	})
+}
+
+func (b *gltfBuilder) indices(idx []uint32, vertexCount int) int {
+	var data []byte
+	ct := 5125
+	if vertexCount <= math.MaxUint16 {
+		ct = 5123
+		data = make([]byte, len(idx)*2)
+		for i, v := range idx {
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(v))
+		}
+	} else {
+		data = make([]byte, len(idx)*4)
+		for i, v := range idx {
+			binary.LittleEndian.PutUint32(data[i*4:], v)
+		}
+	}
+	return b.addAccessor(map[string]any{
+		"bufferView": b.addView(data, 0, 34963), "componentType": ct, "count": len(idx), "type": "SCALAR",
+	})
+}
+
+// gltfMeshHook 可改写单个 primitive 及其节点（如量化后用节点变换还原坐标），返回 false 时按默认方式写入
+type gltfMeshHook func(b *gltfBuilder, m *Mesh, prim, node map[string]any) bool
+
+// buildGLTF 生成文档与二进制 buffer
+func buildGLTF(s *Scene, meshHook gltfMeshHook) *gltfBuilder {
+	b := &gltfBuilder{}
+	b.doc.Asset = map[string]any{"version": "2.0", "generator": "hunyuan3d-gin"}
+	if p := s.Provenance; p != nil {
+		b.doc.Asset["extras"] = p.gltfExtras()
+		if p.License != "" {
+			b.doc.Asset["copyright"] = p.License
+		}
+	}
+	b.doc.Scenes = []map[string]any{{"nodes": []int{}}}
+
+	texOf := map[int]int{}
+	texture := func(img int) map[string]any {
+		if img < 0 || img >= len(s.Images) {
+			return nil
+		}
+		ti, ok := texOf[img]
+		if !ok {
+			im := s.Images[img]
+			view := b.addView(im.Data, 0, 0)
+			b.doc.Images = append(b.doc.Images, map[string]any{"bufferView": view, "mimeType": im.MimeType, "name": im.Name})
+			if len(b.doc.Samplers) == 0 {
+				b.doc.Samplers = []map[string]any{{"magFilter": 9729, "minFilter": 9987, "wrapS": 10497, "wrapT": 10497}}
+			}
+			b.doc.Textures = append(b.doc.Textures, map[string]any{"source": len(b.doc.Images) - 1, "sampler": 0})
+			ti = len(b.doc.Textures) - 1
+			texOf[img] = ti
+		}
+		return map[string]any{"index": ti}
+	}
+
+	for _, mat := range s.Materials {
+		pbr := map[string]any{
+			"baseColorFactor": mat.BaseColor[:], "metallicFactor": mat.Metallic, "roughnessFactor": mat.Roughness,
+		}
+		if t := texture(mat.BaseColorTex); t != nil {
+			pbr["baseColorTexture"] = t
+		}
+		if t := texture(mat.MetalRoughTex); t != nil {
+			pbr["metallicRoughnessTexture"] = t
+		}
+		m := map[string]any{"name": mat.Name, "pbrMetallicRoughness": pbr}
+		if t := texture(mat.NormalTex); t != nil {
+			m["normalTexture"] = t
+		}
+		if t := texture(mat.OcclusionTex); t != nil {
+			m["occlusionTexture"] = t
+		}
+		if t := texture(mat.EmissiveTex); t != nil {
+			m["emissiveTexture"] = t
+		}
+		if mat.Emissive != [3]float32{} {
+			m["emissiveFactor"] = mat.Emissive[:]
+		}
+		if mat.DoubleSided {
+			m["doubleSided"] = true
+		}
+		if mat.AlphaMode != "" && mat.AlphaMode != "OPAQUE" {
+			m["alphaMode"] = mat.AlphaMode
+		}
+		b.doc.Materials = append(b.doc.Materials, m)
+	}
+
+	for _, m := range s.Meshes {
+		node := b.addMesh(s, m, meshHook)
+		b.doc.Scenes[0]["nodes"] = append(b.doc.Scenes[0]["nodes"].([]int), node)
+	}
+	b.align(4)
+	return b
+}
+
+// addMesh 写入一个 Mesh 及其节点，返回节点下标（不挂到 scene 上）
+func (b *gltfBuilder) addMesh(s *Scene, m *Mesh, meshHook gltfMeshHook) int {
+	prim := map[string]any{"mode": 4}
+	node := map[string]any{"name": m.Name}
+	if meshHook == nil || !meshHook(b, m, prim, node) {
+		attrs := map[string]int{"POSITION": b.vec3(m.Positions, true)}
+		if len(m.Normals) == len(m.Positions) {
+			attrs["NORMAL"] = b.vec3(m.Normals, false)
+		}
+		if len(m.UVs) == len(m.Positions) {
+			attrs["TEXCOORD_0"] = b.vec2(m.UVs)
+		}
+		if len(m.Colors) == len(m.Positions) {
+			attrs["COLOR_0"] = b.vec4(m.Colors)
+		}
+		prim["attributes"] = attrs
+		prim["indices"] = b.indices(m.Indices, len(m.Positions))
+	}
+	if m.Material >= 0 && m.Material < len(s.Materials) {
+		prim["material"] = m.Material
+	}
+	b.doc.Meshes = append(b.doc.Meshes, map[string]any{"name": m.Name, "primitives": []any{prim}})
+	node["mesh"] = len(b.doc.Meshes) - 1
+	b.doc.Nodes = append(b.doc.Nodes, node)
+	return len(b.doc.Nodes) - 1
+}
+
+// WriteGLB 输出二进制 glTF
+func WriteGLB(w io.Writer, s *Scene) error {
+	return buildGLTF(s, nil).writeGLB(w)
+}
+
+func (b *gltfBuilder) writeGLB(w io.Writer) error {
+	b.doc.Buffers = []map[string]any{{"byteLength": b.bin.Len()}}
+	js, err := json.Marshal(b.doc)
+	if err != nil {
+		return err
+	}
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+	total := 12 + 8 + len(js) + 8 + b.bin.Len()
+	var h [12]byte
+	copy(h[:4], "glTF")
+	binary.LittleEndian.PutUint32(h[4:], 2)
+	binary.LittleEndian.PutUint32(h[8:], uint32(total))
+	if _, err := w.Write(h[:]); err != nil {
+		return err
+	}
+	if err := writeGLBChunk(w, "JSON", js); err != nil {
+		return err
+	}
+	return writeGLBChunk(w, "BIN\x00", b.bin.Bytes())
+}
+
+func writeGLBChunk(w io.Writer, typ string, data []byte) error {
+	var h [8]byte
+	binary.LittleEndian.PutUint32(h[:4], uint32(len(data)))
+	copy(h[4:], typ)
+	if _, err := w.Write(h[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// WriteGLTFEmbedded 输出单文件 .gltf（buffer 以 base64 data URI 内嵌）
+func WriteGLTFEmbedded(w io.Writer, s *Scene) error {
+	return buildGLTF(s, nil).writeEmbedded(w)
+}
+
+func (b *gltfBuilder) writeEmbedded(w io.Writer) error {
+	b.doc.Buffers = []map[string]any{{
+		"byteLength": b.bin.Len(),
+		"uri":        "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(b.bin.Bytes()),
+	}}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(b.doc)
+}
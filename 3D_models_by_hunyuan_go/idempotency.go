@@ -0,0 +1,308 @@
+// idempotency.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   Idempotency-Key 支持
+   ========================= */
+
+// 同一个 Idempotency-Key 在窗口期内重放时，直接返回首次的响应，避免重复提交付费任务
+var (
+	idemTTL  = 24 * time.Hour
+	idemRepo IdemRepo
+)
+
+const (
+	idemHeader      = "Idempotency-Key"
+	idemMaxKeyLen   = 255
+	idemReplayedHdr = "Idempotent-Replayed"
+)
+
+type IdemRecord struct {
+	Key       string
+	Scope     string // METHOD + 路由，如 "POST /api/submit-text"
+	ReqHash   string // 请求指纹（见 requestFingerprint），防止同一 key 被用于不同请求
+	Done      bool
+	Status    int
+	Body      []byte
+	CreatedAt time.Time
+}
+
+type IdemRepo interface {
+	// Reserve 占位；created=true 表示首次出现，否则返回已有记录
+	Reserve(ctx context.Context, key, scope, reqHash string) (rec *IdemRecord, created bool, err error)
+	Complete(ctx context.Context, key, scope string, status int, body []byte) error
+	Release(ctx context.Context, key, scope string) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+/* =========================
+   PostgreSQL Repo
+   ========================= */
+
+type pgIdemRepo struct{ db *sql.DB }
+
+func NewPGIdemRepo(db *sql.DB) IdemRepo { return &pgIdemRepo{db: db} }
+
+func (r *pgIdemRepo) Reserve(ctx context.Context, key, scope, reqHash string) (*IdemRecord, bool, error) {
+	// 过期记录视为不存在
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE idem_key = $1 AND scope = $2 AND created_at < $3
+	`, key, scope, time.Now().Add(-idemTTL)); err != nil {
+		return nil, false, err
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (idem_key, scope, req_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (idem_key, scope) DO NOTHING
+	`, key, scope, reqHash)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return &IdemRecord{Key: key, Scope: scope, ReqHash: reqHash, CreatedAt: time.Now()}, true, nil
+	}
+
+	var rec IdemRecord
+	var status sql.NullInt64
+	err = r.db.QueryRowContext(ctx, `
+		SELECT idem_key, scope, req_hash, done, status, body, created_at
+		FROM idempotency_keys WHERE idem_key = $1 AND scope = $2
+	`, key, scope).Scan(&rec.Key, &rec.Scope, &rec.ReqHash, &rec.Done, &status, &rec.Body, &rec.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 并发下刚被 Release，交给调用方按冲突处理
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	rec.Status = int(status.Int64)
+	return &rec, false, nil
+}
+
+func (r *pgIdemRepo) Complete(ctx context.Context, key, scope string, status int, body []byte) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET done = TRUE, status = $3, body = $4
+		WHERE idem_key = $1 AND scope = $2
+	`, key, scope, status, body)
+	return err
+}
+
+func (r *pgIdemRepo) Release(ctx context.Context, key, scope string) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE idem_key = $1 AND scope = $2 AND NOT done
+	`, key, scope)
+	return err
+}
+
+func (r *pgIdemRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func createIdemTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			idem_key TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			req_hash TEXT NOT NULL,
+			done BOOLEAN NOT NULL DEFAULT FALSE,
+			status INT,
+			body BYTEA,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (idem_key, scope)
+		)
+	`)
+	return err
+}
+
+// 环境变量 IDEMPOTENCY_TTL（Go duration，如 24h / 30m）
+func initIdempotency(db *sql.DB) {
+	if v := strings.TrimSpace(os.Getenv("IDEMPOTENCY_TTL")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			idemTTL = d
+		}
+	}
+	if err := createIdemTable(db); err != nil {
+		log.Fatal("Error creating idempotency table:", err)
+	}
+	idemRepo = NewPGIdemRepo(db)
+	go idemJanitor()
+}
+
+// 定期清理过期 key
+func idemJanitor() {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for range t.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if n, err := idemRepo.Purge(ctx, time.Now().Add(-idemTTL)); err != nil {
+			log.Println("idempotency purge:", err)
+		} else if n > 0 {
+			log.Printf("idempotency purge: removed %d keys\n", n)
+		}
+		cancel()
+	}
+}
+
+/* =========================
+   Middleware
+   ========================= */
+
+// 缓存响应体的 ResponseWriter
+type idemWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *idemWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idemWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// requestFingerprint 请求指纹。multipart 的 boundary 每次发送都不同，按解析后的字段和各文件内容的
+// SHA-256 计算，重发同一个 FormData 得到相同指纹；表单解析后留给 handler 复用，大文件由 multipart 落盘，
+// 不整体读进内存。其余请求按 Content-Type 与原始请求体计算
+func requestFingerprint(c *gin.Context) (string, error) {
+	h := sha256.New()
+	if c.ContentType() != "multipart/form-data" {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write([]byte(c.ContentType() + "\n"))
+		h.Write(body)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(h, "multipart/form-data")
+	for _, k := range slices.Sorted(maps.Keys(form.Value)) {
+		for _, v := range form.Value[k] {
+			fmt.Fprintf(h, "value %q %q\n", k, v)
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(form.File)) {
+		for _, fh := range form.File[k] {
+			f, err := fh.Open()
+			if err != nil {
+				return "", err
+			}
+			fs := sha256.New()
+			_, err = io.Copy(fs, f)
+			f.Close()
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "file %q %q %x\n", k, fh.Filename, fs.Sum(nil))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotent 未携带 Idempotency-Key 时不做任何处理；
+// 只缓存有响应体的 2xx 响应，失败或没有写出响应时释放 key 以便客户端重试
+func idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(idemHeader))
+		if key == "" || idemRepo == nil {
+			c.Next()
+			return
+		}
+		if len(key) > idemMaxKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Idempotency-Key too long"})
+			return
+		}
+
+		reqHash, err := requestFingerprint(c)
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"ok": false, "error": "request body too large"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"ok": false, "error": "read body failed"})
+			return
+		}
+		// scope 带上调用方身份：不同用户恰好用了同一个 key 时互不影响，也拿不到对方的缓存响应
+		scope := c.Request.Method + " " + c.FullPath() + " " + currentUser(c)
+
+		ctx := c.Request.Context()
+		rec, created, err := idemRepo.Reserve(ctx, key, scope, reqHash)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		if !created {
+			switch {
+			case rec == nil || !rec.Done:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"ok": false, "error": "idempotency_in_progress", "message": "a request with this Idempotency-Key is still being processed"})
+			case rec.ReqHash != reqHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"ok": false, "error": "idempotency_key_reused", "message": "Idempotency-Key was used with a different request body"})
+			default:
+				c.Header(idemReplayedHdr, "true")
+				c.Data(rec.Status, "application/json; charset=utf-8", rec.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		w := &idemWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		// handler panic 时也要释放 key，否则重试会一直得到 idempotency_in_progress 直到过期；释放后继续上抛
+		defer func() {
+			rec := recover()
+			// 客户端可能已断开，用独立 context 落库
+			saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			status := w.Status()
+			if rec == nil && status >= 200 && status < 300 && w.buf.Len() > 0 {
+				if err := idemRepo.Complete(saveCtx, key, scope, status, w.buf.Bytes()); err != nil {
+					log.Println("idempotency complete:", err)
+				}
+				return
+			}
+			if err := idemRepo.Release(saveCtx, key, scope); err != nil {
+				log.Println("idempotency release:", err)
+			}
+			if rec != nil {
+				panic(rec)
+			}
+		}()
+		c.Next()
+	}
+}
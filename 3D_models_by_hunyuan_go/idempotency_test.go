@@ -0,0 +1,171 @@
+// idempotency_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testMultipartContext(t *testing.T, boundary, name string, file []byte) *gin.Context {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteField("name", name)
+	fw, _ := mw.CreateFormFile("file", "model.stl")
+	fw.Write(file)
+	mw.Close()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/api/models/upload", &body)
+	c.Request.Header.Set("Content-Type", mw.FormDataContentType())
+	return c
+}
+
+func TestRequestFingerprintMultipart(t *testing.T) {
+	fp := func(boundary, name string, file []byte) string {
+		c := testMultipartContext(t, boundary, name, file)
+		h, err := requestFingerprint(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 表单留给 handler 复用
+		if c.PostForm("name") != name {
+			t.Fatalf("form not reusable after fingerprint")
+		}
+		return h
+	}
+	base := fp("boundary-one", "cube", []byte("solid cube"))
+	if got := fp("boundary-two", "cube", []byte("solid cube")); got != base {
+		t.Errorf("fingerprint depends on the multipart boundary")
+	}
+	if got := fp("boundary-one", "other", []byte("solid cube")); got == base {
+		t.Errorf("fingerprint ignores form fields")
+	}
+	if got := fp("boundary-one", "cube", []byte("solid other")); got == base {
+		t.Errorf("fingerprint ignores file content")
+	}
+}
+
+func TestRequestFingerprintBody(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/api/submit-text", bytes.NewBufferString(`{"prompt":"cat"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if _, err := requestFingerprint(c); err != nil {
+		t.Fatal(err)
+	}
+	var v struct{ Prompt string }
+	if err := c.ShouldBindJSON(&v); err != nil || v.Prompt != "cat" {
+		t.Fatalf("body not restored: %v %q", err, v.Prompt)
+	}
+}
+
+// memIdemRepo 内存版 IdemRepo
+type memIdemRepo struct {
+	mu   sync.Mutex
+	recs map[string]*IdemRecord
+}
+
+func (r *memIdemRepo) Reserve(ctx context.Context, key, scope, reqHash string) (*IdemRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec, ok := r.recs[scope+" "+key]; ok {
+		cp := *rec
+		return &cp, false, nil
+	}
+	r.recs[scope+" "+key] = &IdemRecord{Key: key, Scope: scope, ReqHash: reqHash, CreatedAt: time.Now()}
+	return nil, true, nil
+}
+
+func (r *memIdemRepo) Complete(ctx context.Context, key, scope string, status int, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec, ok := r.recs[scope+" "+key]; ok {
+		rec.Done, rec.Status, rec.Body = true, status, append([]byte(nil), body...)
+	}
+	return nil
+}
+
+func (r *memIdemRepo) Release(ctx context.Context, key, scope string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.recs, scope+" "+key)
+	return nil
+}
+
+func (r *memIdemRepo) Purge(ctx context.Context, before time.Time) (int64, error) { return 0, nil }
+
+// testIdemServer 装上 idempotent 的路由，handler 由调用方给出
+func testIdemServer(t *testing.T, h gin.HandlerFunc) *gin.Engine {
+	t.Helper()
+	old := idemRepo
+	idemRepo = &memIdemRepo{recs: map[string]*IdemRecord{}}
+	t.Cleanup(func() { idemRepo = old })
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/submit", idempotent(), h)
+	return r
+}
+
+func testIdemPost(r http.Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/submit", bytes.NewBufferString(`{"prompt":"cat"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idemHeader, "k1")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// handler 没写响应体（如客户端断开）时不能把空 200 存成结果
+func TestIdempotentEmptyResponseReleased(t *testing.T) {
+	calls := 0
+	r := testIdemServer(t, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "job_id": "j1"})
+	})
+	testIdemPost(r)
+	w := testIdemPost(r)
+	if calls != 2 || !bytes.Contains(w.Body.Bytes(), []byte("j1")) {
+		t.Fatalf("retry after empty response: calls=%d body=%q", calls, w.Body.String())
+	}
+	w = testIdemPost(r)
+	if calls != 2 || w.Header().Get(idemReplayedHdr) != "true" {
+		t.Errorf("completed response not replayed: calls=%d", calls)
+	}
+}
+
+func TestIdempotentPanicReleased(t *testing.T) {
+	calls := 0
+	r := testIdemServer(t, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("sdk nil deref")
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "job_id": "j1"})
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic swallowed by idempotent()")
+			}
+		}()
+		testIdemPost(r)
+	}()
+	if w := testIdemPost(r); w.Code != http.StatusOK || calls != 2 {
+		t.Fatalf("retry after panic: status %d, calls %d: %s", w.Code, calls, w.Body.String())
+	}
+}
@@ -0,0 +1,673 @@
+// integrity.go
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+/* =========================
+   产物完整性校验
+   ========================= */
+
+// 入库的文件按魔数识别真实格式并做结构校验（截断、HTML 错误页等），同时计算 SHA-256。
+// 校验失败的文件移入 quarantine/ 并删除原对象，由调用方重新拉取，不会被当作模型输出。
+var ErrCorruptArtifact = errors.New("artifact corrupt")
+
+var verifyGroup singleflight.Group
+
+type verifyResult struct {
+	SHA256 string
+	Format string
+	Size   int64
+}
+
+// 各扩展名可接受的实际格式；zip 包里装 OBJ/MTL/贴图是腾讯云的常见返回
+var acceptFormats = map[string][]string{
+	"glb":  {"glb"},
+	"gltf": {"gltf"},
+	"obj":  {"obj", "zip"},
+	"zip":  {"zip", "usdz"},
+	"fbx":  {"fbx"},
+	"usdz": {"usdz"},
+	"stl":  {"stl"},
+	"ply":  {"ply"},
+	"png":  {"png"},
+	"jpg":  {"jpeg"},
+	"jpeg": {"jpeg"},
+	"webp": {"webp"},
+	"gif":  {"gif"},
+}
+
+// imageFormats 预览图的 key 扩展名取自上游地址，地址没有或写错扩展名时 key 默认 .png，
+// 实际可能是 JPEG/WebP；图片之间互相视为匹配，按识别出的格式输出 Content-Type
+var imageFormats = map[string]bool{"png": true, "jpeg": true, "webp": true, "gif": true}
+
+// verifyArtifact 校验存储中的 key；同一内容只校验一次（结果记在 artifacts 表）
+func verifyArtifact(ctx context.Context, jobID string, idx int, kind, key string, info *ArtifactInfo) (*verifyResult, error) {
+	if a, err := artifactRepo.Get(ctx, jobID, idx, kind); err == nil && a != nil &&
+		a.SHA256 != "" && a.Format != "" && a.Key == key && a.Size == info.Size {
+		return &verifyResult{SHA256: a.SHA256, Format: a.Format, Size: a.Size}, nil
+	}
+
+	v, err, _ := verifyGroup.Do(key, func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		res, err := checkStored(ctx, key)
+		if errors.Is(err, ErrCorruptArtifact) {
+			quarantineArtifact(ctx, key, err.Error())
+			_ = artifactRepo.MarkCorrupt(ctx, jobID, idx, kind, err.Error())
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := artifactRepo.SetDigest(ctx, jobID, idx, kind, key, res.Size, res.SHA256, res.Format); err != nil {
+			log.Printf("verify %s: %v\n", key, err)
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*verifyResult), nil
+}
+
+// checkStored 读取对象：顺序读一遍算哈希，再按格式随机读做结构校验
+func checkStored(ctx context.Context, key string) (*verifyResult, error) {
+	rc, info, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	ra, ok := rc.(io.ReaderAt)
+	if !ok {
+		// 远端对象不支持随机读时落一份临时文件
+		tmp, err := os.CreateTemp("", "verify-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, rc); err != nil {
+			return nil, err
+		}
+		ra = tmp
+	} else if _, err := rc.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.NewSectionReader(ra, 0, info.Size))
+	if err != nil {
+		return nil, err
+	}
+	if n != info.Size {
+		return nil, fmt.Errorf("%w: short read %d/%d", ErrCorruptArtifact, n, info.Size)
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(key)), ".")
+	format, err := validateFormat(ra, info.Size, ext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptArtifact, err)
+	}
+	return &verifyResult{SHA256: hex.EncodeToString(h.Sum(nil)), Format: format, Size: info.Size}, nil
+}
+
+// quarantineArtifact 保留一份证据后删除原对象
+func quarantineArtifact(ctx context.Context, key, reason string) {
+	if rc, info, err := store.Get(ctx, key); err == nil {
+		qkey := "quarantine/" + time.Now().UTC().Format("20060102T150405") + "_" + key
+		if _, err := store.Put(ctx, qkey, rc, info.Size, info.ContentType); err != nil {
+			log.Printf("quarantine %s: %v\n", key, err)
+		}
+		rc.Close()
+	}
+	if err := store.Delete(ctx, key); err != nil && !errors.Is(err, ErrArtifactNotFound) {
+		log.Printf("quarantine %s: delete: %v\n", key, err)
+	}
+	log.Printf("quarantined %s: %s\n", key, reason)
+}
+
+/* =========================
+   格式识别与结构校验
+   ========================= */
+
+// sniffFormat 根据文件头识别格式
+func sniffFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("glTF")):
+		return "glb"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return "zip"
+	case bytes.HasPrefix(head, []byte("Kaydara FBX Binary  \x00")), bytes.HasPrefix(head, []byte("; FBX")):
+		return "fbx"
+	case bytes.HasPrefix(head, []byte("ply\n")), bytes.HasPrefix(head, []byte("ply\r\n")):
+		return "ply"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return "jpeg"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		return "webp"
+	case bytes.HasPrefix(head, []byte("GIF8")):
+		return "gif"
+	}
+
+	text := bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	lower := bytes.ToLower(text)
+	switch {
+	case bytes.HasPrefix(lower, []byte("<!doctype")), bytes.HasPrefix(lower, []byte("<html")), bytes.HasPrefix(lower, []byte("<?xml")):
+		return "html"
+	case bytes.HasPrefix(text, []byte("{")):
+		return "gltf"
+	case bytes.HasPrefix(lower, []byte("solid")):
+		return "stl"
+	case bytes.IndexByte(head, 0) < 0 && looksLikeOBJ(text):
+		return "obj"
+	}
+	if len(head) >= 84 {
+		return "stl" // 二进制 STL 没有魔数，交给结构校验判断
+	}
+	return "unknown"
+}
+
+func looksLikeOBJ(text []byte) bool {
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		f := bytes.Fields(line)
+		if len(f) == 0 || f[0][0] == '#' {
+			continue
+		}
+		switch string(f[0]) {
+		case "v", "vn", "vt", "f", "o", "g", "s", "mtllib", "usemtl":
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// validateFormat 识别格式并校验结构，返回实际格式；ext 为期望的扩展名
+func validateFormat(ra io.ReaderAt, size int64, ext string) (string, error) {
+	if size == 0 {
+		return "", errors.New("empty file")
+	}
+	head := make([]byte, 512)
+	n, err := ra.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	format := sniffFormat(head)
+	switch format {
+	case "html":
+		return "", errors.New("got an HTML/XML error page instead of a model")
+	case "unknown":
+		return "", errors.New("unrecognized file format")
+	}
+
+	if want, ok := acceptFormats[ext]; ok {
+		matched := imageFormats[format] && imageFormats[want[0]]
+		for _, w := range want {
+			// zip 内是否为 USDZ 要解开后才知道
+			if w == format || (w == "usdz" && format == "zip") {
+				matched = true
+			}
+		}
+		if !matched {
+			return "", fmt.Errorf("expected %s, got %s", ext, format)
+		}
+	}
+
+	switch format {
+	case "glb":
+		err = checkGLB(ra, size)
+	case "gltf":
+		err = checkGLTF(io.NewSectionReader(ra, 0, size))
+	case "zip":
+		format, err = checkZip(ra, size)
+		if err == nil && ext == "usdz" && format != "usdz" {
+			err = errors.New("zip archive is not a USDZ package")
+		}
+	case "obj":
+		err = checkOBJ(io.NewSectionReader(ra, 0, size))
+	case "fbx":
+		if bytes.HasPrefix(head, []byte("Kaydara")) {
+			err = checkFBX(ra, size)
+		}
+	case "stl":
+		err = checkSTL(ra, size, head)
+	case "ply":
+		err = checkPLY(io.NewSectionReader(ra, 0, size), size)
+	default:
+		err = checkImage(ra, size, format)
+	}
+	return format, err
+}
+
+type gltfDoc struct {
+	Asset *struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	Buffers []struct {
+		ByteLength int64  `json:"byteLength"`
+		URI        string `json:"uri"`
+	} `json:"buffers"`
+}
+
+// checkGLB 校验 GLB 头、声明长度、各 chunk 边界以及 JSON 中的 buffer 长度
+func checkGLB(ra io.ReaderAt, size int64) error {
+	var h [20]byte
+	if size < 20 {
+		return errors.New("glb: too short")
+	}
+	if _, err := ra.ReadAt(h[:], 0); err != nil {
+		return err
+	}
+	if v := binary.LittleEndian.Uint32(h[4:8]); v != 2 {
+		return fmt.Errorf("glb: unsupported version %d", v)
+	}
+	if l := int64(binary.LittleEndian.Uint32(h[8:12])); l != size {
+		return fmt.Errorf("glb: header length %d, file size %d (truncated?)", l, size)
+	}
+	jsonLen := int64(binary.LittleEndian.Uint32(h[12:16]))
+	if string(h[16:20]) != "JSON" || 20+jsonLen > size {
+		return errors.New("glb: missing or oversized JSON chunk")
+	}
+	var doc gltfDoc
+	if err := json.NewDecoder(io.NewSectionReader(ra, 20, jsonLen)).Decode(&doc); err != nil {
+		return fmt.Errorf("glb: bad JSON chunk: %v", err)
+	}
+	if doc.Asset == nil {
+		return errors.New("glb: JSON chunk has no asset")
+	}
+
+	binLen := int64(-1)
+	off := 20 + jsonLen
+	for off < size {
+		var ch [8]byte
+		if off+8 > size {
+			return errors.New("glb: truncated chunk header")
+		}
+		if _, err := ra.ReadAt(ch[:], off); err != nil {
+			return err
+		}
+		l := int64(binary.LittleEndian.Uint32(ch[0:4]))
+		if off+8+l > size {
+			return errors.New("glb: chunk exceeds file size")
+		}
+		if string(ch[4:8]) == "BIN\x00" && binLen < 0 {
+			binLen = l
+		}
+		off += 8 + l
+	}
+	if len(doc.Buffers) > 0 && doc.Buffers[0].URI == "" && doc.Buffers[0].ByteLength > binLen {
+		return fmt.Errorf("glb: buffer 0 needs %d bytes, BIN chunk has %d", doc.Buffers[0].ByteLength, binLen)
+	}
+	return nil
+}
+
+func checkGLTF(r io.Reader) error {
+	var doc gltfDoc
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return fmt.Errorf("gltf: %v", err)
+	}
+	if doc.Asset == nil {
+		return errors.New("gltf: no asset")
+	}
+	return nil
+}
+
+// checkZip 逐个解压以校验 CRC；返回 usdz 或 zip
+func checkZip(ra io.ReaderAt, size int64) (string, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return "", fmt.Errorf("zip: %v", err)
+	}
+	if len(zr.File) == 0 {
+		return "", errors.New("zip: empty archive")
+	}
+	hasModel := false
+	budget := newZipBudget()
+	for _, f := range zr.File {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".obj", ".glb", ".gltf", ".fbx", ".stl", ".usd", ".usda", ".usdc":
+			hasModel = true
+		}
+		// 逐个解压校验 CRC，总量受额度限制，压缩炸弹不会耗尽 CPU
+		if err := budget.copy(io.Discard, f); err != nil {
+			return "", err
+		}
+	}
+	if !hasModel {
+		return "", errors.New("zip: no model file inside")
+	}
+	switch strings.ToLower(path.Ext(zr.File[0].Name)) {
+	case ".usd", ".usda", ".usdc":
+		return "usdz", nil
+	}
+	return "zip", nil
+}
+
+// checkOBJ 逐行解析顶点和面，面索引必须落在已声明的顶点范围内
+func checkOBJ(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	verts, faces, line := 0, 0, 0
+	for sc.Scan() {
+		line++
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "v":
+			if len(f) < 4 {
+				return fmt.Errorf("obj: line %d: vertex needs 3 coordinates", line)
+			}
+			for _, s := range f[1:4] {
+				if _, err := strconv.ParseFloat(s, 64); err != nil {
+					return fmt.Errorf("obj: line %d: bad coordinate %q", line, s)
+				}
+			}
+			verts++
+		case "f":
+			if len(f) < 4 {
+				return fmt.Errorf("obj: line %d: face needs 3 vertices", line)
+			}
+			for _, s := range f[1:] {
+				vi, err := strconv.Atoi(strings.SplitN(s, "/", 2)[0])
+				if err != nil || vi == 0 || vi > verts || -vi > verts {
+					return fmt.Errorf("obj: line %d: bad vertex index %q", line, s)
+				}
+			}
+			faces++
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("obj: %v", err)
+	}
+	if verts < 3 || faces == 0 {
+		return fmt.Errorf("obj: no geometry (%d vertices, %d faces)", verts, faces)
+	}
+	return nil
+}
+
+// checkFBX 沿顶层节点的 EndOffset 链走到空记录，截断的文件会越界
+func checkFBX(ra io.ReaderAt, size int64) error {
+	var h [27]byte
+	if size < 27 {
+		return errors.New("fbx: too short")
+	}
+	if _, err := ra.ReadAt(h[:], 0); err != nil {
+		return err
+	}
+	version := binary.LittleEndian.Uint32(h[23:27])
+	wide := version >= 7500
+	recLen := int64(13)
+	if wide {
+		recLen = 25
+	}
+
+	off := int64(27)
+	for {
+		if off+recLen > size {
+			return errors.New("fbx: truncated node record")
+		}
+		rec := make([]byte, recLen)
+		if _, err := ra.ReadAt(rec, off); err != nil {
+			return err
+		}
+		var end int64
+		if wide {
+			end = int64(binary.LittleEndian.Uint64(rec[0:8]))
+		} else {
+			end = int64(binary.LittleEndian.Uint32(rec[0:4]))
+		}
+		if end == 0 {
+			return nil // 空记录：顶层节点结束
+		}
+		if end <= off || end > size {
+			return fmt.Errorf("fbx: node at %d ends at %d beyond file size %d", off, end, size)
+		}
+		off = end
+	}
+}
+
+// checkSTL 二进制 STL 的大小必须等于 84 + 50*三角形数
+func checkSTL(ra io.ReaderAt, size int64, head []byte) error {
+	if bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace(head)), []byte("solid")) {
+		tail := make([]byte, min(size, 256))
+		if _, err := ra.ReadAt(tail, size-int64(len(tail))); err != nil && err != io.EOF {
+			return err
+		}
+		if bytes.Contains(bytes.ToLower(tail), []byte("endsolid")) {
+			return nil
+		}
+		// 有些二进制 STL 头部也以 solid 开头，按二进制再判断一次
+	}
+	if size < 84 {
+		return errors.New("stl: too short")
+	}
+	var cnt [4]byte
+	if _, err := ra.ReadAt(cnt[:], 80); err != nil {
+		return err
+	}
+	if want := 84 + 50*int64(binary.LittleEndian.Uint32(cnt[:])); want != size {
+		return fmt.Errorf("stl: expected %d bytes for the triangle count, got %d", want, size)
+	}
+	return nil
+}
+
+// PLY 标量类型的字节数
+var plyTypeSize = map[string]int{
+	"char": 1, "uchar": 1, "int8": 1, "uint8": 1, "short": 2, "ushort": 2, "int16": 2, "uint16": 2,
+	"int": 4, "uint": 4, "int32": 4, "uint32": 4, "float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+type plyProp struct {
+	list      bool
+	countType string
+	typ       string
+}
+
+type plyElement struct {
+	name  string
+	count int
+	props []plyProp
+}
+
+// checkPLY 解析头部；二进制小端格式逐元素走一遍，确认数据长度与头部声明一致
+func checkPLY(r io.Reader, size int64) error {
+	br := bufio.NewReader(r)
+	var elems []*plyElement
+	format := ""
+	hdr := int64(0)
+	for {
+		line, err := br.ReadString('\n')
+		hdr += int64(len(line))
+		if err != nil {
+			return errors.New("ply: header not terminated by end_header")
+		}
+		if hdr > 64<<10 {
+			return errors.New("ply: header too large")
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "format":
+			if len(f) < 2 {
+				return errors.New("ply: bad format line")
+			}
+			format = f[1]
+		case "element":
+			if len(f) < 3 {
+				return errors.New("ply: bad element line")
+			}
+			n, err := strconv.Atoi(f[2])
+			if err != nil || n < 0 {
+				return fmt.Errorf("ply: bad element count %q", f[2])
+			}
+			elems = append(elems, &plyElement{name: f[1], count: n})
+		case "property":
+			if len(elems) == 0 {
+				return errors.New("ply: property before element")
+			}
+			e := elems[len(elems)-1]
+			if len(f) >= 5 && f[1] == "list" {
+				if plyTypeSize[f[2]] == 0 || plyTypeSize[f[3]] == 0 {
+					return fmt.Errorf("ply: unknown list type %s %s", f[2], f[3])
+				}
+				e.props = append(e.props, plyProp{list: true, countType: f[2], typ: f[3]})
+			} else if len(f) >= 3 && plyTypeSize[f[1]] > 0 {
+				e.props = append(e.props, plyProp{typ: f[1]})
+			} else {
+				return fmt.Errorf("ply: bad property line %q", strings.TrimSpace(line))
+			}
+		case "end_header":
+			return checkPLYBody(br, format, elems, size-hdr)
+		}
+	}
+}
+
+func checkPLYBody(br *bufio.Reader, format string, elems []*plyElement, remain int64) error {
+	switch format {
+	case "ascii":
+		want := 0
+		for _, e := range elems {
+			want += e.count
+		}
+		lines := 0
+		sc := bufio.NewScanner(br)
+		sc.Buffer(make([]byte, 64<<10), 4<<20)
+		for sc.Scan() {
+			if len(bytes.TrimSpace(sc.Bytes())) > 0 {
+				lines++
+			}
+		}
+		if lines < want {
+			return fmt.Errorf("ply: expected %d data lines, got %d", want, lines)
+		}
+		return nil
+	case "binary_little_endian", "binary_big_endian":
+	default:
+		return fmt.Errorf("ply: unknown format %q", format)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if format == "binary_big_endian" {
+		order = binary.BigEndian
+	}
+	read := int64(0)
+	buf := make([]byte, 8)
+	for _, e := range elems {
+		fixed := true
+		stride := int64(0)
+		for _, p := range e.props {
+			if p.list {
+				fixed = false
+			}
+			stride += int64(plyTypeSize[p.typ])
+		}
+		if fixed {
+			n := stride * int64(e.count)
+			if read+n > remain {
+				return fmt.Errorf("ply: element %s truncated", e.name)
+			}
+			if _, err := br.Discard(int(n)); err != nil {
+				return fmt.Errorf("ply: element %s truncated", e.name)
+			}
+			read += n
+			continue
+		}
+		for i := 0; i < e.count; i++ {
+			for _, p := range e.props {
+				if !p.list {
+					if _, err := br.Discard(plyTypeSize[p.typ]); err != nil {
+						return fmt.Errorf("ply: element %s truncated", e.name)
+					}
+					read += int64(plyTypeSize[p.typ])
+					continue
+				}
+				cs := plyTypeSize[p.countType]
+				if _, err := io.ReadFull(br, buf[:cs]); err != nil {
+					return fmt.Errorf("ply: element %s truncated", e.name)
+				}
+				var cnt uint64
+				switch cs {
+				case 1:
+					cnt = uint64(buf[0])
+				case 2:
+					cnt = uint64(order.Uint16(buf))
+				case 4:
+					cnt = uint64(order.Uint32(buf))
+				default:
+					cnt = order.Uint64(buf)
+				}
+				n := int64(cnt) * int64(plyTypeSize[p.typ])
+				if n < 0 || read+int64(cs)+n > remain {
+					return fmt.Errorf("ply: element %s truncated", e.name)
+				}
+				if _, err := br.Discard(int(n)); err != nil {
+					return fmt.Errorf("ply: element %s truncated", e.name)
+				}
+				read += int64(cs) + n
+			}
+		}
+	}
+	if read != remain {
+		return fmt.Errorf("ply: %d trailing bytes after declared elements", remain-read)
+	}
+	return nil
+}
+
+// checkImage 预览图只检查尾部标记，足以识别截断
+func checkImage(ra io.ReaderAt, size int64, format string) error {
+	tail := make([]byte, min(size, 16))
+	if _, err := ra.ReadAt(tail, size-int64(len(tail))); err != nil && err != io.EOF {
+		return err
+	}
+	switch format {
+	case "png":
+		if !bytes.Contains(tail, []byte("IEND")) {
+			return errors.New("png: missing IEND (truncated?)")
+		}
+	case "jpeg":
+		if !bytes.Contains(tail, []byte("\xff\xd9")) {
+			return errors.New("jpeg: missing EOI marker (truncated?)")
+		}
+	case "webp":
+		var h [8]byte
+		if _, err := ra.ReadAt(h[:], 0); err != nil {
+			return err
+		}
+		if l := int64(binary.LittleEndian.Uint32(h[4:8])) + 8; l != size && l+1 != size {
+			return fmt.Errorf("webp: RIFF length %d, file size %d", l, size)
+		}
+	case "gif":
+		if tail[len(tail)-1] != 0x3b {
+			return errors.New("gif: missing trailer (truncated?)")
+		}
+	}
+	return nil
+}
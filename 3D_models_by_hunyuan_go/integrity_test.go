@@ -0,0 +1,115 @@
+// integrity_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	jpegenc "image/jpeg"
+	"strings"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	for head, want := range map[string]string{
+		"glTF\x02\x00\x00\x00":                "glb",
+		"PK\x03\x04rest":                      "zip",
+		"Kaydara FBX Binary  \x00\x1a\x00":    "fbx",
+		"; FBX 7.4.0 project file":            "fbx",
+		"ply\nformat ascii 1.0\n":             "ply",
+		"\x89PNG\r\n\x1a\n":                   "png",
+		"\xff\xd8\xff\xe0":                    "jpeg",
+		"RIFF\x10\x00\x00\x00WEBPVP8 ":        "webp",
+		"GIF89a":                              "gif",
+		"\xef\xbb\xbf<!DOCTYPE html><html>":   "html",
+		"  <?xml version=\"1.0\"?><Error>":    "html",
+		`{"asset":{"version":"2.0"}}`:         "gltf",
+		"solid cube\nfacet normal 0 0 1\n":    "stl",
+		"# exported\nmtllib a.mtl\nv 0 0 0\n": "obj",
+		"hello world":                         "unknown",
+		"RIFF\x10\x00\x00\x00WAVE":            "unknown",
+		string(make([]byte, 84)):              "stl",
+	} {
+		if got := sniffFormat([]byte(head)); got != want {
+			t.Errorf("sniffFormat(%.24q) = %q, want %q", head, got, want)
+		}
+	}
+}
+
+func TestValidateFormatModels(t *testing.T) {
+	var glb, stl, ply bytes.Buffer
+	if err := WriteGLB(&glb, cubeTestScene()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSTL(&stl, cubeTestScene(), "cube"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePLY(&ply, cubeTestScene(), "cube"); err != nil {
+		t.Fatal(err)
+	}
+	obj := []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")
+	for _, tc := range []struct {
+		ext, want string
+		data      []byte
+	}{
+		{"glb", "glb", glb.Bytes()},
+		{"gltf", "gltf", testTriangleGLTF(t, nil)},
+		{"stl", "stl", stl.Bytes()},
+		{"ply", "ply", ply.Bytes()},
+		{"obj", "obj", obj},
+		{"", "glb", glb.Bytes()}, // 未知扩展名只识别不比对
+	} {
+		got, err := validateFormat(bytes.NewReader(tc.data), int64(len(tc.data)), tc.ext)
+		if err != nil || got != tc.want {
+			t.Errorf(".%s: got %q, %v, want %q", tc.ext, got, err, tc.want)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		ext, msg string
+		data     []byte
+	}{
+		"empty":         {"glb", "empty", nil},
+		"truncated glb": {"glb", "truncated", glb.Bytes()[:glb.Len()-8]},
+		"glb as stl":    {"stl", "expected stl", glb.Bytes()},
+		"truncated stl": {"stl", "", stl.Bytes()[:stl.Len()-10]},
+		"unknown":       {"glb", "unrecognized", []byte("hello")},
+	} {
+		_, err := validateFormat(bytes.NewReader(tc.data), int64(len(tc.data)), tc.ext)
+		if err == nil || !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("%s: err = %v, want containing %q", name, err, tc.msg)
+		}
+	}
+}
+
+func TestValidateFormatPreviewImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpegenc.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	jpeg := buf.Bytes()
+	webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), make([]byte, 64)...)
+	binary.LittleEndian.PutUint32(webp[4:], uint32(len(webp)-8))
+	for _, tc := range []struct {
+		ext, want string
+		data      []byte
+	}{
+		{"png", "jpeg", jpeg}, // 预览地址没有扩展名，key 默认 .png
+		{"png", "webp", webp},
+		{"jpg", "webp", webp},
+		{"jpeg", "jpeg", jpeg},
+	} {
+		got, err := validateFormat(bytes.NewReader(tc.data), int64(len(tc.data)), tc.ext)
+		if err != nil || got != tc.want {
+			t.Errorf(".%s with %s bytes: got %q, %v", tc.ext, tc.want, got, err)
+		}
+	}
+
+	html := []byte("<!DOCTYPE html><html><body>AccessDenied</body></html>")
+	if _, err := validateFormat(bytes.NewReader(html), int64(len(html)), "png"); err == nil {
+		t.Error("HTML error page accepted as a preview image")
+	}
+	if _, err := validateFormat(bytes.NewReader(jpeg), int64(len(jpeg)), "glb"); err == nil {
+		t.Error("image accepted as a GLB model")
+	}
+}
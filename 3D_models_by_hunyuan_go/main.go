@@ -13,7 +13,7 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -47,20 +47,90 @@ type ResultFile struct {
 	Type            string `json:"Type"`
 	Url             string `json:"Url"`
 	PreviewImageUrl string `json:"PreviewImageUrl,omitempty"`
+
+	// 镜像到自有存储后 Url/PreviewImageUrl 改写为永久地址，腾讯云的临时地址保留在 Source* 中
+	SourceUrl        string `json:"SourceUrl,omitempty"`
+	SourcePreviewUrl string `json:"SourcePreviewUrl,omitempty"`
+	Key              string `json:"Key,omitempty"`        // 模型在 artifact 存储中的 key
+	PreviewKey       string `json:"PreviewKey,omitempty"` // 预览图在 artifact 存储中的 key
+}
+
+// sourceURL 返回可从 provider 拉取的原始地址
+func (f ResultFile) sourceURL() string {
+	if f.SourceUrl != "" {
+		return f.SourceUrl
+	}
+	return f.Url
+}
+
+func (f ResultFile) sourcePreviewURL() string {
+	if f.SourcePreviewUrl != "" {
+		return f.SourcePreviewUrl
+	}
+	return f.PreviewImageUrl
 }
 
 type JobMeta struct {
 	JobID     string       `json:"job_id"`
+	Owner     string       `json:"owner,omitempty"`
 	Status    string       `json:"status"` // WAIT | RUN | DONE | FAIL
 	Files     []ResultFile `json:"files"`
 	Error     string       `json:"error"`
+	Params    *JobParams   `json:"params,omitempty"`
+	Stats     []*MeshStats `json:"stats,omitempty"` // 仅列表/状态接口填充
 	CreatedAt time.Time    `json:"created_at"`
 	UpdatedAt time.Time    `json:"updated_at"`
 }
 
+// JobParams 提交时的参数，随 job 保存（图片只记来源，不存内容）
+type JobParams struct {
+	Mode         string `json:"mode"` // text | image | image_url | upload
+	Prompt       string `json:"prompt,omitempty"`
+	PromptUsed   string `json:"prompt_used,omitempty"`
+	Polished     bool   `json:"polished,omitempty"`
+	ImageURL     string `json:"image_url,omitempty"`
+	ImageName    string `json:"image_name,omitempty"`
+	EnablePBR    *bool  `json:"enable_pbr,omitempty"`
+	FaceCount    *int64 `json:"face_count,omitempty"`
+	GenerateType string `json:"generate_type,omitempty"`
+
+	// 用户上传的模型（mode=upload）
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	FileName    string `json:"file_name,omitempty"`
+}
+
+type JobFilter struct {
+	// Owner 为空时只返回匿名提交的任务；AllOwners 忽略 Owner 返回所有人的任务，仅供内部调用（TrackActive 等）
+	Owner     string
+	AllOwners bool
+	Statuses  []string
+	Limit     int
+
+	// 按网格统计过滤：至少有一个文件满足全部条件，0 / nil / 空串表示不限
+	MinFaces    int64
+	MaxFaces    int64
+	MinVertices int64
+	MaxVertices int64
+	HasTextures *bool
+	Format      string
+}
+
+func (f JobFilter) byStats() bool {
+	return f.MinFaces > 0 || f.MaxFaces > 0 || f.MinVertices > 0 || f.MaxVertices > 0 || f.HasTextures != nil || f.Format != ""
+}
+
 type JobRepo interface {
-	Upsert(ctx context.Context, jobID, status string, files []ResultFile, errStr string) error
+	// Create 登记新提交的任务（状态 WAIT）
+	Create(ctx context.Context, jobID, owner string, params *JobParams) error
+	// Upsert 写入上游查询结果。files 为上游返回的列表，在行锁内与库中已镜像的条目逐个合并（见 mergeFiles），返回合并后的列表
+	Upsert(ctx context.Context, jobID, status string, files []ResultFile, errStr string) ([]ResultFile, error)
 	Get(ctx context.Context, jobID string) (*JobMeta, error)
+	// QueuePosition 返回排在该 job 之前、仍处于 WAIT 的本地任务数
+	QueuePosition(ctx context.Context, jobID string) (int, error)
+	List(ctx context.Context, f JobFilter) ([]JobMeta, error)
+	// MergeMirrored 在行锁内把镜像得到的永久地址逐个文件并入当前列表（见 mergeMirrored），返回合并后的列表
+	MergeMirrored(ctx context.Context, jobID string, files []ResultFile) ([]ResultFile, error)
 }
 
 /* =========================
@@ -71,9 +141,35 @@ type pgJobRepo struct{ db *sql.DB }
 
 func NewPGJobRepo(db *sql.DB) JobRepo { return &pgJobRepo{db: db} }
 
-func (r *pgJobRepo) Upsert(ctx context.Context, jobID, status string, files []ResultFile, errStr string) error {
-	b, _ := json.Marshal(files)
+func (r *pgJobRepo) Create(ctx context.Context, jobID, owner string, params *JobParams) error {
+	var p any
+	if params != nil {
+		b, _ := json.Marshal(params)
+		p = string(b)
+	}
 	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO jobs (job_id, status, owner, params)
+		VALUES ($1, 'WAIT', NULLIF($2,''), $3::jsonb)
+		ON CONFLICT (job_id) DO NOTHING
+	`, jobID, owner, p)
+	return err
+}
+
+// Upsert 和 MergeMirrored 都是“读出文件列表、合并、写回”，镜像和上游轮询并发时必须串行，
+// 否则后写的一方会用旧快照覆盖对方刚写入的字段（如镜像得到的永久地址）
+func (r *pgJobRepo) Upsert(ctx context.Context, jobID, status string, files []ResultFile, errStr string) ([]ResultFile, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	cur, err := lockJobFiles(ctx, tx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	merged := mergeFiles(cur, files)
+	b, _ := json.Marshal(merged)
+	_, err = tx.ExecContext(ctx, `
 		INSERT INTO jobs (job_id, status, files, error)
 		VALUES ($1, $2, $3::jsonb, NULLIF($4,''))
 		ON CONFLICT (job_id) DO UPDATE
@@ -82,16 +178,56 @@ func (r *pgJobRepo) Upsert(ctx context.Context, jobID, status string, files []Re
 		    error  = EXCLUDED.error,
 		    updated_at = now()
 	`, jobID, status, string(b), errStr)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	return merged, tx.Commit()
+}
+
+func (r *pgJobRepo) MergeMirrored(ctx context.Context, jobID string, files []ResultFile) ([]ResultFile, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	cur, err := lockJobFiles(ctx, tx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	merged := mergeMirrored(cur, files)
+	b, _ := json.Marshal(merged)
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE jobs SET files = $2::jsonb, updated_at = now() WHERE job_id = $1
+	`, jobID, string(b)); err != nil {
+		return nil, err
+	}
+	return merged, tx.Commit()
+}
+
+// lockJobFiles 锁住任务行并读出文件列表；行不存在时返回 nil
+func lockJobFiles(ctx context.Context, tx *sql.Tx, jobID string) ([]ResultFile, error) {
+	var raw []byte
+	err := tx.QueryRowContext(ctx, `SELECT files FROM jobs WHERE job_id = $1 FOR UPDATE`, jobID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []ResultFile
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &files)
+	}
+	return files, nil
 }
 
 func (r *pgJobRepo) Get(ctx context.Context, jobID string) (*JobMeta, error) {
 	var jm JobMeta
-	var filesJSON []byte
+	var filesJSON, paramsJSON []byte
 	err := r.db.QueryRowContext(ctx, `
-		SELECT job_id, status, files, COALESCE(error,''), created_at, updated_at
+		SELECT job_id, COALESCE(owner,''), status, files, COALESCE(error,''), params, created_at, updated_at
 		FROM jobs WHERE job_id = $1
-	`, jobID).Scan(&jm.JobID, &jm.Status, &filesJSON, &jm.Error, &jm.CreatedAt, &jm.UpdatedAt)
+	`, jobID).Scan(&jm.JobID, &jm.Owner, &jm.Status, &filesJSON, &jm.Error, &paramsJSON, &jm.CreatedAt, &jm.UpdatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -101,9 +237,76 @@ func (r *pgJobRepo) Get(ctx context.Context, jobID string) (*JobMeta, error) {
 	if len(filesJSON) > 0 {
 		_ = json.Unmarshal(filesJSON, &jm.Files)
 	}
+	if len(paramsJSON) > 0 {
+		jm.Params = &JobParams{}
+		_ = json.Unmarshal(paramsJSON, jm.Params)
+	}
 	return &jm, nil
 }
 
+func (r *pgJobRepo) QueuePosition(ctx context.Context, jobID string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM jobs
+		WHERE status = 'WAIT'
+		  AND created_at < (SELECT created_at FROM jobs WHERE job_id = $1)
+	`, jobID).Scan(&n)
+	return n, err
+}
+
+func (r *pgJobRepo) List(ctx context.Context, f JobFilter) ([]JobMeta, error) {
+	limit := f.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var statuses any
+	if len(f.Statuses) > 0 {
+		statuses = f.Statuses
+	}
+	var hasTex any
+	if f.HasTextures != nil {
+		hasTex = *f.HasTextures
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT job_id, COALESCE(owner,''), status, files, COALESCE(error,''), params, created_at, updated_at
+		FROM jobs
+		WHERE ($11::bool OR COALESCE(owner,'') = $1)
+		  AND ($2::text[] IS NULL OR status = ANY($2::text[]))
+		  AND (NOT $4::bool OR EXISTS (
+		      SELECT 1 FROM mesh_stats s
+		      WHERE s.job_id = jobs.job_id AND s.error IS NULL
+		        AND ($5::bigint = 0 OR s.faces >= $5) AND ($6::bigint = 0 OR s.faces <= $6)
+		        AND ($7::bigint = 0 OR s.vertices >= $7) AND ($8::bigint = 0 OR s.vertices <= $8)
+		        AND ($9::bool IS NULL OR (s.textures > 0) = $9::bool)
+		        AND ($10 = '' OR s.format = $10)
+		  ))
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, f.Owner, statuses, limit, f.byStats(), f.MinFaces, f.MaxFaces, f.MinVertices, f.MaxVertices, hasTex, f.Format, f.AllOwners)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []JobMeta
+	for rows.Next() {
+		var jm JobMeta
+		var filesJSON, paramsJSON []byte
+		if err := rows.Scan(&jm.JobID, &jm.Owner, &jm.Status, &filesJSON, &jm.Error, &paramsJSON, &jm.CreatedAt, &jm.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if len(filesJSON) > 0 {
+			_ = json.Unmarshal(filesJSON, &jm.Files)
+		}
+		if len(paramsJSON) > 0 {
+			jm.Params = &JobParams{}
+			_ = json.Unmarshal(paramsJSON, jm.Params)
+		}
+		out = append(out, jm)
+	}
+	return out, rows.Err()
+}
+
 /* =========================
    Env / DB Init
    ========================= */
@@ -119,6 +322,15 @@ func createTable(db *sql.DB) error {
 			updated_at TIMESTAMPTZ DEFAULT NOW()
 		)
 	`)
+	if err != nil {
+		return err
+	}
+	// 兼容旧表：按需补列
+	_, err = db.Exec(`
+		ALTER TABLE jobs ADD COLUMN IF NOT EXISTS owner TEXT;
+		ALTER TABLE jobs ADD COLUMN IF NOT EXISTS params JSONB;
+		CREATE INDEX IF NOT EXISTS jobs_owner_idx ON jobs (owner, created_at DESC);
+	`)
 	return err
 }
 
@@ -133,6 +345,7 @@ func mustInit(dsn string) {
 	if err := os.MkdirAll(downloadDir, 0o755); err != nil {
 		panic(err)
 	}
+	initArtifactStore()
 	mustInitDB(dsn)
 
 	// 创建表格（如果不存在的话）
@@ -142,6 +355,24 @@ func mustInit(dsn string) {
 	}
 	fmt.Println("Table created (if not already exists) successfully.")
 	repo = NewPGJobRepo(db)
+	initIdempotency(db)
+	initJobEvents()
+	initAuth()
+	initWebhooks(db)
+	initWait()
+	initMirror(db)
+	initServe()
+	initStream()
+	initChunked()
+	initExport()
+	initOptimize()
+	initRender()
+	initProvenance()
+	initUpload()
+	initCache(db)
+	initStats(db)
+	initReports(db)
+	hub.TrackActive()
 }
 
 func mustInitDB(dsn string) {
@@ -433,6 +664,58 @@ func queryHunyuan(jobID string) (*QueryProResult, error) {
 	return out, nil
 }
 
+// mergeFiles 用上游的新结果刷新文件列表，已镜像的条目保留永久地址，只更新其原始地址
+func mergeFiles(old, fresh []ResultFile) []ResultFile {
+	if len(old) != len(fresh) {
+		return fresh
+	}
+	out := make([]ResultFile, len(fresh))
+	for i, f := range fresh {
+		o := old[i]
+		out[i] = f
+		if o.Key != "" {
+			out[i].Url, out[i].Key, out[i].SourceUrl = o.Url, o.Key, f.Url
+		}
+		if o.PreviewKey != "" {
+			out[i].PreviewImageUrl, out[i].PreviewKey, out[i].SourcePreviewUrl = o.PreviewImageUrl, o.PreviewKey, f.PreviewImageUrl
+		}
+	}
+	return out
+}
+
+// mergeMirrored 把镜像结果并入当前文件列表：只补上 cur 中还没有的 Key/PreviewKey 及其永久地址，
+// 原始地址以 cur 为准（镜像期间上游可能刷新过签名地址）。文件列表已被替换（长度不同）时保持 cur 不变
+func mergeMirrored(cur, mirrored []ResultFile) []ResultFile {
+	if len(cur) != len(mirrored) {
+		return cur
+	}
+	out := slices.Clone(cur)
+	for i, m := range mirrored {
+		o := &out[i]
+		if m.Key != "" && o.Key == "" {
+			o.SourceUrl, o.Key, o.Url = o.sourceURL(), m.Key, m.Url
+		}
+		if m.PreviewKey != "" && o.PreviewKey == "" {
+			o.SourcePreviewUrl, o.PreviewKey, o.PreviewImageUrl = o.sourcePreviewURL(), m.PreviewKey, m.PreviewImageUrl
+		}
+	}
+	return out
+}
+
+// recordQueryResult 把一次上游查询写入数据库，返回合并后的文件列表
+func recordQueryResult(ctx context.Context, jobID string, res *QueryProResult) []ResultFile {
+	var errStr string
+	if res.Status == "FAIL" {
+		errStr = strings.TrimSpace(res.ErrorCode + " " + res.ErrorMessage)
+	}
+	files, err := repo.Upsert(ctx, jobID, res.Status, res.Files, errStr)
+	if err != nil {
+		log.Printf("record %s: %v\n", jobID, err)
+		return res.Files
+	}
+	return files
+}
+
 /* =========================
    HTTP Handlers
    ========================= */
@@ -445,6 +728,8 @@ type SubmitTextReq struct {
 
 	// 新增：是否先润色再提交
 	Polish bool `json:"polish"` // 默认 false；true 时会先调用混元生文润色
+
+	CallbackURL string `json:"callback_url"` // 可选：完成/失败时回调
 }
 
 func handleSubmitText(c *gin.Context) {
@@ -458,6 +743,12 @@ func handleSubmitText(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "prompt is required"})
 		return
 	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+	}
 
 	// 如果需要润色 -> 先走混元生文
 	usedPrompt := raw
@@ -491,15 +782,18 @@ func handleSubmitText(c *gin.Context) {
 		handleSDKError(c, err)
 		return
 	}
-	_ = repo.Upsert(c.Request.Context(), jobID, "WAIT", nil, "")
+	_ = repo.Create(c.Request.Context(), jobID, currentUser(c), &JobParams{
+		Mode: "text", Prompt: raw, PromptUsed: usedPrompt, Polished: req.Polish,
+		EnablePBR: req.EnablePBR, FaceCount: req.FaceCount, GenerateType: req.GenerateType,
+	})
+	secret := registerJobCallback(c.Request.Context(), jobID, currentUser(c), req.CallbackURL)
+	hub.NotifyCreated(currentUser(c), jobID)
 
 	// 把最终使用的 prompt 回给前端，便于展示/复用
-	c.JSON(http.StatusOK, gin.H{
-		"ok":          true,
-		"job_id":      jobID,
+	respondSubmitted(c, jobID, withCallbackSecret(gin.H{
 		"prompt_used": usedPrompt, // 如果 polish=true，这里就是 refined
 		"polished":    req.Polish,
-	})
+	}, secret))
 }
 
 func handleSubmitImage(c *gin.Context) {
@@ -529,6 +823,13 @@ func handleSubmitImage(c *gin.Context) {
 		}
 	}
 	genType := strings.TrimSpace(c.PostForm("generate_type"))
+	callbackURL := strings.TrimSpace(c.PostForm("callback_url"))
+	if callbackURL != "" {
+		if err := validateCallbackURL(callbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+	}
 
 	payload, err := buildProPayload(
 		"", b64, "",
@@ -543,8 +844,13 @@ func handleSubmitImage(c *gin.Context) {
 		handleSDKError(c, err)
 		return
 	}
-	_ = repo.Upsert(c.Request.Context(), jobID, "WAIT", nil, "")
-	c.JSON(http.StatusOK, gin.H{"ok": true, "job_id": jobID})
+	_ = repo.Create(c.Request.Context(), jobID, currentUser(c), &JobParams{
+		Mode: "image", ImageName: fh.Filename,
+		EnablePBR: &enablePBR, FaceCount: faceCount, GenerateType: genType,
+	})
+	secret := registerJobCallback(c.Request.Context(), jobID, currentUser(c), callbackURL)
+	hub.NotifyCreated(currentUser(c), jobID)
+	respondSubmitted(c, jobID, withCallbackSecret(gin.H{}, secret))
 }
 
 type SubmitImageURLReq struct {
@@ -552,6 +858,7 @@ type SubmitImageURLReq struct {
 	EnablePBR    *bool  `json:"enable_pbr"`
 	FaceCount    *int64 `json:"face_count"`
 	GenerateType string `json:"generate_type"`
+	CallbackURL  string `json:"callback_url"`
 }
 
 func handleSubmitImageURL(c *gin.Context) {
@@ -564,6 +871,12 @@ func handleSubmitImageURL(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "image_url is required"})
 		return
 	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+	}
 
 	payload, err := buildProPayload(
 		"", "", req.ImageURL,
@@ -578,12 +891,31 @@ func handleSubmitImageURL(c *gin.Context) {
 		handleSDKError(c, err)
 		return
 	}
-	_ = repo.Upsert(c.Request.Context(), jobID, "WAIT", nil, "")
-	c.JSON(http.StatusOK, gin.H{"ok": true, "job_id": jobID})
+	_ = repo.Create(c.Request.Context(), jobID, currentUser(c), &JobParams{
+		Mode: "image_url", ImageURL: req.ImageURL,
+		EnablePBR: req.EnablePBR, FaceCount: req.FaceCount, GenerateType: req.GenerateType,
+	})
+	secret := registerJobCallback(c.Request.Context(), jobID, currentUser(c), req.CallbackURL)
+	hub.NotifyCreated(currentUser(c), jobID)
+	respondSubmitted(c, jobID, withCallbackSecret(gin.H{}, secret))
 }
 
 func handleStatus(c *gin.Context) {
 	jobID := c.Param("job_id")
+	jm, err := repo.Get(c.Request.Context(), jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if isUploadJob(jobID) {
+		// 上传的模型没有上游任务，直接读库
+		handleUploadStatus(c, jm)
+		return
+	}
 
 	res, err := queryHunyuan(jobID)
 	if err != nil {
@@ -591,12 +923,26 @@ func handleStatus(c *gin.Context) {
 		return
 	}
 
-	// 写入数据库（与你原有逻辑一致）
-	var errStr string
-	if res.Status == "FAIL" {
-		errStr = strings.TrimSpace(res.ErrorCode + " " + res.ErrorMessage)
+	// 写入数据库（已镜像的文件保留永久地址）
+	files := recordQueryResult(c.Request.Context(), jobID, res)
+	// 顺带喂给事件总线，SSE 订阅者无需等下一轮轮询
+	hub.Observe(jobID, res)
+
+	// 上游已不再保留、且没有镜像副本的条目
+	var expired []int
+	if list, err := artifactRepo.ListByJob(c.Request.Context(), jobID); err == nil {
+		for _, a := range list {
+			if a.Kind == KindModel && a.Status == "expired" {
+				expired = append(expired, a.Idx)
+			}
+		}
+	}
+
+	stats, _ := statsRepo.ListByJob(c.Request.Context(), jobID)
+	if res.Status == "DONE" && len(stats) < len(files) {
+		// 早于统计功能的历史任务在这里补算
+		startPostMirror(jobID, files, postMirrorSteps[:1])
 	}
-	_ = repo.Upsert(c.Request.Context(), jobID, res.Status, res.Files, errStr)
 
 	// 返回值对齐文档字段（并保留你已有的 files 映射）
 	c.JSON(http.StatusOK, gin.H{
@@ -605,12 +951,14 @@ func handleStatus(c *gin.Context) {
 		"status":        res.Status,       // WAIT/RUN/FAIL/DONE
 		"error_code":    res.ErrorCode,    // 可为空
 		"error_message": res.ErrorMessage, // 可为空
-		"files":         res.Files,        // ResultFile3Ds
+		"files":         files,            // ResultFile3Ds（镜像后为永久地址）
 		"request_id":    res.RequestId,    // 便于排障
+		"expired_files": expired,          // 已过期无法再下载的文件下标
+		"stats":         stats,            // 各文件的网格统计（镜像后异步计算）
 	})
 }
 
-func handle  ad(c *gin.Context) {
+func handleDownload(c *gin.Context) {
 	jobID := c.Param("job_id")
 	idxStr := c.Param("idx")
 	idx, _ := strconv.Atoi(idxStr)
@@ -620,8 +968,12 @@ func handle  ad(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
-	if jm == nil || jm.Status != "DONE" {
-		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done or unknown"})
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if jm.Status != "DONE" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done"})
 		return
 	}
 	if idx < 0 || idx >= len(jm.Files) {
@@ -635,15 +987,40 @@ func handle  ad(c *gin.Context) {
 		ext = "bin"
 	}
 	outName := jobID + "_" + strconv.Itoa(idx) + "." + ext
-	outPath := filepath.Join(downloadDir, outName)
+	key := f.Key
+	if key == "" {
+		key = artifactKey(jobID, idx, ext)
+	}
 
-	if _, err := os.Stat(outPath); err != nil {
-		if err := downloadToFile(f.Url, outPath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "download failed: " + err.Error()})
+	// GLB 默认返回优化版（已生成且更小时），original=1 取原文件
+	if original, _ := strconv.ParseBool(c.Query("original")); ext == "glb" && optimizeOnDownload && !original {
+		if optKey, optKind, ok := optimizedDownload(c.Request.Context(), jobID, idx); ok {
+			c.Header("X-Model-Variant", "optimized")
+			serveArtifact(c, jm, idx, optKind, optKey, outName)
 			return
 		}
 	}
-	c.FileAttachment(outPath, outName)
+
+	// 首次下载边拉取边输出，不必等整个文件入库
+	if streamDownload(c, jobID, idx, key, f.sourceURL(), outName) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := fetchArtifact(ctx, jobID, idx, KindModel, key, f.sourceURL()); err != nil {
+		if errors.Is(err, ErrArtifactExpired) {
+			c.JSON(http.StatusGone, gin.H{"ok": false, "error": "artifact_expired", "message": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrCorruptArtifact) {
+			c.JSON(http.StatusBadGateway, gin.H{"ok": false, "error": "artifact_corrupt", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "download failed: " + err.Error()})
+		return
+	}
+
+	serveArtifact(c, jm, idx, KindModel, key, outName)
 }
 
 func handleHealth(c *gin.Context) {
@@ -689,7 +1066,8 @@ var httpClient = &http.Client{
 	Transport: httpTransport,
 }
 
-func downloadToFile(url, out string) error {
+// downloadToFile 断点续传到本地文件；st 非空时上报进度
+func downloadToFile(url, out string, st *fetchState) error {
 	const (
 		maxRetries   = 6
 		chunkSize    = 4 << 20 // 4MiB
@@ -742,6 +1120,23 @@ func downloadToFile(url, out string) error {
 		}
 	}
 
+	// 大文件且已知大小：多连接分片下载
+	if useChunked(total) {
+		err := downloadChunked(url, out, total, st)
+		if !errors.Is(err, errRangeUnsupported) {
+			return err
+		}
+	}
+	if _, err := os.Stat(out + ".chunks"); err == nil {
+		// 分片下载留下的 .part 是稀疏的，不能按前缀续传，从头单连接下载
+		_ = os.Remove(tmp)
+		_ = os.Remove(out + ".chunks")
+		have = 0
+	}
+
+	st.reset(total)
+	st.add(have)
+
 	// 打开 part 文件（续写）
 	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR, 0o644)
 	if err != nil {
@@ -781,7 +1176,7 @@ func downloadToFile(url, out string) error {
 			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
 			resp.Body.Close()
 			cancel()
-			return fmt.Errorf("bad status: %s, body: %s", resp.Status, string(body))
+			return &badStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(body)}
 		}
 
 		// 复制
@@ -795,6 +1190,7 @@ func downloadToFile(url, out string) error {
 					break
 				}
 				have += int64(n)
+				st.add(int64(n))
 			}
 			if rerr == io.EOF {
 				copyErr = nil
@@ -867,7 +1263,8 @@ func main() {
 	mustInit(*dsn)
 
 	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	r := gin.New()
+	r.Use(withAbort(gin.Logger(), gin.Recovery())...)
 	//r.Use(cors.Default())
 
 	//r.Use(cors.New(cors.Config{
@@ -883,9 +1280,11 @@ func main() {
 	//}))
 
 	r.Use(cors.New(cors.Config{
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-User-ID", idemHeader,
+			"Range", "If-Range", "If-None-Match", "If-Modified-Since"},
+		ExposeHeaders: []string{"Content-Length", idemReplayedHdr,
+			"ETag", "Last-Modified", "Accept-Ranges", "Content-Range", "Content-Disposition"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
 			return true // 或者用更具体的逻辑来判断
@@ -897,17 +1296,44 @@ func main() {
 	r.OPTIONS("/api/*path", func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Length, Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Length, Content-Type, Authorization, X-User-ID, "+idemHeader+
+			", Range, If-Range, If-None-Match, If-Modified-Since")
 		c.Status(http.StatusOK)
 	})
 
+	r.Use(identify())
+
 	r.GET("/", handleHealth)
-	r.POST("/api/submit-text", handleSubmitText)
-	r.POST("/api/submit-image", handleSubmitImage)
-	r.POST("/api/submit-image-url", handleSubmitImageURL)
+	r.POST("/api/submit-text", idempotent(), requireQuota(), handleSubmitText)
+	r.POST("/api/submit-image", idempotent(), requireQuota(), handleSubmitImage)
+	r.POST("/api/submit-image-url", idempotent(), requireQuota(), handleSubmitImageURL)
+	r.POST("/api/models/upload", limitUploadBody(), idempotent(), requireQuota(), handleUploadModel)
 	r.GET("/api/status/:job_id", handleStatus)
 	r.GET("/api/download/:job_id/:idx", handleDownload)
-	r.POST("/api/polish-prompt", handlePolishPrompt)
+	r.HEAD("/api/download/:job_id/:idx", handleDownload)
+	r.GET("/api/jobs", handleListJobs)
+	r.GET("/api/jobs/:id/events", handleJobEvents)
+	r.GET("/api/jobs/:id/wait", handleJobWait)
+	r.GET("/api/jobs/:id/artifacts", handleListArtifacts)
+	r.GET("/api/jobs/:id/bundle.zip", handleBundle)
+	r.GET("/api/jobs/:id/export", handleExport)
+	r.GET("/api/jobs/:id/printability", handlePrintability)
+	r.GET("/api/jobs/:id/optimize", handleOptimize)
+	r.GET("/api/jobs/:id/render", handleRender)
+	r.POST("/api/provenance/verify", handleVerifyProvenance)
+	r.GET("/api/jobs/:id/files/:idx/preview", handlePreview)
+	r.GET("/api/jobs/:id/files/:idx/validation", handleValidation)
+	r.GET("/api/jobs/:id/files/:idx/progress", handleFetchProgress)
+	r.GET("/api/ws", handleWS)
+	r.POST("/api/webhooks", handleCreateWebhook)
+	r.GET("/api/webhooks", handleListWebhooks)
+	r.DELETE("/api/webhooks/:id", handleDeleteWebhook)
+	r.GET("/api/webhooks/deliveries", handleListDeliveries)
+	r.GET("/api/webhooks/deliveries/:id", handleGetDelivery)
+	r.POST("/api/webhooks/deliveries/:id/redeliver", handleRedeliver)
+	r.POST("/api/polish-prompt", idempotent(), handlePolishPrompt)
+	r.GET("/api/admin/storage", requireAdmin(), handleStorageUsage)
+	r.POST("/api/admin/storage/gc", requireAdmin(), handleStorageGC)
 
 	addr := ":" + strconv.Itoa(appPort)
 	if p := os.Getenv("PORT"); p != "" {
@@ -0,0 +1,817 @@
+// mesh.go
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+/* =========================
+   网格场景模型
+   ========================= */
+
+// Scene 是格式转换、统计和分析共用的内存表示：节点变换已烘焙进世界坐标，
+// 每个 glTF primitive 对应一个 Mesh，全部为三角形。
+type Scene struct {
+	Meshes    []*Mesh
+	Materials []Material
+	Images    []Image
+
+	// 坐标单位（米/单位，0 视为 1）和上方向；USDZ、FBX 会写进文件头，其余格式不记录单位
+	MetersPerUnit float64
+	ZUp           bool
+
+	// 导出时写入文件的来源信息，nil 表示不写
+	Provenance *Provenance
+}
+
+type Mesh struct {
+	Name      string
+	Positions [][3]float32
+	Normals   [][3]float32 // 可为空
+	UVs       [][2]float32 // 可为空，glTF 约定（v 向下）
+	Colors    [][4]float32 // 可为空
+	Indices   []uint32     // 每 3 个一个三角形
+	Material  int          // -1 表示无材质
+}
+
+type Material struct {
+	Name        string
+	BaseColor   [4]float32
+	Metallic    float32
+	Roughness   float32
+	Emissive    [3]float32
+	DoubleSided bool
+	AlphaMode   string
+	// 以下为 Scene.Images 下标，-1 表示无
+	BaseColorTex  int
+	MetalRoughTex int
+	NormalTex     int
+	EmissiveTex   int
+	OcclusionTex  int
+}
+
+type Image struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+// Ext 图片扩展名
+func (im *Image) Ext() string {
+	switch im.MimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".png"
+}
+
+func (s *Scene) unitMeters() float64 {
+	if s.MetersPerUnit > 0 {
+		return s.MetersPerUnit
+	}
+	return 1
+}
+
+func (s *Scene) VertexCount() int {
+	n := 0
+	for _, m := range s.Meshes {
+		n += len(m.Positions)
+	}
+	return n
+}
+
+func (s *Scene) TriangleCount() int {
+	n := 0
+	for _, m := range s.Meshes {
+		n += len(m.Indices) / 3
+	}
+	return n
+}
+
+// Bounds 世界坐标包围盒；空场景返回零值
+func (s *Scene) Bounds() (min, max [3]float32) {
+	first := true
+	for _, m := range s.Meshes {
+		for _, p := range m.Positions {
+			if first {
+				min, max, first = p, p, false
+				continue
+			}
+			for k := 0; k < 3; k++ {
+				min[k] = float32(math.Min(float64(min[k]), float64(p[k])))
+				max[k] = float32(math.Max(float64(max[k]), float64(p[k])))
+			}
+		}
+	}
+	return min, max
+}
+
+// FaceNormal 三角形法向（未归一化的叉积归一化后），退化三角形返回零向量
+func FaceNormal(a, b, c [3]float32) [3]float32 {
+	u := sub3(b, a)
+	v := sub3(c, a)
+	return normalize3(cross3(u, v))
+}
+
+func sub3(a, b [3]float32) [3]float32 { return [3]float32{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func add3(a, b [3]float32) [3]float32 { return [3]float32{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func scale3(a [3]float32, s float32) [3]float32 {
+	return [3]float32{a[0] * s, a[1] * s, a[2] * s}
+}
+func dot3(a, b [3]float32) float32 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func cross3(a, b [3]float32) [3]float32 {
+	return [3]float32{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+func length3(a [3]float32) float32 { return float32(math.Sqrt(float64(dot3(a, a)))) }
+func normalize3(a [3]float32) [3]float32 {
+	l := length3(a)
+	if l == 0 {
+		return [3]float32{}
+	}
+	return scale3(a, 1/l)
+}
+
+/* =========================
+   glTF / GLB 解析
+   ========================= */
+
+type gltfJSON struct {
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Name        string    `json:"name"`
+		Mesh        *int      `json:"mesh"`
+		Children    []int     `json:"children"`
+		Matrix      []float64 `json:"matrix"`
+		Translation []float64 `json:"translation"`
+		Rotation    []float64 `json:"rotation"`
+		Scale       []float64 `json:"scale"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Name       string `json:"name"`
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Material   *int           `json:"material"`
+			Mode       *int           `json:"mode"`
+			Extensions map[string]any `json:"extensions"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Accessors []struct {
+		BufferView    *int             `json:"bufferView"`
+		ByteOffset    int              `json:"byteOffset"`
+		ComponentType int              `json:"componentType"`
+		Normalized    bool             `json:"normalized"`
+		Count         int              `json:"count"`
+		Type          string           `json:"type"`
+		Sparse        *json.RawMessage `json:"sparse"`
+	} `json:"accessors"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+		ByteStride int `json:"byteStride"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		ByteLength int    `json:"byteLength"`
+		URI        string `json:"uri"`
+	} `json:"buffers"`
+	Materials []struct {
+		Name                 string `json:"name"`
+		PbrMetallicRoughness *struct {
+			BaseColorFactor          []float32   `json:"baseColorFactor"`
+			MetallicFactor           *float32    `json:"metallicFactor"`
+			RoughnessFactor          *float32    `json:"roughnessFactor"`
+			BaseColorTexture         *gltfTexRef `json:"baseColorTexture"`
+			MetallicRoughnessTexture *gltfTexRef `json:"metallicRoughnessTexture"`
+		} `json:"pbrMetallicRoughness"`
+		NormalTexture    *gltfTexRef `json:"normalTexture"`
+		OcclusionTexture *gltfTexRef `json:"occlusionTexture"`
+		EmissiveTexture  *gltfTexRef `json:"emissiveTexture"`
+		EmissiveFactor   []float32   `json:"emissiveFactor"`
+		DoubleSided      bool        `json:"doubleSided"`
+		AlphaMode        string      `json:"alphaMode"`
+	} `json:"materials"`
+	Textures []struct {
+		Source *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		Name       string `json:"name"`
+		URI        string `json:"uri"`
+		MimeType   string `json:"mimeType"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+}
+
+type gltfTexRef struct {
+	Index int `json:"index"`
+}
+
+// 能正确解析的扩展；其余必需扩展（Draco、meshopt 等）会导致几何无法读取
+var supportedRequiredExt = map[string]bool{
+	"KHR_materials_unlit":             true,
+	"KHR_texture_transform":           true,
+	"KHR_mesh_quantization":           true,
+	"KHR_materials_emissive_strength": true,
+}
+
+// 解析的是用户可控的文件（含匿名上传），下标、长度、偏移一律先做范围检查再用；
+// 以下上限防止小文件通过声明的数量或节点实例化撑爆内存/栈
+const (
+	maxZeroAccessorBytes = 16 << 20 // 没有 bufferView 的访问器按全零填充，count 不能随意声明
+	maxSceneVertices     = 1 << 24  // 实例化展开后的顶点总数
+	maxMeshInstances     = 1 << 16  // 实例化展开后的图元数
+	maxNodeDepth         = 256
+)
+
+// spanFits [off, off+length) 是否落在 size 字节内；逐项比较，避免大数相加溢出
+func spanFits(off, length, size int) bool {
+	return off >= 0 && length >= 0 && off <= size && length <= size-off
+}
+
+// accessorFits 从 off 开始、步长 stride、每个元素 elem 字节的 count 个元素能否放进 size 字节
+func accessorFits(off, count, stride, elem, size int) bool {
+	if count == 0 {
+		return off >= 0 && off <= size
+	}
+	if count < 0 || elem < 1 || stride < elem || !spanFits(off, elem, size) {
+		return false
+	}
+	return count-1 <= (size-off-elem)/stride
+}
+
+// ParseGLB 解析 GLB（或 JSON 格式的 .gltf，外部 buffer 仅支持 data URI）
+func ParseGLB(data []byte) (*Scene, error) {
+	var doc gltfJSON
+	var bin []byte
+	if bytes.HasPrefix(data, []byte("glTF")) {
+		if len(data) < 20 {
+			return nil, errors.New("glb: too short")
+		}
+		jsonLen := int(binary.LittleEndian.Uint32(data[12:16]))
+		if 20+jsonLen > len(data) || string(data[16:20]) != "JSON" {
+			return nil, errors.New("glb: bad JSON chunk")
+		}
+		if err := json.Unmarshal(data[20:20+jsonLen], &doc); err != nil {
+			return nil, fmt.Errorf("glb: %v", err)
+		}
+		off := 20 + jsonLen
+		for off+8 <= len(data) {
+			l := int(binary.LittleEndian.Uint32(data[off : off+4]))
+			typ := string(data[off+4 : off+8])
+			if off+8+l > len(data) {
+				return nil, errors.New("glb: chunk exceeds file size")
+			}
+			if typ == "BIN\x00" && bin == nil {
+				bin = data[off+8 : off+8+l]
+			}
+			off += 8 + l
+		}
+	} else if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("gltf: %v", err)
+	}
+
+	for _, ext := range doc.ExtensionsRequired {
+		if !supportedRequiredExt[ext] {
+			return nil, fmt.Errorf("gltf: required extension %s is not supported", ext)
+		}
+	}
+
+	p := &gltfParser{doc: &doc}
+	for i, b := range doc.Buffers {
+		switch {
+		case b.URI == "" && i == 0:
+			p.buffers = append(p.buffers, bin)
+		case strings.HasPrefix(b.URI, "data:"):
+			raw, err := decodeDataURI(b.URI)
+			if err != nil {
+				return nil, fmt.Errorf("gltf: buffer %d: %v", i, err)
+			}
+			p.buffers = append(p.buffers, raw)
+		default:
+			return nil, fmt.Errorf("gltf: external buffer %q is not supported", b.URI)
+		}
+	}
+	return p.scene()
+}
+
+func decodeDataURI(uri string) ([]byte, error) {
+	_, payload, ok := strings.Cut(uri, ",")
+	if !ok || !strings.Contains(uri[:len(uri)-len(payload)], ";base64") {
+		return nil, errors.New("unsupported data URI")
+	}
+	return base64.StdEncoding.DecodeString(payload)
+}
+
+type gltfParser struct {
+	doc       *gltfJSON
+	buffers   [][]byte
+	vertices  int // 已输出的顶点数和图元数，限制实例化展开
+	instances int
+}
+
+func (p *gltfParser) scene() (*Scene, error) {
+	doc := p.doc
+	s := &Scene{}
+
+	for i, im := range doc.Images {
+		img := Image{Name: im.Name, MimeType: im.MimeType}
+		switch {
+		case im.BufferView != nil:
+			b, err := p.view(*im.BufferView)
+			if err != nil {
+				return nil, fmt.Errorf("image %d: %v", i, err)
+			}
+			img.Data = b
+		case strings.HasPrefix(im.URI, "data:"):
+			b, err := decodeDataURI(im.URI)
+			if err != nil {
+				return nil, fmt.Errorf("image %d: %v", i, err)
+			}
+			img.Data = b
+			if img.MimeType == "" {
+				img.MimeType = strings.TrimPrefix(strings.SplitN(im.URI, ";", 2)[0], "data:")
+			}
+		}
+		if img.MimeType == "" {
+			img.MimeType = "image/png"
+			if bytes.HasPrefix(img.Data, []byte("\xff\xd8")) {
+				img.MimeType = "image/jpeg"
+			}
+		}
+		if img.Name == "" {
+			img.Name = fmt.Sprintf("texture_%d", i)
+		}
+		s.Images = append(s.Images, img)
+	}
+
+	texImage := func(ref *gltfTexRef) int {
+		if ref == nil || ref.Index < 0 || ref.Index >= len(doc.Textures) {
+			return -1
+		}
+		src := doc.Textures[ref.Index].Source
+		if src == nil || *src < 0 || *src >= len(s.Images) || len(s.Images[*src].Data) == 0 {
+			return -1
+		}
+		return *src
+	}
+	for i, m := range doc.Materials {
+		mat := Material{
+			Name: m.Name, BaseColor: [4]float32{1, 1, 1, 1}, Metallic: 1, Roughness: 1,
+			DoubleSided: m.DoubleSided, AlphaMode: m.AlphaMode,
+			BaseColorTex: -1, MetalRoughTex: -1,
+			NormalTex: texImage(m.NormalTexture), EmissiveTex: texImage(m.EmissiveTexture), OcclusionTex: texImage(m.OcclusionTexture),
+		}
+		if mat.Name == "" {
+			mat.Name = fmt.Sprintf("material_%d", i)
+		}
+		if pbr := m.PbrMetallicRoughness; pbr != nil {
+			if len(pbr.BaseColorFactor) == 4 {
+				copy(mat.BaseColor[:], pbr.BaseColorFactor)
+			}
+			if pbr.MetallicFactor != nil {
+				mat.Metallic = *pbr.MetallicFactor
+			}
+			if pbr.RoughnessFactor != nil {
+				mat.Roughness = *pbr.RoughnessFactor
+			}
+			mat.BaseColorTex = texImage(pbr.BaseColorTexture)
+			mat.MetalRoughTex = texImage(pbr.MetallicRoughnessTexture)
+		}
+		if len(m.EmissiveFactor) == 3 {
+			copy(mat.Emissive[:], m.EmissiveFactor)
+		}
+		s.Materials = append(s.Materials, mat)
+	}
+
+	// 从场景根节点遍历；没有 scenes 时把所有节点都当作根（只取未被引用的）
+	var roots []int
+	if len(doc.Scenes) > 0 {
+		si := 0
+		if doc.Scene != nil {
+			if *doc.Scene < 0 || *doc.Scene >= len(doc.Scenes) {
+				return nil, fmt.Errorf("gltf: scene %d out of range", *doc.Scene)
+			}
+			si = *doc.Scene
+		}
+		roots = doc.Scenes[si].Nodes
+	} else {
+		child := map[int]bool{}
+		for _, n := range doc.Nodes {
+			for _, c := range n.Children {
+				child[c] = true
+			}
+		}
+		for i := range doc.Nodes {
+			if !child[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+	if len(doc.Nodes) == 0 {
+		// 没有节点时直接输出所有网格
+		for mi := range doc.Meshes {
+			if err := p.addMesh(s, mi, identity4()); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+
+	visited := map[int]bool{}
+	var walk func(ni, depth int, parent [16]float64) error
+	walk = func(ni, depth int, parent [16]float64) error {
+		if ni < 0 || ni >= len(doc.Nodes) || visited[ni] {
+			return nil
+		}
+		if depth > maxNodeDepth {
+			return fmt.Errorf("gltf: node hierarchy deeper than %d", maxNodeDepth)
+		}
+		visited[ni] = true
+		n := doc.Nodes[ni]
+		world := mul4(parent, nodeMatrix(n.Matrix, n.Translation, n.Rotation, n.Scale))
+		if n.Mesh != nil {
+			if err := p.addMesh(s, *n.Mesh, world); err != nil {
+				return err
+			}
+		}
+		for _, c := range n.Children {
+			if err := walk(c, depth+1, world); err != nil {
+				return err
+			}
+		}
+		delete(visited, ni) // 允许同一节点在不同路径下被实例化，只防环
+		return nil
+	}
+	for _, r := range roots {
+		if err := walk(r, 0, identity4()); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *gltfParser) addMesh(s *Scene, mi int, world [16]float64) error {
+	doc := p.doc
+	if mi < 0 || mi >= len(doc.Meshes) {
+		return fmt.Errorf("mesh %d out of range", mi)
+	}
+	gm := doc.Meshes[mi]
+	normalMat := normalMatrix(world)
+	flip := det3(world) < 0
+
+	for pi, prim := range gm.Primitives {
+		if _, ok := prim.Extensions["KHR_draco_mesh_compression"]; ok {
+			return errors.New("gltf: Draco-compressed meshes are not supported")
+		}
+		mode := 4
+		if prim.Mode != nil {
+			mode = *prim.Mode
+		}
+		if mode != 4 && mode != 5 && mode != 6 {
+			continue // 点/线不参与
+		}
+		posIdx, ok := prim.Attributes["POSITION"]
+		if !ok {
+			continue
+		}
+		if p.instances++; p.instances > maxMeshInstances {
+			return fmt.Errorf("gltf: scene expands to more than %d primitives", maxMeshInstances)
+		}
+		pos, err := p.floats(posIdx, 3)
+		if err != nil {
+			return fmt.Errorf("mesh %d/%d POSITION: %v", mi, pi, err)
+		}
+		m := &Mesh{Name: gm.Name, Material: -1}
+		if m.Name == "" {
+			m.Name = fmt.Sprintf("mesh_%d", mi)
+		}
+		if len(gm.Primitives) > 1 {
+			m.Name = fmt.Sprintf("%s_%d", m.Name, pi)
+		}
+		if len(pos)/3 > maxSceneVertices-p.vertices {
+			return fmt.Errorf("gltf: scene expands to more than %d vertices", maxSceneVertices)
+		}
+		p.vertices += len(pos) / 3
+		if prim.Material != nil && *prim.Material >= 0 && *prim.Material < len(s.Materials) {
+			m.Material = *prim.Material
+		}
+		m.Positions = make([][3]float32, len(pos)/3)
+		for i := range m.Positions {
+			m.Positions[i] = transformPoint(world, pos[i*3], pos[i*3+1], pos[i*3+2])
+		}
+		if ai, ok := prim.Attributes["NORMAL"]; ok {
+			if nrm, err := p.floats(ai, 3); err == nil && len(nrm)/3 == len(m.Positions) {
+				m.Normals = make([][3]float32, len(m.Positions))
+				for i := range m.Normals {
+					m.Normals[i] = transformNormal(normalMat, nrm[i*3], nrm[i*3+1], nrm[i*3+2])
+				}
+			}
+		}
+		if ai, ok := prim.Attributes["TEXCOORD_0"]; ok {
+			if uv, err := p.floats(ai, 2); err == nil && len(uv)/2 == len(m.Positions) {
+				m.UVs = make([][2]float32, len(m.Positions))
+				for i := range m.UVs {
+					m.UVs[i] = [2]float32{uv[i*2], uv[i*2+1]}
+				}
+			}
+		}
+		if ai, ok := prim.Attributes["COLOR_0"]; ok && ai >= 0 && ai < len(doc.Accessors) {
+			comps := 4
+			if doc.Accessors[ai].Type == "VEC3" {
+				comps = 3
+			}
+			if col, err := p.floats(ai, comps); err == nil && len(col)/comps == len(m.Positions) {
+				m.Colors = make([][4]float32, len(m.Positions))
+				for i := range m.Colors {
+					c := [4]float32{1, 1, 1, 1}
+					copy(c[:comps], col[i*comps:i*comps+comps])
+					m.Colors[i] = c
+				}
+			}
+		}
+
+		var idx []uint32
+		if prim.Indices != nil {
+			if idx, err = p.uints(*prim.Indices); err != nil {
+				return fmt.Errorf("mesh %d/%d indices: %v", mi, pi, err)
+			}
+		} else {
+			idx = make([]uint32, len(m.Positions))
+			for i := range idx {
+				idx[i] = uint32(i)
+			}
+		}
+		idx = triangulate(idx, mode)
+		for _, v := range idx {
+			if int(v) >= len(m.Positions) {
+				return fmt.Errorf("mesh %d/%d: index %d out of range", mi, pi, v)
+			}
+		}
+		if flip {
+			for i := 0; i+2 < len(idx); i += 3 {
+				idx[i+1], idx[i+2] = idx[i+2], idx[i+1]
+			}
+		}
+		m.Indices = idx
+		s.Meshes = append(s.Meshes, m)
+	}
+	return nil
+}
+
+// triangulate 把 strip / fan 转成三角形列表
+func triangulate(idx []uint32, mode int) []uint32 {
+	if len(idx) < 3 {
+		return nil
+	}
+	switch mode {
+	case 5:
+		out := make([]uint32, 0, (len(idx)-2)*3)
+		for i := 0; i+2 < len(idx); i++ {
+			if i%2 == 0 {
+				out = append(out, idx[i], idx[i+1], idx[i+2])
+			} else {
+				out = append(out, idx[i+1], idx[i], idx[i+2])
+			}
+		}
+		return out
+	case 6:
+		out := make([]uint32, 0, (len(idx)-2)*3)
+		for i := 1; i+1 < len(idx); i++ {
+			out = append(out, idx[0], idx[i], idx[i+1])
+		}
+		return out
+	}
+	return idx[:len(idx)-len(idx)%3]
+}
+
+func (p *gltfParser) view(vi int) ([]byte, error) {
+	if vi < 0 || vi >= len(p.doc.BufferViews) {
+		return nil, fmt.Errorf("bufferView %d out of range", vi)
+	}
+	bv := p.doc.BufferViews[vi]
+	if bv.Buffer < 0 || bv.Buffer >= len(p.buffers) {
+		return nil, fmt.Errorf("buffer %d missing", bv.Buffer)
+	}
+	buf := p.buffers[bv.Buffer]
+	if !spanFits(bv.ByteOffset, bv.ByteLength, len(buf)) {
+		return nil, fmt.Errorf("bufferView %d exceeds buffer", vi)
+	}
+	return buf[bv.ByteOffset : bv.ByteOffset+bv.ByteLength], nil
+}
+
+var componentSize = map[int]int{5120: 1, 5121: 1, 5122: 2, 5123: 2, 5125: 4, 5126: 4}
+var typeComponents = map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT2": 4, "MAT3": 9, "MAT4": 16}
+
+// raw 返回访问器每个元素的起始偏移所在的字节切片和步长
+func (p *gltfParser) raw(ai int) (data []byte, stride, comps, csize int, err error) {
+	if ai < 0 || ai >= len(p.doc.Accessors) {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d out of range", ai)
+	}
+	acc := p.doc.Accessors[ai]
+	if acc.Sparse != nil {
+		return nil, 0, 0, 0, errors.New("sparse accessors are not supported")
+	}
+	comps = typeComponents[acc.Type]
+	csize = componentSize[acc.ComponentType]
+	if comps == 0 || csize == 0 {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d: bad type %s/%d", ai, acc.Type, acc.ComponentType)
+	}
+	if acc.BufferView == nil {
+		// 全零访问器
+		if acc.Count < 0 || acc.Count > maxZeroAccessorBytes/(comps*csize) {
+			return nil, 0, 0, 0, fmt.Errorf("accessor %d: count %d out of range", ai, acc.Count)
+		}
+		return make([]byte, acc.Count*comps*csize), comps * csize, comps, csize, nil
+	}
+	view, err := p.view(*acc.BufferView)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	stride = p.doc.BufferViews[*acc.BufferView].ByteStride
+	if stride == 0 {
+		stride = comps * csize
+	}
+	if stride < comps*csize || stride > 252 {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d: bad byteStride %d", ai, stride)
+	}
+	if !accessorFits(acc.ByteOffset, acc.Count, stride, comps*csize, len(view)) {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d exceeds bufferView", ai)
+	}
+	return view[acc.ByteOffset:], stride, comps, csize, nil
+}
+
+// floats 读取访问器为 float32，支持归一化整数（KHR_mesh_quantization）
+func (p *gltfParser) floats(ai, want int) ([]float32, error) {
+	data, stride, comps, csize, err := p.raw(ai)
+	if err != nil {
+		return nil, err
+	}
+	if comps != want {
+		return nil, fmt.Errorf("accessor %d has %d components, want %d", ai, comps, want)
+	}
+	acc := p.doc.Accessors[ai]
+	out := make([]float32, 0, acc.Count*comps)
+	for i := 0; i < acc.Count; i++ {
+		base := i * stride
+		for c := 0; c < comps; c++ {
+			b := data[base+c*csize:]
+			var v float32
+			switch acc.ComponentType {
+			case 5126:
+				v = math.Float32frombits(binary.LittleEndian.Uint32(b))
+			case 5120:
+				v = float32(int8(b[0]))
+				if acc.Normalized {
+					v = float32(math.Max(float64(v)/127, -1))
+				}
+			case 5121:
+				v = float32(b[0])
+				if acc.Normalized {
+					v /= 255
+				}
+			case 5122:
+				v = float32(int16(binary.LittleEndian.Uint16(b)))
+				if acc.Normalized {
+					v = float32(math.Max(float64(v)/32767, -1))
+				}
+			case 5123:
+				v = float32(binary.LittleEndian.Uint16(b))
+				if acc.Normalized {
+					v /= 65535
+				}
+			case 5125:
+				v = float32(binary.LittleEndian.Uint32(b))
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func (p *gltfParser) uints(ai int) ([]uint32, error) {
+	data, stride, comps, _, err := p.raw(ai)
+	if err != nil {
+		return nil, err
+	}
+	if comps != 1 {
+		return nil, fmt.Errorf("index accessor %d is not SCALAR", ai)
+	}
+	acc := p.doc.Accessors[ai]
+	out := make([]uint32, acc.Count)
+	for i := range out {
+		b := data[i*stride:]
+		switch acc.ComponentType {
+		case 5121:
+			out[i] = uint32(b[0])
+		case 5123:
+			out[i] = uint32(binary.LittleEndian.Uint16(b))
+		case 5125:
+			out[i] = binary.LittleEndian.Uint32(b)
+		default:
+			return nil, fmt.Errorf("index accessor %d: bad component type %d", ai, acc.ComponentType)
+		}
+	}
+	return out, nil
+}
+
+/* =========================
+   变换矩阵（列主序，与 glTF 一致）
+   ========================= */
+
+func identity4() [16]float64 {
+	return [16]float64{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+func mul4(a, b [16]float64) [16]float64 {
+	var r [16]float64
+	for c := 0; c < 4; c++ {
+		for rr := 0; rr < 4; rr++ {
+			var s float64
+			for k := 0; k < 4; k++ {
+				s += a[k*4+rr] * b[c*4+k]
+			}
+			r[c*4+rr] = s
+		}
+	}
+	return r
+}
+
+func nodeMatrix(m, t, r, s []float64) [16]float64 {
+	if len(m) == 16 {
+		var out [16]float64
+		copy(out[:], m)
+		return out
+	}
+	tx, ty, tz := 0.0, 0.0, 0.0
+	if len(t) == 3 {
+		tx, ty, tz = t[0], t[1], t[2]
+	}
+	qx, qy, qz, qw := 0.0, 0.0, 0.0, 1.0
+	if len(r) == 4 {
+		qx, qy, qz, qw = r[0], r[1], r[2], r[3]
+	}
+	sx, sy, sz := 1.0, 1.0, 1.0
+	if len(s) == 3 {
+		sx, sy, sz = s[0], s[1], s[2]
+	}
+	// R * S，再加平移
+	return [16]float64{
+		(1 - 2*(qy*qy+qz*qz)) * sx, (2 * (qx*qy + qz*qw)) * sx, (2 * (qx*qz - qy*qw)) * sx, 0,
+		(2 * (qx*qy - qz*qw)) * sy, (1 - 2*(qx*qx+qz*qz)) * sy, (2 * (qy*qz + qx*qw)) * sy, 0,
+		(2 * (qx*qz + qy*qw)) * sz, (2 * (qy*qz - qx*qw)) * sz, (1 - 2*(qx*qx+qy*qy)) * sz, 0,
+		tx, ty, tz, 1,
+	}
+}
+
+func transformPoint(m [16]float64, x, y, z float32) [3]float32 {
+	fx, fy, fz := float64(x), float64(y), float64(z)
+	return [3]float32{
+		float32(m[0]*fx + m[4]*fy + m[8]*fz + m[12]),
+		float32(m[1]*fx + m[5]*fy + m[9]*fz + m[13]),
+		float32(m[2]*fx + m[6]*fy + m[10]*fz + m[14]),
+	}
+}
+
+func det3(m [16]float64) float64 {
+	return m[0]*(m[5]*m[10]-m[9]*m[6]) - m[4]*(m[1]*m[10]-m[9]*m[2]) + m[8]*(m[1]*m[6]-m[5]*m[2])
+}
+
+// normalMatrix 左上 3x3 的逆转置（行主序 3x3）
+func normalMatrix(m [16]float64) [9]float64 {
+	a, b, c := m[0], m[4], m[8]
+	d, e, f := m[1], m[5], m[9]
+	g, h, i := m[2], m[6], m[10]
+	det := a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+	if det == 0 {
+		return [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	}
+	inv := 1 / det
+	// 逆矩阵的转置 = 余子式矩阵 / det
+	return [9]float64{
+		(e*i - f*h) * inv, -(d*i - f*g) * inv, (d*h - e*g) * inv,
+		-(b*i - c*h) * inv, (a*i - c*g) * inv, -(a*h - b*g) * inv,
+		(b*f - c*e) * inv, -(a*f - c*d) * inv, (a*e - b*d) * inv,
+	}
+}
+
+func transformNormal(n [9]float64, x, y, z float32) [3]float32 {
+	fx, fy, fz := float64(x), float64(y), float64(z)
+	return normalize3([3]float32{
+		float32(n[0]*fx + n[1]*fy + n[2]*fz),
+		float32(n[3]*fx + n[4]*fy + n[5]*fz),
+		float32(n[6]*fx + n[7]*fy + n[8]*fz),
+	})
+}
@@ -0,0 +1,555 @@
+// mesh_check.go
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+/* =========================
+   3D 打印可用性检查与修复
+   ========================= */
+
+// 先按位置焊接顶点（glTF 在 UV 接缝处会拆分顶点，不焊接的话所有接缝都像破洞），
+// 再基于边的邻接关系统计非流形边、边界环（破洞）、朝向不一致、壳体数量，
+// 用均匀网格加速三角形两两相交检测。
+
+const (
+	selfIntersectMaxTris    = 1_000_000 // 超过则跳过自相交检测
+	selfIntersectMaxReports = 10_000
+)
+
+type PrintReport struct {
+	Triangles           int        `json:"triangles"`
+	Vertices            int        `json:"vertices"` // 焊接后
+	DegenerateTriangles int        `json:"degenerate_triangles"`
+	DuplicateTriangles  int        `json:"duplicate_triangles"`
+	BoundaryEdges       int        `json:"boundary_edges"`
+	Holes               int        `json:"holes"` // 边界环数量
+	NonManifoldEdges    int        `json:"non_manifold_edges"`
+	InconsistentEdges   int        `json:"inconsistent_edges"` // 两侧三角形绕序相同的边
+	Shells              int        `json:"shells"`
+	SelfIntersections   int        `json:"self_intersections"`
+	SelfIntersectSkip   bool       `json:"self_intersections_skipped,omitempty"`
+	SelfIntersectCapped bool       `json:"self_intersections_capped,omitempty"`
+	Watertight          bool       `json:"watertight"`
+	Printable           bool       `json:"printable"`
+	Volume              float64    `json:"volume"` // 封闭时才有意义，单位为模型单位的立方
+	Area                float64    `json:"area"`
+	Dimensions          [3]float32 `json:"dimensions"`
+	Issues              []string   `json:"issues,omitempty"`
+}
+
+// weldedMesh 焊接后的纯几何网格
+type weldedMesh struct {
+	pos  [][3]float32
+	tris [][3]uint32
+}
+
+type edgeKey [2]uint32
+
+func mkEdge(a, b uint32) edgeKey {
+	if a > b {
+		a, b = b, a
+	}
+	return edgeKey{a, b}
+}
+
+// weldEps 焊接容差：包围盒对角线的 1e-6
+func weldEps(s *Scene) float64 {
+	mn, mx := s.Bounds()
+	eps := float64(length3(sub3(mx, mn))) * 1e-6
+	if eps <= 0 {
+		eps = 1e-9
+	}
+	return eps
+}
+
+func weldKey(p [3]float32, eps float64) [3]int64 {
+	return [3]int64{int64(math.Round(float64(p[0]) / eps)), int64(math.Round(float64(p[1]) / eps)), int64(math.Round(float64(p[2]) / eps))}
+}
+
+// weldScene 合并所有网格并焊接重合顶点
+func weldScene(s *Scene) *weldedMesh {
+	eps := weldEps(s)
+	w := &weldedMesh{}
+	ids := map[[3]int64]uint32{}
+	for _, m := range s.Meshes {
+		remap := make([]uint32, len(m.Positions))
+		for i, p := range m.Positions {
+			k := weldKey(p, eps)
+			id, ok := ids[k]
+			if !ok {
+				id = uint32(len(w.pos))
+				ids[k] = id
+				w.pos = append(w.pos, p)
+			}
+			remap[i] = id
+		}
+		for i := 0; i+2 < len(m.Indices); i += 3 {
+			w.tris = append(w.tris, [3]uint32{remap[m.Indices[i]], remap[m.Indices[i+1]], remap[m.Indices[i+2]]})
+		}
+	}
+	return w
+}
+
+func (w *weldedMesh) area(t [3]uint32) float32 {
+	a, b, c := w.pos[t[0]], w.pos[t[1]], w.pos[t[2]]
+	return length3(cross3(sub3(b, a), sub3(c, a))) / 2
+}
+
+func (w *weldedMesh) degenerate(t [3]uint32, minArea float32) bool {
+	return t[0] == t[1] || t[1] == t[2] || t[0] == t[2] || w.area(t) <= minArea
+}
+
+func (w *weldedMesh) minArea() float32 {
+	mn, mx := (&Scene{Meshes: []*Mesh{{Positions: w.pos}}}).Bounds()
+	d := length3(sub3(mx, mn))
+	return d * d * 1e-12
+}
+
+// triKey 与绕序无关的三角形标识，用于查重
+func triKey(t [3]uint32) [3]uint32 {
+	if t[0] > t[1] {
+		t[0], t[1] = t[1], t[0]
+	}
+	if t[1] > t[2] {
+		t[1], t[2] = t[2], t[1]
+	}
+	if t[0] > t[1] {
+		t[0], t[1] = t[1], t[0]
+	}
+	return t
+}
+
+// edgeUse 一条无向边被哪些三角形以哪个方向使用
+type edgeUse struct {
+	tri     int32
+	forward bool // 三角形中的方向是 key[0]→key[1]
+}
+
+func (w *weldedMesh) edges() map[edgeKey][]edgeUse {
+	em := make(map[edgeKey][]edgeUse, len(w.tris)*3/2)
+	for ti, t := range w.tris {
+		for k := 0; k < 3; k++ {
+			a, b := t[k], t[(k+1)%3]
+			em[mkEdge(a, b)] = append(em[mkEdge(a, b)], edgeUse{tri: int32(ti), forward: a < b})
+		}
+	}
+	return em
+}
+
+// AnalyzePrintability 生成检查报告（不修改网格）
+func AnalyzePrintability(s *Scene) *PrintReport {
+	w := weldScene(s)
+	r := w.analyze()
+	if len(w.pos) > 0 {
+		mn, mx := s.Bounds()
+		r.Dimensions = sub3(mx, mn)
+	}
+	return r
+}
+
+func (w *weldedMesh) analyze() *PrintReport {
+	r := &PrintReport{Triangles: len(w.tris), Vertices: len(w.pos)}
+	minArea := w.minArea()
+	seen := map[[3]uint32]bool{}
+	for _, t := range w.tris {
+		if w.degenerate(t, minArea) {
+			r.DegenerateTriangles++
+		}
+		k := triKey(t)
+		if seen[k] {
+			r.DuplicateTriangles++
+		}
+		seen[k] = true
+		r.Area += float64(w.area(t))
+		a, b, c := w.pos[t[0]], w.pos[t[1]], w.pos[t[2]]
+		r.Volume += float64(dot3(a, cross3(b, c))) / 6
+	}
+
+	em := w.edges()
+	for _, uses := range em {
+		switch {
+		case len(uses) == 1:
+			r.BoundaryEdges++
+		case len(uses) > 2:
+			r.NonManifoldEdges++
+		case uses[0].forward == uses[1].forward:
+			r.InconsistentEdges++
+		}
+	}
+	r.Holes = len(w.boundaryLoops(em))
+	r.Shells = len(w.shells(em))
+	if len(w.tris) <= selfIntersectMaxTris {
+		r.SelfIntersections, r.SelfIntersectCapped = w.selfIntersections()
+	} else {
+		r.SelfIntersectSkip = true
+	}
+
+	r.Watertight = r.BoundaryEdges == 0 && r.NonManifoldEdges == 0 && len(w.tris) > 0
+	if r.Watertight && r.InconsistentEdges == 0 {
+		r.Volume = math.Abs(r.Volume)
+	} else {
+		r.Volume = 0
+	}
+	r.Printable = r.Watertight && r.InconsistentEdges == 0 && r.SelfIntersections == 0 && r.DegenerateTriangles == 0
+
+	issue := func(n int, msg string) {
+		if n > 0 {
+			r.Issues = append(r.Issues, msg)
+		}
+	}
+	issue(r.BoundaryEdges, "mesh is not watertight (open boundaries / holes)")
+	issue(r.NonManifoldEdges, "non-manifold edges (shared by more than two triangles)")
+	issue(r.InconsistentEdges, "inconsistent triangle winding (flipped normals)")
+	issue(r.SelfIntersections, "self-intersecting triangles")
+	issue(r.DegenerateTriangles, "degenerate (zero-area) triangles")
+	issue(r.DuplicateTriangles, "duplicate triangles")
+	if r.Shells > 1 {
+		r.Issues = append(r.Issues, "multiple disconnected shells")
+	}
+	return r
+}
+
+// boundaryLoops 把边界边按三角形方向串成环，返回每个环的顶点序列
+func (w *weldedMesh) boundaryLoops(em map[edgeKey][]edgeUse) [][]uint32 {
+	next := map[uint32][]uint32{}
+	for k, uses := range em {
+		if len(uses) != 1 {
+			continue
+		}
+		a, b := k[0], k[1]
+		if !uses[0].forward {
+			a, b = b, a
+		}
+		next[a] = append(next[a], b)
+	}
+	starts := make([]uint32, 0, len(next))
+	for v := range next {
+		starts = append(starts, v)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	var loops [][]uint32
+	for _, start := range starts {
+		for len(next[start]) > 0 {
+			loop := []uint32{start}
+			v := start
+			for {
+				outs := next[v]
+				if len(outs) == 0 {
+					break
+				}
+				n := outs[len(outs)-1]
+				next[v] = outs[:len(outs)-1]
+				if n == start {
+					break
+				}
+				loop = append(loop, n)
+				v = n
+			}
+			loops = append(loops, loop)
+		}
+	}
+	return loops
+}
+
+// shells 按共享边连通的三角形分组
+func (w *weldedMesh) shells(em map[edgeKey][]edgeUse) [][]int32 {
+	parent := make([]int32, len(w.tris))
+	for i := range parent {
+		parent[i] = int32(i)
+	}
+	find := func(x int32) int32 {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	for _, uses := range em {
+		for _, u := range uses[1:] {
+			a, b := find(uses[0].tri), find(u.tri)
+			if a != b {
+				parent[a] = b
+			}
+		}
+	}
+	groups := map[int32][]int32{}
+	var order []int32
+	for i := range w.tris {
+		root := find(int32(i))
+		if _, ok := groups[root]; !ok {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], int32(i))
+	}
+	out := make([][]int32, 0, len(order))
+	for _, root := range order {
+		out = append(out, groups[root])
+	}
+	return out
+}
+
+// selfIntersections 统计互相穿插的三角形对（共享顶点的相邻三角形不算）
+func (w *weldedMesh) selfIntersections() (int, bool) {
+	n := len(w.tris)
+	if n < 2 {
+		return 0, false
+	}
+	type box struct{ mn, mx [3]float32 }
+	boxes := make([]box, n)
+	var gmn, gmx [3]float32
+	for i, t := range w.tris {
+		b := box{w.pos[t[0]], w.pos[t[0]]}
+		for _, v := range t[1:] {
+			for k := 0; k < 3; k++ {
+				b.mn[k] = min(b.mn[k], w.pos[v][k])
+				b.mx[k] = max(b.mx[k], w.pos[v][k])
+			}
+		}
+		boxes[i] = b
+		if i == 0 {
+			gmn, gmx = b.mn, b.mx
+		}
+		for k := 0; k < 3; k++ {
+			gmn[k] = min(gmn[k], b.mn[k])
+			gmx[k] = max(gmx[k], b.mx[k])
+		}
+	}
+
+	// 每个格子平均约 2 个三角形
+	res := max(1, int(math.Cbrt(float64(n)/2)))
+	var cell [3]float32
+	for k := 0; k < 3; k++ {
+		cell[k] = (gmx[k] - gmn[k]) / float32(res)
+		if cell[k] <= 0 {
+			cell[k] = 1
+		}
+	}
+	idx := func(v float32, k int) int {
+		i := int((v - gmn[k]) / cell[k])
+		return min(max(i, 0), res-1)
+	}
+	grid := map[[3]int][]int32{}
+	for i, b := range boxes {
+		lo := [3]int{idx(b.mn[0], 0), idx(b.mn[1], 1), idx(b.mn[2], 2)}
+		hi := [3]int{idx(b.mx[0], 0), idx(b.mx[1], 1), idx(b.mx[2], 2)}
+		for x := lo[0]; x <= hi[0]; x++ {
+			for y := lo[1]; y <= hi[1]; y++ {
+				for z := lo[2]; z <= hi[2]; z++ {
+					grid[[3]int{x, y, z}] = append(grid[[3]int{x, y, z}], int32(i))
+				}
+			}
+		}
+	}
+
+	count := 0
+	for c, list := range grid {
+		for ai := 0; ai < len(list); ai++ {
+			a := list[ai]
+			for _, b := range list[ai+1:] {
+				ba, bb := boxes[a], boxes[b]
+				overlap := true
+				var first [3]int
+				for k := 0; k < 3; k++ {
+					if ba.mx[k] < bb.mn[k] || bb.mx[k] < ba.mn[k] {
+						overlap = false
+						break
+					}
+					// 一对三角形只在其包围盒重叠区域的最小格子里检测一次
+					first[k] = idx(max(ba.mn[k], bb.mn[k]), k)
+				}
+				if !overlap || first != c {
+					continue
+				}
+				ta, tb := w.tris[a], w.tris[b]
+				if sharesVertex(ta, tb) {
+					continue
+				}
+				if w.trisIntersect(ta, tb) {
+					count++
+					if count >= selfIntersectMaxReports {
+						return count, true
+					}
+				}
+			}
+		}
+	}
+	return count, false
+}
+
+func sharesVertex(a, b [3]uint32) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trisIntersect 任一三角形的某条边穿过另一个三角形即视为相交（忽略共面重叠）
+func (w *weldedMesh) trisIntersect(a, b [3]uint32) bool {
+	pa := [3][3]float32{w.pos[a[0]], w.pos[a[1]], w.pos[a[2]]}
+	pb := [3][3]float32{w.pos[b[0]], w.pos[b[1]], w.pos[b[2]]}
+	for k := 0; k < 3; k++ {
+		if segmentHitsTri(pa[k], pa[(k+1)%3], pb) || segmentHitsTri(pb[k], pb[(k+1)%3], pa) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentHitsTri Möller–Trumbore，端点和三角形边上的接触不算
+func segmentHitsTri(p, q [3]float32, t [3][3]float32) bool {
+	const eps = 1e-7
+	dir := sub3(q, p)
+	e1, e2 := sub3(t[1], t[0]), sub3(t[2], t[0])
+	h := cross3(dir, e2)
+	det := dot3(e1, h)
+	if det > -eps && det < eps {
+		return false
+	}
+	inv := 1 / det
+	s := sub3(p, t[0])
+	u := inv * dot3(s, h)
+	if u <= eps || u >= 1-eps {
+		return false
+	}
+	qv := cross3(s, e1)
+	v := inv * dot3(dir, qv)
+	if v <= eps || u+v >= 1-eps {
+		return false
+	}
+	tt := inv * dot3(e2, qv)
+	return tt > eps && tt < 1-eps
+}
+
+/* =========================
+   修复
+   ========================= */
+
+// RepairForPrint 焊接顶点、去掉退化和重复三角形、统一绕序并朝外、补洞，返回单网格场景。
+// 非流形边和自相交无法自动修复，会保留在修复后的报告里。
+func RepairForPrint(s *Scene) (*Scene, *PrintReport) {
+	w := weldScene(s)
+
+	minArea := w.minArea()
+	seen := map[[3]uint32]bool{}
+	kept := w.tris[:0]
+	for _, t := range w.tris {
+		k := triKey(t)
+		if w.degenerate(t, minArea) || seen[k] {
+			continue
+		}
+		seen[k] = true
+		kept = append(kept, t)
+	}
+	w.tris = kept
+
+	w.orient()
+	w.fillHoles()
+	w.orient()
+
+	r := w.analyze()
+	if len(w.pos) > 0 {
+		mn, mx := s.Bounds()
+		r.Dimensions = sub3(mx, mn)
+	}
+
+	m := &Mesh{Name: "repaired", Material: -1, Positions: w.pos}
+	m.Indices = make([]uint32, 0, len(w.tris)*3)
+	for _, t := range w.tris {
+		m.Indices = append(m.Indices, t[0], t[1], t[2])
+	}
+	return &Scene{Meshes: []*Mesh{m}, MetersPerUnit: s.MetersPerUnit, ZUp: s.ZUp, Provenance: s.Provenance}, r
+}
+
+// orient 在每个壳体内沿流形边传播，使相邻三角形绕序一致；再按有向体积让封闭壳体朝外
+func (w *weldedMesh) orient() {
+	em := w.edges()
+	adj := make([][]int32, len(w.tris))
+	for _, uses := range em {
+		if len(uses) == 2 {
+			a, b := uses[0].tri, uses[1].tri
+			adj[a] = append(adj[a], b)
+			adj[b] = append(adj[b], a)
+		}
+	}
+	hasEdge := func(t [3]uint32, a, b uint32) bool {
+		for k := 0; k < 3; k++ {
+			if t[k] == a && t[(k+1)%3] == b {
+				return true
+			}
+		}
+		return false
+	}
+
+	done := make([]bool, len(w.tris))
+	for seed := range w.tris {
+		if done[seed] {
+			continue
+		}
+		shell := []int32{int32(seed)}
+		done[seed] = true
+		for q := 0; q < len(shell); q++ {
+			ti := shell[q]
+			t := w.tris[ti]
+			for _, ni := range adj[ti] {
+				if done[ni] {
+					continue
+				}
+				// 邻居与当前三角形以相同方向使用共享边时翻转邻居
+				for k := 0; k < 3; k++ {
+					a, b := t[k], t[(k+1)%3]
+					if hasEdge(w.tris[ni], a, b) {
+						n := w.tris[ni]
+						w.tris[ni] = [3]uint32{n[0], n[2], n[1]}
+						break
+					}
+				}
+				done[ni] = true
+				shell = append(shell, ni)
+			}
+		}
+		vol := 0.0
+		for _, ti := range shell {
+			t := w.tris[ti]
+			vol += float64(dot3(w.pos[t[0]], cross3(w.pos[t[1]], w.pos[t[2]])))
+		}
+		if vol < 0 {
+			for _, ti := range shell {
+				t := w.tris[ti]
+				w.tris[ti] = [3]uint32{t[0], t[2], t[1]}
+			}
+		}
+	}
+}
+
+// fillHoles 用中心点扇形补上每个边界环
+func (w *weldedMesh) fillHoles() {
+	for _, loop := range w.boundaryLoops(w.edges()) {
+		if len(loop) < 3 {
+			continue
+		}
+		if len(loop) == 3 {
+			w.tris = append(w.tris, [3]uint32{loop[0], loop[2], loop[1]})
+			continue
+		}
+		var c [3]float32
+		for _, v := range loop {
+			c = add3(c, w.pos[v])
+		}
+		c = scale3(c, 1/float32(len(loop)))
+		ci := uint32(len(w.pos))
+		w.pos = append(w.pos, c)
+		// 边界边方向为 a→b（与所属三角形一致），补面需反向 b→a
+		for i := range loop {
+			a, b := loop[i], loop[(i+1)%len(loop)]
+			w.tris = append(w.tris, [3]uint32{ci, b, a})
+		}
+	}
+}
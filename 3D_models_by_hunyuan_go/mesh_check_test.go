@@ -0,0 +1,91 @@
+// mesh_check_test.go
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// signedVolume 按绕序计算的有向体积，朝外为正
+func signedVolume(m *Mesh) float64 {
+	v := 0.0
+	for i := 0; i+2 < len(m.Indices); i += 3 {
+		a, b, c := m.Positions[m.Indices[i]], m.Positions[m.Indices[i+1]], m.Positions[m.Indices[i+2]]
+		v += float64(dot3(a, cross3(b, c))) / 6
+	}
+	return v
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-5
+}
+
+func TestAnalyzePrintabilityClosedCube(t *testing.T) {
+	r := AnalyzePrintability(cubeTestScene())
+	if r.Triangles != 12 || r.Vertices != 8 {
+		t.Fatalf("triangles = %d, vertices = %d", r.Triangles, r.Vertices)
+	}
+	if r.Holes != 0 || r.BoundaryEdges != 0 || r.NonManifoldEdges != 0 || r.InconsistentEdges != 0 || r.Shells != 1 {
+		t.Fatalf("report = %+v", r)
+	}
+	if !r.Watertight || !r.Printable || len(r.Issues) != 0 {
+		t.Fatalf("watertight = %v, printable = %v, issues = %v", r.Watertight, r.Printable, r.Issues)
+	}
+	if !near(r.Volume, 1) || !near(r.Area, 6) || r.Dimensions != [3]float32{1, 1, 1} {
+		t.Fatalf("volume = %g, area = %g, dimensions = %v", r.Volume, r.Area, r.Dimensions)
+	}
+}
+
+func TestRepairForPrintFillsHole(t *testing.T) {
+	s := cubeTestScene()
+	s.Meshes[0].Indices = s.Meshes[0].Indices[6:] // 去掉 z=0 的面
+	r := AnalyzePrintability(s)
+	if r.Holes != 1 || r.BoundaryEdges != 4 || r.Watertight || r.Printable || r.Volume != 0 {
+		t.Fatalf("open cube report = %+v", r)
+	}
+
+	fixed, rr := RepairForPrint(s)
+	if rr.Holes != 0 || rr.BoundaryEdges != 0 || rr.InconsistentEdges != 0 || rr.Shells != 1 {
+		t.Fatalf("repaired report = %+v", rr)
+	}
+	if !rr.Watertight || !rr.Printable || !near(rr.Volume, 1) {
+		t.Fatalf("watertight = %v, printable = %v, volume = %g", rr.Watertight, rr.Printable, rr.Volume)
+	}
+	// 修复结果重新检查一遍，与修复报告一致
+	if again := AnalyzePrintability(fixed); !again.Watertight || again.Holes != 0 || !near(signedVolume(fixed.Meshes[0]), 1) {
+		t.Fatalf("re-analyzed = %+v, signed volume %g", again, signedVolume(fixed.Meshes[0]))
+	}
+	if len(s.Meshes[0].Indices) != 30 {
+		t.Fatalf("input mesh modified: %d indices", len(s.Meshes[0].Indices))
+	}
+}
+
+func TestRepairForPrintWinding(t *testing.T) {
+	flipped := cubeTestScene()
+	idx := flipped.Meshes[0].Indices
+	idx[1], idx[2] = idx[2], idx[1]
+
+	inverted := cubeTestScene()
+	idx = inverted.Meshes[0].Indices
+	for i := 0; i+2 < len(idx); i += 3 {
+		idx[i+1], idx[i+2] = idx[i+2], idx[i+1]
+	}
+
+	for name, s := range map[string]*Scene{"one flipped triangle": flipped, "inside out": inverted} {
+		t.Run(name, func(t *testing.T) {
+			r := AnalyzePrintability(s)
+			if name == "one flipped triangle" && (r.InconsistentEdges != 3 || r.Printable) {
+				t.Fatalf("inconsistent edges = %d, printable = %v", r.InconsistentEdges, r.Printable)
+			}
+
+			fixed, rr := RepairForPrint(s)
+			if rr.InconsistentEdges != 0 || !rr.Watertight || !rr.Printable || rr.Triangles != 12 {
+				t.Fatalf("repaired report = %+v", rr)
+			}
+			// 统一绕序后整体朝外
+			if v := signedVolume(fixed.Meshes[0]); !near(v, 1) {
+				t.Fatalf("signed volume = %g, want 1", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+// mesh_obj.go
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/* =========================
+   OBJ / ZIP 解析
+   ========================= */
+
+// ParseModel 按校验得到的实际格式解析模型文件
+func ParseModel(data []byte, format string) (*Scene, error) {
+	switch format {
+	case "glb", "gltf":
+		return ParseGLB(data)
+	case "obj":
+		return ParseOBJ(data, func(string) []byte { return nil })
+	case "zip":
+		return parseModelZip(data)
+	case "stl":
+		return ParseSTL(data)
+	}
+	return nil, fmt.Errorf("cannot parse %s models", format)
+}
+
+// 压缩包解压出的总字节数上限为上传上限的倍数；OBJ 文本的压缩比通常不到 10 倍，超出按压缩炸弹拒绝
+const zipExpandRatio = 16
+
+// zipBudget 限制一个压缩包解压出的总字节数
+type zipBudget struct{ left int64 }
+
+func newZipBudget() *zipBudget { return &zipBudget{left: zipExpandRatio * uploadMaxBytes} }
+
+// copy 解压 f 写入 w；声明的大小或实际解压出的字节数超出剩余额度时返回错误
+func (b *zipBudget) copy(w io.Writer, f *zip.File) error {
+	if f.UncompressedSize64 > uint64(b.left) {
+		return fmt.Errorf("zip: %s: uncompressed size exceeds the %d byte limit", f.Name, zipExpandRatio*uploadMaxBytes)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("zip: %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	n, err := io.Copy(w, io.LimitReader(rc, b.left+1))
+	b.left -= n
+	if err != nil {
+		return fmt.Errorf("zip: %s: %v", f.Name, err)
+	}
+	if b.left < 0 {
+		return fmt.Errorf("zip: %s: uncompressed size exceeds the %d byte limit", f.Name, zipExpandRatio*uploadMaxBytes)
+	}
+	return nil
+}
+
+// parseModelZip 取包内第一个模型文件；OBJ 的 MTL 和贴图按文件名在包内查找
+func parseModelZip(data []byte) (*Scene, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("zip: %v", err)
+	}
+	byName := map[string]*zip.File{}
+	for _, f := range zr.File {
+		byName[strings.ToLower(path.Base(f.Name))] = f
+	}
+	budget := newZipBudget()
+	var readErr error
+	read := func(f *zip.File) []byte {
+		var buf bytes.Buffer
+		if err := budget.copy(&buf, f); err != nil {
+			if readErr == nil {
+				readErr = err
+			}
+			return nil
+		}
+		return buf.Bytes()
+	}
+	// 超出额度时以额度错误为准，而不是随后的解析错误
+	result := func(s *Scene, err error) (*Scene, error) {
+		if readErr != nil {
+			return nil, readErr
+		}
+		return s, err
+	}
+	for _, f := range zr.File {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".glb", ".gltf":
+			return result(ParseGLB(read(f)))
+		case ".obj":
+			return result(ParseOBJ(read(f), func(name string) []byte {
+				if zf, ok := byName[strings.ToLower(path.Base(strings.ReplaceAll(name, `\`, "/")))]; ok {
+					return read(zf)
+				}
+				return nil
+			}))
+		}
+	}
+	return nil, errors.New("zip: no GLB/GLTF/OBJ inside")
+}
+
+type objGroup struct {
+	mesh       *Mesh
+	vmap       map[[3]int32]uint32
+	missingN   bool
+	missingUV  bool
+	missingCol bool
+}
+
+// ParseOBJ 解析 OBJ 文本；open 按文件名读取 mtllib 和贴图（找不到返回 nil）。
+// 按材质拆成多个 Mesh，多边形按扇形三角化，UV 转成 glTF 约定（v 向下）。
+func ParseOBJ(data []byte, open func(name string) []byte) (*Scene, error) {
+	var pos, nrm [][3]float32
+	var col [][3]float32
+	var uv [][2]float32
+	var mtllibs []string
+	groups := map[string]*objGroup{}
+	var order []string
+	cur := ""
+
+	group := func() *objGroup {
+		g, ok := groups[cur]
+		if !ok {
+			g = &objGroup{mesh: &Mesh{Material: -1}, vmap: map[[3]int32]uint32{}}
+			g.mesh.Name = cur
+			if g.mesh.Name == "" {
+				g.mesh.Name = "default"
+			}
+			groups[cur] = g
+			order = append(order, cur)
+		}
+		return g
+	}
+	floats := func(f []string, n int) ([]float32, error) {
+		if len(f) < n {
+			return nil, errors.New("too few components")
+		}
+		out := make([]float32, n)
+		for i := 0; i < n; i++ {
+			v, err := strconv.ParseFloat(f[i], 32)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = float32(v)
+		}
+		return out, nil
+	}
+	// resolve 处理 1 起始和负数（相对）索引，0 表示缺省
+	resolve := func(s string, n int) (int32, error) {
+		if s == "" {
+			return -1, nil
+		}
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, err
+		}
+		if i < 0 {
+			i += n + 1
+		}
+		if i < 1 || i > n {
+			return 0, fmt.Errorf("index %s out of range", s)
+		}
+		return int32(i - 1), nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	line := 0
+	var corner []uint32
+	for sc.Scan() {
+		line++
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		switch f[0] {
+		case "v":
+			v, err := floats(f[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj: line %d: %v", line, err)
+			}
+			pos = append(pos, [3]float32{v[0], v[1], v[2]})
+			if c, err := floats(f[4:], 3); err == nil {
+				col = append(col, [3]float32{c[0], c[1], c[2]})
+			}
+		case "vt":
+			v, err := floats(f[1:], 1)
+			if err != nil {
+				return nil, fmt.Errorf("obj: line %d: %v", line, err)
+			}
+			t := [2]float32{v[0], 0}
+			if len(f) > 2 {
+				if w, err := strconv.ParseFloat(f[2], 32); err == nil {
+					t[1] = float32(w)
+				}
+			}
+			uv = append(uv, [2]float32{t[0], 1 - t[1]})
+		case "vn":
+			v, err := floats(f[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj: line %d: %v", line, err)
+			}
+			nrm = append(nrm, normalize3([3]float32{v[0], v[1], v[2]}))
+		case "usemtl":
+			cur = strings.Join(f[1:], " ")
+		case "mtllib":
+			mtllibs = append(mtllibs, strings.Join(f[1:], " "))
+		case "f":
+			if len(f) < 4 {
+				continue
+			}
+			g := group()
+			m := g.mesh
+			corner = corner[:0]
+			for _, tok := range f[1:] {
+				parts := strings.Split(tok, "/")
+				var key [3]int32
+				var err error
+				if key[0], err = resolve(parts[0], len(pos)); err != nil || key[0] < 0 {
+					return nil, fmt.Errorf("obj: line %d: bad vertex %q", line, tok)
+				}
+				key[1], key[2] = -1, -1
+				if len(parts) > 1 {
+					if key[1], err = resolve(parts[1], len(uv)); err != nil {
+						return nil, fmt.Errorf("obj: line %d: %v", line, err)
+					}
+				}
+				if len(parts) > 2 {
+					if key[2], err = resolve(parts[2], len(nrm)); err != nil {
+						return nil, fmt.Errorf("obj: line %d: %v", line, err)
+					}
+				}
+				vi, ok := g.vmap[key]
+				if !ok {
+					vi = uint32(len(m.Positions))
+					g.vmap[key] = vi
+					m.Positions = append(m.Positions, pos[key[0]])
+					if key[1] >= 0 {
+						m.UVs = append(m.UVs, uv[key[1]])
+					} else {
+						m.UVs = append(m.UVs, [2]float32{})
+						g.missingUV = true
+					}
+					if key[2] >= 0 {
+						m.Normals = append(m.Normals, nrm[key[2]])
+					} else {
+						m.Normals = append(m.Normals, [3]float32{})
+						g.missingN = true
+					}
+					if int(key[0]) < len(col) && len(col) == len(pos) {
+						c := col[key[0]]
+						m.Colors = append(m.Colors, [4]float32{c[0], c[1], c[2], 1})
+					} else {
+						g.missingCol = true
+					}
+				}
+				corner = append(corner, vi)
+			}
+			for i := 1; i+1 < len(corner); i++ {
+				m.Indices = append(m.Indices, corner[0], corner[i], corner[i+1])
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("obj: %v", err)
+	}
+	if len(order) == 0 {
+		return nil, errors.New("obj: no faces")
+	}
+
+	s := &Scene{}
+	mats := map[string]objMaterial{}
+	for _, lib := range mtllibs {
+		if b := open(lib); b != nil {
+			for name, m := range parseMTL(b) {
+				mats[name] = m
+			}
+		}
+	}
+	imgIdx := map[string]int{}
+	image := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		if i, ok := imgIdx[name]; ok {
+			return i
+		}
+		i := -1
+		if b := open(name); len(b) > 0 {
+			mt := "image/png"
+			switch sniffFormat(b[:min(len(b), 512)]) {
+			case "jpeg":
+				mt = "image/jpeg"
+			case "webp":
+				mt = "image/webp"
+			}
+			s.Images = append(s.Images, Image{Name: path.Base(strings.ReplaceAll(name, `\`, "/")), MimeType: mt, Data: b})
+			i = len(s.Images) - 1
+		}
+		imgIdx[name] = i
+		return i
+	}
+
+	for _, name := range order {
+		g := groups[name]
+		m := g.mesh
+		if g.missingN {
+			m.Normals = nil
+		}
+		if g.missingUV {
+			m.UVs = nil
+		}
+		if g.missingCol {
+			m.Colors = nil
+		}
+		if om, ok := mats[name]; ok && name != "" {
+			mat := om.Material
+			mat.Name = name
+			mat.BaseColorTex = image(om.mapKd)
+			mat.NormalTex = image(om.mapBump)
+			mat.EmissiveTex = image(om.mapKe)
+			s.Materials = append(s.Materials, mat)
+			m.Material = len(s.Materials) - 1
+		}
+		s.Meshes = append(s.Meshes, m)
+	}
+	return s, nil
+}
+
+type objMaterial struct {
+	Material
+	mapKd, mapBump, mapKe string
+}
+
+// parseMTL 把 Phong 参数近似换算成 PBR（Pr/Pm 扩展优先）
+func parseMTL(data []byte) map[string]objMaterial {
+	out := map[string]objMaterial{}
+	var cur *objMaterial
+	var curName string
+	hasPr := false
+	flush := func() {
+		if cur != nil {
+			out[curName] = *cur
+		}
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	num := func(s string) float32 {
+		v, _ := strconv.ParseFloat(s, 32)
+		return float32(v)
+	}
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		if f[0] == "newmtl" {
+			flush()
+			curName = strings.Join(f[1:], " ")
+			cur = &objMaterial{Material: Material{
+				BaseColor: [4]float32{1, 1, 1, 1}, Metallic: 0, Roughness: 1,
+				BaseColorTex: -1, MetalRoughTex: -1, NormalTex: -1, EmissiveTex: -1, OcclusionTex: -1,
+			}}
+			hasPr = false
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		last := f[len(f)-1] // 贴图语句前面可能带 -bm 等选项，文件名取最后一项
+		switch strings.ToLower(f[0]) {
+		case "kd":
+			if len(f) >= 4 {
+				cur.BaseColor[0], cur.BaseColor[1], cur.BaseColor[2] = num(f[1]), num(f[2]), num(f[3])
+			}
+		case "d":
+			cur.BaseColor[3] = num(last)
+		case "tr":
+			cur.BaseColor[3] = 1 - num(last)
+		case "ke":
+			if len(f) >= 4 {
+				cur.Emissive = [3]float32{num(f[1]), num(f[2]), num(f[3])}
+			}
+		case "ns":
+			if !hasPr {
+				cur.Roughness = float32(1 - math.Sqrt(float64(min(max(num(last), 0), 1000))/1000))
+			}
+		case "pr":
+			cur.Roughness, hasPr = num(last), true
+		case "pm":
+			cur.Metallic = num(last)
+		case "map_kd":
+			cur.mapKd = last
+		case "map_bump", "bump", "norm":
+			cur.mapBump = last
+		case "map_ke":
+			cur.mapKe = last
+		}
+		if cur.BaseColor[3] < 1 {
+			cur.AlphaMode = "BLEND"
+		} else {
+			cur.AlphaMode = ""
+		}
+	}
+	flush()
+	return out
+}
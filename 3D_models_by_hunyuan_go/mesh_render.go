@@ -0,0 +1,476 @@
+// mesh_render.go
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+	"sort"
+)
+
+/* =========================
+   CPU 软件光栅化
+   ========================= */
+
+// 不依赖 GPU 的简单渲染器：透视相机环绕包围球，z-buffer 先记录每个像素命中的三角形，
+// 再逐像素着色（底色 × 贴图 × 顶点色，Lambert 漫反射 + Blinn 高光 + 环境光，线性空间计算后转 sRGB），
+// 超采样后按 alpha 加权缩小抗锯齿。双面渲染，不处理透明排序和阴影。
+
+type RenderOptions struct {
+	Width, Height int
+	Yaw, Pitch    float64 // 相机方位角/仰角（度），yaw=0 从 +Z 方向看向模型
+	FOV           float64 // 视角（度），按宽高中较短的一边计算
+	Background    color.NRGBA
+	LightYaw      float64 // 主光方向，相对相机（度）
+	LightPitch    float64
+	Light         float64 // 主光强度
+	Ambient       float64 // 环境光强度
+	Supersample   int
+}
+
+func defaultRenderOptions() RenderOptions {
+	return RenderOptions{
+		Width: 512, Height: 512, Yaw: 30, Pitch: 20, FOV: 35,
+		Background: color.NRGBA{255, 255, 255, 255},
+		LightYaw:   -35, LightPitch: 45, Light: 0.9, Ambient: 0.35, Supersample: 2,
+	}
+}
+
+type renderer struct {
+	s        *Scene
+	tex      []*image.NRGBA // 解码失败（如 WebP）为 nil，只用材质底色
+	center   [3]float64
+	radius   float64
+	srgbToLn [256]float32
+}
+
+func newRenderer(s *Scene) *renderer {
+	r := &renderer{s: s}
+	for i := range r.srgbToLn {
+		r.srgbToLn[i] = float32(srgbToLinear(float64(i) / 255))
+	}
+	r.tex = make([]*image.NRGBA, len(s.Images))
+	for i, im := range s.Images {
+		if src, _, err := image.Decode(bytes.NewReader(im.Data)); err == nil {
+			b := src.Bounds()
+			t := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+			draw.Draw(t, t.Bounds(), src, b.Min, draw.Src)
+			r.tex[i] = t
+		}
+	}
+	if s.VertexCount() > 0 {
+		mn, mx := s.Bounds()
+		for k := 0; k < 3; k++ {
+			r.center[k] = (float64(mn[k]) + float64(mx[k])) / 2
+		}
+		for _, m := range s.Meshes {
+			for _, p := range m.Positions {
+				r.radius = math.Max(r.radius, math.Sqrt(dot64(sub64(vec64(p), r.center), sub64(vec64(p), r.center))))
+			}
+		}
+	}
+	if r.radius == 0 {
+		r.radius = 1
+	}
+	return r
+}
+
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(c float64) uint8 {
+	c = math.Min(math.Max(c, 0), 1)
+	if c <= 0.0031308 {
+		c *= 12.92
+	} else {
+		c = 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	return uint8(c*255 + 0.5)
+}
+
+func normalize64(v [3]float64) [3]float64 {
+	l := math.Sqrt(dot64(v, v))
+	if l == 0 {
+		return v
+	}
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
+
+func scale64(v [3]float64, f float64) [3]float64 { return [3]float64{v[0] * f, v[1] * f, v[2] * f} }
+
+func add64(a, b [3]float64) [3]float64 { return [3]float64{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+
+// orbit 方位角/仰角对应的单位方向（从目标指向相机）
+func orbit(yaw, pitch float64) [3]float64 {
+	y, p := yaw*math.Pi/180, pitch*math.Pi/180
+	return [3]float64{math.Cos(p) * math.Sin(y), math.Sin(p), math.Cos(p) * math.Cos(y)}
+}
+
+type gsample struct {
+	mesh, tri int32 // mesh < 0 表示背景
+	b1, b2    float32
+}
+
+// Render 渲染一帧
+func (r *renderer) Render(o RenderOptions) *image.NRGBA {
+	ss := max(o.Supersample, 1)
+	W, H := o.Width*ss, o.Height*ss
+	pitch := math.Min(math.Max(o.Pitch, -89), 89)
+	fov := math.Min(math.Max(o.FOV, 5), 120) * math.Pi / 180
+
+	dir := orbit(o.Yaw, pitch)
+	// 包围球恰好入画时的距离再留约 10% 边距
+	dist := r.radius / math.Sin(fov/2) * 1.1
+	eye := add64(r.center, scale64(dir, dist))
+	fwd := scale64(dir, -1)
+	right := normalize64(cross64(fwd, [3]float64{0, 1, 0}))
+	up := cross64(right, fwd)
+	fpx := float64(min(W, H)) / 2 / math.Tan(fov/2)
+
+	// 主光方向跟随相机，转台时相当于模型在固定灯光下旋转
+	lc := orbit(o.LightYaw, o.LightPitch)
+	light := normalize64(add64(add64(scale64(right, lc[0]), scale64(up, lc[1])), scale64(dir, lc[2])))
+
+	depth := make([]float32, W*H)
+	for i := range depth {
+		depth[i] = float32(math.Inf(1))
+	}
+	gbuf := make([]gsample, W*H)
+	for i := range gbuf {
+		gbuf[i].mesh = -1
+	}
+
+	type proj struct{ x, y, invz float64 }
+	for mi, m := range r.s.Meshes {
+		pv := make([]proj, len(m.Positions))
+		for i, p := range m.Positions {
+			v := sub64(vec64(p), eye)
+			z := dot64(v, fwd)
+			if z <= 1e-9 {
+				z = 1e-9
+			}
+			pv[i] = proj{float64(W)/2 + dot64(v, right)/z*fpx, float64(H)/2 - dot64(v, up)/z*fpx, 1 / z}
+		}
+		for t := 0; t+2 < len(m.Indices); t += 3 {
+			i0, i1, i2 := m.Indices[t], m.Indices[t+1], m.Indices[t+2]
+			if int(max(i0, i1, i2)) >= len(pv) {
+				continue
+			}
+			a, b, c := pv[i0], pv[i1], pv[i2]
+			area := (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+			if math.Abs(area) < 1e-12 {
+				continue
+			}
+			x0 := max(int(math.Floor(min(a.x, b.x, c.x))), 0)
+			x1 := min(int(math.Ceil(max(a.x, b.x, c.x))), W-1)
+			y0 := max(int(math.Floor(min(a.y, b.y, c.y))), 0)
+			y1 := min(int(math.Ceil(max(a.y, b.y, c.y))), H-1)
+			for y := y0; y <= y1; y++ {
+				py := float64(y) + 0.5
+				for x := x0; x <= x1; x++ {
+					px := float64(x) + 0.5
+					w0 := ((b.x-px)*(c.y-py) - (b.y-py)*(c.x-px)) / area
+					w1 := ((c.x-px)*(a.y-py) - (c.y-py)*(a.x-px)) / area
+					w2 := 1 - w0 - w1
+					if w0 < 0 || w1 < 0 || w2 < 0 {
+						continue
+					}
+					iz := w0*a.invz + w1*b.invz + w2*c.invz
+					z := float32(1 / iz)
+					k := y*W + x
+					if z >= depth[k] {
+						continue
+					}
+					depth[k] = z
+					// 透视校正的重心坐标
+					gbuf[k] = gsample{int32(mi), int32(t / 3), float32(w1 * b.invz / iz), float32(w2 * c.invz / iz)}
+				}
+			}
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, W, H))
+	for k, g := range gbuf {
+		p := img.Pix[k*4 : k*4+4]
+		if g.mesh < 0 {
+			p[0], p[1], p[2], p[3] = o.Background.R, o.Background.G, o.Background.B, o.Background.A
+			continue
+		}
+		view := normalize64(sub64(eye, r.pointOn(g)))
+		col := r.shade(g, view, light, o)
+		p[0], p[1], p[2], p[3] = linearToSRGB(col[0]), linearToSRGB(col[1]), linearToSRGB(col[2]), 255
+	}
+	if ss == 1 {
+		return img
+	}
+	return resolve(img, o.Width, o.Height, ss)
+}
+
+func (r *renderer) corners(g gsample) (*Mesh, [3]uint32, [3]float64) {
+	m := r.s.Meshes[g.mesh]
+	t := int(g.tri) * 3
+	b1, b2 := float64(g.b1), float64(g.b2)
+	return m, [3]uint32{m.Indices[t], m.Indices[t+1], m.Indices[t+2]}, [3]float64{1 - b1 - b2, b1, b2}
+}
+
+func (r *renderer) pointOn(g gsample) [3]float64 {
+	m, idx, w := r.corners(g)
+	var p [3]float64
+	for i := 0; i < 3; i++ {
+		p = add64(p, scale64(vec64(m.Positions[idx[i]]), w[i]))
+	}
+	return p
+}
+
+// shade 计算一个像素的线性颜色
+func (r *renderer) shade(g gsample, view, light [3]float64, o RenderOptions) [3]float64 {
+	m, idx, w := r.corners(g)
+
+	var n [3]float64
+	if len(m.Normals) == len(m.Positions) {
+		for i := 0; i < 3; i++ {
+			n = add64(n, scale64(vec64(m.Normals[idx[i]]), w[i]))
+		}
+	}
+	if dot64(n, n) < 1e-12 {
+		n = vec64(FaceNormal(m.Positions[idx[0]], m.Positions[idx[1]], m.Positions[idx[2]]))
+	}
+	n = normalize64(n)
+	if dot64(n, view) < 0 {
+		n = scale64(n, -1) // 双面
+	}
+
+	base := [3]float64{0.8, 0.8, 0.8}
+	rough, metal := 0.6, 0.0
+	var emissive [3]float64
+	if m.Material >= 0 && m.Material < len(r.s.Materials) {
+		mat := r.s.Materials[m.Material]
+		base = [3]float64{float64(mat.BaseColor[0]), float64(mat.BaseColor[1]), float64(mat.BaseColor[2])}
+		rough, metal = float64(mat.Roughness), float64(mat.Metallic)
+		emissive = [3]float64{float64(mat.Emissive[0]), float64(mat.Emissive[1]), float64(mat.Emissive[2])}
+		if len(m.UVs) == len(m.Positions) && mat.BaseColorTex >= 0 && mat.BaseColorTex < len(r.tex) && r.tex[mat.BaseColorTex] != nil {
+			var u, v float64
+			for i := 0; i < 3; i++ {
+				u += float64(m.UVs[idx[i]][0]) * w[i]
+				v += float64(m.UVs[idx[i]][1]) * w[i]
+			}
+			tc := r.sample(r.tex[mat.BaseColorTex], u, v)
+			for k := 0; k < 3; k++ {
+				base[k] *= tc[k]
+			}
+		}
+	}
+	if len(m.Colors) == len(m.Positions) {
+		for k := 0; k < 3; k++ {
+			var c float64
+			for i := 0; i < 3; i++ {
+				c += float64(m.Colors[idx[i]][k]) * w[i]
+			}
+			base[k] *= c
+		}
+	}
+
+	diff := math.Max(dot64(n, light), 0)
+	h := normalize64(add64(light, view))
+	shin := 2 + (1-rough)*(1-rough)*126
+	spec := math.Pow(math.Max(dot64(n, h), 0), shin) * (1 - rough) * 0.5
+	var out [3]float64
+	for k := 0; k < 3; k++ {
+		// 金属度越高，漫反射越弱、高光越带底色
+		d := base[k] * (1 - metal*0.8)
+		sc := 1 - metal + metal*base[k]
+		out[k] = d*(o.Ambient+o.Light*diff) + o.Light*spec*sc + emissive[k]
+	}
+	return out
+}
+
+// sample 双线性采样（UV 重复平铺，v 向下），返回线性颜色
+func (r *renderer) sample(t *image.NRGBA, u, v float64) [3]float64 {
+	w, h := t.Rect.Dx(), t.Rect.Dy()
+	x := (u-math.Floor(u))*float64(w) - 0.5
+	y := (v-math.Floor(v))*float64(h) - 0.5
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	at := func(px, py int) []uint8 {
+		px = ((px % w) + w) % w
+		py = ((py % h) + h) % h
+		return t.Pix[py*t.Stride+px*4:]
+	}
+	p00, p10, p01, p11 := at(x0, y0), at(x0+1, y0), at(x0, y0+1), at(x0+1, y0+1)
+	var out [3]float64
+	for k := 0; k < 3; k++ {
+		a := float64(r.srgbToLn[p00[k]])*(1-fx) + float64(r.srgbToLn[p10[k]])*fx
+		b := float64(r.srgbToLn[p01[k]])*(1-fx) + float64(r.srgbToLn[p11[k]])*fx
+		out[k] = a*(1-fy) + b*fy
+	}
+	return out
+}
+
+// resolve 超采样缩小，按 alpha 加权避免透明背景边缘发黑
+func resolve(src *image.NRGBA, w, h, ss int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	n := ss * ss
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b, a int
+			for sy := 0; sy < ss; sy++ {
+				row := src.Pix[(y*ss+sy)*src.Stride:]
+				for sx := 0; sx < ss; sx++ {
+					p := row[(x*ss+sx)*4:]
+					pa := int(p[3])
+					r += int(p[0]) * pa
+					g += int(p[1]) * pa
+					b += int(p[2]) * pa
+					a += pa
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			if a > 0 {
+				d[0], d[1], d[2] = uint8((r+a/2)/a), uint8((g+a/2)/a), uint8((b+a/2)/a)
+			}
+			d[3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+/* =========================
+   转台动画
+   ========================= */
+
+// Turntable 绕 Y 轴等角度渲染 frames 帧
+func (r *renderer) Turntable(o RenderOptions, frames int) []*image.NRGBA {
+	out := make([]*image.NRGBA, frames)
+	for i := range out {
+		fo := o
+		fo.Yaw = o.Yaw + 360*float64(i)/float64(frames)
+		out[i] = r.Render(fo)
+	}
+	return out
+}
+
+// SpriteSheet 把帧按行排成网格，列数为 ceil(sqrt(帧数))
+func SpriteSheet(frames []*image.NRGBA) *image.NRGBA {
+	cols := int(math.Ceil(math.Sqrt(float64(len(frames)))))
+	rows := (len(frames) + cols - 1) / cols
+	fw, fh := frames[0].Rect.Dx(), frames[0].Rect.Dy()
+	sheet := image.NewNRGBA(image.Rect(0, 0, cols*fw, rows*fh))
+	for i, f := range frames {
+		x, y := i%cols*fw, i/cols*fh
+		draw.Draw(sheet, image.Rect(x, y, x+fw, y+fh), f, image.Point{}, draw.Src)
+	}
+	return sheet
+}
+
+// TurntableGIF 所有帧共用一个中位切分调色板；透明背景占用 0 号颜色
+func TurntableGIF(frames []*image.NRGBA, delay int, transparent bool) *gif.GIF {
+	ncol := 256
+	if transparent {
+		ncol = 255
+	}
+	var samples [][3]uint8
+	for _, f := range frames {
+		step := max(1, len(f.Pix)/4/(200000/len(frames)+1))
+		for i := 0; i+3 < len(f.Pix); i += 4 * step {
+			if f.Pix[i+3] >= 128 {
+				samples = append(samples, [3]uint8{f.Pix[i], f.Pix[i+1], f.Pix[i+2]})
+			}
+		}
+	}
+	pal := color.Palette{}
+	if transparent {
+		pal = append(pal, color.NRGBA{})
+	}
+	pal = append(pal, medianCut(samples, ncol)...)
+	if len(pal) == 0 {
+		pal = append(pal, color.NRGBA{A: 255})
+	}
+
+	// 5 位/通道查找表，避免每个像素线性搜索调色板
+	var lut [32 * 32 * 32]uint8
+	first := 0
+	if transparent {
+		first = 1
+	}
+	for i := range lut {
+		c := color.NRGBA{uint8(i>>10&31)<<3 | 4, uint8(i>>5&31)<<3 | 4, uint8(i&31)<<3 | 4, 255}
+		best, bestD := first, math.MaxInt
+		for j := first; j < len(pal); j++ {
+			p := pal[j].(color.NRGBA)
+			dr, dg, db := int(p.R)-int(c.R), int(p.G)-int(c.G), int(p.B)-int(c.B)
+			if d := dr*dr + dg*dg + db*db; d < bestD {
+				best, bestD = j, d
+			}
+		}
+		lut[i] = uint8(best)
+	}
+
+	g := &gif.GIF{LoopCount: 0}
+	for _, f := range frames {
+		pm := image.NewPaletted(f.Rect, pal)
+		for i := 0; i < len(f.Pix)/4; i++ {
+			p := f.Pix[i*4:]
+			if transparent && p[3] < 128 {
+				pm.Pix[i] = 0
+				continue
+			}
+			pm.Pix[i] = lut[int(p[0]>>3)<<10|int(p[1]>>3)<<5|int(p[2]>>3)]
+		}
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, delay)
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+	return g
+}
+
+// medianCut 中位切分量化，返回至多 n 种颜色
+func medianCut(samples [][3]uint8, n int) []color.Color {
+	if len(samples) == 0 {
+		return nil
+	}
+	boxes := [][][3]uint8{samples}
+	for len(boxes) < n {
+		// 选颜色范围最大的盒子沿最长轴对半分
+		bi, axis, best := -1, 0, 0
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			for k := 0; k < 3; k++ {
+				lo, hi := uint8(255), uint8(0)
+				for _, c := range b {
+					lo, hi = min(lo, c[k]), max(hi, c[k])
+				}
+				if int(hi-lo) > best {
+					bi, axis, best = i, k, int(hi-lo)
+				}
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		b := boxes[bi]
+		sort.Slice(b, func(i, j int) bool { return b[i][axis] < b[j][axis] })
+		mid := len(b) / 2
+		boxes[bi] = b[:mid]
+		boxes = append(boxes, b[mid:])
+	}
+	out := make([]color.Color, 0, len(boxes))
+	for _, b := range boxes {
+		var s [3]int
+		for _, c := range b {
+			s[0] += int(c[0])
+			s[1] += int(c[1])
+			s[2] += int(c[2])
+		}
+		out = append(out, color.NRGBA{uint8(s[0] / len(b)), uint8(s[1] / len(b)), uint8(s[2] / len(b)), 255})
+	}
+	return out
+}
@@ -0,0 +1,446 @@
+// mesh_simplify.go
+package main
+
+import (
+	"container/heap"
+	"math"
+)
+
+/* =========================
+   网格简化（QEM）
+   ========================= */
+
+// 基于二次误差度量（Garland–Heckbert）的半边折叠：顶点只折叠到相邻顶点上，
+// 留下的都是原始顶点，UV/法线/颜色不需要插值。
+// 重合位置（与打印检查相同的焊接容差）上 UV 或颜色不同的顶点（贴图接缝）按位置一起处理，接缝上的顶点只允许沿接缝折叠，
+// 避免贴图撕裂；开放边界和接缝额外加垂直约束平面，尽量保持轮廓。
+// 接缝很多的模型可能达不到目标面数，此时返回能做到的最小结果。
+
+const simplifyBorderWeight = 10
+
+type quadric [10]float64
+
+func planeQuadric(n [3]float64, d, w float64) quadric {
+	a, b, c := n[0], n[1], n[2]
+	return quadric{a * a * w, a * b * w, a * c * w, a * d * w, b * b * w, b * c * w, b * d * w, c * c * w, c * d * w, d * d * w}
+}
+
+func (q *quadric) add(o *quadric) {
+	for i := range q {
+		q[i] += o[i]
+	}
+}
+
+func (q *quadric) eval(p [3]float64) float64 {
+	x, y, z := p[0], p[1], p[2]
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z + q[9]
+}
+
+func vec64(v [3]float32) [3]float64 { return [3]float64{float64(v[0]), float64(v[1]), float64(v[2])} }
+
+func cross64(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func sub64(a, b [3]float64) [3]float64 { return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+
+func dot64(a, b [3]float64) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+func triNormal64(a, b, c [3]float64) [3]float64 { return cross64(sub64(b, a), sub64(c, a)) }
+
+// Simplify 返回三角形数不超过 target 的新场景（材质与贴图共用），各 Mesh 按原面数比例分配预算。
+// 结果的 Meshes 与输入一一对应，供 LOD 按下标关联
+func Simplify(s *Scene, target int) *Scene {
+	out := &Scene{Materials: s.Materials, Images: s.Images, MetersPerUnit: s.MetersPerUnit, ZUp: s.ZUp, Provenance: s.Provenance}
+	total := s.TriangleCount()
+	if target >= total || total == 0 {
+		out.Meshes = append(out.Meshes, s.Meshes...)
+		return out
+	}
+	budget := make([]int, len(s.Meshes))
+	used, largest := 0, 0
+	for i, m := range s.Meshes {
+		budget[i] = target * (len(m.Indices) / 3) / total
+		used += budget[i]
+		if len(m.Indices) > len(s.Meshes[largest].Indices) {
+			largest = i
+		}
+	}
+	budget[largest] += target - used
+	for i, m := range s.Meshes {
+		sm := simplifyMesh(m, budget[i])
+		if len(sm.Indices) == 0 {
+			sm = m // 只有退化三角形，原样保留
+		}
+		out.Meshes = append(out.Meshes, sm)
+	}
+	return out
+}
+
+type collapse struct {
+	cost       float64
+	from, to   int32
+	verF, verT uint32
+}
+
+type collapseHeap []collapse
+
+func (h collapseHeap) Len() int           { return len(h) }
+func (h collapseHeap) Less(i, j int) bool { return h[i].cost < h[j].cost }
+func (h collapseHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *collapseHeap) Push(x any)        { *h = append(*h, x.(collapse)) }
+func (h *collapseHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type simplifier struct {
+	m       *Mesh
+	wedges  []int32 // 简化用顶点 -> 原始顶点
+	wpos    []int32 // 简化用顶点 -> 位置 id
+	normals [][3]float32
+
+	pos     [][3]float64
+	q       []quadric
+	ver     []uint32
+	gone    []bool
+	border  []bool // 开放边界上的位置
+	locked  []bool // 非流形，不参与折叠
+	vtris   [][]int32
+	tris    [][3]int32 // 简化用顶点下标
+	dead    []bool
+	live    int
+	pending collapseHeap
+}
+
+// newSimplifier 先把同一位置上 UV、颜色相同（只有法线不同）的顶点合并，只把真正的贴图接缝当作接缝
+func newSimplifier(m *Mesh) *simplifier {
+	sp := &simplifier{m: m}
+	type wkey struct {
+		p  [3]int64
+		uv [2]float32
+		c  [4]float32
+	}
+	eps := weldEps(&Scene{Meshes: []*Mesh{m}})
+	posID := map[[3]int64]int32{}
+	wedgeID := map[wkey]int32{}
+	remap := make([]int32, len(m.Positions))
+	for i, p := range m.Positions {
+		k := wkey{p: weldKey(p, eps)}
+		if len(m.UVs) == len(m.Positions) {
+			k.uv = m.UVs[i]
+		}
+		if len(m.Colors) == len(m.Positions) {
+			k.c = m.Colors[i]
+		}
+		w, ok := wedgeID[k]
+		if !ok {
+			pid, ok := posID[k.p]
+			if !ok {
+				pid = int32(len(sp.pos))
+				posID[k.p] = pid
+				sp.pos = append(sp.pos, vec64(p))
+			}
+			w = int32(len(sp.wedges))
+			wedgeID[k] = w
+			sp.wedges = append(sp.wedges, int32(i))
+			sp.wpos = append(sp.wpos, pid)
+			if len(m.Normals) == len(m.Positions) {
+				sp.normals = append(sp.normals, [3]float32{})
+			}
+		}
+		if sp.normals != nil {
+			sp.normals[w] = add3(sp.normals[w], m.Normals[i])
+		}
+		remap[i] = w
+	}
+	for i := range sp.normals {
+		sp.normals[i] = normalize3(sp.normals[i])
+	}
+
+	np := len(sp.pos)
+	sp.q = make([]quadric, np)
+	sp.ver = make([]uint32, np)
+	sp.gone = make([]bool, np)
+	sp.border = make([]bool, np)
+	sp.locked = make([]bool, np)
+	sp.vtris = make([][]int32, np)
+	for t := 0; t+2 < len(m.Indices); t += 3 {
+		tri := [3]int32{remap[m.Indices[t]], remap[m.Indices[t+1]], remap[m.Indices[t+2]]}
+		a, b, c := sp.wpos[tri[0]], sp.wpos[tri[1]], sp.wpos[tri[2]]
+		if a == b || b == c || a == c {
+			continue
+		}
+		ti := int32(len(sp.tris))
+		sp.tris = append(sp.tris, tri)
+		for _, p := range [3]int32{a, b, c} {
+			sp.vtris[p] = append(sp.vtris[p], ti)
+		}
+		n := triNormal64(sp.pos[a], sp.pos[b], sp.pos[c])
+		if l := math.Sqrt(dot64(n, n)); l > 0 {
+			n = [3]float64{n[0] / l, n[1] / l, n[2] / l}
+			fq := planeQuadric(n, -dot64(n, sp.pos[a]), l/2)
+			for _, p := range [3]int32{a, b, c} {
+				sp.q[p].add(&fq)
+			}
+		}
+	}
+	sp.dead = make([]bool, len(sp.tris))
+	sp.live = len(sp.tris)
+
+	// 边界与接缝约束：过该边、垂直于所在三角形的平面
+	type use struct {
+		tri    int32
+		wa, wb int32
+	}
+	edges := map[[2]int32][]use{}
+	for ti, tri := range sp.tris {
+		for k := 0; k < 3; k++ {
+			wa, wb := tri[k], tri[(k+1)%3]
+			pa, pb := sp.wpos[wa], sp.wpos[wb]
+			if pa > pb {
+				pa, pb, wa, wb = pb, pa, wb, wa
+			}
+			edges[[2]int32{pa, pb}] = append(edges[[2]int32{pa, pb}], use{int32(ti), wa, wb})
+		}
+	}
+	for e, us := range edges {
+		switch {
+		case len(us) > 2:
+			sp.locked[e[0]], sp.locked[e[1]] = true, true
+			continue
+		case len(us) == 1:
+			sp.border[e[0]], sp.border[e[1]] = true, true
+		case us[0].wa == us[1].wa && us[0].wb == us[1].wb:
+			continue
+		}
+		for _, u := range us {
+			tri := sp.tris[u.tri]
+			a, b, c := sp.pos[sp.wpos[tri[0]]], sp.pos[sp.wpos[tri[1]]], sp.pos[sp.wpos[tri[2]]]
+			fn := triNormal64(a, b, c)
+			ev := sub64(sp.pos[e[1]], sp.pos[e[0]])
+			n := cross64(ev, fn)
+			l := math.Sqrt(dot64(n, n))
+			if l == 0 {
+				continue
+			}
+			n = [3]float64{n[0] / l, n[1] / l, n[2] / l}
+			bq := planeQuadric(n, -dot64(n, sp.pos[e[0]]), dot64(ev, ev)*simplifyBorderWeight)
+			sp.q[e[0]].add(&bq)
+			sp.q[e[1]].add(&bq)
+		}
+	}
+	return sp
+}
+
+func simplifyMesh(m *Mesh, target int) *Mesh {
+	sp := newSimplifier(m)
+	// 一轮结束后局部拓扑已变，之前被拒绝的折叠可能变得可行，重建队列再试，直到没有进展
+	for sp.live > target {
+		sp.fill()
+		if sp.run(target) == 0 {
+			break
+		}
+	}
+	return sp.result()
+}
+
+func (sp *simplifier) candidate(from, to int32) collapse {
+	q := sp.q[from]
+	q.add(&sp.q[to])
+	return collapse{cost: q.eval(sp.pos[to]), from: from, to: to, verF: sp.ver[from], verT: sp.ver[to]}
+}
+
+func (sp *simplifier) fill() {
+	sp.pending = sp.pending[:0]
+	seen := map[[2]int32]bool{}
+	for ti, tri := range sp.tris {
+		if sp.dead[ti] {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			a, b := sp.wpos[tri[k]], sp.wpos[tri[(k+1)%3]]
+			if a > b {
+				a, b = b, a
+			}
+			if seen[[2]int32{a, b}] {
+				continue
+			}
+			seen[[2]int32{a, b}] = true
+			sp.pending = append(sp.pending, sp.candidate(a, b), sp.candidate(b, a))
+		}
+	}
+	heap.Init(&sp.pending)
+}
+
+func (sp *simplifier) run(target int) int {
+	n := 0
+	for sp.live > target && sp.pending.Len() > 0 {
+		c := heap.Pop(&sp.pending).(collapse)
+		if sp.gone[c.from] || sp.gone[c.to] || sp.ver[c.from] != c.verF || sp.ver[c.to] != c.verT {
+			continue
+		}
+		if sp.tryCollapse(c.from, c.to, target) {
+			n++
+		}
+	}
+	return n
+}
+
+func (sp *simplifier) hasPos(ti, p int32) (int, bool) {
+	for k, w := range sp.tris[ti] {
+		if sp.wpos[w] == p {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// tryCollapse 把位置 p 折叠到 q；不满足流形、接缝或翻面约束时放弃
+func (sp *simplifier) tryCollapse(p, q int32, target int) bool {
+	if sp.locked[p] {
+		return false
+	}
+	var shared, others []int32
+	for _, ti := range sp.vtris[p] {
+		if sp.dead[ti] {
+			continue
+		}
+		if _, ok := sp.hasPos(ti, q); ok {
+			shared = append(shared, ti)
+		} else {
+			others = append(others, ti)
+		}
+	}
+	if len(shared) == 0 || len(shared) > 2 || sp.live-len(shared) < max(target, 1) {
+		return false
+	}
+	// 边界上的点只能沿边界移动
+	if sp.border[p] && len(shared) != 1 {
+		return false
+	}
+
+	// link 条件：p、q 的公共邻点只能是被删三角形的对顶点，否则会产生非流形
+	nbr := func(v int32) map[int32]bool {
+		set := map[int32]bool{}
+		for _, ti := range sp.vtris[v] {
+			if sp.dead[ti] {
+				continue
+			}
+			for _, w := range sp.tris[ti] {
+				if u := sp.wpos[w]; u != v {
+					set[u] = true
+				}
+			}
+		}
+		return set
+	}
+	np, nq := nbr(p), nbr(q)
+	common := 0
+	for u := range np {
+		if nq[u] {
+			common++
+		}
+	}
+	if common != len(shared) {
+		return false
+	}
+
+	// p 上的每个顶点（接缝两侧各一个）都要在被删三角形里找到对应的 q 顶点
+	wmap := map[int32]int32{}
+	for _, ti := range shared {
+		kp, _ := sp.hasPos(ti, p)
+		kq, _ := sp.hasPos(ti, q)
+		wp, wq := sp.tris[ti][kp], sp.tris[ti][kq]
+		if old, ok := wmap[wp]; ok && old != wq {
+			return false
+		}
+		wmap[wp] = wq
+	}
+	for _, ti := range others {
+		k, _ := sp.hasPos(ti, p)
+		if _, ok := wmap[sp.tris[ti][k]]; !ok {
+			return false
+		}
+	}
+
+	// 翻面检查
+	for _, ti := range others {
+		tri := sp.tris[ti]
+		var before, after [3][3]float64
+		for k, w := range tri {
+			before[k] = sp.pos[sp.wpos[w]]
+			after[k] = before[k]
+			if sp.wpos[w] == p {
+				after[k] = sp.pos[q]
+			}
+		}
+		nb := triNormal64(before[0], before[1], before[2])
+		na := triNormal64(after[0], after[1], after[2])
+		if dot64(na, na) == 0 || dot64(nb, na) <= 0 {
+			return false
+		}
+	}
+
+	for _, ti := range shared {
+		sp.dead[ti] = true
+		sp.live--
+	}
+	for _, ti := range others {
+		k, _ := sp.hasPos(ti, p)
+		sp.tris[ti][k] = wmap[sp.tris[ti][k]]
+		sp.vtris[q] = append(sp.vtris[q], ti)
+	}
+	kept := sp.vtris[q][:0]
+	for _, ti := range sp.vtris[q] {
+		if !sp.dead[ti] {
+			kept = append(kept, ti)
+		}
+	}
+	sp.vtris[q] = kept
+	sp.vtris[p] = nil
+	sp.q[q].add(&sp.q[p])
+	sp.gone[p] = true
+	sp.ver[q]++
+	for u := range nbr(q) {
+		heap.Push(&sp.pending, sp.candidate(q, u))
+		heap.Push(&sp.pending, sp.candidate(u, q))
+	}
+	return true
+}
+
+// result 按剩余三角形重建 Mesh，只保留用到的顶点
+func (sp *simplifier) result() *Mesh {
+	m := sp.m
+	out := &Mesh{Name: m.Name, Material: m.Material}
+	idx := map[int32]uint32{}
+	for ti, tri := range sp.tris {
+		if sp.dead[ti] {
+			continue
+		}
+		for _, w := range tri {
+			ni, ok := idx[w]
+			if !ok {
+				ni = uint32(len(out.Positions))
+				idx[w] = ni
+				src := sp.wedges[w]
+				out.Positions = append(out.Positions, m.Positions[src])
+				if sp.normals != nil {
+					out.Normals = append(out.Normals, sp.normals[w])
+				}
+				if len(m.UVs) == len(m.Positions) {
+					out.UVs = append(out.UVs, m.UVs[src])
+				}
+				if len(m.Colors) == len(m.Positions) {
+					out.Colors = append(out.Colors, m.Colors[src])
+				}
+			}
+			out.Indices = append(out.Indices, ni)
+		}
+	}
+	return out
+}
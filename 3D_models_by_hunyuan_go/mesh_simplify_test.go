@@ -0,0 +1,66 @@
+// mesh_simplify_test.go
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// gridTestMesh n×n 的平面网格，2n² 个三角形
+func gridTestMesh(n int, y float32) *Mesh {
+	m := &Mesh{Name: "grid", Material: -1}
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= n; j++ {
+			m.Positions = append(m.Positions, [3]float32{float32(j) / float32(n), y, float32(i) / float32(n)})
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			a := uint32(i*(n+1) + j)
+			b, c, d := a+1, a+uint32(n+1), a+uint32(n+2)
+			m.Indices = append(m.Indices, a, c, b, b, c, d)
+		}
+	}
+	return m
+}
+
+func TestSimplifyPlane(t *testing.T) {
+	s := &Scene{Meshes: []*Mesh{gridTestMesh(20, 0)}}
+	out := Simplify(s, 100)
+	got := out.TriangleCount()
+	if got == 0 || got > 100 {
+		t.Fatalf("triangles = %d, want 1..100", got)
+	}
+	// 平面没有曲率，简化后仍在平面内；边界权重高，包围盒不缩
+	mn, mx := out.Bounds()
+	for _, p := range out.Meshes[0].Positions {
+		if math.Abs(float64(p[1])) > 1e-5 {
+			t.Fatalf("vertex %v left the plane", p)
+		}
+	}
+	if mn[0] > 1e-5 || mn[2] > 1e-5 || mx[0] < 1-1e-5 || mx[2] < 1-1e-5 {
+		t.Errorf("bounds shrank: %v %v", mn, mx)
+	}
+	if s.TriangleCount() != 800 {
+		t.Error("input scene modified")
+	}
+}
+
+func TestSimplifyBudget(t *testing.T) {
+	s := &Scene{Meshes: []*Mesh{gridTestMesh(20, 0), gridTestMesh(10, 1)}}
+	out := Simplify(s, 200)
+	if len(out.Meshes) != 2 {
+		t.Fatalf("meshes = %d, want 2 (LOD matches by index)", len(out.Meshes))
+	}
+	if got := out.TriangleCount(); got == 0 || got > 200 {
+		t.Errorf("triangles = %d, want 1..200", got)
+	}
+	// 按原面数比例分配：大网格保留更多
+	if a, b := len(out.Meshes[0].Indices), len(out.Meshes[1].Indices); a <= b || b == 0 {
+		t.Errorf("budget split %d/%d triangles", a/3, b/3)
+	}
+
+	if out := Simplify(s, 10000); out.TriangleCount() != s.TriangleCount() {
+		t.Errorf("target above total changed the mesh: %d", out.TriangleCount())
+	}
+}
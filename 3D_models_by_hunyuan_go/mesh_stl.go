@@ -0,0 +1,114 @@
+// mesh_stl.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/* =========================
+   STL 解析
+   ========================= */
+
+// ParseSTL 解析二进制或 ASCII STL。STL 没有共享顶点，按坐标焊接后得到索引网格；
+// 法线由渲染和导出按面重算，文件里的面法线不保留。
+// STL 不带单位和上方向：坐标按毫米（stlUnit，与 STL 导出默认一致）换算为米，上方向按 Y 轴，
+// 与不带参数的 STL 导出结果往返一致。
+func ParseSTL(data []byte) (*Scene, error) {
+	m := &Mesh{Name: "stl", Material: -1}
+	vmap := map[[3]float32]uint32{}
+	add := func(p [3]float32) {
+		idx, ok := vmap[p]
+		if !ok {
+			idx = uint32(len(m.Positions))
+			vmap[p] = idx
+			m.Positions = append(m.Positions, p)
+		}
+		m.Indices = append(m.Indices, idx)
+	}
+
+	var err error
+	if stlIsBinary(data) {
+		err = parseBinarySTL(data, add)
+	} else {
+		err = parseASCIISTL(data, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Indices) == 0 {
+		return nil, errors.New("stl: no triangles")
+	}
+	scale := float32(unitMeters[stlUnit])
+	for i, p := range m.Positions {
+		m.Positions[i] = [3]float32{p[0] * scale, p[1] * scale, p[2] * scale}
+	}
+	return &Scene{Meshes: []*Mesh{m}}, nil
+}
+
+// stlIsBinary 与 checkSTL 一致：大小符合三角形数即视为二进制（有些二进制 STL 头部也以 solid 开头）
+func stlIsBinary(data []byte) bool {
+	if len(data) < 84 {
+		return false
+	}
+	n := int64(binary.LittleEndian.Uint32(data[80:]))
+	return 84+50*n == int64(len(data))
+}
+
+func parseBinarySTL(data []byte, add func([3]float32)) error {
+	n := int(binary.LittleEndian.Uint32(data[80:]))
+	for i := 0; i < n; i++ {
+		rec := data[84+50*i:]
+		for v := 0; v < 3; v++ {
+			var p [3]float32
+			for k := 0; k < 3; k++ {
+				p[k] = math.Float32frombits(binary.LittleEndian.Uint32(rec[12+v*12+k*4:]))
+				if math.IsNaN(float64(p[k])) || math.IsInf(float64(p[k]), 0) {
+					return fmt.Errorf("stl: triangle %d has a non-finite coordinate", i)
+				}
+			}
+			add(p)
+		}
+	}
+	return nil
+}
+
+// parseASCIISTL 只关心 vertex 行，每 3 个顶点一个三角形；facet/outer loop 等结构行跳过
+func parseASCIISTL(data []byte, add func([3]float32)) error {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	line, verts := 0, 0
+	for sc.Scan() {
+		line++
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || !strings.EqualFold(f[0], "vertex") {
+			continue
+		}
+		if len(f) != 4 {
+			return fmt.Errorf("stl: line %d: bad vertex", line)
+		}
+		var p [3]float32
+		for k := 0; k < 3; k++ {
+			v, err := strconv.ParseFloat(f[k+1], 32)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("stl: line %d: bad coordinate %q", line, f[k+1])
+			}
+			p[k] = float32(v)
+		}
+		add(p)
+		verts++
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("stl: %v", err)
+	}
+	if verts%3 != 0 {
+		return fmt.Errorf("stl: %d vertices is not a whole number of triangles", verts)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+// mesh_test.go
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testTriangleGLTF 一个三角形的 .gltf（buffer 为 data URI），patch 可改写任意字段构造异常输入
+func testTriangleGLTF(t testing.TB, patch func(doc map[string]any)) []byte {
+	t.Helper()
+	bin := float32Bytes([]float32{0, 0, 0, 1, 0, 0, 0, 1, 0})
+	bin = append(bin, 0, 0, 1, 0, 2, 0, 0, 0) // uint16 索引，补齐 4 字节
+	doc := map[string]any{
+		"asset":  map[string]any{"version": "2.0"},
+		"scene":  0,
+		"scenes": []any{map[string]any{"nodes": []any{0}}},
+		"nodes":  []any{map[string]any{"mesh": 0}},
+		"meshes": []any{map[string]any{"primitives": []any{map[string]any{
+			"attributes": map[string]any{"POSITION": 0},
+			"indices":    1,
+		}}}},
+		"accessors": []any{
+			map[string]any{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+			map[string]any{"bufferView": 1, "componentType": 5123, "count": 3, "type": "SCALAR"},
+		},
+		"bufferViews": []any{
+			map[string]any{"buffer": 0, "byteOffset": 0, "byteLength": 36},
+			map[string]any{"buffer": 0, "byteOffset": 36, "byteLength": 6},
+		},
+		"buffers": []any{map[string]any{
+			"byteLength": len(bin),
+			"uri":        "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin),
+		}},
+	}
+	if patch != nil {
+		patch(doc)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func testItem(doc map[string]any, kind string, i int) map[string]any {
+	return doc[kind].([]any)[i].(map[string]any)
+}
+
+func testPrimitive(doc map[string]any) map[string]any {
+	return testItem(doc, "meshes", 0)["primitives"].([]any)[0].(map[string]any)
+}
+
+func TestParseGLBTriangle(t *testing.T) {
+	s, err := ParseGLB(testTriangleGLTF(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.VertexCount() != 3 || s.TriangleCount() != 1 {
+		t.Fatalf("got %d vertices, %d triangles", s.VertexCount(), s.TriangleCount())
+	}
+
+	// 写出的 GLB 能原样读回
+	var buf bytes.Buffer
+	if err := WriteGLB(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseGLB(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.VertexCount() != 3 || back.TriangleCount() != 1 {
+		t.Fatalf("round trip: got %d vertices, %d triangles", back.VertexCount(), back.TriangleCount())
+	}
+}
+
+// 构造的异常文件只能返回错误，不能 panic 或按声明的大小分配内存
+func TestParseGLBMalformed(t *testing.T) {
+	chain := func(n int, children func(i int) []any) func(doc map[string]any) {
+		return func(doc map[string]any) {
+			nodes := make([]any, n)
+			for i := range nodes {
+				node := map[string]any{"mesh": 0}
+				if i+1 < n {
+					node["children"] = children(i)
+				}
+				nodes[i] = node
+			}
+			doc["nodes"] = nodes
+		}
+	}
+	cases := []struct {
+		name    string
+		patch   func(doc map[string]any)
+		wantErr bool
+	}{
+		{"negative scene", func(d map[string]any) { d["scene"] = -1 }, true},
+		{"scene out of range", func(d map[string]any) { d["scene"] = 5 }, true},
+		{"missing COLOR_0 accessor", func(d map[string]any) { testPrimitive(d)["attributes"].(map[string]any)["COLOR_0"] = 7 }, false},
+		{"negative COLOR_0 accessor", func(d map[string]any) { testPrimitive(d)["attributes"].(map[string]any)["COLOR_0"] = -1 }, false},
+		{"negative material", func(d map[string]any) { testPrimitive(d)["material"] = -3 }, false},
+		{"missing POSITION accessor", func(d map[string]any) { testPrimitive(d)["attributes"].(map[string]any)["POSITION"] = 9 }, true},
+		{"negative indices accessor", func(d map[string]any) { testPrimitive(d)["indices"] = -1 }, true},
+		{"zero-filled negative count", func(d map[string]any) {
+			a := testItem(d, "accessors", 0)
+			delete(a, "bufferView")
+			a["count"] = -1
+		}, true},
+		{"zero-filled huge count", func(d map[string]any) {
+			a := testItem(d, "accessors", 0)
+			delete(a, "bufferView")
+			a["count"] = 1 << 40
+		}, true},
+		{"huge count", func(d map[string]any) { testItem(d, "accessors", 0)["count"] = 1 << 40 }, true},
+		{"negative count", func(d map[string]any) { testItem(d, "accessors", 0)["count"] = -5 }, true},
+		{"negative accessor byteOffset", func(d map[string]any) { testItem(d, "accessors", 0)["byteOffset"] = -4 }, true},
+		{"huge accessor byteOffset", func(d map[string]any) { testItem(d, "accessors", 0)["byteOffset"] = math.MaxInt64 - 2 }, true},
+		{"negative byteLength", func(d map[string]any) { testItem(d, "bufferViews", 0)["byteLength"] = -1 }, true},
+		{"negative view byteOffset", func(d map[string]any) { testItem(d, "bufferViews", 0)["byteOffset"] = -8 }, true},
+		{"overflowing view range", func(d map[string]any) {
+			testItem(d, "bufferViews", 0)["byteOffset"] = 1 << 62
+			testItem(d, "bufferViews", 0)["byteLength"] = 1 << 62
+		}, true},
+		{"negative byteStride", func(d map[string]any) { testItem(d, "bufferViews", 0)["byteStride"] = -4 }, true},
+		{"byteStride smaller than element", func(d map[string]any) { testItem(d, "bufferViews", 0)["byteStride"] = 4 }, true},
+		{"huge byteStride", func(d map[string]any) { testItem(d, "bufferViews", 0)["byteStride"] = 1 << 40 }, true},
+		{"negative buffer", func(d map[string]any) { testItem(d, "bufferViews", 0)["buffer"] = -1 }, true},
+		{"bad component type", func(d map[string]any) { testItem(d, "accessors", 0)["componentType"] = 1 }, true},
+		{"deep hierarchy", chain(maxNodeDepth+10, func(i int) []any { return []any{i + 1} }), true},
+		// 每层两个子节点都指向下一层：2^40 个实例
+		{"instancing explosion", chain(40, func(i int) []any { return []any{i + 1, i + 1} }), true},
+		{"self loop", func(d map[string]any) { testItem(d, "nodes", 0)["children"] = []any{0} }, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := testTriangleGLTF(t, tc.patch)
+			_, err := ParseGLB(data)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			// 校验器与解析器共用边界检查，同样不能 panic
+			ValidateGLTF(data)
+		})
+	}
+}
+
+func TestParseGLBChunks(t *testing.T) {
+	glb := func(jsonLen, chunkLen uint32) []byte {
+		b := []byte("glTF\x02\x00\x00\x00\x00\x00\x00\x00")
+		b = binary.LittleEndian.AppendUint32(b, jsonLen)
+		b = append(b, "JSON{}  "...)
+		b = binary.LittleEndian.AppendUint32(b, chunkLen)
+		return append(b, "BIN\x00"...)
+	}
+	for _, data := range [][]byte{
+		[]byte("glTF"),
+		glb(1<<31, 0),
+		glb(4, 1<<31),
+		glb(math.MaxUint32, math.MaxUint32),
+	} {
+		if _, err := ParseGLB(data); err == nil {
+			t.Errorf("% x: want error", data)
+		}
+		ValidateGLTF(data)
+	}
+}
+
+func TestParseOBJ(t *testing.T) {
+	const quad = "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvt 0 0\nvt 1 1\nf 1/1 2/2 3/1 4/2\n"
+	s, err := ParseOBJ([]byte(quad), func(string) []byte { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.VertexCount() != 4 || s.TriangleCount() != 2 {
+		t.Fatalf("got %d vertices, %d triangles", s.VertexCount(), s.TriangleCount())
+	}
+	if len(s.Meshes[0].UVs) != 4 || s.Meshes[0].UVs[1] != [2]float32{1, 0} {
+		t.Fatalf("UVs not flipped to glTF convention: %v", s.Meshes[0].UVs)
+	}
+
+	// 相对索引和 MTL 材质
+	rel := "mtllib a.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl red\nf -3 -2 -1\n"
+	s, err = ParseOBJ([]byte(rel), func(name string) []byte {
+		if name == "a.mtl" {
+			return []byte("newmtl red\nKd 1 0 0\n")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Materials) != 1 || s.Meshes[0].Material != 0 || s.Materials[0].BaseColor[1] != 0 {
+		t.Fatalf("material not applied: %+v", s.Materials)
+	}
+
+	for name, src := range map[string]string{
+		"no faces":          "v 0 0 0\nv 1 0 0\n",
+		"zero index":        "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 0 1 2\n",
+		"index too large":   "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n",
+		"relative too far":  "v 0 0 0\nv 1 0 0\nv 0 1 0\nf -4 1 2\n",
+		"uv out of range":   "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1/1 2/1 3/1\n",
+		"bad coordinate":    "v 0 x 0\n",
+		"missing component": "v 0 0\n",
+		"huge index":        "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 99999999999999999999\n",
+	} {
+		if _, err := ParseOBJ([]byte(src), func(string) []byte { return nil }); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestParseSTL(t *testing.T) {
+	s := cubeTestScene()
+	var bin bytes.Buffer
+	if err := WriteSTL(&bin, s, "solid but actually binary"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseSTL(bin.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 焊接后与源网格的顶点数一致
+	if got.VertexCount() != s.VertexCount() || got.TriangleCount() != s.TriangleCount() {
+		t.Fatalf("binary: got %d vertices, %d triangles, want %d, %d", got.VertexCount(), got.TriangleCount(), s.VertexCount(), s.TriangleCount())
+	}
+
+	// 按 STL 导出默认（毫米）写出，再读回应与源模型尺寸一致
+	var mm bytes.Buffer
+	exported := cubeTestScene()
+	tf, _ := parseExportTransform(nil, stlUnit)
+	tf.Apply(exported, false)
+	if err := WriteSTL(&mm, exported, "cube"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = ParseSTL(mm.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if mn, mx := got.Bounds(); math.Abs(float64(mx[1]-mn[1])-1) > 1e-6 {
+		t.Fatalf("round trip height %v m, want 1", mx[1]-mn[1])
+	}
+
+	ascii := "solid x\n" + strings.Repeat("facet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nvertex 0 1 0\nendloop\nendfacet\n", 2) + "endsolid x\n"
+	got, err = ParseSTL([]byte(ascii))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.VertexCount() != 3 || got.TriangleCount() != 2 {
+		t.Fatalf("ascii: got %d vertices, %d triangles", got.VertexCount(), got.TriangleCount())
+	}
+
+	nan := append([]byte(nil), bin.Bytes()...)
+	binary.LittleEndian.PutUint32(nan[84+12:], math.Float32bits(float32(math.NaN())))
+	for name, data := range map[string][]byte{
+		"empty":             nil,
+		"no facets":         []byte("solid x\nendsolid x\n"),
+		"partial triangle":  []byte("solid x\nvertex 0 0 0\nvertex 1 0 0\nendsolid\n"),
+		"bad vertex":        []byte("solid x\nvertex 0 0\nendsolid\n"),
+		"bad coordinate":    []byte("solid x\nvertex 0 nan 0\nvertex 1 0 0\nvertex 0 1 0\nendsolid\n"),
+		"truncated binary":  bin.Bytes()[:bin.Len()-10],
+		"non-finite binary": nan,
+	} {
+		if _, err := ParseSTL(data); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestParseModelZipBudget(t *testing.T) {
+	old := uploadMaxBytes
+	uploadMaxBytes = 1 << 10
+	defer func() { uploadMaxBytes = old }()
+
+	obj := []byte("mtllib m.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl a\nf 1 2 3\n")
+	pack := func(mtl []byte) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create("m.obj")
+		w.Write(obj)
+		w, _ = zw.Create("m.mtl")
+		w.Write(mtl)
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	ok := pack([]byte("newmtl a\nKd 1 0 0\n"))
+	if _, err := ParseModel(ok, "zip"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validateFormat(bytes.NewReader(ok), int64(len(ok)), "zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 MiB 的零压缩后只有 1 KiB 左右，解压后远超 16 倍上传上限
+	bomb := pack(make([]byte, 1<<20))
+	if len(bomb) > int(uploadMaxBytes)*4 {
+		t.Fatalf("test archive unexpectedly large: %d bytes", len(bomb))
+	}
+	if _, err := ParseModel(bomb, "zip"); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("ParseModel: err = %v, want size limit error", err)
+	}
+	if _, err := validateFormat(bytes.NewReader(bomb), int64(len(bomb)), "zip"); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("validateFormat: err = %v, want size limit error", err)
+	}
+}
+
+// cubeTestScene 单位立方体，8 个顶点、12 个三角形
+func cubeTestScene() *Scene {
+	m := &Mesh{Name: "cube", Material: -1}
+	for i := 0; i < 8; i++ {
+		m.Positions = append(m.Positions, [3]float32{float32(i & 1), float32(i >> 1 & 1), float32(i >> 2 & 1)})
+	}
+	m.Indices = []uint32{0, 2, 1, 1, 2, 3, 4, 5, 6, 5, 7, 6, 0, 1, 4, 1, 5, 4, 2, 6, 3, 3, 6, 7, 0, 4, 2, 2, 4, 6, 1, 3, 5, 3, 7, 5}
+	return &Scene{Meshes: []*Mesh{m}}
+}
+
+func FuzzParseGLB(f *testing.F) {
+	f.Add(testTriangleGLTF(f, nil))
+	var glb bytes.Buffer
+	if s, err := ParseGLB(testTriangleGLTF(f, nil)); err == nil && WriteGLB(&glb, s) == nil {
+		f.Add(glb.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseGLB(data)
+		ValidateGLTF(data)
+	})
+}
+
+func FuzzParseOBJ(f *testing.F) {
+	f.Add([]byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvn 0 0 1\nf 1/1/1 2/1/1 3/1/1\n"))
+	f.Add([]byte("v 0 0 0 1 0 0\nv 1 0 0\nv 0 1 0\nf -1 -2 -3\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseOBJ(data, func(string) []byte { return nil })
+	})
+}
+
+func FuzzParseSTL(f *testing.F) {
+	var bin bytes.Buffer
+	WriteSTL(&bin, cubeTestScene(), "")
+	f.Add(bin.Bytes())
+	f.Add([]byte("solid x\nvertex 0 0 0\nvertex 1 0 0\nvertex 0 1 0\nendsolid\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseSTL(data)
+	})
+}
@@ -0,0 +1,505 @@
+// mirror.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+/* =========================
+   产物镜像
+   ========================= */
+
+// 腾讯云返回的 Url 是临时地址。job 变为 DONE 时立即把模型和预览图拷进 artifact 存储，
+// 并把数据库中的地址改写为本服务的永久地址；失败的条目记录在 artifacts 表中定期重试。
+var (
+	artifactRepo       ArtifactRepo
+	mirrorEnabled      = true
+	publicBaseURL      string // 永久地址前缀，如 https://api.example.com；为空时使用相对路径
+	artifactPublicBase string // 公有读的存储/CDN 域名，设置后永久地址直接指向存储
+)
+
+const (
+	KindModel   = "model"
+	KindPreview = "preview"
+
+	mirrorMaxAttempts = 10
+	mirrorLease       = 10 * time.Minute
+	mirrorBackoffBase = time.Minute
+	mirrorBackoffMax  = 6 * time.Hour
+)
+
+type Artifact struct {
+	JobID     string    `json:"job_id"`
+	Idx       int       `json:"idx"`
+	Kind      string    `json:"kind"` // model | preview | export:<variant>
+	Key       string    `json:"key"`
+	Status    string    `json:"status"` // pending | mirrored | failed | expired
+	Attempts  int       `json:"attempts"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Format    string    `json:"format,omitempty"` // 校验后识别出的实际格式
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ArtifactRepo interface {
+	// Begin 登记一次镜像尝试并加租约，防止重试任务并发处理同一条目
+	Begin(ctx context.Context, jobID string, idx int, kind, key string) error
+	MarkMirrored(ctx context.Context, jobID string, idx int, kind string, size int64) error
+	MarkFailed(ctx context.Context, jobID string, idx int, kind, errStr string, next time.Time) error
+	// MarkExpired 上游已不再保留，永久失败，不再重试
+	MarkExpired(ctx context.Context, jobID string, idx int, kind, errStr string) error
+	// SetDigest 记录校验通过的内容 SHA-256（下载接口的强 ETag）与实际格式，条目不存在时一并创建
+	SetDigest(ctx context.Context, jobID string, idx int, kind, key string, size int64, sha, format string) error
+	// MarkCorrupt 校验失败、文件已隔离，清掉摘要并立即进入重试
+	MarkCorrupt(ctx context.Context, jobID string, idx int, kind, errStr string) error
+	Get(ctx context.Context, jobID string, idx int, kind string) (*Artifact, error)
+	ListByJob(ctx context.Context, jobID string) ([]Artifact, error)
+	// DueJobs 返回有待重试条目的 job
+	DueJobs(ctx context.Context, limit int) ([]string, error)
+}
+
+/* =========================
+   PostgreSQL Repo
+   ========================= */
+
+type pgArtifactRepo struct{ db *sql.DB }
+
+func NewPGArtifactRepo(db *sql.DB) ArtifactRepo { return &pgArtifactRepo{db: db} }
+
+func (r *pgArtifactRepo) Begin(ctx context.Context, jobID string, idx int, kind, key string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO artifacts (job_id, idx, kind, key, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, 'pending', now() + $5::interval)
+		ON CONFLICT (job_id, idx, kind) DO UPDATE
+		SET key = EXCLUDED.key,
+		    next_attempt_at = EXCLUDED.next_attempt_at,
+		    updated_at = now()
+	`, jobID, idx, kind, key, fmt.Sprintf("%d seconds", int(mirrorLease.Seconds())))
+	return err
+}
+
+func (r *pgArtifactRepo) MarkMirrored(ctx context.Context, jobID string, idx int, kind string, size int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE artifacts
+		SET status = 'mirrored', size = $4, last_error = NULL, attempts = attempts + 1, updated_at = now()
+		WHERE job_id = $1 AND idx = $2 AND kind = $3
+	`, jobID, idx, kind, size)
+	return err
+}
+
+func (r *pgArtifactRepo) MarkFailed(ctx context.Context, jobID string, idx int, kind, errStr string, next time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE artifacts
+		SET status = 'failed', last_error = $4, attempts = attempts + 1, next_attempt_at = $5, updated_at = now()
+		WHERE job_id = $1 AND idx = $2 AND kind = $3
+	`, jobID, idx, kind, errStr, next)
+	return err
+}
+
+func (r *pgArtifactRepo) MarkExpired(ctx context.Context, jobID string, idx int, kind, errStr string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE artifacts
+		SET status = 'expired', last_error = $4, attempts = attempts + 1, updated_at = now()
+		WHERE job_id = $1 AND idx = $2 AND kind = $3
+	`, jobID, idx, kind, errStr)
+	return err
+}
+
+func (r *pgArtifactRepo) SetDigest(ctx context.Context, jobID string, idx int, kind, key string, size int64, sha, format string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO artifacts (job_id, idx, kind, key, status, size, sha256, format)
+		VALUES ($1, $2, $3, $4, 'mirrored', $5, $6, $7)
+		ON CONFLICT (job_id, idx, kind) DO UPDATE
+		SET key = EXCLUDED.key, status = 'mirrored', size = EXCLUDED.size, sha256 = EXCLUDED.sha256, format = EXCLUDED.format,
+		    last_error = NULL, updated_at = now()
+	`, jobID, idx, kind, key, size, sha, format)
+	return err
+}
+
+func (r *pgArtifactRepo) MarkCorrupt(ctx context.Context, jobID string, idx int, kind, errStr string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE artifacts
+		SET status = 'failed', sha256 = NULL, format = NULL, last_error = $4, next_attempt_at = now(), updated_at = now()
+		WHERE job_id = $1 AND idx = $2 AND kind = $3
+	`, jobID, idx, kind, errStr)
+	return err
+}
+
+func (r *pgArtifactRepo) Get(ctx context.Context, jobID string, idx int, kind string) (*Artifact, error) {
+	var a Artifact
+	err := r.db.QueryRowContext(ctx, `
+		SELECT job_id, idx, kind, key, status, attempts, COALESCE(size,0), COALESCE(sha256,''), COALESCE(format,''), COALESCE(last_error,''), updated_at
+		FROM artifacts WHERE job_id = $1 AND idx = $2 AND kind = $3
+	`, jobID, idx, kind).Scan(&a.JobID, &a.Idx, &a.Kind, &a.Key, &a.Status, &a.Attempts, &a.Size, &a.SHA256, &a.Format, &a.LastError, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *pgArtifactRepo) ListByJob(ctx context.Context, jobID string) ([]Artifact, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT job_id, idx, kind, key, status, attempts, COALESCE(size,0), COALESCE(sha256,''), COALESCE(format,''), COALESCE(last_error,''), updated_at
+		FROM artifacts WHERE job_id = $1 ORDER BY idx, kind
+	`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Artifact
+	for rows.Next() {
+		var a Artifact
+		if err := rows.Scan(&a.JobID, &a.Idx, &a.Kind, &a.Key, &a.Status, &a.Attempts, &a.Size, &a.SHA256, &a.Format, &a.LastError, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgArtifactRepo) DueJobs(ctx context.Context, limit int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT job_id FROM artifacts
+		WHERE kind IN ($3, $4) AND status IN ('pending','failed') AND attempts < $1 AND next_attempt_at <= now()
+		LIMIT $2
+	`, mirrorMaxAttempts, limit, KindModel, KindPreview)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func createArtifactTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS artifacts (
+			job_id TEXT NOT NULL,
+			idx INT NOT NULL,
+			kind TEXT NOT NULL,
+			key TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			size BIGINT,
+			last_error TEXT,
+			next_attempt_at TIMESTAMPTZ DEFAULT NOW(),
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (job_id, idx, kind)
+		);
+		CREATE INDEX IF NOT EXISTS artifacts_due_idx ON artifacts (status, next_attempt_at);
+		ALTER TABLE artifacts ADD COLUMN IF NOT EXISTS sha256 TEXT;
+		ALTER TABLE artifacts ADD COLUMN IF NOT EXISTS format TEXT;
+	`)
+	return err
+}
+
+func initMirror(db *sql.DB) {
+	mirrorEnabled = parseBoolDefault(os.Getenv("MIRROR_ARTIFACTS"), true)
+	publicBaseURL = strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	artifactPublicBase = strings.TrimRight(os.Getenv("ARTIFACT_PUBLIC_BASE"), "/")
+	if err := createArtifactTable(db); err != nil {
+		log.Fatal("Error creating artifacts table:", err)
+	}
+	artifactRepo = NewPGArtifactRepo(db)
+	if !mirrorEnabled {
+		return
+	}
+	hub.SetPrepare(func(jobID string, _ *QueryProResult) []ResultFile { return mirrorJob(jobID) })
+	go mirrorRetryLoop()
+}
+
+/* =========================
+   镜像流程
+   ========================= */
+
+func previewKey(jobID string, idx int, srcURL string) string {
+	ext := ".png"
+	if u, err := url.Parse(srcURL); err == nil {
+		if e := strings.ToLower(path.Ext(u.Path)); e == ".jpg" || e == ".jpeg" || e == ".webp" || e == ".gif" {
+			ext = e
+		}
+	}
+	return fmt.Sprintf("%s_%d_preview%s", jobID, idx, ext)
+}
+
+// permanentURL 本服务对外的永久地址
+func permanentURL(jobID string, idx int, kind, key string) string {
+	if artifactPublicBase != "" {
+		return artifactPublicBase + "/" + key
+	}
+	if kind == KindPreview {
+		return fmt.Sprintf("%s/api/jobs/%s/files/%d/preview", publicBaseURL, jobID, idx)
+	}
+	return fmt.Sprintf("%s/api/download/%s/%d", publicBaseURL, jobID, idx)
+}
+
+func mirrorBackoff(attempts int) time.Duration {
+	d := mirrorBackoffBase << attempts
+	if d <= 0 || d > mirrorBackoffMax {
+		d = mirrorBackoffMax
+	}
+	return d
+}
+
+// mirrorJob 镜像 job 的所有未镜像条目，返回改写后的文件列表（失败的条目保留原地址）
+func mirrorJob(jobID string) []ResultFile {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil || jm == nil {
+		log.Printf("mirror %s: load job: %v\n", jobID, err)
+		return nil
+	}
+	if jm.Status != "DONE" {
+		return jm.Files
+	}
+
+	attempts := map[string]int{}
+	if list, err := artifactRepo.ListByJob(ctx, jobID); err == nil {
+		for _, a := range list {
+			attempts[a.Kind+strconv.Itoa(a.Idx)] = a.Attempts
+		}
+	}
+
+	files := append([]ResultFile(nil), jm.Files...)
+	total, done := 0, 0
+	for _, f := range files {
+		total++
+		if f.sourcePreviewURL() != "" {
+			total++
+		}
+	}
+
+	progress := func(idx int, kind, state, errStr string) {
+		done++
+		hub.Publish(jobID, EventMirror, gin.H{
+			"index": idx, "kind": kind, "state": state, "error": errStr,
+			"done": done, "total": total,
+		})
+	}
+
+	mirror := func(idx int, kind, key, src string) bool {
+		if err := artifactRepo.Begin(ctx, jobID, idx, kind, key); err != nil {
+			log.Printf("mirror %s/%d/%s: %v\n", jobID, idx, kind, err)
+		}
+		info, err := fetchArtifact(ctx, jobID, idx, kind, key, src)
+		if errors.Is(err, ErrArtifactExpired) {
+			progress(idx, kind, "expired", err.Error())
+			return false
+		}
+		if err != nil {
+			next := time.Now().Add(mirrorBackoff(attempts[kind+strconv.Itoa(idx)]))
+			_ = artifactRepo.MarkFailed(ctx, jobID, idx, kind, err.Error(), next)
+			progress(idx, kind, "failed", err.Error())
+			return false
+		}
+		_ = artifactRepo.MarkMirrored(ctx, jobID, idx, kind, info.Size)
+		progress(idx, kind, "mirrored", "")
+		return true
+	}
+
+	changed := false
+	for i := range files {
+		f := &files[i]
+		if f.Key != "" {
+			progress(i, KindModel, "mirrored", "")
+		} else {
+			ext := strings.ToLower(f.Type)
+			if ext == "" {
+				ext = "bin"
+			}
+			key := artifactKey(jobID, i, ext)
+			if mirror(i, KindModel, key, f.sourceURL()) {
+				f.SourceUrl, f.Key = f.sourceURL(), key
+				f.Url = permanentURL(jobID, i, KindModel, key)
+				changed = true
+			}
+		}
+
+		src := f.sourcePreviewURL()
+		if src == "" {
+			continue
+		}
+		if f.PreviewKey != "" {
+			progress(i, KindPreview, "mirrored", "")
+			continue
+		}
+		key := previewKey(jobID, i, src)
+		if mirror(i, KindPreview, key, src) {
+			f.SourcePreviewUrl, f.PreviewKey = src, key
+			f.PreviewImageUrl = permanentURL(jobID, i, KindPreview, key)
+			changed = true
+		}
+	}
+
+	if changed {
+		merged, err := repo.MergeMirrored(ctx, jobID, files)
+		if err != nil {
+			log.Printf("mirror %s: update files: %v\n", jobID, err)
+		} else {
+			files = merged
+		}
+	}
+	// 统计、校验、优化版和缩略图都要解析整个模型，后台进行，不阻塞完成事件
+	startPostMirror(jobID, files, postMirrorSteps)
+	return files
+}
+
+/* =========================
+   镜像后处理
+   ========================= */
+
+type postMirrorStep struct {
+	name string
+	run  func(ctx context.Context, jobID string, files []ResultFile)
+}
+
+// postMirrorSteps 依次执行，统计排在最前（列表接口的过滤依赖它）
+var postMirrorSteps = []postMirrorStep{
+	{"mesh stats", recordMeshStats},
+	{"validate", validateModels},
+	{"optimize", optimizeModels},
+	{"render", renderModelPreviews},
+}
+
+const postMirrorStepTimeout = 10 * time.Minute
+
+var postMirrorGroup singleflight.Group
+
+// startPostMirror 在后台执行 steps；同一 job 的同一组步骤同时只跑一份。
+// 解析第三方模型的代码可能 panic，每一步单独 recover 并记日志，不会带崩进程，也不影响后面的步骤
+func startPostMirror(jobID string, files []ResultFile, steps []postMirrorStep) {
+	names := make([]string, len(steps))
+	for i, s := range steps {
+		names[i] = s.name
+	}
+	go postMirrorGroup.Do(jobID+" "+strings.Join(names, ","), func() (any, error) {
+		for _, s := range steps {
+			runPostMirrorStep(jobID, files, s)
+		}
+		return nil, nil
+	})
+}
+
+func runPostMirrorStep(jobID string, files []ResultFile, s postMirrorStep) {
+	ctx, cancel := context.WithTimeout(context.Background(), postMirrorStepTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("post-mirror %s %s: panic: %v\n%s", jobID, s.name, r, debug.Stack())
+		}
+	}()
+	s.run(ctx, jobID, files)
+}
+
+// 定期重试镜像失败/中断的条目
+func mirrorRetryLoop() {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for range t.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ids, err := artifactRepo.DueJobs(ctx, 20)
+		cancel()
+		if err != nil {
+			log.Println("mirror retry:", err)
+			continue
+		}
+		for _, id := range ids {
+			mirrorJob(id)
+		}
+	}
+}
+
+/* =========================
+   HTTP Handlers
+   ========================= */
+
+// GET /api/jobs/:id/files/:idx/preview[?source=1]
+func handlePreview(c *gin.Context) {
+	jobID := c.Param("id")
+	idx, _ := strconv.Atoi(c.Param("idx"))
+	ctx := c.Request.Context()
+
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if idx < 0 || idx >= len(jm.Files) {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "index out of range"})
+		return
+	}
+	f := jm.Files[idx]
+	// 默认返回统一风格的渲染图；渲染失败或格式不支持时退回上游预览图
+	noSource := f.PreviewKey == "" && f.sourcePreviewURL() == ""
+	if jm.Status == "DONE" && c.Query("source") != "1" && (renderPreviews || noSource) && servePreviewRender(c, jm, idx) {
+		return
+	}
+	if f.PreviewKey == "" {
+		if src := f.sourcePreviewURL(); src != "" {
+			c.Redirect(http.StatusFound, src)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "no preview"})
+		return
+	}
+
+	// 缺失或校验失败被隔离时重新拉取
+	if _, err := fetchArtifact(ctx, jobID, idx, KindPreview, f.PreviewKey, f.sourcePreviewURL()); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	serveArtifact(c, jm, idx, KindPreview, f.PreviewKey, "")
+}
+
+// GET /api/jobs/:id/artifacts 查看镜像状态
+func handleListArtifacts(c *gin.Context) {
+	jobID := c.Param("id")
+	jm, err := repo.Get(c.Request.Context(), jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	list, err := artifactRepo.ListByJob(c.Request.Context(), jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "job_id": jobID, "artifacts": list})
+}
@@ -0,0 +1,54 @@
+// mirror_test.go
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStartPostMirrorRecoversPanics(t *testing.T) {
+	done := make(chan struct{})
+	steps := []postMirrorStep{
+		{"boom", func(context.Context, string, []ResultFile) { panic("malformed model") }},
+		{"after", func(context.Context, string, []ResultFile) { close(done) }},
+	}
+	startPostMirror("job-panic", nil, steps)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("step after the panic did not run")
+	}
+}
+
+// 镜像期间上游轮询写入了新的签名地址：两边各自的更新都不能丢
+func TestMergeMirroredKeepsConcurrentRefresh(t *testing.T) {
+	snapshot := []ResultFile{{Type: "GLB", Url: "https://cos/a.glb?sig=1", PreviewImageUrl: "https://cos/a.png?sig=1"}}
+	mirrored := []ResultFile{{
+		Type: "GLB", Url: "https://api/artifacts/a", Key: "jobs/j/0.glb", SourceUrl: "https://cos/a.glb?sig=1",
+		PreviewImageUrl: "https://cos/a.png?sig=1",
+	}}
+	refreshed := []ResultFile{{Type: "GLB", Url: "https://cos/a.glb?sig=2", PreviewImageUrl: "https://cos/a.png?sig=2"}}
+
+	// 轮询先写，镜像后写
+	cur := mergeFiles(snapshot, refreshed)
+	got := mergeMirrored(cur, mirrored)[0]
+	if got.Key != "jobs/j/0.glb" || got.Url != "https://api/artifacts/a" || got.SourceUrl != "https://cos/a.glb?sig=2" {
+		t.Errorf("mirror after refresh: %+v", got)
+	}
+	if got.PreviewImageUrl != "https://cos/a.png?sig=2" || got.PreviewKey != "" {
+		t.Errorf("preview not mirrored must keep the refreshed url: %+v", got)
+	}
+
+	// 镜像先写，轮询后写
+	cur = mergeMirrored(snapshot, mirrored)
+	got = mergeFiles(cur, refreshed)[0]
+	if got.Key != "jobs/j/0.glb" || got.Url != "https://api/artifacts/a" || got.SourceUrl != "https://cos/a.glb?sig=2" {
+		t.Errorf("refresh after mirror: %+v", got)
+	}
+
+	// 文件列表已被替换时不合并
+	if got := mergeMirrored(append(refreshed, ResultFile{Type: "OBJ"}), mirrored); got[0].Key != "" {
+		t.Errorf("merged into a replaced list: %+v", got)
+	}
+}
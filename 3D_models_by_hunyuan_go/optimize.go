@@ -0,0 +1,510 @@
+// optimize.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   GLB 压缩与贴图优化
+   ========================= */
+
+// enable_pbr 的模型贴图大且未压缩，网页查看器加载慢。优化版 GLB：
+//   - 几何按 KHR_mesh_quantization 量化（位置 16 位、法线 8 位、UV 16 位、顶点色 8 位）
+//   - 贴图等比缩到 max_texture 以内，不透明贴图重编码为 JPEG（PNG 更小时用 PNG），法线贴图和带透明的贴图
+//     用 PNG 无损压缩；未缩放且重编码不变小时保留原图
+// 没有纯 Go 的 WebP/KTX2 编码器（仓库也不引入 cgo 依赖），内置路径贴图只输出 JPEG/PNG，原本就是 WebP 的贴图原样保留；
+// 配置 OPTIMIZE_GLTFPACK 后可用 texture_format=webp|ktx2、meshopt=1 交给 gltfpack 处理（见 optimize_external.go）。
+// 优化版在镜像完成后后台生成，GLB 下载默认返回优化版（比原文件小时），带 original=1 取原文件。
+//
+// GET /api/jobs/:id/optimize[?index=N][&max_texture=2048&jpeg_quality=85&quantize=1][&texture_format=webp&meshopt=1]
+//                                                                                      生成并返回节省情况
+// GET /api/jobs/:id/export?format=glb&optimize=1[&max_texture=...]                      下载优化版（也可与其他导出参数组合）
+
+const ReportOptimize = "optimize"
+
+type OptimizeOptions struct {
+	MaxTexture  int  `json:"max_texture"`
+	JPEGQuality int  `json:"jpeg_quality"`
+	Quantize    bool `json:"quantize"`
+
+	// 以下两项需要 gltfpack，见 optimize_external.go
+	TextureFormat string `json:"texture_format,omitempty"` // webp|ktx2，空为内置 JPEG/PNG
+	Meshopt       bool   `json:"meshopt,omitempty"`
+}
+
+var (
+	optimizeDefaults   = OptimizeOptions{MaxTexture: 2048, JPEGQuality: 85, Quantize: true}
+	optimizeOnDownload = true
+)
+
+type TextureChange struct {
+	From TextureInfo `json:"from"`
+	To   TextureInfo `json:"to"`
+	Note string      `json:"note,omitempty"`
+}
+
+type OptimizeReport struct {
+	Options        OptimizeOptions `json:"options"`
+	OriginalBytes  int64           `json:"original_bytes"`
+	OptimizedBytes int64           `json:"optimized_bytes"`
+	SavedBytes     int64           `json:"saved_bytes"`
+	SavedPercent   float64         `json:"saved_percent"`
+	Textures       []TextureChange `json:"textures,omitempty"`
+	Encoder        string          `json:"encoder,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func initOptimize() {
+	optimizeOnDownload = parseBoolDefault(os.Getenv("OPTIMIZE_DEFAULT"), true)
+	optimizeDefaults.Quantize = parseBoolDefault(os.Getenv("OPTIMIZE_QUANTIZE"), true)
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("OPTIMIZE_MAX_TEXTURE"))); err == nil && n >= 64 {
+		optimizeDefaults.MaxTexture = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("OPTIMIZE_JPEG_QUALITY"))); err == nil && n >= 1 && n <= 100 {
+		optimizeDefaults.JPEGQuality = n
+	}
+	initGltfpack()
+}
+
+// parseOptimizeOptions 未带 optimize=1 时返回 nil；未给出的参数取默认值
+func parseOptimizeOptions(q url.Values) (*OptimizeOptions, error) {
+	if on, _ := strconv.ParseBool(q.Get("optimize")); !on {
+		return nil, nil
+	}
+	o := optimizeDefaults
+	if v := q.Get("max_texture"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 64 || n > 16384 {
+			return nil, errors.New("invalid max_texture, want 64..16384")
+		}
+		o.MaxTexture = n
+	}
+	if v := q.Get("jpeg_quality"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			return nil, errors.New("invalid jpeg_quality, want 1..100")
+		}
+		o.JPEGQuality = n
+	}
+	if v := q.Get("quantize"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("invalid quantize")
+		}
+		o.Quantize = b
+	}
+	// texture_format=jpeg、meshopt=0 可关闭 OPTIMIZE_TEXTURE_FORMAT/OPTIMIZE_MESHOPT 设置的默认值
+	if v := strings.ToLower(q.Get("texture_format")); v != "" {
+		if v != "jpeg" && textureFormats[v] == "" {
+			return nil, errors.New("invalid texture_format, want jpeg|webp|ktx2")
+		}
+		if v == "jpeg" {
+			v = ""
+		}
+		o.TextureFormat = v
+	}
+	if v := q.Get("meshopt"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("invalid meshopt")
+		}
+		o.Meshopt = b
+	}
+	if o.external() && gltfpackPath == "" {
+		return nil, errNoExternalEncoder
+	}
+	return &o, nil
+}
+
+// Variant 缓存 key 中的参数部分，如 opt-t2048-j85-mq、opt-t2048-j85-mq-tw-mc
+func (o *OptimizeOptions) Variant() string {
+	if o == nil {
+		return ""
+	}
+	v := fmt.Sprintf("opt-t%d-j%d", o.MaxTexture, o.JPEGQuality)
+	if o.Quantize {
+		v += "-mq"
+	}
+	if o.TextureFormat != "" {
+		v += "-t" + o.TextureFormat[:1]
+	}
+	if o.Meshopt {
+		v += "-mc"
+	}
+	return v
+}
+
+/* =========================
+   贴图
+   ========================= */
+
+// OptimizeTextures 就地缩小、重编码场景中的贴图，返回每张贴图的变化。
+// 贴图之后还要交给 gltfpack 转码时只缩放、用 PNG 无损保存，避免两次有损压缩
+func OptimizeTextures(s *Scene, o *OptimizeOptions) []TextureChange {
+	normal := map[int]bool{}
+	for _, m := range s.Materials {
+		if m.NormalTex >= 0 {
+			normal[m.NormalTex] = true
+		}
+	}
+	var changes []TextureChange
+	for i, im := range s.Images {
+		out, note := optimizeImage(im, o.MaxTexture, o.JPEGQuality, normal[i] || o.TextureFormat != "")
+		s.Images[i] = out
+		changes = append(changes, TextureChange{From: textureInfo(im), To: textureInfo(out), Note: note})
+	}
+	return changes
+}
+
+func optimizeImage(im Image, maxDim, quality int, lossless bool) (Image, string) {
+	src, _, err := image.Decode(bytes.NewReader(im.Data))
+	if err != nil {
+		return im, "kept: cannot decode (" + strings.TrimPrefix(im.Ext(), ".") + ")"
+	}
+	b := src.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), src, b.Min, draw.Src)
+
+	resized := false
+	if w, h := b.Dx(), b.Dy(); max(w, h) > maxDim {
+		f := float64(maxDim) / float64(max(w, h))
+		nrgba = downsample(nrgba, max(1, int(math.Round(float64(w)*f))), max(1, int(math.Round(float64(h)*f))))
+		resized = true
+	}
+
+	var buf bytes.Buffer
+	out := Image{Name: im.Name, MimeType: "image/jpeg"}
+	if !lossless && nrgba.Opaque() {
+		err = jpeg.Encode(&buf, nrgba, &jpeg.Options{Quality: quality})
+	}
+	// 有透明、法线贴图，或 JPEG 反而比原图大（色块简单的图 PNG 更省）时用 PNG
+	if lossless || !nrgba.Opaque() || err != nil || buf.Len() >= len(im.Data) {
+		var pb bytes.Buffer
+		if perr := (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&pb, nrgba); perr == nil && (buf.Len() == 0 || err != nil || pb.Len() < buf.Len()) {
+			buf, out.MimeType, err = pb, "image/png", nil
+		}
+	}
+	if err != nil {
+		return im, "kept: " + err.Error()
+	}
+	if !resized && buf.Len() >= len(im.Data) {
+		return im, "kept: re-encoding is not smaller"
+	}
+	out.Data = buf.Bytes()
+	return out, ""
+}
+
+// downsample 区域平均缩小（按覆盖的源像素块取均值）
+func downsample(src *image.NRGBA, w, h int) *image.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max((y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max((x+1)*sw/w, x0+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					sum[0] += int(p[0])
+					sum[1] += int(p[1])
+					sum[2] += int(p[2])
+					sum[3] += int(p[3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			d := dst.Pix[y*dst.Stride+x*4:]
+			for k := 0; k < 4; k++ {
+				d[k] = uint8((sum[k] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+/* =========================
+   几何量化
+   ========================= */
+
+// quantizeHook 按 KHR_mesh_quantization 写 primitive。整个场景共用一套位置量化网格
+// （统一缩放，法线不受影响），节点的 translation/scale 还原坐标；LOD 各级顶点都在主模型包围盒内，可共用
+func quantizeHook(s *Scene) gltfMeshHook {
+	if s.VertexCount() == 0 {
+		return nil
+	}
+	mn, mx := s.Bounds()
+	ext := float64(max(mx[0]-mn[0], mx[1]-mn[1], mx[2]-mn[2]))
+	if !(ext > 0) {
+		return nil
+	}
+	step := ext / 65535
+
+	return func(b *gltfBuilder, m *Mesh, prim, node map[string]any) bool {
+		n := len(m.Positions)
+		if n == 0 {
+			return false
+		}
+		// 位置：uint16 x3，步长补齐到 8 字节
+		data := make([]byte, n*8)
+		qmin, qmax := [3]int{65535, 65535, 65535}, [3]int{}
+		for i, p := range m.Positions {
+			for k := 0; k < 3; k++ {
+				q := min(max(int(math.Round(float64(p[k]-mn[k])/step)), 0), 65535)
+				binary.LittleEndian.PutUint16(data[i*8+k*2:], uint16(q))
+				qmin[k], qmax[k] = min(qmin[k], q), max(qmax[k], q)
+			}
+		}
+		attrs := map[string]int{"POSITION": b.addAccessor(map[string]any{
+			"bufferView": b.addView(data, 8, 34962), "componentType": 5123,
+			"count": n, "type": "VEC3", "min": qmin[:], "max": qmax[:],
+		})}
+
+		if len(m.Normals) == n {
+			data := make([]byte, n*4)
+			for i, v := range m.Normals {
+				for k := 0; k < 3; k++ {
+					data[i*4+k] = byte(int8(math.Round(float64(min(max(v[k], -1), 1)) * 127)))
+				}
+			}
+			attrs["NORMAL"] = b.addAccessor(map[string]any{
+				"bufferView": b.addView(data, 4, 34962), "componentType": 5120, "normalized": true,
+				"count": n, "type": "VEC3",
+			})
+		}
+
+		if len(m.UVs) == n {
+			inRange := true
+			for _, uv := range m.UVs {
+				if uv[0] < 0 || uv[0] > 1 || uv[1] < 0 || uv[1] > 1 {
+					inRange = false
+					break
+				}
+			}
+			if inRange {
+				data := make([]byte, n*4)
+				for i, uv := range m.UVs {
+					binary.LittleEndian.PutUint16(data[i*4:], uint16(math.Round(float64(uv[0])*65535)))
+					binary.LittleEndian.PutUint16(data[i*4+2:], uint16(math.Round(float64(uv[1])*65535)))
+				}
+				attrs["TEXCOORD_0"] = b.addAccessor(map[string]any{
+					"bufferView": b.addView(data, 0, 34962), "componentType": 5123, "normalized": true,
+					"count": n, "type": "VEC2",
+				})
+			} else {
+				attrs["TEXCOORD_0"] = b.vec2(m.UVs) // 平铺 UV 超出 [0,1]，保持浮点
+			}
+		}
+
+		if len(m.Colors) == n {
+			data := make([]byte, n*4)
+			for i, c := range m.Colors {
+				for k := 0; k < 4; k++ {
+					data[i*4+k] = uint8(math.Round(float64(clamp01(c[k])) * 255))
+				}
+			}
+			attrs["COLOR_0"] = b.addAccessor(map[string]any{
+				"bufferView": b.addView(data, 0, 34962), "componentType": 5121, "normalized": true,
+				"count": n, "type": "VEC4",
+			})
+		}
+
+		prim["attributes"] = attrs
+		prim["indices"] = b.indices(m.Indices, n)
+		node["translation"] = []float32{mn[0], mn[1], mn[2]}
+		node["scale"] = []float64{step, step, step}
+		b.useExtension("KHR_mesh_quantization", true)
+		return true
+	}
+}
+
+// writeOptimizedGLTF 按选项量化几何并输出 glTF/GLB（贴图需事先处理）；WebP/KTX2、meshopt 只支持 GLB
+func writeOptimizedGLTF(w io.Writer, s *Scene, o *OptimizeOptions, binary bool) error {
+	if o.external() {
+		if !binary {
+			return errors.New("texture_format and meshopt are only supported for glb")
+		}
+		return gltfpackGLB(w, s, o)
+	}
+	var hook gltfMeshHook
+	if o.Quantize {
+		hook = quantizeHook(s)
+	}
+	b := buildGLTF(s, hook)
+	if binary {
+		return b.writeGLB(w)
+	}
+	return b.writeEmbedded(w)
+}
+
+/* =========================
+   生成、缓存与下载
+   ========================= */
+
+func optimizedKey(jobID string, idx int, o *OptimizeOptions) (key, kind string) {
+	variant := "glb-" + o.Variant()
+	return exportKey(jobID, idx, variant, "glb"), KindExport + ":" + variant
+}
+
+// ensureOptimized 生成（或复用）第 idx 个模型的优化版 GLB，返回节省情况报告
+func ensureOptimized(ctx context.Context, jobID string, idx int, f ResultFile, o *OptimizeOptions) (json.RawMessage, error) {
+	_, src, err := modelArtifact(ctx, jobID, idx, f)
+	if err != nil {
+		return nil, err
+	}
+	key, kind := optimizedKey(jobID, idx, o)
+	reportKind := ReportOptimize + ":" + o.Variant()
+	if _, err := store.Stat(ctx, key); err == nil {
+		if raw, err := reportRepo.Get(ctx, jobID, idx, reportKind, src.SHA256); err == nil && raw != nil {
+			return raw, nil
+		}
+	}
+
+	v, err, _ := exportGroup.Do(key, func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		exportSem <- struct{}{}
+		defer func() { <-exportSem }()
+
+		s, err := loadScene(ctx, jobID, idx, f)
+		if err != nil {
+			return nil, err
+		}
+		if jm, err := repo.Get(ctx, jobID); err == nil {
+			s.Provenance = jobProvenance(jm, idx)
+		}
+		rep := &OptimizeReport{Options: *o, OriginalBytes: src.Size, CreatedAt: time.Now()}
+		rep.Textures = OptimizeTextures(s, o)
+		if o.external() {
+			rep.Encoder = "gltfpack " + strings.Join(o.gltfpackArgs(), " ")
+		}
+		var buf bytes.Buffer
+		if err := writeOptimizedGLTF(&buf, s, o, true); err != nil {
+			return nil, err
+		}
+		rep.OptimizedBytes = int64(buf.Len())
+		rep.SavedBytes = rep.OriginalBytes - rep.OptimizedBytes
+		if rep.OriginalBytes > 0 {
+			rep.SavedPercent = math.Round(float64(rep.SavedBytes)*1000/float64(rep.OriginalBytes)) / 10
+		}
+		if err := putExport(ctx, jobID, idx, kind, key, func(w io.Writer) error {
+			_, err := w.Write(buf.Bytes())
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		if err := reportRepo.Put(ctx, jobID, idx, reportKind, src.SHA256, rep); err != nil {
+			log.Printf("optimize report %s/%d: %v\n", jobID, idx, err)
+		}
+		log.Printf("optimized %s/%d: %d -> %d bytes\n", jobID, idx, rep.OriginalBytes, rep.OptimizedBytes)
+		return json.Marshal(rep)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// optimizeModels 为 GLB 文件生成默认优化版（后处理流水线的一步）
+func optimizeModels(ctx context.Context, jobID string, files []ResultFile) {
+	if !optimizeOnDownload || reportRepo == nil {
+		return
+	}
+	for i, f := range files {
+		if f.Key == "" || !strings.EqualFold(f.Type, "glb") {
+			continue
+		}
+		if _, err := ensureOptimized(ctx, jobID, i, f, &optimizeDefaults); err != nil {
+			log.Printf("optimize %s/%d: %v\n", jobID, i, err)
+		}
+	}
+}
+
+// optimizedDownload 默认优化版已生成且确实更小时返回其 key
+func optimizedDownload(ctx context.Context, jobID string, idx int) (key, kind string, ok bool) {
+	key, kind = optimizedKey(jobID, idx, &optimizeDefaults)
+	opt, err := artifactRepo.Get(ctx, jobID, idx, kind)
+	if err != nil || opt == nil || opt.Status != "mirrored" {
+		return "", "", false
+	}
+	orig, err := artifactRepo.Get(ctx, jobID, idx, KindModel)
+	if err != nil || orig == nil || orig.Size <= opt.Size {
+		return "", "", false
+	}
+	if _, err := store.Stat(ctx, key); err != nil {
+		return "", "", false
+	}
+	return key, kind, true
+}
+
+func handleOptimize(c *gin.Context) {
+	jobID := c.Param("id")
+	ctx := c.Request.Context()
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if jm.Status != "DONE" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done"})
+		return
+	}
+	idx, err := modelSourceIndex(jm, c.Query("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	q := c.Request.URL.Query()
+	q.Set("optimize", "1")
+	o, err := parseOptimizeOptions(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	raw, err := ensureOptimized(ctx, jobID, idx, jm.Files[idx], o)
+	if err != nil {
+		exportError(c, err)
+		return
+	}
+	params := url.Values{"format": {"glb"}, "optimize": {"1"}, "index": {strconv.Itoa(idx)},
+		"max_texture": {strconv.Itoa(o.MaxTexture)}, "jpeg_quality": {strconv.Itoa(o.JPEGQuality)}, "quantize": {strconv.FormatBool(o.Quantize)}}
+	if gltfpackPath != "" {
+		tex := o.TextureFormat
+		if tex == "" {
+			tex = "jpeg"
+		}
+		params.Set("texture_format", tex)
+		params.Set("meshopt", strconv.FormatBool(o.Meshopt))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok": true, "job_id": jobID, "index": idx, "report": raw,
+		"optimized_url": fmt.Sprintf("%s/api/jobs/%s/export?%s", publicBaseURL, jobID, params.Encode()),
+		"original_url":  fmt.Sprintf("%s/api/download/%s/%d?original=1", publicBaseURL, jobID, idx),
+	})
+}
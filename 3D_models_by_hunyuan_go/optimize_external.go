@@ -0,0 +1,123 @@
+// optimize_external.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/* =========================
+   外部编码器（gltfpack）
+   ========================= */
+
+// WebP/KTX2 贴图和 EXT_meshopt_compression 没有纯 Go 实现，配置 OPTIMIZE_GLTFPACK（gltfpack 可执行文件路径）后
+// 交给 gltfpack 处理：本服务先缩放贴图（无损 PNG，避免二次有损）、写出未量化的 GLB，gltfpack 再做量化、
+// meshopt 压缩和贴图转码。
+//   texture_format=webp  贴图转 WebP（EXT_texture_webp，需 gltfpack 0.21+）
+//   texture_format=ktx2  贴图转 KTX2/BasisU（KHR_texture_basisu，需带 BasisU 的 gltfpack 构建）
+//   meshopt=1            EXT_meshopt_compression，查看器需加载 MeshoptDecoder
+// 产物依赖查看器支持对应扩展，默认不开启；只支持输出 GLB，不能与 lods 组合。
+
+const gltfpackTimeout = 5 * time.Minute
+
+var (
+	gltfpackPath string
+
+	textureFormats = map[string]string{"webp": "-tw", "ktx2": "-tc"}
+
+	errNoExternalEncoder = errors.New("texture_format and meshopt require OPTIMIZE_GLTFPACK")
+)
+
+// initGltfpack 在 initOptimize 中调用；找不到可执行文件时记日志并关闭外部编码
+func initGltfpack() {
+	p := strings.TrimSpace(os.Getenv("OPTIMIZE_GLTFPACK"))
+	if p == "" {
+		return
+	}
+	resolved, err := exec.LookPath(p)
+	if err != nil {
+		log.Printf("OPTIMIZE_GLTFPACK: %v, external encoding disabled\n", err)
+		return
+	}
+	gltfpackPath = resolved
+	if f := strings.ToLower(strings.TrimSpace(os.Getenv("OPTIMIZE_TEXTURE_FORMAT"))); textureFormats[f] != "" {
+		optimizeDefaults.TextureFormat = f
+	}
+	optimizeDefaults.Meshopt = parseBoolDefault(os.Getenv("OPTIMIZE_MESHOPT"), false)
+}
+
+// external 是否需要 gltfpack
+func (o *OptimizeOptions) external() bool {
+	return o != nil && (o.TextureFormat != "" || o.Meshopt)
+}
+
+// gltfpackArgs 除输入输出外的参数；-ke 保留 extras（来源信息）
+func (o *OptimizeOptions) gltfpackArgs() []string {
+	args := []string{"-ke"}
+	if !o.Quantize {
+		args = append(args, "-noq")
+	}
+	if o.Meshopt {
+		args = append(args, "-cc")
+	}
+	if f := textureFormats[o.TextureFormat]; f != "" {
+		args = append(args, f)
+	}
+	return args
+}
+
+// gltfpackGLB 写出未量化的 GLB 交给 gltfpack，结果写入 w
+func gltfpackGLB(w io.Writer, s *Scene, o *OptimizeOptions) error {
+	if gltfpackPath == "" {
+		return errNoExternalEncoder
+	}
+	dir, err := os.MkdirTemp("", "gltfpack-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.glb"), filepath.Join(dir, "out.glb")
+
+	f, err := os.Create(in)
+	if err != nil {
+		return err
+	}
+	err = buildGLTF(s, nil).writeGLB(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gltfpackTimeout)
+	defer cancel()
+	args := append([]string{"-i", in, "-o", out}, o.gltfpackArgs()...)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gltfpackPath, args...)
+	cmd.Stdout, cmd.Stderr = io.Discard, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 512 {
+			msg = msg[len(msg)-512:]
+		}
+		return fmt.Errorf("gltfpack %s: %v: %s", strings.Join(o.gltfpackArgs(), " "), err, msg)
+	}
+
+	rf, err := os.Open(out)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+	_, err = io.Copy(w, rf)
+	return err
+}
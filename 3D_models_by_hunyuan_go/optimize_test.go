@@ -0,0 +1,74 @@
+// optimize_test.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseOptimizeExternal(t *testing.T) {
+	q := url.Values{"optimize": {"1"}, "texture_format": {"webp"}}
+	if _, err := parseOptimizeOptions(q); !errors.Is(err, errNoExternalEncoder) {
+		t.Fatalf("without gltfpack: got %v, want errNoExternalEncoder", err)
+	}
+
+	gltfpackPath = "/usr/bin/gltfpack"
+	defer func() { gltfpackPath = "" }()
+	for raw, want := range map[string]string{
+		"optimize=1":                                "opt-t2048-j85-mq",
+		"optimize=1&texture_format=webp":            "opt-t2048-j85-mq-tw",
+		"optimize=1&texture_format=KTX2&meshopt=1":  "opt-t2048-j85-mq-tk-mc",
+		"optimize=1&texture_format=jpeg&quantize=0": "opt-t2048-j85",
+	} {
+		q, _ := url.ParseQuery(raw)
+		o, err := parseOptimizeOptions(q)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if got := o.Variant(); got != want {
+			t.Errorf("%s: variant %q, want %q", raw, got, want)
+		}
+	}
+	if _, err := parseOptimizeOptions(url.Values{"optimize": {"1"}, "texture_format": {"avif"}}); err == nil {
+		t.Error("texture_format=avif accepted")
+	}
+}
+
+func TestGltfpackGLB(t *testing.T) {
+	// 假的 gltfpack：记录参数并把输入原样复制到输出
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\ncp \"$2\" \"$4\"\n"
+	gltfpackPath = filepath.Join(dir, "gltfpack")
+	if err := os.WriteFile(gltfpackPath, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { gltfpackPath = "" }()
+
+	o := optimizeDefaults
+	o.TextureFormat, o.Meshopt = "webp", true
+	var buf bytes.Buffer
+	if err := writeOptimizedGLTF(&buf, cubeTestScene(), &o, true); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := ParseGLB(buf.Bytes()); err != nil || s.VertexCount() == 0 {
+		t.Fatalf("output is not a valid GLB: %v", err)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if got := strings.TrimSpace(string(args)); !strings.HasSuffix(got, "-ke -cc -tw") {
+		t.Errorf("args %q, want quantized meshopt webp", got)
+	}
+	if err := writeOptimizedGLTF(&bytes.Buffer{}, cubeTestScene(), &o, false); err == nil {
+		t.Error("gltf output accepted for external encoder")
+	}
+
+	os.WriteFile(gltfpackPath, []byte("#!/bin/sh\necho 'unsupported option -tw' >&2\nexit 1\n"), 0o755)
+	if err := writeOptimizedGLTF(&bytes.Buffer{}, cubeTestScene(), &o, true); err == nil || !strings.Contains(err.Error(), "unsupported option") {
+		t.Errorf("got %v, want stderr in error", err)
+	}
+}
@@ -0,0 +1,197 @@
+// printability.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+/* =========================
+   3D 打印检查接口
+   ========================= */
+
+// GET /api/jobs/:id/printability[?index=N]           检查报告（JSON）
+// GET /api/jobs/:id/printability?repair=1[&index=N]  修复后的 STL，可带导出接口的 unit/height/ground 等参数
+// 报告按源文件 SHA-256 缓存在 mesh_reports 表，源文件重新拉取后自动失效。
+
+const (
+	ReportPrintability         = "printability"
+	ReportPrintabilityRepaired = "printability:repaired"
+)
+
+var (
+	reportRepo  ReportRepo
+	reportGroup singleflight.Group
+)
+
+// ReportRepo 保存针对某个模型文件的分析报告
+type ReportRepo interface {
+	// Get 源文件摘要不一致（文件已变化）时返回 nil
+	Get(ctx context.Context, jobID string, idx int, kind, sha string) (json.RawMessage, error)
+	Put(ctx context.Context, jobID string, idx int, kind, sha string, report any) error
+}
+
+type pgReportRepo struct{ db *sql.DB }
+
+func NewPGReportRepo(db *sql.DB) ReportRepo { return &pgReportRepo{db: db} }
+
+func (r *pgReportRepo) Get(ctx context.Context, jobID string, idx int, kind, sha string) (json.RawMessage, error) {
+	var raw []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT report FROM mesh_reports WHERE job_id = $1 AND idx = $2 AND kind = $3 AND source_sha = $4
+	`, jobID, idx, kind, sha).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return raw, err
+}
+
+func (r *pgReportRepo) Put(ctx context.Context, jobID string, idx int, kind, sha string, report any) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO mesh_reports (job_id, idx, kind, source_sha, report, updated_at)
+		VALUES ($1, $2, $3, $4, $5::jsonb, now())
+		ON CONFLICT (job_id, idx, kind) DO UPDATE
+		SET source_sha = EXCLUDED.source_sha, report = EXCLUDED.report, updated_at = now()
+	`, jobID, idx, kind, sha, string(b))
+	return err
+}
+
+func createReportTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS mesh_reports (
+			job_id TEXT NOT NULL,
+			idx INT NOT NULL,
+			kind TEXT NOT NULL,
+			source_sha TEXT NOT NULL,
+			report JSONB NOT NULL,
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (job_id, idx, kind)
+		)
+	`)
+	return err
+}
+
+func initReports(db *sql.DB) {
+	if err := createReportTable(db); err != nil {
+		log.Fatal("Error creating mesh_reports table:", err)
+	}
+	reportRepo = NewPGReportRepo(db)
+}
+
+// cachedReport 读取报告，没有时调用 build 生成并保存；同一文件并发请求只算一次
+func cachedReport(ctx context.Context, jobID string, idx int, kind, sha string, build func(context.Context) (any, error)) (json.RawMessage, error) {
+	if raw, err := reportRepo.Get(ctx, jobID, idx, kind, sha); err == nil && raw != nil {
+		return raw, nil
+	}
+	v, err, _ := reportGroup.Do(fmt.Sprintf("%s/%d/%s/%s", jobID, idx, kind, sha), func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		exportSem <- struct{}{}
+		defer func() { <-exportSem }()
+
+		rep, err := build(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := reportRepo.Put(ctx, jobID, idx, kind, sha, rep); err != nil {
+			log.Printf("report %s/%d/%s: %v\n", jobID, idx, kind, err)
+		}
+		return json.Marshal(rep)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+func handlePrintability(c *gin.Context) {
+	jobID := c.Param("id")
+	ctx := c.Request.Context()
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if jm.Status != "DONE" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done"})
+		return
+	}
+	idx, err := modelSourceIndex(jm, c.Query("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	_, src, err := modelArtifact(ctx, jobID, idx, jm.Files[idx])
+	if err != nil {
+		exportError(c, err)
+		return
+	}
+
+	if repair, _ := strconv.ParseBool(c.Query("repair")); repair {
+		tf, err := parseExportTransform(c.Request.URL.Query(), stlUnit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		variant := "printfix"
+		if v := tf.Variant(); v != "" {
+			variant += "-" + v
+		}
+		key := exportKey(jobID, idx, variant, "stl")
+		kind := KindExport + ":" + variant
+		if _, err := store.Stat(ctx, key); err != nil {
+			err := buildExport(ctx, jm, idx, kind, key, func(w io.Writer, s *Scene) error {
+				fixed, rep := RepairForPrint(s)
+				if err := reportRepo.Put(ctx, jobID, idx, ReportPrintabilityRepaired, src.SHA256, rep); err != nil {
+					log.Printf("report %s/%d: %v\n", jobID, idx, err)
+				}
+				tf.Apply(fixed, false)
+				return WriteSTL(w, fixed, exportCreator+" "+jobID+" repaired")
+			})
+			if err != nil {
+				exportError(c, err)
+				return
+			}
+		}
+		serveArtifact(c, jm, idx, kind, key, jobID+"_"+strconv.Itoa(idx)+"_repaired.stl")
+		return
+	}
+
+	raw, err := cachedReport(ctx, jobID, idx, ReportPrintability, src.SHA256, func(ctx context.Context) (any, error) {
+		s, err := loadScene(ctx, jobID, idx, jm.Files[idx])
+		if err != nil {
+			return nil, err
+		}
+		return AnalyzePrintability(s), nil
+	})
+	if err != nil {
+		exportError(c, err)
+		return
+	}
+	resp := gin.H{
+		"ok": true, "job_id": jobID, "index": idx, "report": raw,
+		"repair_url": fmt.Sprintf("%s/api/jobs/%s/printability?index=%d&repair=1", publicBaseURL, jobID, idx),
+	}
+	// 修复版已生成过时附上修复后的复查结果
+	if fixed, err := reportRepo.Get(ctx, jobID, idx, ReportPrintabilityRepaired, src.SHA256); err == nil && fixed != nil {
+		resp["repaired"] = fixed
+	}
+	c.JSON(http.StatusOK, resp)
+}
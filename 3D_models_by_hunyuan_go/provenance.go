@@ -0,0 +1,393 @@
+// provenance.go
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   来源信息（Provenance）
+   ========================= */
+
+// 导出的模型里写入生成来源，文件离开服务后仍能追溯是哪个任务、哪段 prompt 生成的：
+//   glTF/GLB  asset.extras（字段见 Provenance），设置了许可时同时写 asset.copyright
+//   OBJ       .obj 开头的注释行  # provenance {...}
+//   PLY       头部注释行        comment provenance {...}
+//   USDZ      USDA 层元数据     customLayerData = { string provenance = "{...}" }
+//   STL       80 字节文件头只放得下  <generator> job=<job_id> created=<日期>
+// FBX 不写入。只有经过导出链路（/export、优化版下载、打印修复）的文件带来源信息，原始下载保持上游文件不变。
+//
+// POST /api/provenance/verify  (multipart: file)  读出上传文件中的来源信息，并与任务记录、产物摘要比对
+
+const (
+	provenanceProvider = "Tencent Cloud Hunyuan 3D"
+	maxVerifyUpload    = 512 << 20
+)
+
+var (
+	provenanceEmbed   = true
+	provenancePrompt  = true
+	provenanceLicense = ""
+)
+
+func initProvenance() {
+	provenanceEmbed = parseBoolDefault(os.Getenv("PROVENANCE_EMBED"), true)
+	provenancePrompt = parseBoolDefault(os.Getenv("PROVENANCE_PROMPT"), true)
+	provenanceLicense = strings.TrimSpace(os.Getenv("PROVENANCE_LICENSE"))
+}
+
+// provenanceVariant 导出缓存 key 中的来源信息部分：关闭写入时为 p0，否则为设置的摘要。
+// 修改 PROVENANCE_* 后旧导出不再命中，按新设置重新生成
+func provenanceVariant() string {
+	if !provenanceEmbed {
+		return "p0"
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%t\x00%s", provenancePrompt, provenanceLicense)))
+	return "p" + hex.EncodeToString(h[:4])
+}
+
+type Provenance struct {
+	JobID        string    `json:"job_id"`
+	FileIndex    int       `json:"file_index"`
+	Mode         string    `json:"mode,omitempty"` // text | image | image_url | upload
+	Prompt       string    `json:"prompt,omitempty"`
+	GenerateType string    `json:"generate_type,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Generator    string    `json:"generator"`
+	Provider     string    `json:"provider"`
+	License      string    `json:"license,omitempty"`
+}
+
+// jobProvenance 导出时写入的来源信息；关闭写入时返回 nil
+func jobProvenance(jm *JobMeta, idx int) *Provenance {
+	if !provenanceEmbed || jm == nil {
+		return nil
+	}
+	return newProvenance(jm, idx)
+}
+
+func newProvenance(jm *JobMeta, idx int) *Provenance {
+	p := &Provenance{
+		JobID: jm.JobID, FileIndex: idx, CreatedAt: jm.CreatedAt.UTC(),
+		Generator: exportCreator, Provider: provenanceProvider, License: provenanceLicense,
+	}
+	if jm.Params != nil {
+		p.Mode, p.GenerateType = jm.Params.Mode, jm.Params.GenerateType
+		if p.Mode == "upload" {
+			p.Provider = uploadProvider
+		}
+		if provenancePrompt {
+			// 润色后实际提交的 prompt 才是模型的来源
+			p.Prompt = jm.Params.PromptUsed
+			if p.Prompt == "" {
+				p.Prompt = jm.Params.Prompt
+			}
+		}
+	}
+	return p
+}
+
+// line 单行 JSON，供注释行使用（换行已被转义）
+func (p *Provenance) line() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// gltfExtras asset.extras 的内容
+func (p *Provenance) gltfExtras() map[string]any {
+	var m map[string]any
+	_ = json.Unmarshal([]byte(p.line()), &m)
+	return m
+}
+
+// stlHeader STL 文件头，超长时依次省略创建时间和截断
+func (p *Provenance) stlHeader() string {
+	h := p.Generator + " job=" + p.JobID
+	if full := h + " created=" + p.CreatedAt.Format(time.DateOnly); len(full) <= 80 {
+		h = full
+	}
+	if len(h) > 80 {
+		h = h[:80]
+	}
+	return h
+}
+
+/* =========================
+   读取
+   ========================= */
+
+var ErrNoProvenance = errors.New("no provenance metadata found")
+
+// readProvenance 识别格式并读出来源信息；格式可识别但没有来源信息时返回 ErrNoProvenance
+func readProvenance(ra io.ReaderAt, size int64) (string, *Provenance, error) {
+	head := make([]byte, 512)
+	n, err := ra.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	format := sniffFormat(head)
+
+	var p *Provenance
+	switch format {
+	case "glb":
+		p, err = glbProvenance(ra, size)
+	case "gltf":
+		p, err = gltfProvenance(io.NewSectionReader(ra, 0, size))
+	case "obj":
+		p, err = commentProvenance(io.NewSectionReader(ra, 0, size), "#")
+	case "ply":
+		p, err = commentProvenance(io.NewSectionReader(ra, 0, size), "comment")
+	case "zip":
+		format, p, err = zipProvenance(ra, size)
+	case "stl":
+		p, err = stlProvenance(head)
+	default:
+		return format, nil, fmt.Errorf("%s files do not carry provenance metadata", format)
+	}
+	if err == nil && p == nil {
+		err = ErrNoProvenance
+	}
+	return format, p, err
+}
+
+func decodeProvenance(raw []byte) (*Provenance, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var p Provenance
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("bad provenance: %v", err)
+	}
+	if p.JobID == "" {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func gltfProvenance(r io.Reader) (*Provenance, error) {
+	var doc struct {
+		Asset struct {
+			Extras json.RawMessage `json:"extras"`
+		} `json:"asset"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("gltf: bad JSON: %v", err)
+	}
+	return decodeProvenance(doc.Asset.Extras)
+}
+
+func glbProvenance(ra io.ReaderAt, size int64) (*Provenance, error) {
+	var h [20]byte
+	if size < 20 {
+		return nil, errors.New("glb: too short")
+	}
+	if _, err := ra.ReadAt(h[:], 0); err != nil {
+		return nil, err
+	}
+	jsonLen := int64(binary.LittleEndian.Uint32(h[12:16]))
+	if string(h[16:20]) != "JSON" || 20+jsonLen > size {
+		return nil, errors.New("glb: missing or oversized JSON chunk")
+	}
+	return gltfProvenance(io.NewSectionReader(ra, 20, jsonLen))
+}
+
+// commentProvenance 在文件开头的注释行中查找 "<prefix> provenance {...}"
+func commentProvenance(r io.Reader, prefix string) (*Provenance, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 0; sc.Scan() && n < 64; n++ {
+		line := strings.TrimSpace(sc.Text())
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			if js, ok := strings.CutPrefix(strings.TrimSpace(rest), "provenance "); ok {
+				return decodeProvenance([]byte(js))
+			}
+		}
+	}
+	return nil, sc.Err()
+}
+
+// zipProvenance OBJ 压缩包读 .obj，USDZ 读 .usda
+func zipProvenance(ra io.ReaderAt, size int64) (string, *Provenance, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return "zip", nil, err
+	}
+	for _, f := range zr.File {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".obj":
+			rc, err := f.Open()
+			if err != nil {
+				return "obj", nil, err
+			}
+			p, err := commentProvenance(rc, "#")
+			rc.Close()
+			return "obj", p, err
+		case ".usda":
+			rc, err := f.Open()
+			if err != nil {
+				return "usdz", nil, err
+			}
+			p, err := usdaProvenance(rc)
+			rc.Close()
+			return "usdz", p, err
+		}
+	}
+	return "zip", nil, nil
+}
+
+func usdaProvenance(r io.Reader) (*Provenance, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 0; sc.Scan() && n < 64; n++ {
+		if q, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "string provenance = "); ok {
+			js, err := strconv.Unquote(q)
+			if err != nil {
+				return nil, fmt.Errorf("usda: bad provenance string: %v", err)
+			}
+			return decodeProvenance([]byte(js))
+		}
+	}
+	return nil, sc.Err()
+}
+
+// stlProvenance 解析文件头（二进制 80 字节或 ASCII 的 solid 行）中的 job=/created=
+func stlProvenance(head []byte) (*Provenance, error) {
+	h := head[:min(len(head), 80)]
+	if line, _, ok := bytes.Cut(head, []byte("\n")); ok && bytes.HasPrefix(bytes.TrimSpace(line), []byte("solid")) {
+		h = line
+	}
+	fields := strings.Fields(strings.TrimRight(string(h), "\x00"))
+	p := &Provenance{}
+	for i, f := range fields {
+		switch {
+		case strings.HasPrefix(f, "job="):
+			p.JobID = strings.TrimPrefix(f, "job=")
+			if i > 0 {
+				p.Generator = fields[i-1]
+			}
+		case strings.HasPrefix(f, "created="):
+			if t, err := time.Parse(time.DateOnly, strings.TrimPrefix(f, "created=")); err == nil {
+				p.CreatedAt = t
+			}
+		}
+	}
+	if p.JobID == "" {
+		return nil, nil
+	}
+	return p, nil
+}
+
+/* =========================
+   HTTP Handler
+   ========================= */
+
+func handleVerifyProvenance(c *gin.Context) {
+	// 解析表单前限制请求体，超大的文件不落盘；multipart 头留 1MiB 余量
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxVerifyUpload+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"ok": false, "error": "file too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "file is required"})
+		return
+	}
+	if fh.Size > maxVerifyUpload {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"ok": false, "error": "file too large"})
+		return
+	}
+	file, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, fh.Size)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	sha := hex.EncodeToString(h.Sum(nil))
+
+	format, p, err := readProvenance(file, fh.Size)
+	resp := gin.H{"ok": true, "format": format, "sha256": sha, "found": p != nil}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	if p == nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	resp["provenance"] = p
+
+	// 只向有权限的用户透露任务是否存在及比对结果
+	ctx := c.Request.Context()
+	jm, err := repo.Get(ctx, p.JobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		resp["job"] = gin.H{"known": false}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	job := gin.H{"known": true, "status": jm.Status}
+	job["mismatch"] = provenanceMismatch(p, newProvenance(jm, p.FileIndex))
+	// 与服务生成过的文件逐字节一致
+	if list, err := artifactRepo.ListByJob(ctx, p.JobID); err == nil {
+		for _, a := range list {
+			if a.SHA256 == sha {
+				job["artifact"] = gin.H{"idx": a.Idx, "kind": a.Kind}
+				break
+			}
+		}
+	}
+	resp["job"] = job
+	c.JSON(http.StatusOK, resp)
+}
+
+// provenanceMismatch 列出与任务记录不一致的字段；STL 只携带 job_id 和创建日期，其余字段不比较
+func provenanceMismatch(got, want *Provenance) []string {
+	out := []string{}
+	if got.Provider == "" {
+		if !got.CreatedAt.IsZero() && got.CreatedAt.Format(time.DateOnly) != want.CreatedAt.Format(time.DateOnly) {
+			out = append(out, "created_at")
+		}
+		return out
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) {
+		out = append(out, "created_at")
+	}
+	if got.Mode != want.Mode {
+		out = append(out, "mode")
+	}
+	if got.GenerateType != want.GenerateType {
+		out = append(out, "generate_type")
+	}
+	if got.Prompt != "" && got.Prompt != want.Prompt {
+		out = append(out, "prompt")
+	}
+	return out
+}
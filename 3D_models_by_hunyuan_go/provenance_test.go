@@ -0,0 +1,70 @@
+// provenance_test.go
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 简化、LOD 和打印修复会新建 Scene，来源信息要一路带到导出文件里
+func TestProvenanceSurvivesDerivedScenes(t *testing.T) {
+	prov := &Provenance{JobID: "job-prov", FileIndex: 0, CreatedAt: time.Now().UTC(), Generator: exportCreator, Provider: provenanceProvider}
+	src := func() *Scene {
+		s := cubeTestScene()
+		s.Provenance = prov
+		s.MetersPerUnit, s.ZUp = 0.001, true
+		return s
+	}
+	lods, err := parseSimplifyOptions(url.Values{"lods": {"8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, write := range map[string]func(io.Writer) error{
+		"faces glb": func(w io.Writer) error { return WriteGLB(w, Simplify(src(), 8)) },
+		"faces ply": func(w io.Writer) error { return WritePLY(w, Simplify(src(), 8), "") },
+		"lods glb":  func(w io.Writer) error { return lods.writeLODs(w, src(), true, nil) },
+		"repair stl": func(w io.Writer) error {
+			fixed, _ := RepairForPrint(src())
+			if fixed.MetersPerUnit != 0.001 || !fixed.ZUp {
+				t.Errorf("repair dropped units/orientation: %v %v", fixed.MetersPerUnit, fixed.ZUp)
+			}
+			return WriteSTL(w, fixed, "fallback header")
+		},
+	} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		_, p, err := readProvenance(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil || p == nil || p.JobID != prov.JobID {
+			t.Errorf("%s: provenance %+v, %v", name, p, err)
+		}
+	}
+}
+
+func TestExportKeyTracksProvenanceSettings(t *testing.T) {
+	oldEmbed, oldPrompt, oldLicense := provenanceEmbed, provenancePrompt, provenanceLicense
+	defer func() { provenanceEmbed, provenancePrompt, provenanceLicense = oldEmbed, oldPrompt, oldLicense }()
+
+	keys := map[string]bool{}
+	for _, set := range []func(){
+		func() { provenanceEmbed, provenancePrompt, provenanceLicense = true, true, "" },
+		func() { provenancePrompt = false },
+		func() { provenanceLicense = "CC-BY-4.0" },
+		func() { provenanceEmbed = false },
+	} {
+		set()
+		k := exportKey("j1", 0, "glb", "glb")
+		if keys[k] {
+			t.Errorf("key %s reused after a provenance setting change", k)
+		}
+		keys[k] = true
+		if k != exportKey("j1", 0, "glb", "glb") {
+			t.Error("export key not stable")
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// refresh.go
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	tcerr "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+)
+
+/* =========================
+   过期地址刷新
+   ========================= */
+
+// 腾讯云的结果地址是带签名的临时 URL，过期后返回 403/404。
+// 此时重新调用 QueryHunyuanTo3DProJob 拿新地址重试；上游也已不再保留的 job 记为永久的 expired。
+var ErrArtifactExpired = errors.New("artifact expired: provider no longer retains this result")
+
+func isExpiredURLErr(err error) bool {
+	var bad *badStatusError
+	if !errors.As(err, &bad) {
+		return false
+	}
+	return bad.Code == http.StatusForbidden || bad.Code == http.StatusNotFound || bad.Code == http.StatusGone
+}
+
+// 上游查询本身表示 job 已不存在
+func isJobGoneErr(err error) bool {
+	var se *tcerr.TencentCloudSDKError
+	if errors.As(err, &se) {
+		code := se.GetCode()
+		return strings.HasPrefix(code, "ResourceNotFound") || strings.Contains(code, "NotExist") || strings.Contains(code, "NotFound")
+	}
+	return false
+}
+
+// refreshSource 重新查询上游，返回第 idx 个条目的新原始地址
+func refreshSource(ctx context.Context, jobID string, idx int, kind string) (string, error) {
+	if isUploadJob(jobID) {
+		// 上传的文件只有存储里这一份
+		return "", ErrArtifactExpired
+	}
+	res, err := queryHunyuan(jobID)
+	if err != nil {
+		if isJobGoneErr(err) {
+			return "", ErrArtifactExpired
+		}
+		return "", err
+	}
+	if res.Status != "DONE" || idx >= len(res.Files) {
+		return "", ErrArtifactExpired
+	}
+	recordQueryResult(ctx, jobID, res)
+
+	f := res.Files[idx]
+	src := f.Url
+	if kind == KindPreview {
+		src = f.PreviewImageUrl
+	}
+	if src == "" {
+		return "", ErrArtifactExpired
+	}
+	return src, nil
+}
+
+// downloadVerified 拉取并校验；损坏的文件已被隔离，返回 ErrCorruptArtifact
+func downloadVerified(ctx context.Context, jobID string, idx int, kind, key, src string) (*ArtifactInfo, error) {
+	info, err := downloadToStore(ctx, src, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifyArtifact(ctx, jobID, idx, kind, key, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// fetchArtifact 把 job 的一个产物拉进存储；遇到过期地址自动刷新后重试一次
+func fetchArtifact(ctx context.Context, jobID string, idx int, kind, key, src string) (*ArtifactInfo, error) {
+	if a, err := artifactRepo.Get(ctx, jobID, idx, kind); err == nil && a != nil && a.Status == "expired" {
+		// 已确认过期且本地没有副本，不再打上游
+		if info, err := store.Stat(ctx, key); err == nil {
+			return info, nil
+		}
+		return nil, ErrArtifactExpired
+	}
+
+	info, err := downloadVerified(ctx, jobID, idx, kind, key, src)
+	corrupt := errors.Is(err, ErrCorruptArtifact)
+	if err == nil || !(isExpiredURLErr(err) || corrupt) {
+		return info, err
+	}
+
+	// 地址过期，或拿到了损坏的内容（过期地址有时返回 200 的错误页）：刷新地址重拉一次
+	fresh, rerr := refreshSource(ctx, jobID, idx, kind)
+	if rerr == nil && (fresh != src || corrupt) {
+		info, err = downloadVerified(ctx, jobID, idx, kind, key, fresh)
+		if err == nil || !isExpiredURLErr(err) {
+			return info, err
+		}
+	} else if rerr != nil && !errors.Is(rerr, ErrArtifactExpired) {
+		// 上游暂时不可用，按普通失败处理，稍后可重试
+		return nil, rerr
+	}
+
+	_ = artifactRepo.Begin(ctx, jobID, idx, kind, key)
+	_ = artifactRepo.MarkExpired(ctx, jobID, idx, kind, err.Error())
+	return nil, ErrArtifactExpired
+}
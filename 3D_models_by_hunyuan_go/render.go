@@ -0,0 +1,270 @@
+// render.go
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   缩略图与转台预览
+   ========================= */
+
+// 上游预览图风格不一，有的任务没有预览图。服务端用 CPU 光栅化（mesh_render.go）统一出图：
+//
+// GET /api/jobs/:id/render[?index=N][&type=png|gif|sprite][&size=512][&yaw=30][&pitch=20][&fov=35]
+//     [&bg=ffffff|transparent][&light=0.9][&ambient=0.35][&light_yaw=-35][&light_pitch=45][&frames=24][&fps=12]
+//   png    单帧缩略图
+//   gif    转台动画，frames 帧绕 Y 轴一圈
+//   sprite 转台帧拼成的 PNG 精灵图（列数 ceil(sqrt(frames))，逐行排列），供前端拖拽旋转
+// 结果按参数缓存在 exports/ 下。没有纯 Go 的动画 WebP 编码器，转台只输出 GIF/精灵图。
+//
+// RENDER_PREVIEWS 开启时（默认），/api/jobs/:id/files/:idx/preview 对可解析的模型返回默认参数的渲染图，
+// 列表和卡片的预览风格一致；带 source=1 取上游原图。关闭时只在上游没有预览图时才渲染。
+
+const (
+	minRenderSize     = 64
+	maxRenderSize     = 2048
+	maxTurntableSize  = 512
+	minTurntableFrame = 4
+	maxTurntableFrame = 72
+)
+
+var renderPreviews = true
+
+func initRender() {
+	renderPreviews = parseBoolDefault(os.Getenv("RENDER_PREVIEWS"), true)
+}
+
+type RenderRequest struct {
+	Type   string // png|gif|sprite
+	Opts   RenderOptions
+	Frames int
+	FPS    int
+}
+
+func parseRenderRequest(q url.Values) (*RenderRequest, error) {
+	r := &RenderRequest{Type: strings.ToLower(q.Get("type")), Opts: defaultRenderOptions(), Frames: 24, FPS: 12}
+	if r.Type == "" {
+		r.Type = "png"
+	}
+	maxSize := maxRenderSize
+	switch r.Type {
+	case "png":
+	case "gif", "sprite":
+		maxSize = maxTurntableSize
+		r.Opts.Width, r.Opts.Height = 256, 256
+	default:
+		return nil, errors.New("invalid type, want png|gif|sprite")
+	}
+
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minRenderSize || n > maxSize {
+			return nil, fmt.Errorf("invalid size, want %d..%d for %s", minRenderSize, maxSize, r.Type)
+		}
+		r.Opts.Width, r.Opts.Height = n, n
+	}
+	floats := []struct {
+		name   string
+		dst    *float64
+		lo, hi float64
+	}{
+		{"yaw", &r.Opts.Yaw, -360, 360},
+		{"pitch", &r.Opts.Pitch, -89, 89},
+		{"fov", &r.Opts.FOV, 5, 120},
+		{"light", &r.Opts.Light, 0, 4},
+		{"ambient", &r.Opts.Ambient, 0, 2},
+		{"light_yaw", &r.Opts.LightYaw, -360, 360},
+		{"light_pitch", &r.Opts.LightPitch, -90, 90},
+	}
+	for _, p := range floats {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || f < p.lo || f > p.hi {
+			return nil, fmt.Errorf("invalid %s, want %g..%g", p.name, p.lo, p.hi)
+		}
+		*p.dst = f
+	}
+	if v := q.Get("bg"); v != "" {
+		bg, err := parseBackground(v)
+		if err != nil {
+			return nil, err
+		}
+		r.Opts.Background = bg
+	}
+	if v := q.Get("frames"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minTurntableFrame || n > maxTurntableFrame {
+			return nil, fmt.Errorf("invalid frames, want %d..%d", minTurntableFrame, maxTurntableFrame)
+		}
+		r.Frames = n
+	}
+	if v := q.Get("fps"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 50 {
+			return nil, errors.New("invalid fps, want 1..50")
+		}
+		r.FPS = n
+	}
+	return r, nil
+}
+
+// parseBackground 支持 transparent、RRGGBB、RRGGBBAA（可带 #）
+func parseBackground(v string) (color.NRGBA, error) {
+	if strings.EqualFold(v, "transparent") {
+		return color.NRGBA{}, nil
+	}
+	v = strings.TrimPrefix(v, "#")
+	b, err := hex.DecodeString(v)
+	if err != nil || len(b) != 3 && len(b) != 4 {
+		return color.NRGBA{}, errors.New("invalid bg, want transparent or RRGGBB[AA]")
+	}
+	c := color.NRGBA{b[0], b[1], b[2], 255}
+	if len(b) == 4 {
+		c.A = b[3]
+	}
+	return c, nil
+}
+
+func (r *RenderRequest) ext() string {
+	if r.Type == "gif" {
+		return "gif"
+	}
+	return "png"
+}
+
+// Variant 参数较多，缓存 key 用规范化参数的哈希，如 render-png-3f9a1c2b7d
+func (r *RenderRequest) Variant() string {
+	o := r.Opts
+	canon := fmt.Sprintf("%s|%dx%d|%g|%g|%g|%02x%02x%02x%02x|%g|%g|%g|%g", r.Type, o.Width, o.Height,
+		o.Yaw, o.Pitch, o.FOV, o.Background.R, o.Background.G, o.Background.B, o.Background.A,
+		o.Light, o.Ambient, o.LightYaw, o.LightPitch)
+	if r.Type != "png" {
+		canon += fmt.Sprintf("|%d|%d", r.Frames, r.FPS)
+	}
+	sum := sha256.Sum256([]byte(canon))
+	return "render-" + r.Type + "-" + hex.EncodeToString(sum[:5])
+}
+
+// Write 渲染并编码
+func (r *RenderRequest) Write(w io.Writer, s *Scene) error {
+	rd := newRenderer(s)
+	if r.Type == "png" {
+		return png.Encode(w, rd.Render(r.Opts))
+	}
+	start := time.Now()
+	frames := rd.Turntable(r.Opts, r.Frames)
+	log.Printf("render: %d turntable frames %dx%d in %v\n", r.Frames, r.Opts.Width, r.Opts.Height, time.Since(start))
+	if r.Type == "sprite" {
+		return png.Encode(w, SpriteSheet(frames))
+	}
+	return gif.EncodeAll(w, TurntableGIF(frames, max(1, (100+r.FPS/2)/r.FPS), r.Opts.Background.A < 128))
+}
+
+// renderable 源格式能否解析为 Scene
+func renderable(f ResultFile) bool {
+	switch strings.ToLower(f.Type) {
+	case "glb", "gltf", "obj", "zip", "stl":
+		return true
+	}
+	return false
+}
+
+// ensureRender 生成（或复用）渲染结果，返回存储 key 与 kind
+func ensureRender(ctx context.Context, jm *JobMeta, idx int, r *RenderRequest) (key, kind string, err error) {
+	variant := r.Variant()
+	key = exportKey(jm.JobID, idx, variant, r.ext())
+	kind = KindExport + ":" + variant
+	if _, err := store.Stat(ctx, key); err == nil {
+		return key, kind, nil
+	}
+	return key, kind, buildExport(ctx, jm, idx, kind, key, r.Write)
+}
+
+// renderModelPreviews 为可解析的模型生成默认缩略图（后处理流水线的一步）
+func renderModelPreviews(ctx context.Context, jobID string, files []ResultFile) {
+	if !renderPreviews {
+		return
+	}
+	jm := &JobMeta{JobID: jobID, Files: files}
+	def, _ := parseRenderRequest(url.Values{})
+	for i, f := range jm.Files {
+		if f.Key == "" || !renderable(f) {
+			continue
+		}
+		if _, _, err := ensureRender(ctx, jm, i, def); err != nil {
+			log.Printf("render preview %s/%d: %v\n", jm.JobID, i, err)
+		}
+	}
+}
+
+// servePreviewRender 用默认参数渲染第 idx 个模型作为预览图，成功返回 true
+func servePreviewRender(c *gin.Context, jm *JobMeta, idx int) bool {
+	if !renderable(jm.Files[idx]) {
+		return false
+	}
+	def, _ := parseRenderRequest(url.Values{})
+	key, kind, err := ensureRender(c.Request.Context(), jm, idx, def)
+	if err != nil {
+		log.Printf("render preview %s/%d: %v\n", jm.JobID, idx, err)
+		return false
+	}
+	c.Header("X-Preview-Source", "rendered")
+	serveArtifact(c, jm, idx, kind, key, "")
+	return true
+}
+
+func handleRender(c *gin.Context) {
+	jobID := c.Param("id")
+	ctx := c.Request.Context()
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if jm.Status != "DONE" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done"})
+		return
+	}
+	idx, err := modelSourceIndex(jm, c.Query("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	r, err := parseRenderRequest(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	key, kind, err := ensureRender(ctx, jm, idx, r)
+	if err != nil {
+		exportError(c, err)
+		return
+	}
+	serveArtifact(c, jm, idx, kind, key, "")
+}
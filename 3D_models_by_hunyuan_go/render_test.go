@@ -0,0 +1,184 @@
+// render_test.go
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestParseRenderRequest(t *testing.T) {
+	cases := []struct {
+		query   string
+		wantErr bool
+		check   func(r *RenderRequest) bool
+	}{
+		{"", false, func(r *RenderRequest) bool {
+			return r.Type == "png" && r.Opts == defaultRenderOptions() && r.ext() == "png"
+		}},
+		{"type=GIF", false, func(r *RenderRequest) bool {
+			return r.Type == "gif" && r.Opts.Width == 256 && r.Frames == 24 && r.FPS == 12 && r.ext() == "gif"
+		}},
+		{"type=sprite", false, func(r *RenderRequest) bool { return r.Opts.Width == 256 && r.ext() == "png" }},
+		{"type=webp", true, nil},
+		{"size=64", false, func(r *RenderRequest) bool { return r.Opts.Width == 64 && r.Opts.Height == 64 }},
+		{"size=2048", false, func(r *RenderRequest) bool { return r.Opts.Width == 2048 }},
+		{"size=63", true, nil},
+		{"size=2049", true, nil},
+		{"size=big", true, nil},
+		{"type=gif&size=512", false, func(r *RenderRequest) bool { return r.Opts.Width == 512 }},
+		{"type=gif&size=1024", true, nil},
+		{"type=sprite&size=513", true, nil},
+		{"yaw=-360&pitch=89&fov=5", false, func(r *RenderRequest) bool {
+			return r.Opts.Yaw == -360 && r.Opts.Pitch == 89 && r.Opts.FOV == 5
+		}},
+		{"yaw=361", true, nil},
+		{"pitch=-90", true, nil},
+		{"fov=121", true, nil},
+		{"light=4.5", true, nil},
+		{"ambient=-0.1", true, nil},
+		{"light_yaw=NaN", true, nil},
+		{"light_pitch=91", true, nil},
+		{"bg=transparent", false, func(r *RenderRequest) bool { return r.Opts.Background == color.NRGBA{} }},
+		{"bg=%23ff000080", false, func(r *RenderRequest) bool { return r.Opts.Background == color.NRGBA{255, 0, 0, 128} }},
+		{"bg=00ff00", false, func(r *RenderRequest) bool { return r.Opts.Background == color.NRGBA{0, 255, 0, 255} }},
+		{"bg=fff", true, nil},
+		{"bg=red", true, nil},
+		{"type=gif&frames=4&fps=50", false, func(r *RenderRequest) bool { return r.Frames == 4 && r.FPS == 50 }},
+		{"frames=3", true, nil},
+		{"frames=73", true, nil},
+		{"fps=0", true, nil},
+		{"fps=51", true, nil},
+	}
+	for _, tc := range cases {
+		q, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := parseRenderRequest(q)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tc.query, err, tc.wantErr)
+			continue
+		}
+		if err == nil && tc.check != nil && !tc.check(r) {
+			t.Errorf("%q: unexpected request %+v", tc.query, r)
+		}
+	}
+}
+
+func TestRenderVariant(t *testing.T) {
+	variant := func(query string) string {
+		t.Helper()
+		q, _ := url.ParseQuery(query)
+		r, err := parseRenderRequest(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Variant()
+	}
+
+	// 缓存 key 变了会让已有渲染全部失效，改动规范化格式时要同步更新这里
+	if got := variant(""); got != "render-png-bc1de07b7e" {
+		t.Fatalf("default variant = %s", got)
+	}
+	if got := variant(""); !regexp.MustCompile(`^render-png-[0-9a-f]{10}$`).MatchString(got) {
+		t.Fatalf("variant format = %s", got)
+	}
+	same := [][2]string{
+		{"", "type=png&size=512&yaw=30&pitch=20&fov=35&bg=ffffff&light=0.9&ambient=0.35&light_yaw=-35&light_pitch=45"},
+		{"yaw=10&bg=transparent", "bg=00000000&yaw=10.0"},
+		{"", "frames=8&fps=5"}, // png 不受帧参数影响
+		{"type=gif", "type=gif&size=256&frames=24&fps=12"},
+	}
+	for _, p := range same {
+		if a, b := variant(p[0]), variant(p[1]); a != b {
+			t.Errorf("%q = %s, %q = %s, want equal", p[0], a, p[1], b)
+		}
+	}
+	diff := [][2]string{
+		{"", "yaw=31"},
+		{"", "size=256"},
+		{"", "bg=fffffffe"},
+		{"", "light_pitch=44"},
+		{"type=gif", "type=sprite"},
+		{"type=gif", "type=gif&frames=25"},
+		{"type=gif", "type=gif&fps=13"},
+	}
+	for _, p := range diff {
+		if a, b := variant(p[0]), variant(p[1]); a == b {
+			t.Errorf("%q and %q share variant %s", p[0], p[1], a)
+		}
+	}
+}
+
+func TestRenderCube(t *testing.T) {
+	o := defaultRenderOptions()
+	o.Width, o.Height = 64, 64
+	img := newRenderer(cubeTestScene()).Render(o)
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 64 {
+		t.Fatalf("bounds = %v", b)
+	}
+	bg := o.Background
+	covered := 0
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if img.NRGBAAt(x, y) != bg {
+				covered++
+			}
+		}
+	}
+	// 立方体居中入画，应占画面相当一部分但不铺满
+	if covered < 64*64/8 || covered > 64*64*3/4 {
+		t.Fatalf("%d of %d pixels differ from background", covered, 64*64)
+	}
+	if img.NRGBAAt(0, 0) != bg || img.NRGBAAt(63, 63) != bg {
+		t.Fatalf("corners = %v %v, want background", img.NRGBAAt(0, 0), img.NRGBAAt(63, 63))
+	}
+	if c := img.NRGBAAt(32, 32); c == bg || c.A != 255 {
+		t.Fatalf("center = %v, want opaque shaded pixel", c)
+	}
+
+	// 透明背景：四角全透明，中心不透明
+	o.Background = color.NRGBA{}
+	img = newRenderer(cubeTestScene()).Render(o)
+	if img.NRGBAAt(0, 0).A != 0 || img.NRGBAAt(32, 32).A != 255 {
+		t.Fatalf("transparent render: corner %v, center %v", img.NRGBAAt(0, 0), img.NRGBAAt(32, 32))
+	}
+}
+
+func TestRenderRequestWrite(t *testing.T) {
+	for _, query := range []string{"size=64", "type=sprite&size=64&frames=4", "type=gif&size=64&frames=4&bg=transparent"} {
+		q, _ := url.ParseQuery(query)
+		r, err := parseRenderRequest(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Write(&buf, cubeTestScene()); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		switch r.Type {
+		case "gif":
+			g, err := gif.DecodeAll(&buf)
+			if err != nil || len(g.Image) != 4 || g.Config.Width != 64 {
+				t.Fatalf("%s: err = %v, decoded %+v", query, err, g)
+			}
+		default:
+			img, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			want := 64
+			if r.Type == "sprite" {
+				want = 128 // 4 帧排成 2x2
+			}
+			if b := img.Bounds(); b.Dx() != want || b.Dy() != want {
+				t.Fatalf("%s: bounds = %v, want %dx%d", query, b, want, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// serve.go
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   产物输出（Range / ETag / 条件请求）
+   ========================= */
+
+// 产物内容一旦落盘即不可变，ETag 取校验时算出的 SHA-256（强校验），记录在 artifacts 表中只算一次。
+// Range（单段/多段）、If-Range、If-Modified-Since 由 http.ServeContent 处理。
+var artifactCacheCtrl = "public, max-age=86400"
+
+func initServe() {
+	if v := strings.TrimSpace(os.Getenv("ARTIFACT_CACHE_CONTROL")); v != "" {
+		artifactCacheCtrl = v
+	}
+}
+
+// etagMatches 判断 If-None-Match 是否命中（弱比较，支持列表和 *）
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// artifactCacheControl 有主任务的产物只允许浏览器缓存：把 public 换成 private 并去掉 s-maxage，
+// 避免 CDN/代理把一个用户的模型缓存后发给别人
+func artifactCacheControl(jm *JobMeta) string {
+	if jm.Owner == "" {
+		return artifactCacheCtrl
+	}
+	out := []string{"private"}
+	for _, d := range strings.Split(artifactCacheCtrl, ",") {
+		d = strings.TrimSpace(d)
+		name := strings.ToLower(d)
+		if name == "" || name == "public" || name == "private" || strings.HasPrefix(name, "s-maxage") {
+			continue
+		}
+		out = append(out, d)
+	}
+	return strings.Join(out, ", ")
+}
+
+// serveArtifact 输出存储中的产物；filename 非空时作为附件下载
+func serveArtifact(c *gin.Context, jm *JobMeta, idx int, kind, key, filename string) {
+	ctx := c.Request.Context()
+	jobID := jm.JobID
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	etag, format := "", ""
+	if v, err := verifyArtifact(ctx, jobID, idx, kind, key, info); err == nil {
+		etag, format = `"`+v.SHA256+`"`, v.Format
+	} else if errors.Is(err, ErrCorruptArtifact) {
+		// 已隔离，下次请求会重新拉取
+		c.JSON(http.StatusBadGateway, gin.H{"ok": false, "error": "artifact_corrupt", "message": err.Error()})
+		return
+	} else {
+		log.Printf("verify %s: %v\n", key, err)
+	}
+
+	// 跳转到预签名地址前先处理 If-None-Match，缓存命中时不必再走一次存储
+	if inm := c.GetHeader("If-None-Match"); etag != "" && inm != "" && etagMatches(inm, etag) {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", artifactCacheControl(jm))
+		c.Header("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// 远端存储直接跳转到预签名地址，省去本服务转发流量；预签名地址会过期，跳转本身不可缓存
+	if artifactRedirect {
+		if u, err := store.PresignGet(ctx, key, presignTTL, filename); err == nil {
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, u)
+			return
+		}
+	}
+
+	_ = cacheRepo.Touch(ctx, jobID, idx, kind)
+
+	rc, info, err := store.Get(ctx, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	defer rc.Close()
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+	c.Header("Cache-Control", artifactCacheControl(jm))
+	if filename != "" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	if imageFormats[format] {
+		// 扩展名可能与实际图片格式不符（见 imageFormats）
+		c.Header("Content-Type", "image/"+format)
+	} else {
+		c.Header("Content-Type", info.ContentType)
+	}
+	http.ServeContent(c.Writer, c.Request, key, info.ModTime, rc)
+}
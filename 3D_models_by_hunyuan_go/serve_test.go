@@ -0,0 +1,24 @@
+// serve_test.go
+package main
+
+import "testing"
+
+func TestArtifactCacheControl(t *testing.T) {
+	old := artifactCacheCtrl
+	defer func() { artifactCacheCtrl = old }()
+
+	cases := []struct {
+		ctrl, owner, want string
+	}{
+		{"public, max-age=86400", "", "public, max-age=86400"},
+		{"public, max-age=86400", "alice", "private, max-age=86400"},
+		{"public, max-age=600, s-maxage=86400, immutable", "alice", "private, max-age=600, immutable"},
+		{"no-store", "alice", "private, no-store"},
+	}
+	for _, tc := range cases {
+		artifactCacheCtrl = tc.ctrl
+		if got := artifactCacheControl(&JobMeta{Owner: tc.owner}); got != tc.want {
+			t.Errorf("%q owner %q: got %q, want %q", tc.ctrl, tc.owner, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// stats.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   网格统计
+   ========================= */
+
+// 镜像完成后解析每个模型文件，记录顶点/三角形数、包围盒、材质与贴图信息，
+// 随 status 和 job 列表返回，并可在列表中按这些字段过滤。
+
+type TextureInfo struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int    `json:"bytes"`
+}
+
+type MeshStats struct {
+	Index      int           `json:"index"`
+	Format     string        `json:"format"`
+	FileSize   int64         `json:"file_size"`
+	Vertices   int64         `json:"vertices"`
+	Faces      int64         `json:"faces"` // 三角形数
+	Meshes     int           `json:"meshes"`
+	Materials  int           `json:"materials"`
+	Textures   int           `json:"textures"`
+	TextureSet []TextureInfo `json:"texture_info,omitempty"`
+	BBoxMin    [3]float32    `json:"bbox_min"`
+	BBoxMax    [3]float32    `json:"bbox_max"`
+	Dimensions [3]float32    `json:"dimensions"`
+	Error      string        `json:"error,omitempty"` // 无法解析时的原因
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+var statsRepo StatsRepo
+
+type StatsRepo interface {
+	Put(ctx context.Context, jobID string, st *MeshStats) error
+	ListByJob(ctx context.Context, jobID string) ([]*MeshStats, error)
+	// ListByJobs 批量读取，供列表接口使用
+	ListByJobs(ctx context.Context, jobIDs []string) (map[string][]*MeshStats, error)
+}
+
+type pgStatsRepo struct{ db *sql.DB }
+
+func NewPGStatsRepo(db *sql.DB) StatsRepo { return &pgStatsRepo{db: db} }
+
+func (r *pgStatsRepo) Put(ctx context.Context, jobID string, st *MeshStats) error {
+	detail, _ := json.Marshal(st)
+	maxTex := 0
+	for _, t := range st.TextureSet {
+		maxTex = max(maxTex, t.Width, t.Height)
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO mesh_stats (job_id, idx, format, file_size, vertices, faces, materials, textures, max_texture, error, detail, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10,''), $11::jsonb, now())
+		ON CONFLICT (job_id, idx) DO UPDATE
+		SET format = EXCLUDED.format, file_size = EXCLUDED.file_size, vertices = EXCLUDED.vertices,
+		    faces = EXCLUDED.faces, materials = EXCLUDED.materials, textures = EXCLUDED.textures,
+		    max_texture = EXCLUDED.max_texture, error = EXCLUDED.error, detail = EXCLUDED.detail, updated_at = now()
+	`, jobID, st.Index, st.Format, st.FileSize, st.Vertices, st.Faces, st.Materials, st.Textures, maxTex, st.Error, string(detail))
+	return err
+}
+
+func (r *pgStatsRepo) ListByJob(ctx context.Context, jobID string) ([]*MeshStats, error) {
+	m, err := r.ListByJobs(ctx, []string{jobID})
+	if err != nil {
+		return nil, err
+	}
+	return m[jobID], nil
+}
+
+func (r *pgStatsRepo) ListByJobs(ctx context.Context, jobIDs []string) (map[string][]*MeshStats, error) {
+	out := map[string][]*MeshStats{}
+	if len(jobIDs) == 0 {
+		return out, nil
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT job_id, detail, updated_at FROM mesh_stats WHERE job_id = ANY($1::text[]) ORDER BY job_id, idx
+	`, jobIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var detail []byte
+		st := &MeshStats{}
+		if err := rows.Scan(&id, &detail, &st.UpdatedAt); err != nil {
+			return nil, err
+		}
+		updated := st.UpdatedAt
+		_ = json.Unmarshal(detail, st)
+		st.UpdatedAt = updated
+		out[id] = append(out[id], st)
+	}
+	return out, rows.Err()
+}
+
+func createStatsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS mesh_stats (
+			job_id TEXT NOT NULL,
+			idx INT NOT NULL,
+			format TEXT,
+			file_size BIGINT,
+			vertices BIGINT,
+			faces BIGINT,
+			materials INT,
+			textures INT,
+			max_texture INT,
+			error TEXT,
+			detail JSONB,
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (job_id, idx)
+		);
+		CREATE INDEX IF NOT EXISTS mesh_stats_faces_idx ON mesh_stats (faces);
+	`)
+	return err
+}
+
+func initStats(db *sql.DB) {
+	if err := createStatsTable(db); err != nil {
+		log.Fatal("Error creating mesh_stats table:", err)
+	}
+	statsRepo = NewPGStatsRepo(db)
+}
+
+// sceneStats 从解析结果汇总统计
+func sceneStats(s *Scene) *MeshStats {
+	st := &MeshStats{
+		Vertices:  int64(s.VertexCount()),
+		Faces:     int64(s.TriangleCount()),
+		Meshes:    len(s.Meshes),
+		Materials: len(s.Materials),
+		Textures:  len(s.Images),
+	}
+	if st.Vertices > 0 {
+		st.BBoxMin, st.BBoxMax = s.Bounds()
+		st.Dimensions = sub3(st.BBoxMax, st.BBoxMin)
+	}
+	for _, im := range s.Images {
+		st.TextureSet = append(st.TextureSet, textureInfo(im))
+	}
+	return st
+}
+
+// textureInfo 只读图片头取尺寸；WebP 标准库不支持，按 RIFF 块手工解析
+func textureInfo(im Image) TextureInfo {
+	ti := TextureInfo{Name: im.Name, Format: strings.TrimPrefix(im.Ext(), "."), Bytes: len(im.Data)}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(im.Data)); err == nil {
+		ti.Width, ti.Height, ti.Format = cfg.Width, cfg.Height, format
+	} else if w, h, ok := webpSize(im.Data); ok {
+		ti.Width, ti.Height, ti.Format = w, h, "webp"
+	}
+	return ti
+}
+
+func webpSize(b []byte) (int, int, bool) {
+	if len(b) < 30 || string(b[:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	switch string(b[12:16]) {
+	case "VP8 ":
+		if b[23] == 0x9d && b[24] == 0x01 && b[25] == 0x2a {
+			return int(binary.LittleEndian.Uint16(b[26:]) & 0x3fff), int(binary.LittleEndian.Uint16(b[28:]) & 0x3fff), true
+		}
+	case "VP8L":
+		if b[20] == 0x2f {
+			v := binary.LittleEndian.Uint32(b[21:])
+			return int(v&0x3fff) + 1, int(v>>14&0x3fff) + 1, true
+		}
+	case "VP8X":
+		w := int(b[24]) | int(b[25])<<8 | int(b[26])<<16
+		h := int(b[27]) | int(b[28])<<8 | int(b[29])<<16
+		return w + 1, h + 1, true
+	}
+	return 0, 0, false
+}
+
+// collectStats 解析 job 的第 idx 个模型；文件本身无法解析时返回带 Error 的记录，避免反复重试，
+// 拉取失败等临时错误直接返回 error，下次再算
+func collectStats(ctx context.Context, jobID string, idx int, f ResultFile) (*MeshStats, error) {
+	exportSem <- struct{}{}
+	defer func() { <-exportSem }()
+
+	st := &MeshStats{}
+	s, err := loadScene(ctx, jobID, idx, f)
+	switch {
+	case err == nil:
+		st = sceneStats(s)
+	case errors.Is(err, ErrUnsupportedSource):
+		st.Error = err.Error()
+	default:
+		return nil, err
+	}
+	st.Index = idx
+	if a, err := artifactRepo.Get(ctx, jobID, idx, KindModel); err == nil && a != nil {
+		st.Format, st.FileSize = a.Format, a.Size
+	}
+	return st, nil
+}
+
+// recordMeshStats 为已入库、尚无统计（或文件大小已变化）的模型补算统计（后处理流水线的一步）
+func recordMeshStats(ctx context.Context, jobID string, files []ResultFile) {
+	if statsRepo == nil {
+		return
+	}
+	have := map[int]int64{}
+	if list, err := statsRepo.ListByJob(ctx, jobID); err == nil {
+		for _, st := range list {
+			have[st.Index] = st.FileSize
+		}
+	}
+	for i, f := range files {
+		if f.Key == "" {
+			continue
+		}
+		info, err := store.Stat(ctx, f.Key)
+		if err != nil {
+			continue
+		}
+		if size, ok := have[i]; ok && size == info.Size {
+			continue
+		}
+		st, err := collectStats(ctx, jobID, i, f)
+		if err != nil {
+			log.Printf("mesh stats %s/%d: %v\n", jobID, i, err)
+			continue
+		}
+		if err := statsRepo.Put(ctx, jobID, st); err != nil {
+			log.Printf("mesh stats %s/%d: %v\n", jobID, i, err)
+		}
+	}
+}
+
+/* =========================
+   HTTP Handlers
+   ========================= */
+
+// GET /api/jobs?status=DONE&min_faces=1000&max_faces=50000&has_textures=true&format=glb&limit=50
+// 列出当前用户的 job，带每个文件的网格统计
+func handleListJobs(c *gin.Context) {
+	f := JobFilter{Owner: currentUser(c), Format: strings.ToLower(c.Query("format"))}
+	if s := c.Query("status"); s != "" {
+		f.Statuses = strings.Split(strings.ToUpper(s), ",")
+	}
+	for q, dst := range map[string]*int64{
+		"min_faces": &f.MinFaces, "max_faces": &f.MaxFaces,
+		"min_vertices": &f.MinVertices, "max_vertices": &f.MaxVertices,
+	} {
+		if v := c.Query(q); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "invalid " + q})
+				return
+			}
+			*dst = n
+		}
+	}
+	if v := c.Query("has_textures"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "invalid has_textures"})
+			return
+		}
+		f.HasTextures = &b
+	}
+	f.Limit, _ = strconv.Atoi(c.Query("limit"))
+
+	ctx := c.Request.Context()
+	jobs, err := repo.List(ctx, f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	ids := make([]string, len(jobs))
+	for i := range jobs {
+		ids[i] = jobs[i].JobID
+	}
+	if stats, err := statsRepo.ListByJobs(ctx, ids); err == nil {
+		for i := range jobs {
+			jobs[i].Stats = stats[jobs[i].JobID]
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "jobs": jobs})
+}
@@ -0,0 +1,403 @@
+// store.go
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+/* =========================
+   Artifact Store
+   ========================= */
+
+// 生成结果的持久化存储：本地磁盘（默认）或 S3 兼容存储（七牛云 Kodo / MinIO 等）。
+// 环境变量 ARTIFACT_STORE=local|s3
+var store ArtifactStore
+
+var (
+	ErrArtifactNotFound   = errors.New("artifact not found")
+	ErrPresignUnsupported = errors.New("presigned url not supported by this store")
+)
+
+type ArtifactInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ETag        string    `json:"etag,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+type ArtifactStore interface {
+	// Put 写入对象；size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*ArtifactInfo, error)
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, *ArtifactInfo, error)
+	Stat(ctx context.Context, key string) (*ArtifactInfo, error)
+	Delete(ctx context.Context, key string) error
+	// PresignGet 生成限时下载地址；filename 非空时带 Content-Disposition
+	PresignGet(ctx context.Context, key string, ttl time.Duration, filename string) (string, error)
+}
+
+var modelMimeTypes = map[string]string{
+	".glb":  "model/gltf-binary",
+	".gltf": "model/gltf+json",
+	".obj":  "model/obj",
+	".mtl":  "model/mtl",
+	".stl":  "model/stl",
+	".ply":  "application/x-ply",
+	".fbx":  "application/octet-stream",
+	".usdz": "model/vnd.usdz+zip",
+	".zip":  "application/zip",
+}
+
+func contentTypeFor(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if ct, ok := modelMimeTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+/* =========================
+   本地磁盘
+   ========================= */
+
+type LocalStore struct{ root string }
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Path 返回 key 对应的本地路径（已防目录穿越）
+func (s *LocalStore) Path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s *LocalStore) info(key string, fi os.FileInfo) *ArtifactInfo {
+	return &ArtifactInfo{Key: key, Size: fi.Size(), ContentType: contentTypeFor(key), ModTime: fi.ModTime()}
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*ArtifactInfo, error) {
+	p := s.Path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+	tmp := p + ".tmp-" + hex.EncodeToString(suffix)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("short write: got=%d, want=%d", n, size)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	return s.Stat(ctx, key)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, *ArtifactInfo, error) {
+	f, err := os.Open(s.Path(key))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, s.info(key, fi), nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*ArtifactInfo, error) {
+	fi, err := os.Stat(s.Path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.info(key, fi), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.Path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) PresignGet(ctx context.Context, key string, ttl time.Duration, filename string) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+/* =========================
+   S3 兼容（七牛云 Kodo / MinIO）
+   ========================= */
+
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+type S3Config struct {
+	Endpoint  string // 如 s3.cn-east-1.qiniucs.com / 127.0.0.1:9000
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	Prefix    string
+	UseSSL    bool
+}
+
+func NewS3Store(ctx context.Context, cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required")
+	}
+	cli, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ok, err := cli.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// 本地 MinIO 调试时自动建桶；Kodo 的桶需预先在控制台创建
+		if err := cli.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, err
+		}
+	}
+	return &S3Store{client: cli, bucket: cfg.Bucket, prefix: strings.Trim(cfg.Prefix, "/")}, nil
+}
+
+func (s *S3Store) objectKey(key string) string {
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func isS3NotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*ArtifactInfo, error) {
+	if contentType == "" {
+		contentType = contentTypeFor(key)
+	}
+	up, err := s.client.PutObject(ctx, s.bucket, s.objectKey(key), r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return nil, err
+	}
+	return &ArtifactInfo{Key: key, Size: up.Size, ETag: up.ETag, ContentType: contentType, ModTime: time.Now()}, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadSeekCloser, *ArtifactInfo, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.objectKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if isS3NotFound(err) {
+			return nil, nil, ErrArtifactNotFound
+		}
+		return nil, nil, err
+	}
+	return obj, &ArtifactInfo{Key: key, Size: st.Size, ETag: st.ETag, ContentType: st.ContentType, ModTime: st.LastModified}, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*ArtifactInfo, error) {
+	st, err := s.client.StatObject(ctx, s.bucket, s.objectKey(key), minio.StatObjectOptions{})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrArtifactNotFound
+		}
+		return nil, err
+	}
+	return &ArtifactInfo{Key: key, Size: st.Size, ETag: st.ETag, ContentType: st.ContentType, ModTime: st.LastModified}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.objectKey(key), minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, key string, ttl time.Duration, filename string) (string, error) {
+	params := url.Values{}
+	if filename != "" {
+		params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, s.objectKey(key), ttl, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+/* =========================
+   初始化 / 拉取
+   ========================= */
+
+var (
+	presignTTL       = 15 * time.Minute
+	artifactRedirect = true // 支持预签名时，下载接口 302 到存储地址而非由本服务转发
+)
+
+func initArtifactStore() {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("ARTIFACT_STORE")))
+	artifactRedirect = parseBoolDefault(os.Getenv("ARTIFACT_REDIRECT"), true)
+	if v := strings.TrimSpace(os.Getenv("ARTIFACT_PRESIGN_TTL")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			presignTTL = d
+		}
+	}
+
+	switch kind {
+	case "s3", "kodo", "qiniu", "minio":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s, err := NewS3Store(ctx, S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			Prefix:    os.Getenv("S3_PREFIX"),
+			UseSSL:    parseBoolDefault(os.Getenv("S3_USE_SSL"), true),
+		})
+		if err != nil {
+			log.Fatal("Error initializing S3 artifact store:", err)
+		}
+		store = s
+	default:
+		s, err := NewLocalStore(downloadDir)
+		if err != nil {
+			log.Fatal("Error initializing local artifact store:", err)
+		}
+		store = s
+	}
+}
+
+// artifactKey 与旧版 downloads 目录下的文件名保持一致，已有缓存可直接复用
+func artifactKey(jobID string, idx int, ext string) string {
+	return fmt.Sprintf("%s_%d.%s", jobID, idx, ext)
+}
+
+// fetchToStore 实际执行拉取：本地存储走可续传的 downloadToFile（持有跨进程文件锁），远端存储边下边传。
+// 调用方应通过 downloadToStore 进入，以合并并发请求。
+func fetchToStore(ctx context.Context, srcURL, key string, st *fetchState) (*ArtifactInfo, error) {
+	if ls, ok := store.(*LocalStore); ok {
+		p := ls.Path(key)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, err
+		}
+		unlock, err := lockFile(ctx, p+".lock")
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		// 拿到锁时可能已被其它进程下载完成
+		if info, err := store.Stat(ctx, key); err == nil {
+			return info, nil
+		}
+		if err := downloadToFile(srcURL, p, st); err != nil {
+			return nil, err
+		}
+		return store.Stat(ctx, key)
+	}
+
+	const maxRetries = 4
+	backoff := 400 * time.Millisecond
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		info, err := streamURLToStore(ctx, srcURL, key, st)
+		if err == nil {
+			return info, nil
+		}
+		lastErr = err
+		var bad *badStatusError
+		if errors.As(err, &bad) || ctx.Err() != nil {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return nil, lastErr
+}
+
+type badStatusError struct {
+	Code   int
+	Status string
+	Body   string
+}
+
+func (e *badStatusError) Error() string {
+	return fmt.Sprintf("bad status: %s, body: %s", e.Status, e.Body)
+}
+
+func streamURLToStore(ctx context.Context, srcURL, key string, st *fetchState) (*ArtifactInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srcURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &badStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	st.reset(resp.ContentLength)
+	return store.Put(ctx, key, &progressReader{r: resp.Body, st: st}, resp.ContentLength, contentTypeFor(key))
+}
@@ -0,0 +1,363 @@
+// store_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s, err := NewLocalStore(filepath.Join(root, "artifacts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("glTF fake model bytes")
+	key := "jobs/j1/0.glb"
+
+	info, err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != key || info.Size != int64(len(data)) || info.ContentType != "model/gltf-binary" {
+		t.Errorf("Put info = %+v", info)
+	}
+
+	rc, got, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(b, data) || got.Size != int64(len(data)) {
+		t.Errorf("Get = %q (%+v), want %q", b, got, data)
+	}
+	if st, err := s.Stat(ctx, key); err != nil || st.Size != int64(len(data)) {
+		t.Errorf("Stat = %+v, %v", st, err)
+	}
+
+	// 覆盖写
+	if _, err := s.Put(ctx, key, strings.NewReader("v2"), -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := s.Stat(ctx, key); st == nil || st.Size != 2 {
+		t.Errorf("overwrite: Stat = %+v", st)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get(ctx, key); !errors.Is(err, ErrArtifactNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrArtifactNotFound", err)
+	}
+	if _, err := s.Stat(ctx, key); !errors.Is(err, ErrArtifactNotFound) {
+		t.Errorf("Stat after Delete: %v, want ErrArtifactNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete missing key: %v", err)
+	}
+	if _, err := s.PresignGet(ctx, key, 0, ""); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("PresignGet: %v", err)
+	}
+}
+
+func TestLocalStoreShortWrite(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(context.Background(), "jobs/j1/0.glb", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Fatal("short write accepted")
+	}
+	// 临时文件清理掉，目标文件不存在
+	entries, _ := os.ReadDir(filepath.Dir(s.Path("jobs/j1/0.glb")))
+	if len(entries) != 0 {
+		t.Errorf("left behind %d files", len(entries))
+	}
+}
+
+func TestLocalStorePathTraversal(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"../../etc/passwd", "/etc/passwd", "jobs/../../x"} {
+		if p := s.Path(key); !strings.HasPrefix(p, root+string(filepath.Separator)) {
+			t.Errorf("Path(%q) = %s escapes %s", key, p, root)
+		}
+	}
+}
+
+/* ---------- 内存 S3 替身 ---------- */
+
+// testS3Server 只实现 S3Store 用到的 path-style 请求：建桶、PUT/GET/HEAD/DELETE 对象，不校验签名
+type testS3Server struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string]testS3Object // "bucket/key"
+}
+
+type testS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func newTestS3Server(t *testing.T) (*testS3Server, *httptest.Server) {
+	s := &testS3Server{buckets: map[string]bool{}, objects: map[string]testS3Object{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *testS3Server) object(key string) (testS3Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	return o, ok
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !s.buckets[bucket] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			s.buckets[bucket] = true
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+	if !s.buckets[bucket] {
+		testS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	id := bucket + "/" + key
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := testS3Body(r)
+		if err != nil {
+			testS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[id] = testS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		w.Header().Set("ETag", testS3ETag(data))
+	case http.MethodGet, http.MethodHead:
+		o, ok := s.objects[id]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				testS3Error(w, http.StatusNotFound, "NoSuchKey")
+			}
+			return
+		}
+		h := w.Header()
+		h.Set("ETag", testS3ETag(o.data))
+		h.Set("Content-Type", o.contentType)
+		h.Set("Last-Modified", o.modTime.Format(http.TimeFormat))
+		h.Set("Accept-Ranges", "bytes")
+		// ServeContent 处理 Range，读回时 minio-go 可能按区间重新请求
+		http.ServeContent(w, r, "", o.modTime, bytes.NewReader(o.data))
+	case http.MethodDelete:
+		delete(s.objects, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func testS3ETag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(data))
+}
+
+func testS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// testS3Body 读取请求体；非 TLS 下 minio-go 用 aws-chunked 分块签名上传，需要拆掉分块头和尾部校验
+func testS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	br := bufio.NewReader(r.Body)
+	var out []byte
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		chunk := make([]byte, n+2) // 数据后跟 \r\n
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk[:n]...)
+	}
+	if want := r.Header.Get("X-Amz-Decoded-Content-Length"); want != "" && want != strconv.Itoa(len(out)) {
+		return nil, fmt.Errorf("decoded %d bytes, header says %s", len(out), want)
+	}
+	return out, nil
+}
+
+/* ---------- S3Store ---------- */
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	stub, srv := newTestS3Server(t)
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+
+	s, err := NewS3Store(ctx, S3Config{
+		Endpoint: endpoint, AccessKey: "test", SecretKey: "testsecret",
+		Bucket: "models", Region: "us-east-1", Prefix: "/artifacts/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 桶不存在时自动创建
+	if !stub.buckets["models"] {
+		t.Fatal("bucket not created")
+	}
+
+	data := []byte("glTF fake model bytes")
+	key := "jobs/j1/0.glb"
+	info, err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != key || info.Size != int64(len(data)) || info.ContentType != "model/gltf-binary" || info.ETag == "" {
+		t.Errorf("Put info = %+v", info)
+	}
+	// 对象按前缀存放，key 里的 .. 不会越出前缀
+	o, ok := stub.object("models/artifacts/jobs/j1/0.glb")
+	if !ok || !bytes.Equal(o.data, data) || o.contentType != "model/gltf-binary" {
+		t.Fatalf("stored object = %+v, %v", o, ok)
+	}
+	if got := s.objectKey("../../x/../jobs/j1/0.glb"); got != "artifacts/jobs/j1/0.glb" {
+		t.Errorf("objectKey = %s", got)
+	}
+
+	rc, got, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(b, data) || got.Size != int64(len(data)) || got.ContentType != "model/gltf-binary" {
+		t.Errorf("Get = %q (%+v), %v; want %q", b, got, err, data)
+	}
+
+	// Get 返回的对象可以 Seek，断点续传和 Range 下载依赖这一点
+	rc, _, err = s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(b, data[5:]) {
+		t.Errorf("read after Seek = %q, want %q", b, data[5:])
+	}
+
+	st, err := s.Stat(ctx, key)
+	if err != nil || st.Size != int64(len(data)) || st.Key != key || st.ModTime.IsZero() {
+		t.Errorf("Stat = %+v, %v", st, err)
+	}
+
+	// 覆盖写，显式 Content-Type
+	if _, err := s.Put(ctx, key, strings.NewReader("v2"), 2, "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := s.Stat(ctx, key); err != nil || st.Size != 2 || st.ContentType != "application/octet-stream" {
+		t.Errorf("overwrite: Stat = %+v, %v", st, err)
+	}
+
+	u, err := s.PresignGet(ctx, key, time.Minute, "model 1.glb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := pu.Query()
+	if pu.Host != endpoint || pu.Path != "/models/artifacts/jobs/j1/0.glb" || q.Get("X-Amz-Signature") == "" ||
+		q.Get("X-Amz-Expires") != "60" || q.Get("response-content-disposition") != `attachment; filename="model 1.glb"` {
+		t.Errorf("presigned URL = %s", u)
+	}
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != "v2" {
+		t.Errorf("GET presigned = %d %q", resp.StatusCode, b)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stub.object("models/artifacts/jobs/j1/0.glb"); ok {
+		t.Fatal("object still stored after Delete")
+	}
+	if _, _, err := s.Get(ctx, key); !errors.Is(err, ErrArtifactNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrArtifactNotFound", err)
+	}
+	if _, err := s.Stat(ctx, key); !errors.Is(err, ErrArtifactNotFound) {
+		t.Errorf("Stat after Delete: %v, want ErrArtifactNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete missing key: %v", err)
+	}
+}
+
+func TestNewS3StoreConfig(t *testing.T) {
+	if _, err := NewS3Store(context.Background(), S3Config{Endpoint: "127.0.0.1:9000"}); err == nil {
+		t.Fatal("missing bucket accepted")
+	}
+	// 桶已存在时不再创建
+	stub, srv := newTestS3Server(t)
+	stub.buckets["models"] = true
+	if _, err := NewS3Store(context.Background(), S3Config{
+		Endpoint: strings.TrimPrefix(srv.URL, "http://"), Bucket: "models", Region: "us-east-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
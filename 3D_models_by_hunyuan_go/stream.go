@@ -0,0 +1,191 @@
+// stream.go
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   流式代理下载
+   ========================= */
+
+// 首次下载时不必等整个文件落进存储：上游响应同时写给客户端和 artifact 存储。
+// 客户端中途断开不影响入库；上游中途失败时断开客户端连接，存储中不留残缺文件。
+var streamEnabled = true
+
+func initStream() {
+	streamEnabled = parseBoolDefault(os.Getenv("ARTIFACT_STREAM"), true)
+}
+
+// streamSink 把入库的数据旁路给正在等待的客户端；客户端离开后静默丢弃。
+// 最后一个字节压到校验通过后才发出，损坏的文件不会被客户端当作完整响应。
+type streamSink struct {
+	ready chan int64 // 上游响应头到达，值为 Content-Length（未知为 -1）
+	pw    *io.PipeWriter
+	dead  atomic.Bool
+	held  []byte
+}
+
+func (s *streamSink) send(p []byte) {
+	if s.dead.Load() || len(p) == 0 {
+		return
+	}
+	if _, err := s.pw.Write(p); err != nil {
+		s.dead.Store(true)
+	}
+}
+
+func (s *streamSink) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	s.send(s.held)
+	s.send(p[:len(p)-1])
+	s.held = append(s.held[:0], p[len(p)-1])
+	return len(p), nil
+}
+
+// finish 结束输出：err 为空时补发压住的字节，否则让客户端收到错误
+func (s *streamSink) finish(err error) {
+	if err == nil {
+		s.send(s.held)
+	}
+	s.pw.CloseWithError(err)
+}
+
+// streamFetch 与 fetchToStore 相同地入库，但边下边转给 sink
+func streamFetch(ctx context.Context, srcURL, key string, st *fetchState, sink *streamSink) (*ArtifactInfo, error) {
+	if ls, ok := store.(*LocalStore); ok {
+		p := ls.Path(key)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, err
+		}
+		unlock, err := lockFile(ctx, p+".lock")
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		if info, err := store.Stat(ctx, key); err == nil {
+			return info, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srcURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &badStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+
+	st.reset(resp.ContentLength)
+	sink.ready <- resp.ContentLength
+	body := io.TeeReader(&progressReader{r: resp.Body, st: st}, sink)
+	return store.Put(ctx, key, body, resp.ContentLength, contentTypeFor(key))
+}
+
+const ctxAbortConn = "abort_conn"
+
+// abortConn 直接断开连接，让客户端知道响应不完整（分块编码下正常结束会被当成完整文件）。
+// 响应体写出后 gin 不允许 Hijack，HTTP/2 连接也不能 Hijack，统一交给 net/http：
+// panic(http.ErrAbortHandler) 时它关闭 HTTP/1 连接或重置 HTTP/2 流。gin.Recovery 会吞掉这个 panic，
+// 所以由 withAbort 在 Recovery 内侧接住，等日志记完后再在最外层重新抛出
+func abortConn(c *gin.Context) {
+	c.Set(ctxAbortConn, true)
+	panic(http.ErrAbortHandler)
+}
+
+// withAbort 把 mw（通常是 gin.Logger、gin.Recovery）夹在两层之间：
+// 内层接住 abortConn 的 panic，不让 Recovery 打印堆栈、尝试写 500；外层在日志记完之后重新抛给 net/http
+func withAbort(mw ...gin.HandlerFunc) []gin.HandlerFunc {
+	outer := func(c *gin.Context) {
+		c.Next()
+		if c.GetBool(ctxAbortConn) {
+			panic(http.ErrAbortHandler)
+		}
+	}
+	inner := func(c *gin.Context) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec != http.ErrAbortHandler || !c.GetBool(ctxAbortConn) {
+					panic(rec)
+				}
+				c.Abort()
+			}
+		}()
+		c.Next()
+	}
+	return append(append([]gin.HandlerFunc{outer}, mw...), inner)
+}
+
+// streamDownload 尝试以流式方式响应首次下载；返回 false 表示未处理，调用方按原流程
+// （等待入库后输出）继续。同一文件已有下载在进行时只等待其结果，不重复拉取上游。
+func streamDownload(c *gin.Context, jobID string, idx int, key, src, filename string) bool {
+	if !parseBoolDefault(c.Query("stream"), streamEnabled) ||
+		c.Request.Method != http.MethodGet || c.GetHeader("Range") != "" || src == "" {
+		return false
+	}
+	ctx := c.Request.Context()
+	if _, err := store.Stat(ctx, key); err == nil {
+		return false
+	}
+	if a, err := artifactRepo.Get(ctx, jobID, idx, KindModel); err == nil && a != nil && a.Status == "expired" {
+		return false
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	sink := &streamSink{ready: make(chan int64, 1), pw: pw}
+
+	st := joinFetch(key)
+	defer st.waiters.Add(-1)
+	ch := fetchGroup.DoChan(key, func() (any, error) {
+		defer endFetch(key, st)
+		bg := context.WithoutCancel(ctx)
+		info, err := streamFetch(bg, src, key, st, sink)
+		if err == nil {
+			_, err = verifyArtifact(bg, jobID, idx, KindModel, key, info)
+		}
+		sink.finish(err)
+		return info, err
+	})
+
+	var size int64
+	select {
+	case <-ctx.Done():
+		return true
+	case <-ch:
+		// 加入了别人的下载，或上游在响应头之前就失败（过期地址等），交给原流程处理
+		return false
+	case size = <-sink.ready:
+	}
+
+	c.Header("Content-Type", contentTypeFor(key))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+	}
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	if _, err := io.Copy(c.Writer, pr); err != nil {
+		abortConn(c)
+	}
+	return true
+}
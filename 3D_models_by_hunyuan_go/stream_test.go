@@ -0,0 +1,66 @@
+// stream_test.go
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应体写出一部分后中断：HTTP/1.1 和 HTTP/2 下客户端都必须读到错误，而不是一个“完整”的短文件
+func TestAbortConnAfterBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs, recovered bytes.Buffer
+	r := gin.New()
+	r.Use(withAbort(gin.LoggerWithWriter(&logs), gin.RecoveryWithWriter(&recovered))...)
+	r.GET("/dl", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.Write([]byte("partial model bytes"))
+		c.Writer.Flush()
+		abortConn(c)
+	})
+	r.GET("/boom", func(c *gin.Context) { panic("bug") })
+
+	for _, h2 := range []bool{false, true} {
+		srv := httptest.NewUnstartedServer(r)
+		srv.EnableHTTP2 = h2
+		srv.StartTLS()
+
+		resp, err := srv.Client().Get(srv.URL + "/dl")
+		if err != nil {
+			t.Fatalf("h2=%v: %v", h2, err)
+		}
+		if h2 != (resp.ProtoMajor == 2) {
+			t.Fatalf("h2=%v: got %s", h2, resp.Proto)
+		}
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			t.Errorf("%s: aborted response read without error", resp.Proto)
+		}
+
+		// 其余 panic 仍由 gin.Recovery 转成 500
+		resp, err = srv.Client().Get(srv.URL + "/boom")
+		if err != nil {
+			t.Fatalf("h2=%v: %v", h2, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s: panic status %d, want 500", resp.Proto, resp.StatusCode)
+		}
+		srv.Close()
+	}
+
+	// 主动中断不算 panic：访问日志照常记录，Recovery 不打印堆栈
+	if n := strings.Count(logs.String(), "/dl"); n != 2 {
+		t.Errorf("access log has %d /dl lines, want 2:\n%s", n, logs.String())
+	}
+	if strings.Contains(recovered.String(), "/dl") || strings.Count(recovered.String(), "panic recovered") != 2 {
+		t.Errorf("recovery output:\n%s", recovered.String())
+	}
+}
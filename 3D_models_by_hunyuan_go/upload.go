@@ -0,0 +1,307 @@
+// upload.go
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   上传自有模型
+   ========================= */
+
+// 前端 Upload3D 视图上传的模型按一个已完成的 job 入库，历史记录、预览、导出等接口与生成的模型一致：
+//
+// POST /api/models/upload  multipart/form-data
+//   file         模型文件：glb | gltf（内嵌资源）| obj | zip（OBJ+MTL+贴图打包）| stl | fbx
+//   files        可重复，OBJ 的 MTL 和贴图，与 OBJ 一起打包成 zip 存储
+//   name         显示名称，默认取文件名
+//   description  描述
+//
+// 文件先按扩展名和文件头校验结构，再完整解析一遍并算出网格统计（FBX 只入库，不解析）。
+// job id 以 upload- 开头，状态查询、过期刷新直接读库，不访问上游；原始文件不参与缓存淘汰。
+
+const (
+	uploadJobPrefix      = "upload-"
+	uploadProvider       = "user upload"
+	maxUploadNameLen     = 200
+	maxUploadDescription = 2000
+)
+
+var (
+	uploadMaxBytes int64 = 50 << 20
+
+	// 主文件允许的扩展名
+	uploadFormats = map[string]bool{"glb": true, "gltf": true, "obj": true, "zip": true, "stl": true, "fbx": true}
+	// 随 OBJ 一起上传的附属文件
+	uploadExtraExts = map[string]bool{".mtl": true, ".png": true, ".jpg": true, ".jpeg": true, ".webp": true}
+)
+
+func initUpload() {
+	if n := parseBytes(os.Getenv("UPLOAD_MAX_BYTES")); n > 0 {
+		uploadMaxBytes = n
+	}
+}
+
+func isUploadJob(jobID string) bool {
+	return strings.HasPrefix(jobID, uploadJobPrefix)
+}
+
+func newUploadJobID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return uploadJobPrefix + hex.EncodeToString(b)
+}
+
+// limitUploadBody 放在 idempotent 之前，解析表单计算指纹时同样受上限约束；
+// multipart 头和表单字段留 1MiB 余量，文件本身的上限在 handler 里按文件大小判断
+func limitUploadBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := uploadMaxBytes + 1<<20
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"ok": false, "error": fmt.Sprintf("upload exceeds %d bytes", uploadMaxBytes)})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// stageUpload 把上传内容写进临时文件：OBJ 带附属文件时打包成 zip，否则原样复制
+func stageUpload(model *multipart.FileHeader, extras []*multipart.FileHeader) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	copyPart := func(w io.Writer, fh *multipart.FileHeader) error {
+		f, err := fh.Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+
+	if len(extras) == 0 {
+		err = copyPart(tmp, model)
+	} else {
+		zw := zip.NewWriter(tmp)
+		for _, fh := range append([]*multipart.FileHeader{model}, extras...) {
+			var w io.Writer
+			if w, err = zw.Create(path.Base(fh.Filename)); err != nil {
+				break
+			}
+			if err = copyPart(w, fh); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// inspectUpload 校验结构并解析网格；返回实际格式、摘要和统计。错误均为文件本身的问题
+func inspectUpload(f *os.File, size int64, ext string) (string, string, *MeshStats, error) {
+	format, err := validateFormat(f, size, ext)
+	if err != nil {
+		return "", "", nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		return "", "", nil, err
+	}
+	sha := hex.EncodeToString(h.Sum(nil))
+
+	st := &MeshStats{}
+	switch format {
+	case "fbx":
+		// FBX 只入库，导出和渲染不支持以它为源
+		st.Error = fmt.Errorf("%w: format %s", ErrUnsupportedSource, format).Error()
+	case "glb", "gltf", "obj", "zip", "stl":
+		data, err := io.ReadAll(io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return "", "", nil, err
+		}
+		s, err := parseUploadScene(data, format)
+		if err != nil {
+			if format == "gltf" {
+				return "", "", nil, fmt.Errorf("cannot parse model (external buffers and images are not supported, upload a GLB instead): %v", err)
+			}
+			return "", "", nil, fmt.Errorf("cannot parse model: %v", err)
+		}
+		if s.TriangleCount() == 0 {
+			return "", "", nil, errors.New("model has no triangles")
+		}
+		st = sceneStats(s)
+	default:
+		return "", "", nil, fmt.Errorf("unsupported model format %s", format)
+	}
+	st.Format, st.FileSize = format, size
+	return format, sha, st, nil
+}
+
+// parseUploadScene 占用一个转换槽位解析模型；用 defer 归还，解析中途 panic 也不会漏还槽位
+func parseUploadScene(data []byte, format string) (*Scene, error) {
+	exportSem <- struct{}{}
+	defer func() { <-exportSem }()
+	return ParseModel(data, format)
+}
+
+func handleUploadModel(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"ok": false, "error": fmt.Sprintf("upload exceeds %d bytes", uploadMaxBytes)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "invalid multipart form"})
+		return
+	}
+	if len(form.File["file"]) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "exactly one file is required"})
+		return
+	}
+	model, extras := form.File["file"][0], form.File["files"]
+
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(model.Filename)), ".")
+	if !uploadFormats[ext] {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "unsupported file type, want one of glb|gltf|obj|zip|stl|fbx"})
+		return
+	}
+	if len(extras) > 0 && ext != "obj" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "extra files are only accepted with an OBJ model"})
+		return
+	}
+	total := model.Size
+	seen := map[string]bool{strings.ToLower(path.Base(model.Filename)): true}
+	for _, fh := range extras {
+		name := strings.ToLower(path.Base(fh.Filename))
+		if !uploadExtraExts[path.Ext(name)] {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "extra files must be .mtl or png/jpeg/webp textures: " + fh.Filename})
+			return
+		}
+		if seen[name] {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "duplicate file name: " + fh.Filename})
+			return
+		}
+		seen[name] = true
+		total += fh.Size
+	}
+	if total > uploadMaxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"ok": false, "error": fmt.Sprintf("upload exceeds %d bytes", uploadMaxBytes)})
+		return
+	}
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		base := path.Base(model.Filename)
+		name = strings.TrimSuffix(base, path.Ext(base))
+	}
+	desc := strings.TrimSpace(c.PostForm("description"))
+	if utf8.RuneCountInString(name) > maxUploadNameLen || utf8.RuneCountInString(desc) > maxUploadDescription {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": fmt.Sprintf("name or description too long (max %d/%d characters)", maxUploadNameLen, maxUploadDescription)})
+		return
+	}
+
+	tmp, err := stageUpload(model, extras)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	format, sha, st, err := inspectUpload(tmp, size, ext)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	jobID := newUploadJobID()
+	key := artifactKey(jobID, 0, ext)
+	if _, err := store.Put(ctx, key, io.NewSectionReader(tmp, 0, size), size, contentTypeFor(key)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	files := []ResultFile{{Type: strings.ToUpper(ext), Url: permanentURL(jobID, 0, KindModel, key), Key: key}}
+	if err := recordUpload(ctx, jobID, currentUser(c), &JobParams{
+		Mode: "upload", Name: name, Description: desc, FileName: path.Base(model.Filename),
+	}, files, key, size, sha, format); err != nil {
+		if derr := store.Delete(context.Background(), key); derr != nil {
+			log.Printf("upload %s: delete %s: %v\n", jobID, key, derr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if err := statsRepo.Put(ctx, jobID, st); err != nil {
+		log.Printf("upload %s: stats: %v\n", jobID, err)
+	}
+	log.Printf("uploaded %s: %s %s (%d bytes)\n", jobID, format, model.Filename, size)
+
+	// 作为已完成的 job 开始跟踪：校验、优化版和缩略图走与生成模型相同的后台流程
+	hub.NotifyCreated(currentUser(c), jobID)
+	respondSubmitted(c, jobID, gin.H{
+		"status": "DONE",
+		"format": format,
+		"sha256": sha,
+		"size":   size,
+		"files":  files,
+		"stats":  []*MeshStats{st},
+	})
+}
+
+// recordUpload 登记 job 并记录文件摘要
+func recordUpload(ctx context.Context, jobID, owner string, params *JobParams, files []ResultFile, key string, size int64, sha, format string) error {
+	if err := repo.Create(ctx, jobID, owner, params); err != nil {
+		return err
+	}
+	if _, err := repo.Upsert(ctx, jobID, "DONE", files, ""); err != nil {
+		return err
+	}
+	return artifactRepo.SetDigest(ctx, jobID, 0, KindModel, key, size, sha, format)
+}
+
+// handleUploadStatus 上传的模型没有上游任务，状态查询直接读库，字段与 handleStatus 对齐
+func handleUploadStatus(c *gin.Context, jm *JobMeta) {
+	stats, _ := statsRepo.ListByJob(c.Request.Context(), jm.JobID)
+	c.JSON(http.StatusOK, gin.H{
+		"ok":            true,
+		"job_id":        jm.JobID,
+		"status":        jm.Status,
+		"error_code":    "",
+		"error_message": jm.Error,
+		"files":         jm.Files,
+		"request_id":    "",
+		"expired_files": []int{},
+		"stats":         stats,
+	})
+}
@@ -0,0 +1,194 @@
+// upload_test.go
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testUploadOBJ = "mtllib model.mtl\nv 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nusemtl red\nf 1 2 3\nf 1 3 4\n"
+	testUploadMTL = "newmtl red\nKd 1 0 0\n"
+)
+
+type testUploadPart struct {
+	field, name, data string
+}
+
+// testUploadRequest 组装 multipart 上传请求
+func testUploadRequest(t *testing.T, parts ...testUploadPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		fw, err := mw.CreateFormFile(p.field, p.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(p.data))
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/models/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// testUploadFiles 解析请求，返回主文件和附属文件
+func testUploadFiles(t *testing.T, parts ...testUploadPart) (*multipart.FileHeader, []*multipart.FileHeader) {
+	t.Helper()
+	req := testUploadRequest(t, parts...)
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { req.MultipartForm.RemoveAll() })
+	return req.MultipartForm.File["file"][0], req.MultipartForm.File["files"]
+}
+
+// testStageInspect 暂存并检查上传内容
+func testStageInspect(t *testing.T, ext string, parts ...testUploadPart) (*os.File, int64, string, string, *MeshStats, error) {
+	t.Helper()
+	model, extras := testUploadFiles(t, parts...)
+	tmp, err := stageUpload(model, extras)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	})
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, sha, st, err := inspectUpload(tmp, size, ext)
+	return tmp, size, format, sha, st, err
+}
+
+func TestStageUploadOBJWithMTL(t *testing.T) {
+	tmp, size, format, sha, st, err := testStageInspect(t, "obj",
+		testUploadPart{"file", "dir/model.obj", testUploadOBJ},
+		testUploadPart{"files", "model.mtl", testUploadMTL},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "zip" || st.Format != "zip" || st.FileSize != size {
+		t.Fatalf("format = %s, stats = %+v", format, st)
+	}
+	if st.Faces != 2 || st.Vertices != 4 || st.Materials != 1 || st.Error != "" {
+		t.Fatalf("stats = %+v", st)
+	}
+
+	// 打包进 zip 时只保留文件名，摘要按打包后的内容计算
+	data, err := io.ReadAll(io.NewSectionReader(tmp, 0, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); sha != hex.EncodeToString(sum[:]) {
+		t.Fatalf("sha256 = %s, want digest of staged zip", sha)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "model.obj,model.mtl" {
+		t.Fatalf("zip entries = %v", names)
+	}
+
+	// 解析时用上了 MTL 里的材质
+	s, err := ParseModel(data, "zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Materials) != 1 || s.Materials[0].BaseColor != [4]float32{1, 0, 0, 1} {
+		t.Fatalf("materials = %+v", s.Materials)
+	}
+}
+
+func TestStageUploadSingleFile(t *testing.T) {
+	tmp, size, format, _, st, err := testStageInspect(t, "obj", testUploadPart{"file", "model.obj", testUploadOBJ})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "obj" || st.Faces != 2 {
+		t.Fatalf("format = %s, stats = %+v", format, st)
+	}
+	data, _ := io.ReadAll(io.NewSectionReader(tmp, 0, size))
+	if string(data) != testUploadOBJ {
+		t.Fatalf("single file not copied verbatim: %q", data)
+	}
+}
+
+func TestInspectUploadRejects(t *testing.T) {
+	cases := []struct {
+		name, ext, data, want string
+	}{
+		{"extension mismatch", "glb", testUploadOBJ, "expected glb"},
+		{"empty", "obj", "", "empty file"},
+		{"no faces", "obj", "v 0 0 0\nv 1 0 0\n", "no geometry"},
+		{"html error page", "stl", "<!DOCTYPE html><html></html>", "HTML"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, _, _, err := testStageInspect(t, tc.ext, testUploadPart{"file", "model." + tc.ext, tc.data})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// 以下请求都在暂存前被拒绝，不会访问存储和数据库
+func TestHandleUploadModelRejects(t *testing.T) {
+	old := uploadMaxBytes
+	uploadMaxBytes = 256
+	defer func() { uploadMaxBytes = old }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/models/upload", limitUploadBody(), handleUploadModel)
+
+	cases := []struct {
+		name   string
+		parts  []testUploadPart
+		status int
+		want   string
+	}{
+		{"no file", []testUploadPart{{"files", "model.mtl", testUploadMTL}}, http.StatusBadRequest, "exactly one file"},
+		{"rejected extension", []testUploadPart{{"file", "model.exe", "MZ"}}, http.StatusBadRequest, "unsupported file type"},
+		{"extras without obj", []testUploadPart{{"file", "model.stl", "solid"}, {"files", "model.mtl", testUploadMTL}}, http.StatusBadRequest, "only accepted with an OBJ"},
+		{"rejected extra extension", []testUploadPart{{"file", "model.obj", testUploadOBJ}, {"files", "notes.txt", "hi"}}, http.StatusBadRequest, "extra files must be"},
+		{"duplicate extra", []testUploadPart{
+			{"file", "model.obj", testUploadOBJ}, {"files", "a/tex.png", "x"}, {"files", "b/TEX.png", "y"},
+		}, http.StatusBadRequest, "duplicate file name"},
+		{"model over limit", []testUploadPart{{"file", "model.stl", strings.Repeat("x", 257)}}, http.StatusRequestEntityTooLarge, "upload exceeds 256 bytes"},
+		{"total over limit", []testUploadPart{
+			{"file", "model.obj", testUploadOBJ}, {"files", "model.mtl", testUploadMTL}, {"files", "tex.png", strings.Repeat("x", 200)},
+		}, http.StatusRequestEntityTooLarge, "upload exceeds 256 bytes"},
+		{"body over limit", []testUploadPart{{"file", "model.stl", strings.Repeat("x", 2<<20)}}, http.StatusRequestEntityTooLarge, "upload exceeds 256 bytes"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, testUploadRequest(t, tc.parts...))
+			if w.Code != tc.status || !strings.Contains(w.Body.String(), tc.want) {
+				t.Fatalf("status = %d, body = %s; want %d %q", w.Code, w.Body, tc.status, tc.want)
+			}
+		})
+	}
+}
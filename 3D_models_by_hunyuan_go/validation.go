@@ -0,0 +1,116 @@
+// validation.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   glTF 校验报告
+   ========================= */
+
+// 前端显示不出模型时，先看文件本身是否合规（gltf_validate.go）。报告按源文件摘要存在 mesh_reports，
+// 模型入库后在后台生成，文件变化后自动重算：
+//
+// GET /api/jobs/:id/files/:idx/validation[?severity=error|warning]
+
+const ReportValidation = "validation"
+
+// modelValidation 返回第 idx 个模型的校验报告（必要时生成）
+func modelValidation(ctx context.Context, jobID string, idx int, f ResultFile) (json.RawMessage, error) {
+	key, src, err := modelArtifact(ctx, jobID, idx, f)
+	if err != nil {
+		return nil, err
+	}
+	if src.Format != "glb" && src.Format != "gltf" {
+		return nil, fmt.Errorf("%w: validation only supports glb/gltf, got %s", ErrUnsupportedSource, src.Format)
+	}
+	return cachedReport(ctx, jobID, idx, ReportValidation, src.SHA256, func(ctx context.Context) (any, error) {
+		rc, _, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		rep := ValidateGLTF(data)
+		log.Printf("validated %s/%d: %d errors, %d warnings\n", jobID, idx, rep.Errors, rep.Warnings)
+		return rep, nil
+	})
+}
+
+// validateModels 校验 GLB/GLTF 文件（后处理流水线的一步）
+func validateModels(ctx context.Context, jobID string, files []ResultFile) {
+	if reportRepo == nil {
+		return
+	}
+	for i, f := range files {
+		if t := strings.ToLower(f.Type); f.Key == "" || t != "glb" && t != "gltf" {
+			continue
+		}
+		if _, err := modelValidation(ctx, jobID, i, f); err != nil {
+			log.Printf("validate %s/%d: %v\n", jobID, i, err)
+		}
+	}
+}
+
+// GET /api/jobs/:id/files/:idx/validation
+func handleValidation(c *gin.Context) {
+	jobID := c.Param("id")
+	ctx := c.Request.Context()
+	idx, err := strconv.Atoi(c.Param("idx"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "invalid index"})
+		return
+	}
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+	if jm.Status != "DONE" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "job not done"})
+		return
+	}
+	if idx < 0 || idx >= len(jm.Files) {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "index out of range"})
+		return
+	}
+	raw, err := modelValidation(ctx, jobID, idx, jm.Files[idx])
+	if err != nil {
+		exportError(c, err)
+		return
+	}
+
+	// 只看某一级别及以上的问题
+	if sev := c.Query("severity"); sev == "error" || sev == "warning" {
+		var rep ValidationReport
+		if err := json.Unmarshal(raw, &rep); err == nil {
+			kept := rep.Issues[:0]
+			for _, is := range rep.Issues {
+				if is.Severity == "error" || sev == "warning" && is.Severity == "warning" {
+					kept = append(kept, is)
+				}
+			}
+			rep.Issues = kept
+			c.JSON(http.StatusOK, gin.H{"ok": true, "job_id": jobID, "index": idx, "report": rep})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "job_id": jobID, "index": idx, "report": raw})
+}
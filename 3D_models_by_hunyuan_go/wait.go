@@ -0,0 +1,190 @@
+// wait.go
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   长轮询 / 提交并等待
+   ========================= */
+
+var (
+	waitDefault = 30 * time.Second
+	waitMax     = 120 * time.Second // 单次阻塞的上限，避免占满连接
+)
+
+func initWait() {
+	if v := strings.TrimSpace(os.Getenv("WAIT_MAX_TIMEOUT")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			waitMax = d
+		}
+	}
+}
+
+// parseWaitTimeout 支持 "60s" / "2m" / 纯秒数
+func parseWaitTimeout(raw string, def time.Duration) time.Duration {
+	raw = strings.TrimSpace(raw)
+	d := def
+	if raw != "" {
+		if v, err := time.ParseDuration(raw); err == nil {
+			d = v
+		} else if n, err := strconv.Atoi(raw); err == nil {
+			d = time.Duration(n) * time.Second
+		}
+	}
+	if d <= 0 {
+		d = def
+	}
+	if d > waitMax {
+		d = waitMax
+	}
+	return d
+}
+
+func isTerminal(status string) bool { return status == "DONE" || status == "FAIL" }
+
+func eventStatus(ev JobEvent) string {
+	if m, ok := ev.Data.(gin.H); ok {
+		s, _ := m["status"].(string)
+		return s
+	}
+	return ""
+}
+
+// waitJob 阻塞直到 until(status) 为真、job 结束或 ctx 到期；返回是否满足条件
+func waitJob(ctx context.Context, jobID string, until func(status string) bool) bool {
+	var lastID int64
+	for {
+		replay, ch, cancel := hub.Subscribe(jobID, lastID)
+
+		// 历史只看最新状态，避免旧状态误判
+		latest := ""
+		for _, ev := range replay {
+			lastID = ev.ID
+			if ev.Type == EventStatus {
+				latest = eventStatus(ev)
+			}
+			if ev.Type == EventEnd {
+				cancel()
+				return true
+			}
+		}
+		if latest != "" && until(latest) {
+			cancel()
+			return true
+		}
+
+		resub := false
+		for !resub {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return false
+			case ev, ok := <-ch:
+				if !ok {
+					resub = true
+					break
+				}
+				lastID = ev.ID
+				if ev.Type == EventEnd || (ev.Type == EventStatus && until(eventStatus(ev))) {
+					cancel()
+					return true
+				}
+			}
+		}
+		cancel()
+	}
+}
+
+func jobBody(jm *JobMeta) gin.H {
+	return gin.H{
+		"ok":         true,
+		"job_id":     jm.JobID,
+		"status":     jm.Status,
+		"error":      jm.Error,
+		"files":      jm.Files,
+		"updated_at": jm.UpdatedAt,
+	}
+}
+
+// GET /api/jobs/:id/wait?timeout=60s&status=RUN
+// status 为客户端已知状态（默认取当前状态），状态变化或超时即返回
+func handleJobWait(c *gin.Context) {
+	jobID := c.Param("id")
+	ctx := c.Request.Context()
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if jm == nil || !canAccessJob(c, jm) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+		return
+	}
+
+	known := strings.ToUpper(strings.TrimSpace(c.Query("status")))
+	if known == "" {
+		known = jm.Status
+	}
+	if isTerminal(jm.Status) || jm.Status != known {
+		body := jobBody(jm)
+		body["changed"] = jm.Status != known
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, parseWaitTimeout(c.Query("timeout"), waitDefault))
+	defer cancel()
+	changed := waitJob(wctx, jobID, func(st string) bool { return st != known })
+	if ctx.Err() != nil {
+		return // 客户端已断开
+	}
+
+	if jm2, err := repo.Get(ctx, jobID); err == nil && jm2 != nil {
+		jm = jm2
+	}
+	body := jobBody(jm)
+	body["changed"] = changed
+	body["timeout"] = !changed
+	c.JSON(http.StatusOK, body)
+}
+
+// respondSubmitted 提交成功后的统一响应；
+// ?wait=true 时在截止时间（wait_timeout，默认 60s）内等待生成完成并直接返回文件列表，否则仅返回 job_id
+func respondSubmitted(c *gin.Context, jobID string, body gin.H) {
+	body["ok"] = true
+	body["job_id"] = jobID
+	if !parseBoolDefault(c.Query("wait"), false) {
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	ctx := c.Request.Context()
+	wctx, cancel := context.WithTimeout(ctx, parseWaitTimeout(c.Query("wait_timeout"), 60*time.Second))
+	defer cancel()
+	// 等到 end 事件（DONE 时产物已镜像完成）
+	done := waitJob(wctx, jobID, func(string) bool { return false })
+	body["completed"] = done
+	// 客户端已断开时任务也已创建，照样写出 job_id：带 Idempotency-Key 的重试靠这份响应拿到 job_id
+	if ctx.Err() != nil {
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	if jm, err := repo.Get(ctx, jobID); err == nil && jm != nil {
+		body["status"] = jm.Status
+		if done {
+			body["files"] = jm.Files
+			body["error"] = jm.Error
+		}
+	}
+	c.JSON(http.StatusOK, body)
+}
@@ -0,0 +1,709 @@
+// webhooks.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* =========================
+   Outgoing Webhooks
+   ========================= */
+
+// job 进入 DONE/FAIL 时向回调地址 POST 签名后的 JSON。
+// 签名：X-Hunyuan-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+// 每个 webhook 和每个 job 的 callback_url 都有自己的密钥，只在创建时返回一次；投递总是签名。
+var (
+	webhookRepo         WebhookRepo
+	webhookSecret       string // 旧版本登记的、没有密钥的 callback_url 使用的全局密钥（WEBHOOK_SECRET）
+	webhookAllowPrivate bool   // WEBHOOK_ALLOW_PRIVATE：允许回调内网地址，仅供本地联调
+)
+
+const (
+	webhookMaxAttempts   = 8
+	webhookBackoffBase   = 30 * time.Second
+	webhookBackoffMax    = 6 * time.Hour
+	webhookBatch         = 20
+	webhookTimeout       = 15 * time.Second // 单次投递的超时
+	webhookRecordTimeout = 5 * time.Second  // 记录投递结果的超时
+	// 领取后的租约，防止多实例重复投递。一批按顺序投递，租约须覆盖整批都超时的情况，否则批尾的条目会被别的实例重复领取
+	webhookLease = webhookBatch*(webhookTimeout+webhookRecordTimeout) + time.Minute
+)
+
+// webhookClient 回调地址由调用方填写：拨号时按解析出的实际 IP 拦截内网/本机/元数据地址（防 DNS rebinding），
+// 不走代理、不跟随重定向（3xx 按投递失败处理）
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: webhookDialControl}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+var errCallbackAddress = errors.New("callback address not allowed")
+
+// 除 netip 自带分类外还需拦截的网段：0.0.0.0/8、运营商级 NAT（含阿里云元数据 100.100.100.200）、
+// IETF 协议地址、基准测试网段
+var blockedCallbackPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// blockedCallbackIP 回环、私有、链路本地（含 169.254.169.254 等云元数据地址）、组播等非公网地址
+func blockedCallbackIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return true
+	}
+	for _, p := range blockedCallbackPrefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	if webhookAllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || blockedCallbackIP(ip) {
+		return fmt.Errorf("%w: %s", errCallbackAddress, host)
+	}
+	return nil
+}
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	Owner     string    `json:"owner,omitempty"`
+	JobID     string    `json:"job_id,omitempty"` // 非空表示只针对单个 job
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // 仅创建时返回
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	URL            string          `json:"url"`
+	JobID          string          `json:"job_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending | delivered | failed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	secret string
+}
+
+type WebhookAttempt struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookRepo interface {
+	Create(ctx context.Context, wh *Webhook) error
+	ListByOwner(ctx context.Context, owner string) ([]Webhook, error)
+	Delete(ctx context.Context, id int64, owner string) (bool, error)
+	// ForJob 返回该 job 的专属回调及其所有者注册的全局回调
+	ForJob(ctx context.Context, jobID, owner string) ([]Webhook, error)
+
+	Enqueue(ctx context.Context, webhookID int64, jobID, event string, payload []byte) error
+	ClaimDue(ctx context.Context, limit int) ([]WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, id int64, a WebhookAttempt, status string, next *time.Time) error
+	ListDeliveries(ctx context.Context, owner, jobID, status string, limit int) ([]WebhookDelivery, error)
+	GetDelivery(ctx context.Context, id int64, owner string) (*WebhookDelivery, []WebhookAttempt, error)
+	Redeliver(ctx context.Context, id int64, owner string) (bool, error)
+}
+
+/* =========================
+   PostgreSQL Repo
+   ========================= */
+
+type pgWebhookRepo struct{ db *sql.DB }
+
+func NewPGWebhookRepo(db *sql.DB) WebhookRepo { return &pgWebhookRepo{db: db} }
+
+func (r *pgWebhookRepo) Create(ctx context.Context, wh *Webhook) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (owner, job_id, url, secret)
+		VALUES (NULLIF($1,''), NULLIF($2,''), $3, $4)
+		RETURNING id, created_at
+	`, wh.Owner, wh.JobID, wh.URL, wh.Secret).Scan(&wh.ID, &wh.CreatedAt)
+}
+
+func (r *pgWebhookRepo) ListByOwner(ctx context.Context, owner string) ([]Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(owner,''), COALESCE(job_id,''), url, created_at
+		FROM webhooks WHERE COALESCE(owner,'') = $1 AND active
+		ORDER BY id DESC
+	`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Webhook
+	for rows.Next() {
+		var wh Webhook
+		if err := rows.Scan(&wh.ID, &wh.Owner, &wh.JobID, &wh.URL, &wh.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, wh)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgWebhookRepo) Delete(ctx context.Context, id int64, owner string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhooks SET active = FALSE WHERE id = $1 AND COALESCE(owner,'') = $2 AND active
+	`, id, owner)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func (r *pgWebhookRepo) ForJob(ctx context.Context, jobID, owner string) ([]Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(owner,''), COALESCE(job_id,''), url, secret, created_at
+		FROM webhooks
+		WHERE active AND (job_id = $1 OR (job_id IS NULL AND $2 <> '' AND owner = $2))
+	`, jobID, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Webhook
+	for rows.Next() {
+		var wh Webhook
+		if err := rows.Scan(&wh.ID, &wh.Owner, &wh.JobID, &wh.URL, &wh.Secret, &wh.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, wh)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgWebhookRepo) Enqueue(ctx context.Context, webhookID int64, jobID, event string, payload []byte) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, job_id, event, payload)
+		VALUES ($1, $2, $3, $4::jsonb)
+		ON CONFLICT (webhook_id, job_id, event) DO NOTHING
+	`, webhookID, jobID, event, string(payload))
+	return err
+}
+
+func (r *pgWebhookRepo) ClaimDue(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + $2::interval
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, w.url, w.secret, d.job_id, d.event, d.payload, d.attempts
+	`, limit, fmt.Sprintf("%d seconds", int(webhookLease.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.secret, &d.JobID, &d.Event, &d.Payload, &d.Attempts); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgWebhookRepo) RecordAttempt(ctx context.Context, id int64, a WebhookAttempt, status string, next *time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms)
+		VALUES ($1, NULLIF($2,0), NULLIF($3,''), $4)
+	`, id, a.StatusCode, a.Error, a.DurationMs); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+		    status = $2,
+		    next_attempt_at = $3,
+		    last_status_code = NULLIF($4,0),
+		    last_error = NULLIF($5,''),
+		    updated_at = now()
+		WHERE id = $1
+	`, id, status, next, a.StatusCode, a.Error); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const deliveryCols = `d.id, d.webhook_id, w.url, d.job_id, d.event, d.payload, d.status, d.attempts,
+	d.next_attempt_at, COALESCE(d.last_status_code,0), COALESCE(d.last_error,''), d.created_at, d.updated_at`
+
+func scanDelivery(sc interface{ Scan(...any) error }) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var next sql.NullTime
+	if err := sc.Scan(&d.ID, &d.WebhookID, &d.URL, &d.JobID, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+		&next, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if next.Valid && d.Status == "pending" {
+		d.NextAttemptAt = &next.Time
+	}
+	return &d, nil
+}
+
+func (r *pgWebhookRepo) ListDeliveries(ctx context.Context, owner, jobID, status string, limit int) ([]WebhookDelivery, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+deliveryCols+`
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE COALESCE(w.owner,'') = $1
+		  AND ($2 = '' OR d.job_id = $2)
+		  AND ($3 = '' OR d.status = $3)
+		ORDER BY d.id DESC
+		LIMIT $4
+	`, owner, jobID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgWebhookRepo) GetDelivery(ctx context.Context, id int64, owner string) (*WebhookDelivery, []WebhookAttempt, error) {
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, `
+		SELECT `+deliveryCols+`
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.id = $1 AND COALESCE(w.owner,'') = $2
+	`, id, owner))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT COALESCE(status_code,0), COALESCE(error,''), duration_ms, created_at
+		FROM webhook_attempts WHERE delivery_id = $1 ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var attempts []WebhookAttempt
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.StatusCode, &a.Error, &a.DurationMs, &a.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return d, attempts, rows.Err()
+}
+
+func (r *pgWebhookRepo) Redeliver(ctx context.Context, id int64, owner string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET status = 'pending', attempts = 0, next_attempt_at = now(), updated_at = now()
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id = $1 AND COALESCE(w.owner,'') = $2
+	`, id, owner)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+func createWebhookTables(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id BIGSERIAL PRIMARY KEY,
+			owner TEXT,
+			job_id TEXT,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMPTZ DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS webhooks_job_idx ON webhooks (job_id);
+		CREATE INDEX IF NOT EXISTS webhooks_owner_idx ON webhooks (owner);
+
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			webhook_id BIGINT NOT NULL REFERENCES webhooks(id),
+			job_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMPTZ DEFAULT NOW(),
+			last_status_code INT,
+			last_error TEXT,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			UNIQUE (webhook_id, job_id, event)
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at);
+
+		CREATE TABLE IF NOT EXISTS webhook_attempts (
+			id BIGSERIAL PRIMARY KEY,
+			delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+			status_code INT,
+			error TEXT,
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ DEFAULT NOW()
+		);
+	`)
+	return err
+}
+
+func initWebhooks(db *sql.DB) {
+	webhookSecret = os.Getenv("WEBHOOK_SECRET")
+	webhookAllowPrivate = parseBoolDefault(os.Getenv("WEBHOOK_ALLOW_PRIVATE"), false)
+	if err := createWebhookTables(db); err != nil {
+		log.Fatal("Error creating webhook tables:", err)
+	}
+	webhookRepo = NewPGWebhookRepo(db)
+	hub.OnTerminal(enqueueWebhooks)
+	go webhookWorker()
+}
+
+/* =========================
+   投递
+   ========================= */
+
+// validateCallbackURL 登记时先拒绝明显的内网地址（IP 字面量、localhost），给调用方即时的错误；
+// 域名解析到内网的情况在投递拨号时拦截
+func validateCallbackURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("callback_url must be an absolute http(s) URL")
+	}
+	if webhookAllowPrivate {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("callback_url: %w: %s", errCallbackAddress, host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && blockedCallbackIP(ip) {
+		return fmt.Errorf("callback_url: %w: %s", errCallbackAddress, host)
+	}
+	return nil
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+func signWebhook(secret, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// registerJobCallback 为单个 job 登记 callback_url（提交接口调用），返回生成的签名密钥；
+// 未带 callback_url 或登记失败时返回空串
+func registerJobCallback(ctx context.Context, jobID, owner, callbackURL string) string {
+	if strings.TrimSpace(callbackURL) == "" {
+		return ""
+	}
+	wh := &Webhook{Owner: owner, JobID: jobID, URL: strings.TrimSpace(callbackURL), Secret: newWebhookSecret()}
+	if err := webhookRepo.Create(ctx, wh); err != nil {
+		log.Printf("register callback for %s: %v\n", jobID, err)
+		return ""
+	}
+	return wh.Secret
+}
+
+// withCallbackSecret 把 callback_url 的密钥放进提交响应，只此一次返回
+func withCallbackSecret(body gin.H, secret string) gin.H {
+	if secret != "" {
+		body["callback_secret"] = secret
+	}
+	return body
+}
+
+// enqueueWebhooks 在 job 终态时生成投递记录；同一 webhook/job/event 只会入队一次
+func enqueueWebhooks(jobID string, _ *QueryProResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	jm, err := repo.Get(ctx, jobID)
+	if err != nil || jm == nil {
+		return
+	}
+	hooks, err := webhookRepo.ForJob(ctx, jobID, jm.Owner)
+	if err != nil {
+		log.Printf("webhooks for %s: %v\n", jobID, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	event := "job.done"
+	if jm.Status == "FAIL" {
+		event = "job.failed"
+	}
+	payload, _ := json.Marshal(gin.H{
+		"event":      event,
+		"job_id":     jm.JobID,
+		"owner":      jm.Owner,
+		"status":     jm.Status,
+		"error":      jm.Error,
+		"files":      jm.Files,
+		"created_at": jm.CreatedAt,
+		"updated_at": jm.UpdatedAt,
+	})
+	for _, wh := range hooks {
+		if err := webhookRepo.Enqueue(ctx, wh.ID, jobID, event, payload); err != nil {
+			log.Printf("enqueue webhook %d for %s: %v\n", wh.ID, jobID, err)
+		}
+	}
+}
+
+func webhookWorker() {
+	t := time.NewTicker(5 * time.Second)
+	defer t.Stop()
+	for range t.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		due, err := webhookRepo.ClaimDue(ctx, webhookBatch)
+		cancel()
+		if err != nil {
+			log.Println("webhook claim:", err)
+			continue
+		}
+		for _, d := range due {
+			deliverWebhook(d)
+		}
+	}
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBackoffBase << attempts
+	if d <= 0 || d > webhookBackoffMax {
+		d = webhookBackoffMax
+	}
+	return d
+}
+
+func deliverWebhook(d WebhookDelivery) {
+	secret := d.secret
+	if secret == "" {
+		secret = webhookSecret
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	start := time.Now()
+	var a WebhookAttempt
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	// 旧数据：没有密钥且未配置 WEBHOOK_SECRET，不发送未签名的回调，直接记为失败
+	unsigned := err == nil && secret == ""
+	if unsigned {
+		err = errors.New("webhook has no signing secret; set WEBHOOK_SECRET or re-register the callback")
+	}
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "hunyuan3d-webhook/1")
+		req.Header.Set("X-Hunyuan-Event", d.Event)
+		req.Header.Set("X-Hunyuan-Delivery", strconv.FormatInt(d.ID, 10))
+		req.Header.Set("X-Hunyuan-Timestamp", ts)
+		req.Header.Set("X-Hunyuan-Signature", signWebhook(secret, ts, d.Payload))
+		var resp *http.Response
+		resp, err = webhookClient.Do(req)
+		if err == nil {
+			a.StatusCode = resp.StatusCode
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				err = fmt.Errorf("bad status: %s, body: %s", resp.Status, string(body))
+			}
+		}
+	}
+	a.DurationMs = time.Since(start).Milliseconds()
+
+	status := "delivered"
+	var next *time.Time
+	if err != nil {
+		a.Error = err.Error()
+		if unsigned || d.Attempts+1 >= webhookMaxAttempts {
+			status = "failed"
+		} else {
+			status = "pending"
+			n := time.Now().Add(webhookBackoff(d.Attempts))
+			next = &n
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookRecordTimeout)
+	defer cancel()
+	if err := webhookRepo.RecordAttempt(ctx, d.ID, a, status, next); err != nil {
+		log.Printf("record webhook attempt %d: %v\n", d.ID, err)
+	}
+}
+
+/* =========================
+   HTTP Handlers
+   ========================= */
+
+type CreateWebhookReq struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"` // 可选，不填则自动生成
+}
+
+// POST /api/webhooks 为当前调用方（API key）注册全局回调
+func handleCreateWebhook(c *gin.Context) {
+	var req CreateWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "invalid json"})
+		return
+	}
+	owner := currentUser(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "unauthorized"})
+		return
+	}
+	if err := validateCallbackURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	secret := strings.TrimSpace(req.Secret)
+	if secret == "" {
+		secret = newWebhookSecret()
+	}
+	wh := &Webhook{Owner: owner, URL: strings.TrimSpace(req.URL), Secret: secret}
+	if err := webhookRepo.Create(c.Request.Context(), wh); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "webhook": wh})
+}
+
+func handleListWebhooks(c *gin.Context) {
+	list, err := webhookRepo.ListByOwner(c.Request.Context(), currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "webhooks": list})
+}
+
+func handleDeleteWebhook(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	ok, err := webhookRepo.Delete(c.Request.Context(), id, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// GET /api/webhooks/deliveries?job_id=&status=pending|delivered|failed&limit=
+func handleListDeliveries(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	list, err := webhookRepo.ListDeliveries(c.Request.Context(), currentUser(c), c.Query("job_id"), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "deliveries": list})
+}
+
+func handleGetDelivery(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	d, attempts, err := webhookRepo.GetDelivery(c.Request.Context(), id, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if d == nil {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "delivery not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "delivery": d, "attempts": attempts})
+}
+
+// POST /api/webhooks/deliveries/:id/redeliver 手动重投（重置重试次数）
+func handleRedeliver(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	ok, err := webhookRepo.Redeliver(c.Request.Context(), id, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "delivery not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,89 @@
+// webhooks_test.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestBlockedCallbackIP(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1":        true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"169.254.0.23":     true,
+		"100.100.100.200":  true,
+		"0.0.0.0":          true,
+		"0.1.2.3":          true,
+		"224.0.0.1":        true,
+		"::1":              true,
+		"fe80::1":          true,
+		"fd00:ec2::254":    true,
+		"::ffff:127.0.0.1": true,
+		"8.8.8.8":          false,
+		"2606:4700::1111":  false,
+	} {
+		if got := blockedCallbackIP(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s: blocked=%v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://example.com/hook":       true,
+		"http://8.8.8.8:8080/hook":       true,
+		"ftp://example.com/hook":         false,
+		"https:///hook":                  false,
+		"http://localhost:9000/hook":     false,
+		"http://api.localhost/hook":      false,
+		"http://127.0.0.1/hook":          false,
+		"http://[::1]/hook":              false,
+		"http://169.254.169.254/latest/": false,
+	} {
+		if err := validateCallbackURL(raw); (err == nil) != ok {
+			t.Errorf("%s: err=%v, want ok=%v", raw, err, ok)
+		}
+	}
+}
+
+func TestWebhookClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := webhookClient.Post(srv.URL, "application/json", nil)
+	if !errors.Is(err, errCallbackAddress) {
+		t.Fatalf("dial to %s: got %v, want errCallbackAddress", srv.URL, err)
+	}
+
+	webhookAllowPrivate = true
+	defer func() { webhookAllowPrivate = false }()
+	resp, err := webhookClient.Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("with WEBHOOK_ALLOW_PRIVATE: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestWebhookClientNoRedirect(t *testing.T) {
+	webhookAllowPrivate = true
+	defer func() { webhookAllowPrivate = false }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	resp, err := webhookClient.Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("status %d, want the 302 itself", resp.StatusCode)
+	}
+}
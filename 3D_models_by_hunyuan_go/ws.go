@@ -0,0 +1,352 @@
+// ws.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+/* =========================
+   WebSocket 多路订阅
+   ========================= */
+
+// 一个连接内可订阅任意多个 job，复用 hub 的事件扇出。
+//
+// 客户端消息：
+//   {"op":"subscribe","job_ids":["..."]}    {"op":"unsubscribe","job_ids":["..."]}
+//   {"op":"subscribe_all"}                  {"op":"unsubscribe_all"}
+//   {"op":"ping"}
+// 服务端消息：
+//   {"type":"status|queue|mirror|files|end","job_id":"...","event_id":1,"data":{...}}
+//   {"type":"subscribed|unsubscribed|error|pong", ...}
+
+const (
+	wsWriteWait   = 10 * time.Second
+	wsPongWait    = 60 * time.Second
+	wsPingPeriod  = 30 * time.Second
+	wsMaxMsgSize  = 64 << 10
+	wsOutBuffer   = 256
+	wsMaxSubs     = 500
+	wsLossyWater  = wsOutBuffer * 3 / 4 // 超过水位后丢弃可丢失的进度消息
+	wsActiveLimit = 200
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true }, // 与 CORS 策略保持一致
+}
+
+type wsClientMsg struct {
+	Op     string   `json:"op"`
+	JobIDs []string `json:"job_ids"`
+}
+
+type wsServerMsg struct {
+	Type    string `json:"type"`
+	JobID   string `json:"job_id,omitempty"`
+	EventID int64  `json:"event_id,omitempty"`
+	Data    any    `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type wsSub struct {
+	once sync.Once
+	stop chan struct{}
+}
+
+func (s *wsSub) cancel() { s.once.Do(func() { close(s.stop) }) }
+
+type wsConn struct {
+	conn   *websocket.Conn
+	user   string
+	out    chan wsServerMsg
+	closed chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	subs    map[string]*wsSub
+	allStop func()
+}
+
+// GET /api/ws （浏览器无法带 Authorization 时可用 ?token=）
+func handleWS(c *gin.Context) {
+	user := currentUser(c)
+	if user == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "unauthorized"})
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	wc := &wsConn{
+		conn:   conn,
+		user:   user,
+		out:    make(chan wsServerMsg, wsOutBuffer),
+		closed: make(chan struct{}),
+		subs:   map[string]*wsSub{},
+	}
+	go wc.writeLoop()
+	wc.readLoop()
+}
+
+func (wc *wsConn) close() {
+	wc.once.Do(func() {
+		close(wc.closed)
+		wc.mu.Lock()
+		for id, sub := range wc.subs {
+			sub.cancel()
+			delete(wc.subs, id)
+		}
+		if wc.allStop != nil {
+			wc.allStop()
+			wc.allStop = nil
+		}
+		wc.mu.Unlock()
+		_ = wc.conn.Close()
+	})
+}
+
+// send 处理背压：进度类消息在缓冲高水位时丢弃，关键消息缓冲满则断开慢消费者
+func (wc *wsConn) send(m wsServerMsg) bool {
+	if m.Type == EventMirror || m.Type == EventQueue {
+		if len(wc.out) >= wsLossyWater {
+			return true
+		}
+	}
+	select {
+	case wc.out <- m:
+		return true
+	case <-wc.closed:
+		return false
+	default:
+		log.Printf("ws %s: slow consumer, closing\n", wc.user)
+		_ = wc.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"),
+			time.Now().Add(wsWriteWait))
+		wc.close()
+		return false
+	}
+}
+
+func (wc *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ping.Stop()
+		wc.close()
+	}()
+	for {
+		select {
+		case <-wc.closed:
+			return
+		case m := <-wc.out:
+			_ = wc.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := wc.conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-ping.C:
+			_ = wc.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := wc.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (wc *wsConn) readLoop() {
+	defer wc.close()
+	wc.conn.SetReadLimit(wsMaxMsgSize)
+	_ = wc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	wc.conn.SetPongHandler(func(string) error {
+		return wc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, raw, err := wc.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = wc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var msg wsClientMsg
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			wc.send(wsServerMsg{Type: "error", Error: "invalid json"})
+			continue
+		}
+		switch msg.Op {
+		case "subscribe":
+			for _, id := range msg.JobIDs {
+				wc.subscribe(id)
+			}
+		case "unsubscribe":
+			for _, id := range msg.JobIDs {
+				wc.unsubscribe(id)
+			}
+		case "subscribe_all":
+			wc.subscribeAll()
+		case "unsubscribe_all":
+			wc.unsubscribeAll()
+		case "ping":
+			wc.send(wsServerMsg{Type: "pong"})
+		default:
+			wc.send(wsServerMsg{Type: "error", Error: "unknown op: " + msg.Op})
+		}
+	}
+}
+
+func (wc *wsConn) subscribe(jobID string) {
+	wc.mu.Lock()
+	_, dup := wc.subs[jobID]
+	full := len(wc.subs) >= wsMaxSubs
+	wc.mu.Unlock()
+	if dup {
+		return
+	}
+	if full {
+		wc.send(wsServerMsg{Type: "error", JobID: jobID, Error: "too many subscriptions"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	jm, err := repo.Get(ctx, jobID)
+	cancel()
+	if err != nil {
+		wc.send(wsServerMsg{Type: "error", JobID: jobID, Error: err.Error()})
+		return
+	}
+	if jm == nil || !jobVisibleTo(wc.user, jm) {
+		wc.send(wsServerMsg{Type: "error", JobID: jobID, Error: "job not found"})
+		return
+	}
+
+	// 查库期间 subscribe_all 的回调可能已经订阅了同一个 job（或连接已关闭），插入前在同一把锁下再检查一次
+	sub := &wsSub{stop: make(chan struct{})}
+	wc.mu.Lock()
+	select {
+	case <-wc.closed:
+		wc.mu.Unlock()
+		return
+	default:
+	}
+	if _, dup := wc.subs[jobID]; dup {
+		wc.mu.Unlock()
+		return
+	}
+	if len(wc.subs) >= wsMaxSubs {
+		wc.mu.Unlock()
+		wc.send(wsServerMsg{Type: "error", JobID: jobID, Error: "too many subscriptions"})
+		return
+	}
+	wc.subs[jobID] = sub
+	wc.mu.Unlock()
+
+	wc.send(wsServerMsg{Type: "subscribed", JobID: jobID})
+	go wc.forward(jobID, sub)
+}
+
+// forward 把 hub 事件转发到连接；hub 因缓冲满断开时凭最后的事件 ID 续订
+func (wc *wsConn) forward(jobID string, sub *wsSub) {
+	var lastID int64
+	for {
+		replay, ch, cancel := hub.Subscribe(jobID, lastID)
+		resub := wc.pump(jobID, replay, ch, sub.stop, &lastID)
+		cancel()
+		if !resub {
+			break
+		}
+	}
+	wc.mu.Lock()
+	if wc.subs[jobID] == sub {
+		delete(wc.subs, jobID)
+	}
+	wc.mu.Unlock()
+}
+
+// pump 返回 true 表示需要续订
+func (wc *wsConn) pump(jobID string, replay []JobEvent, ch <-chan JobEvent, stop <-chan struct{}, lastID *int64) bool {
+	emit := func(ev JobEvent) bool {
+		*lastID = ev.ID
+		return wc.send(wsServerMsg{Type: ev.Type, JobID: jobID, EventID: ev.ID, Data: ev.Data}) && ev.Type != EventEnd
+	}
+	for _, ev := range replay {
+		if !emit(ev) {
+			return false
+		}
+	}
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-wc.closed:
+			return false
+		case ev, ok := <-ch:
+			if !ok {
+				return true
+			}
+			// 终态后自动退订
+			if !emit(ev) {
+				return false
+			}
+		}
+	}
+}
+
+func (wc *wsConn) unsubscribe(jobID string) {
+	wc.mu.Lock()
+	sub, ok := wc.subs[jobID]
+	delete(wc.subs, jobID)
+	wc.mu.Unlock()
+	if ok {
+		sub.cancel()
+		wc.send(wsServerMsg{Type: "unsubscribed", JobID: jobID})
+	}
+}
+
+// subscribeAll 订阅该用户所有未结束的 job，并跟随后续新提交的 job
+func (wc *wsConn) subscribeAll() {
+	wc.mu.Lock()
+	already := wc.allStop != nil
+	wc.mu.Unlock()
+	if already {
+		return
+	}
+	stop := hub.WatchOwner(wc.user, wc.subscribe)
+	wc.mu.Lock()
+	wc.allStop = stop
+	wc.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	jobs, err := repo.List(ctx, JobFilter{Owner: wc.user, Statuses: []string{"WAIT", "RUN"}, Limit: wsActiveLimit})
+	cancel()
+	if err != nil {
+		wc.send(wsServerMsg{Type: "error", Error: err.Error()})
+		return
+	}
+	for _, jm := range jobs {
+		wc.subscribe(jm.JobID)
+	}
+	wc.send(wsServerMsg{Type: "subscribed", Data: gin.H{"all": true, "active": len(jobs)}})
+}
+
+func (wc *wsConn) unsubscribeAll() {
+	wc.mu.Lock()
+	if wc.allStop != nil {
+		wc.allStop()
+		wc.allStop = nil
+	}
+	subs := wc.subs
+	wc.subs = map[string]*wsSub{}
+	wc.mu.Unlock()
+	for _, sub := range subs {
+		sub.cancel()
+	}
+	wc.send(wsServerMsg{Type: "unsubscribed", Data: gin.H{"all": true}})
+}
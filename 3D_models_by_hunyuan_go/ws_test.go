@@ -0,0 +1,84 @@
+// ws_test.go
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowGetRepo 只实现 Get，放慢查库以放大并发窗口
+type slowGetRepo struct {
+	JobRepo
+	owner string
+}
+
+func (r *slowGetRepo) Get(ctx context.Context, jobID string) (*JobMeta, error) {
+	time.Sleep(20 * time.Millisecond)
+	return &JobMeta{JobID: jobID, Owner: r.owner, Status: "RUN"}, nil
+}
+
+// 客户端 subscribe 与 subscribe_all 的回调同时订阅同一个 job：只能登记一次
+func TestWSSubscribeConcurrentDup(t *testing.T) {
+	oldRepo := repo
+	repo = &slowGetRepo{owner: "alice"}
+	defer func() { repo = oldRepo }()
+	const jobID = "ws-dup-test"
+	w := hub.watch(jobID)
+	w.mu.Lock()
+	w.terminal = true // 不启动上游轮询
+	w.mu.Unlock()
+
+	wc := &wsConn{user: "alice", out: make(chan wsServerMsg, 64), closed: make(chan struct{}), subs: map[string]*wsSub{}}
+	defer close(wc.closed)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wc.subscribe(jobID)
+		}()
+	}
+	wg.Wait()
+
+	subscribed := 0
+	for len(wc.out) > 0 {
+		if m := <-wc.out; m.Type == "subscribed" {
+			subscribed++
+		}
+	}
+	wc.mu.Lock()
+	n := len(wc.subs)
+	wc.mu.Unlock()
+	if subscribed != 1 || n != 1 {
+		t.Fatalf("subscribed %d times, %d subs, want 1", subscribed, n)
+	}
+}
+
+// NotifyCreated 不等回调执行完
+func TestNotifyCreatedAsync(t *testing.T) {
+	h := newJobHub()
+	h.watch("j1").terminal = true
+	release := make(chan struct{})
+	done := make(chan struct{})
+	stop := h.WatchOwner("alice", func(string) {
+		<-release
+		close(done)
+	})
+	defer stop()
+
+	returned := make(chan struct{})
+	go func() {
+		h.NotifyCreated("alice", "j1")
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("NotifyCreated blocked on the owner callback")
+	}
+	close(release)
+	<-done
+}